@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"log"
+	"os"
+	"time"
+
+	"buf-lib-poc/pkg/auth"
+	"buf-lib-poc/pkg/io"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	authMember       string
+	authSequencer    string
+	authSynchronizer string
+	authAlgo         string
+	authSignedBy     string
+)
+
+func initAuthCommands(cantonCmd *cobra.Command) {
+	authCmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Authenticate members towards a sequencer",
+		Long: `Challenge-response authentication of a member towards a sequencer, in three steps that let the
+member key stay offline:
+  1. 'challenge' asks the sequencer for a nonce and the fingerprints of the keys it expects;
+  2. 'respond' signs the authentication token hash of the nonce and writes the AuthenticateRequest;
+  3. 'authenticate' sends it to the sequencer and prints the token.`,
+	}
+
+	var challengeCmd = &cobra.Command{
+		Use:   "challenge",
+		Short: "Request an authentication challenge for a member",
+		Long: `Requests a challenge for --member from the sequencer authentication service at --sequencer
+(host:port, or https://host:port for TLS) and prints the ChallengeResponse as JSON; -o binary
+writes its protobuf encoding. Without --sequencer, the ChallengeRequest itself is written, for use
+with other gRPC clients.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if authMember == "" {
+				log.Fatal("missing required flag: --member")
+			}
+			schema := loadAuthSchema()
+			req := &auth.ChallengeRequest{Member: authMember}
+			if authSequencer == "" {
+				writeOutput(io.Value{Bytes: marshalAuth(schema, req), JSON: req}, io.FormatBase64)
+				return
+			}
+
+			client := dialSequencer(schema)
+			defer client.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			resp, err := client.Challenge(ctx, req)
+			if err != nil {
+				log.Fatalf("challenge failed: %v", err)
+			}
+			writeOutput(io.Value{Bytes: marshalAuth(schema, resp), JSON: resp}, io.FormatJSON)
+		},
+	}
+	challengeCmd.Flags().StringVar(&authMember, "member", "", "Member to authenticate, e.g. PAR::participant1::1220...")
+	challengeCmd.Flags().StringVar(&authSequencer, "sequencer", "", "Sequencer address: host:port, or https://host:port for TLS")
+
+	var respondCmd = &cobra.Command{
+		Use:   "respond [challenge] [private-key-file|signer]",
+		Short: "Sign an authentication challenge",
+		Long: `Reads a ChallengeResponse (JSON as printed by 'challenge', or its protobuf encoding), signs the
+authentication token hash of its nonce for --synchronizer-id with the member key, and writes the
+AuthenticateRequest; -o json shows it. The key must be one the sequencer expects. The signer is a
+private key file or signer backend, see 'crypto sign'.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if authMember == "" || authSynchronizer == "" {
+				log.Fatal("missing required flags: --member, --synchronizer-id")
+			}
+			data, err := io.ReadData(args[0], false)
+			if err != nil {
+				log.Fatalf("failed to read challenge: %v", err)
+			}
+			schema := loadAuthSchema()
+			var challenge auth.ChallengeResponse
+			if err := schema.Decode(data, &challenge); err != nil {
+				log.Fatalf("failed to parse challenge: %v", err)
+			}
+
+			s := openSigner(args[1], false)
+			req, err := auth.Respond(&challenge, authMember, authSynchronizer, s, authAlgo, authSignedBy)
+			if err != nil {
+				log.Fatal(err)
+			}
+			writeOutput(io.Value{Bytes: marshalAuth(schema, req), JSON: req}, io.FormatBinary)
+		},
+	}
+	respondCmd.Flags().StringVar(&authMember, "member", "", "Member to authenticate")
+	respondCmd.Flags().StringVar(&authSynchronizer, "synchronizer-id", "", "Synchronizer the sequencer belongs to")
+	respondCmd.Flags().StringVarP(&authAlgo, "algo", "a", "ed25519", "Signing algorithm (ed25519, ecdsa256, ecdsa384)")
+	respondCmd.Flags().StringVar(&authSignedBy, "signed-by", "", "Fingerprint of the member key (default: that of the signer)")
+	addSignerFlags(respondCmd)
+
+	var authenticateCmd = &cobra.Command{
+		Use:   "authenticate [request]",
+		Short: "Exchange a signed challenge for a token",
+		Long: `Sends an AuthenticateRequest written by 'respond' to the sequencer at --sequencer and prints the
+token in hex, as sequencer calls send it; -o json prints the AuthenticateResponse with its expiry.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if authSequencer == "" {
+				log.Fatal("missing required flag: --sequencer")
+			}
+			data, err := io.ReadData(args[0], false)
+			if err != nil {
+				log.Fatalf("failed to read request: %v", err)
+			}
+			schema := loadAuthSchema()
+			var req auth.AuthenticateRequest
+			if err := schema.Decode(data, &req); err != nil {
+				log.Fatalf("failed to parse request: %v", err)
+			}
+
+			client := dialSequencer(schema)
+			defer client.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			resp, err := client.Authenticate(ctx, &req)
+			if err != nil {
+				log.Fatalf("authentication failed: %v", err)
+			}
+			writeOutput(io.Value{Text: hex.EncodeToString(resp.Token), JSON: resp}, io.FormatText)
+		},
+	}
+	authenticateCmd.Flags().StringVar(&authSequencer, "sequencer", "", "Sequencer address: host:port, or https://host:port for TLS")
+
+	authCmd.AddCommand(challengeCmd)
+	authCmd.AddCommand(respondCmd)
+	authCmd.AddCommand(authenticateCmd)
+	cantonCmd.AddCommand(authCmd)
+}
+
+func dialSequencer(schema *auth.Schema) *auth.Client {
+	client, err := auth.Dial(authSequencer, schema)
+	if err != nil {
+		log.Fatalf("failed to connect to %s: %v", authSequencer, err)
+	}
+	return client
+}
+
+// loadAuthSchema loads the sequencer authentication service from the image of PROTO_IMAGE.
+func loadAuthSchema() *auth.Schema {
+	schemaFile := os.Getenv("PROTO_IMAGE")
+	if schemaFile == "" {
+		log.Fatal("PROTO_IMAGE must be set to point to Canton topology image")
+	}
+	schema, err := auth.LoadSchema(context.Background(), schemaFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return schema
+}
+
+func marshalAuth(schema *auth.Schema, m auth.Message) []byte {
+	data, err := schema.Marshal(m)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return data
+}
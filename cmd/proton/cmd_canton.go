@@ -2,19 +2,24 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
 	"buf-lib-poc/pkg/canton"
 	"buf-lib-poc/pkg/io"
 	"buf-lib-poc/pkg/loader"
 	"buf-lib-poc/pkg/patch"
+	"buf-lib-poc/pkg/signer"
 
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
 
@@ -26,13 +31,14 @@ var (
 	prepFilePath  string
 	signaturePath string
 	signatureAlgo string
+	signatureFmt  string
 	signedBy      string
-	finalOutput   string
 	revokeFlag    bool
 	serialFlag    int64
 	restrictions  string
 	inputPath     string
 	pubKeyPaths   []string
+	partySpec     string
 )
 
 func initCantonCommands(cantonCmd *cobra.Command) {
@@ -46,7 +52,7 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 		Short: "Prepare a namespace delegation transaction",
 		Run: func(cmd *cobra.Command, args []string) {
 			if rootKeyPath == "" || (targetKeyPath == "" && !isRoot) || outputPrefix == "" {
-				log.Fatal("missing required flags: --root-key, --target-key (unless --root), --output")
+				log.Fatal("missing required flags: --root-key, --target-key (unless --root), --out-prefix")
 			}
 
 			// 1. Resolve Root Key & Fingerprint
@@ -55,7 +61,7 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 				log.Fatalf("failed to read root key: %v", err)
 			}
 			fingerprint := canton.Fingerprint(rootData)
-			fmt.Printf("Root namespace fingerprint: %s\n", fingerprint)
+			fmt.Fprintf(os.Stderr, "Root namespace fingerprint: %s\n", fingerprint)
 
 			// 2. Resolve Target Key Info
 			tPath := targetKeyPath
@@ -70,6 +76,9 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 			if err != nil {
 				log.Fatalf("failed to inspect target key: %v", err)
 			}
+			if info.Detected != canton.KeyFormatDERSPKI {
+				fmt.Fprintf(os.Stderr, "Target key converted from %s to DER SubjectPublicKeyInfo\n", info.Detected)
+			}
 
 			// 3. Build Transaction JSON using Patching Logic
 			tx := make(map[string]interface{})
@@ -82,76 +91,76 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 			patch.Set(tx, "operation", op)
 			patch.Set(tx, "serial", serialFlag)
 
-			// Shared Delegation Fields
-			prefix := "mapping.namespaceDelegation"
-			patch.Set(tx, prefix+".namespace", fingerprint)
-			patch.Set(tx, prefix+".targetKey.format", info.Format)
-			patch.Set(tx, prefix+".targetKey.publicKey", targetData)
-			patch.Set(tx, prefix+".targetKey.usage", []string{"SIGNING_KEY_USAGE_NAMESPACE"})
-			patch.Set(tx, prefix+".targetKey.keySpec", info.KeySpec)
-
-			// Restrictions
-			switch restrictions {
-			case "all":
-				patch.Set(tx, prefix+".canSignAllMappings", map[string]interface{}{})
-			case "all-but-delegation":
-				patch.Set(tx, prefix+".canSignAllButNamespaceDelegations", map[string]interface{}{})
-			default:
-				// Comma-separated list of mapping codes
-				codes := strings.Split(restrictions, ",")
-				patch.Set(tx, prefix+".canSignSpecificMapings.mappings", codes)
-			}
+			patch.Set(tx, "mapping.namespaceDelegation", delegationMapping(fingerprint, info, restrictions))
 
 			jsonData, _ := json.Marshal(tx)
 
-			// 4. Generate Binary Prep File
-			schemaFile := os.Getenv("PROTO_IMAGE")
-			if schemaFile == "" {
-				log.Fatal("PROTO_IMAGE must be set to point to Canton topology image")
-			}
-
-			version := int32(30)
-			binaryData, err := e.Generate(context.Background(), schemaFile, "com.digitalasset.canton.protocol.v30.TopologyTransaction", jsonData, &version)
-			if err != nil {
-				log.Fatalf("failed to generate binary transaction: %v", err)
-			}
-
-			prepPath := outputPrefix + ".prep"
-			if err := os.WriteFile(prepPath, binaryData, 0644); err != nil {
-				log.Fatalf("failed to write .prep file: %v", err)
-			}
-			fmt.Printf("Namespace delegation Transaction written to %s\n", prepPath)
-
-			// 5. Compute and Write Hash
-			hash := canton.ComputeHash(binaryData, 11)
-			hashPath := outputPrefix + ".hash"
-			if err := os.WriteFile(hashPath, hash, 0644); err != nil {
-				log.Fatalf("failed to write .hash file: %v", err)
-			}
-			fmt.Printf("Namespace delegation Transaction Hash written to %s\n", hashPath)
+			// 4. Generate Binary Prep File and Hash
+			reportPrepared(outputPrefix, "Namespace delegation", prepareTransaction(jsonData, outputPrefix))
 		},
 	}
 
 	delegationCmd.Flags().BoolVar(&isRoot, "root", false, "Is this a self-signed root delegation")
 	delegationCmd.Flags().StringVar(&rootKeyPath, "root-key", "", "Path to root public key")
 	delegationCmd.Flags().StringVar(&targetKeyPath, "target-key", "", "Path to target public key")
-	delegationCmd.Flags().StringVar(&outputPrefix, "output", "", "Output prefix")
+	delegationCmd.Flags().StringVar(&outputPrefix, "out-prefix", "", "Write <prefix>.prep and <prefix>.hash")
+	deprecatedOutputFlag(delegationCmd, &outputPrefix, "out-prefix")
 	delegationCmd.Flags().BoolVar(&revokeFlag, "revoke", false, "Revoke the transaction (operation = REMOVE)")
 	delegationCmd.Flags().Int64Var(&serialFlag, "serial", 1, "Transaction serial number")
 	delegationCmd.Flags().StringVar(&restrictions, "restrictions", "all", "Signing restrictions (all, all-but-delegation, or comma-separated mapping codes)")
 
+	var transactionCmd = &cobra.Command{
+		Use:   "transaction [file]",
+		Short: "Prepare a topology transaction written in JSON or YAML",
+		Long: `Prepare a TopologyTransaction from its JSON or YAML form, as produced by
+"proton proto template -f yaml com.digitalasset.canton.protocol.v30.TopologyTransaction".
+Writes the versioned transaction to <prefix>.prep and its hash to <prefix>.hash.`,
+		Args: cobra.RangeArgs(0, 1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if outputPrefix == "" {
+				log.Fatal("missing required flag: --out-prefix")
+			}
+			input := "-"
+			if len(args) > 0 {
+				input = args[0]
+			}
+
+			data, err := io.ReadData(input, false)
+			if err != nil {
+				log.Fatalf("failed to read transaction: %v", err)
+			}
+			jsonData, err := io.ToJSON(data)
+			if err != nil {
+				log.Fatalf("failed to parse transaction: %v", err)
+			}
+			if partySpec != "" {
+				if jsonData, err = setParty(jsonData, resolveParty(partySpec)); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			reportPrepared(outputPrefix, "Topology", prepareTransaction(jsonData, outputPrefix))
+		},
+	}
+	transactionCmd.Flags().StringVar(&outputPrefix, "out-prefix", "", "Write <prefix>.prep and <prefix>.hash")
+	deprecatedOutputFlag(transactionCmd, &outputPrefix, "out-prefix")
+	transactionCmd.Flags().StringVar(&partySpec, "party", "", "Set the party of the mapping: a party ID, or hint@<key> such as alice@@alice.pub for the party in the namespace of the key")
+
 	var prepareCmd = &cobra.Command{
 		Use:   "prepare",
 		Short: "Preparation commands for topology transactions",
 	}
 	prepareCmd.AddCommand(delegationCmd)
+	prepareCmd.AddCommand(transactionCmd)
+	initVettingCommands(prepareCmd)
+	initParamsCommands(prepareCmd)
 
 	var assembleCmd = &cobra.Command{
 		Use:   "assemble",
 		Short: "Assemble a signed topology transaction",
 		Run: func(cmd *cobra.Command, args []string) {
-			if prepFilePath == "" || signaturePath == "" || signatureAlgo == "" || signedBy == "" || finalOutput == "" {
-				log.Fatal("missing required flags: --prepared-transaction, --signature, --signature-algorithm, --signed-by, --output")
+			if prepFilePath == "" || (signaturePath == "") == (signerSpec == "") || signatureAlgo == "" {
+				log.Fatal("missing required flags: --prepared-transaction, --signature or --signer, --signature-algorithm")
 			}
 
 			schemaFile := os.Getenv("PROTO_IMAGE")
@@ -165,17 +174,45 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 				log.Fatalf("failed to read prepared transaction: %v", err)
 			}
 
-			// 2. Load Signature
-			sigData, err := io.ReadData(signaturePath, false)
-			if err != nil {
-				log.Fatalf("failed to read signature: %v", err)
+			// 2. Load Signature, or sign the transaction hash
+			var sigData []byte
+			if signerSpec != "" {
+				s := openSigner(signerSpec, false)
+				sigData, err = signer.Sign(s, canton.ComputeHash(prepData, canton.HashPurposeTopologyTransaction), signatureAlgo)
+				if err != nil {
+					log.Fatalf("signing failed: %v", err)
+				}
+				if signedBy == "" {
+					pub, err := s.PublicKey()
+					if err != nil {
+						log.Fatalf("--signed-by is required: %v", err)
+					}
+					signedBy = canton.Fingerprint(pub.DER)
+				}
+			} else {
+				sigData, err = io.ReadData(signaturePath, false)
+				if err != nil {
+					log.Fatalf("failed to read signature: %v", err)
+				}
+			}
+			if signedBy == "" {
+				log.Fatal("missing required flag: --signed-by")
 			}
 
-			// 3. Get Signature Metadata
+			// 3. Get Signature Metadata, and bring the signature into the declared format
 			sigMeta, err := canton.GetSignatureMetadata(signatureAlgo)
 			if err != nil {
 				log.Fatalf("invalid signature algorithm: %v", err)
 			}
+			if signatureFmt != "" {
+				if sigMeta.Format, err = canton.ParseSignatureFormat(signatureFmt); err != nil {
+					log.Fatal(err)
+				}
+			}
+			sigData, err = canton.NormalizeSignature(sigData, sigMeta.Algorithm, sigMeta.Format)
+			if err != nil {
+				log.Fatalf("invalid signature: %v", err)
+			}
 
 			// 4. Build Signed Transaction JSON
 			signedTx := map[string]interface{}{
@@ -200,17 +237,20 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 				log.Fatalf("failed to generate signed transaction: %v", err)
 			}
 
-			if err := os.WriteFile(finalOutput, binaryData, 0644); err != nil {
-				log.Fatalf("failed to write certificate: %v", err)
+			writeOutput(io.Value{Bytes: binaryData}, io.FormatBinary)
+			if output.ToFile() {
+				fmt.Printf("Certificate written to %s\n", output.Path)
 			}
-			fmt.Printf("Certificate written to %s\n", finalOutput)
 		},
 	}
 	assembleCmd.Flags().StringVar(&prepFilePath, "prepared-transaction", "", "Path to prepared transaction (.prep)")
 	assembleCmd.Flags().StringVar(&signaturePath, "signature", "", "Path to signature file")
 	assembleCmd.Flags().StringVar(&signatureAlgo, "signature-algorithm", "", "Signature algorithm (ed25519, ecdsa256, ecdsa384)")
-	assembleCmd.Flags().StringVar(&signedBy, "signed-by", "", "Fingerprint of the signer")
-	assembleCmd.Flags().StringVar(&finalOutput, "output", "", "Output path")
+	assembleCmd.Flags().StringVar(&signatureFmt, "signature-format", "", "Declared signature format: der or concat (default: der for ECDSA, concat for Ed25519); DER and r||s signatures are converted")
+	assembleCmd.Flags().StringVar(&signedBy, "signed-by", "", "Fingerprint of the signer (default: that of the --signer key)")
+	assembleCmd.Flags().StringVar(&signerSpec, "signer", "", "Sign the transaction with this private key file or signer backend instead of --signature (see 'crypto sign')")
+	deprecatedOutputFlag(assembleCmd, &output.Path, "out-file")
+	addSignerFlags(assembleCmd)
 
 	var verifyCmd = &cobra.Command{
 		Use:   "verify",
@@ -226,6 +266,7 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 			}
 
 			// 1. Load Public Keys and compute fingerprints
+			var text strings.Builder
 			keys := make(map[string][]byte)
 			for _, p := range pubKeyPaths {
 				data, err := io.ReadData(p, false)
@@ -234,7 +275,7 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 				}
 				fp := canton.Fingerprint(data)
 				keys[fp] = data
-				fmt.Printf("Loaded key for fingerprint: %s\n", fp)
+				fmt.Fprintf(&text, "Loaded key for fingerprint: %s\n", fp)
 			}
 
 			inputData, err := io.ReadData(inputPath, false)
@@ -285,15 +326,15 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 				log.Fatal("transaction field is empty")
 			}
 
-			// Canton Hash Purpose 11 = Topology Transaction
-			txHash := canton.ComputeHash(rawTx, 11)
-			fmt.Printf("Computed transaction hash: %x\n", txHash)
+			txHash := canton.ComputeHash(rawTx, canton.HashPurposeTopologyTransaction)
+			fmt.Fprintf(&text, "Computed transaction hash: %x\n", txHash)
 
 			// 6. Verify Signatures
 			sigField := foundMsg.Fields().ByName("signatures")
 			sigsList := signedTx.Get(sigField).List()
 
 			allValid := true
+			var results []map[string]interface{}
 			for i := 0; i < sigsList.Len(); i++ {
 				sigVal := sigsList.Get(i).Message()
 				sigDesc := sigVal.Descriptor()
@@ -305,33 +346,65 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 					fp = sigVal.Get(sigDesc.Fields().ByName("signedBy")).String()
 				}
 
-				algoEnumVal := sigVal.Get(sigDesc.Fields().ByName("signing_algorithm_spec")).Enum()
-				// if default 0, might look empty? UNSPECIFIED = 0.
-
-				algoName := string(sigDesc.Fields().ByName("signing_algorithm_spec").Enum().Values().ByNumber(algoEnumVal).Name())
-
+				algoName, algoKnown := enumName(sigVal, sigDesc.Fields().ByName("signing_algorithm_spec"))
 				sigData := sigVal.Get(sigDesc.Fields().ByName("signature")).Bytes()
-
-				fmt.Printf("Checking signature %d by %s (%s)...\n", i, fp, algoName)
+				formatName, formatKnown := enumName(sigVal, sigDesc.Fields().ByName("format"))
+
+				fmt.Fprintf(&text, "Checking signature %d by %s (%s)...\n", i, fp, algoName)
+				result := map[string]interface{}{"signedBy": fp, "algorithm": algoName}
+				results = append(results, result)
+				var unknown error
+				if !algoKnown {
+					unknown = fmt.Errorf("unknown signing algorithm %s", algoName)
+				} else if !formatKnown {
+					unknown = fmt.Errorf("unknown signature format %s", formatName)
+				}
+				if unknown != nil {
+					fmt.Fprintf(&text, "  ERROR: %v\n", unknown)
+					result["result"], result["error"] = "error", unknown.Error()
+					allValid = false
+					continue
+				}
 				pubKey, ok := keys[fp]
 				if !ok {
-					fmt.Printf("  WARNING: Public key for fingerprint %s not provided\n", fp)
+					fmt.Fprintf(&text, "  WARNING: Public key for fingerprint %s not provided\n", fp)
+					result["result"] = "unknown-key"
 					allValid = false
 					continue
 				}
 
+				if formatName != "SIGNATURE_FORMAT_UNSPECIFIED" {
+					if err := canton.CheckSignatureFormat(sigData, algoName, formatName); err != nil {
+						fmt.Fprintf(&text, "  ERROR: %v (see 'crypto convert-signature')\n", err)
+						result["result"], result["error"] = "error", err.Error()
+						allValid = false
+						continue
+					}
+				}
+
 				valid, err := canton.VerifySignature(txHash, sigData, pubKey, algoName)
 				if err != nil {
-					fmt.Printf("  ERROR: %v\n", err)
+					fmt.Fprintf(&text, "  ERROR: %v\n", err)
+					result["result"], result["error"] = "error", err.Error()
 					allValid = false
 				} else if valid {
-					fmt.Printf("  SUCCESS: Signature is valid\n")
+					fmt.Fprintf(&text, "  SUCCESS: Signature is valid\n")
+					result["result"] = "valid"
 				} else {
-					fmt.Printf("  FAILURE: Signature is INVALID\n")
+					fmt.Fprintf(&text, "  FAILURE: Signature is INVALID\n")
+					result["result"] = "invalid"
 					allValid = false
 				}
 			}
 
+			writeOutput(io.Value{
+				Text: strings.TrimSuffix(text.String(), "\n"),
+				JSON: map[string]interface{}{
+					"hash":       hex.EncodeToString(txHash),
+					"signatures": results,
+					"valid":      allValid,
+				},
+			}, io.FormatText)
 			if !allValid {
 				os.Exit(1)
 			}
@@ -346,3 +419,128 @@ func initCantonCommands(cantonCmd *cobra.Command) {
 
 	cantonCmd.AddCommand(topologyCmd)
 }
+
+// delegationMapping returns the JSON form of a NamespaceDelegation of namespace to a target key,
+// with the signing restrictions all, all-but-delegation or a comma-separated list of mapping codes.
+// enumName returns the name of the value of the enum field fd in msg, or its number when the
+// value is not declared in the schema.
+func enumName(msg protoreflect.Message, fd protoreflect.FieldDescriptor) (string, bool) {
+	n := msg.Get(fd).Enum()
+	if v := fd.Enum().Values().ByNumber(n); v != nil {
+		return string(v.Name()), true
+	}
+	return strconv.Itoa(int(n)), false
+}
+
+func delegationMapping(namespace string, target *canton.PublicKeyInfo, restrictions string) map[string]interface{} {
+	delegation := map[string]interface{}{
+		"namespace": namespace,
+		"targetKey": map[string]interface{}{
+			"format":    target.Format,
+			"publicKey": target.PublicKey,
+			"usage":     []string{"SIGNING_KEY_USAGE_NAMESPACE"},
+			"keySpec":   target.KeySpec,
+		},
+	}
+	switch restrictions {
+	case "all":
+		delegation["canSignAllMappings"] = map[string]interface{}{}
+	case "all-but-delegation":
+		delegation["canSignAllButNamespaceDelegations"] = map[string]interface{}{}
+	default:
+		delegation["canSignSpecificMapings"] = map[string]interface{}{"mappings": strings.Split(restrictions, ",")}
+	}
+	return delegation
+}
+
+// partyMappings are the topology mappings with a party field.
+var partyMappings = []string{"partyToParticipant", "partyToKeyMapping", "partyHostingLimits"}
+
+// setParty sets the party of the mapping of a TopologyTransaction in JSON form.
+func setParty(jsonData []byte, party string) ([]byte, error) {
+	var tx map[string]interface{}
+	if err := json.Unmarshal(jsonData, &tx); err != nil {
+		return nil, fmt.Errorf("failed to parse transaction: %v", err)
+	}
+	mapping, _ := tx["mapping"].(map[string]interface{})
+	for _, kind := range partyMappings {
+		if _, ok := mapping[kind]; ok {
+			patch.Set(tx, "mapping."+kind+".party", party)
+			return json.Marshal(tx)
+		}
+	}
+	return nil, fmt.Errorf("--party needs a mapping with a party: %s", strings.Join(partyMappings, ", "))
+}
+
+// prepareTransaction serializes the JSON form of a TopologyTransaction as a version 30 message and
+// writes it to <prefix>.prep, and its topology transaction hash to <prefix>.hash. It returns the
+// serialized transaction.
+func prepareTransaction(jsonData []byte, prefix string) []byte {
+	schemaFile := os.Getenv("PROTO_IMAGE")
+	if schemaFile == "" {
+		log.Fatal("PROTO_IMAGE must be set to point to Canton topology image")
+	}
+
+	version := int32(30)
+	binaryData, err := e.Generate(context.Background(), schemaFile, "com.digitalasset.canton.protocol.v30.TopologyTransaction", jsonData, &version)
+	if err != nil {
+		log.Fatalf("failed to generate binary transaction: %v", err)
+	}
+
+	if err := os.WriteFile(prefix+".prep", binaryData, 0644); err != nil {
+		log.Fatalf("failed to write .prep file: %v", err)
+	}
+	hash := canton.ComputeHash(binaryData, canton.HashPurposeTopologyTransaction)
+	if err := os.WriteFile(prefix+".hash", hash, 0644); err != nil {
+		log.Fatalf("failed to write .hash file: %v", err)
+	}
+	return binaryData
+}
+
+// preparedText tells where prepareTransaction wrote a transaction.
+func preparedText(prefix, label string) string {
+	return fmt.Sprintf("%s Transaction written to %s.prep\n%s Transaction Hash written to %s.hash", label, prefix, label, prefix)
+}
+
+// reportPrepared writes the result of prepareTransaction through --output and --out-file: the
+// files written as text, the transaction hash in the byte formats, or both as JSON.
+func reportPrepared(prefix, label string, data []byte) {
+	hash := canton.ComputeHash(data, canton.HashPurposeTopologyTransaction)
+	writeOutput(io.Value{
+		Text:  preparedText(prefix, label),
+		Bytes: hash,
+		JSON: map[string]interface{}{
+			"transaction": prefix + ".prep",
+			"hashFile":    prefix + ".hash",
+			"hash":        hex.EncodeToString(hash),
+		},
+	}, io.FormatText)
+}
+
+// decodeTopologyTransaction returns the JSON form of a TopologyTransaction given as a prepared
+// transaction (.prep) or as a SignedTopologyTransaction, such as a certificate exported from a node.
+func decodeTopologyTransaction(data []byte) (map[string]interface{}, error) {
+	schemaFile := os.Getenv("PROTO_IMAGE")
+	if schemaFile == "" {
+		return nil, fmt.Errorf("PROTO_IMAGE must be set to point to Canton topology image")
+	}
+	ctx := context.Background()
+	if signedTx, _, err := e.Message(ctx, schemaFile, "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction", data, true); err == nil {
+		if tx := signedTx.Get(signedTx.Descriptor().Fields().ByName("transaction")).Bytes(); len(tx) > 0 && len(signedTx.GetUnknown()) == 0 {
+			data = tx
+		}
+	}
+	tx, types, err := e.Message(ctx, schemaFile, "com.digitalasset.canton.protocol.v30.TopologyTransaction", data, true)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := protojson.MarshalOptions{Resolver: types}.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(jsonData, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -1,19 +1,41 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"buf-lib-poc/pkg/canton"
 	"buf-lib-poc/pkg/io"
+	"buf-lib-poc/pkg/signer"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var (
 	isBase64Crypto bool
 	signAlgo       string
+	passphraseFile string
+	keygenSpec     string
+	keygenUsage    string
+	keygenPrefix   string
+	keygenPEM      bool
+	keygenProto    bool
+	signerSpec     string
+	signerPubKey   string
+	convertAlgo    string
+	convertTo      string
+	convertLowS    bool
+	hashPurpose    string
+	hashDigest     bool
+	hashCheck      string
 )
 
 func initCryptoCommands(cryptoCmd *cobra.Command) {
@@ -28,44 +50,313 @@ func initCryptoCommands(cryptoCmd *cobra.Command) {
 				log.Fatalf("failed to read public key: %v", err)
 			}
 
-			fmt.Println(canton.Fingerprint(data))
+			fp := canton.Fingerprint(data)
+			fpBytes, _ := hex.DecodeString(fp)
+			v := io.Value{Text: fp, Bytes: fpBytes, JSON: map[string]interface{}{"fingerprint": fp}}
+			if info, err := canton.InspectPublicKey(data); err == nil {
+				v.JSON = map[string]interface{}{"fingerprint": fp, "keySpec": info.KeySpec, "detectedFormat": info.Detected}
+			}
+			writeOutput(v, io.FormatText)
 		},
 	}
 	fingerprintCmd.Flags().BoolVarP(&isBase64Crypto, "base64", "b", false, "Is input base64 encoded")
 
 	var signCmd = &cobra.Command{
-		Use:   "sign [private-key-file] [data-file]",
-		Short: "Sign data using a private key",
-		Args:  cobra.ExactArgs(2),
+		Use:   "sign [private-key-file|signer] [data-file]",
+		Short: "Sign data using a private key or a signer backend",
+		Long: `Signs data with a private key file (any format of 'crypto public-key', e.g. @key.pem) or a signer
+backend that keeps the key elsewhere:
+  exec:COMMAND   run COMMAND with the data on stdin; it prints the signature (hex, base64 or raw)
+  pkcs11:URI     sign on a PKCS#11 token with pkcs11-tool, e.g.
+                 'pkcs11:token=canton;object=ns-key?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=pin.txt'
+  https://URL    call a signing service (POST {"algorithm","message"} -> {"signature"})
+Signatures are checked against the public key of the signer when it is known.`,
+		Args: cobra.ExactArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
-			privKeyPath := args[0]
-			dataPath := args[1]
-
-			privKey, err := io.ReadData(privKeyPath, isBase64Crypto)
-			if err != nil {
-				log.Fatalf("failed to read private key: %v", err)
-			}
+			s := openSigner(args[0], isBase64Crypto)
 
-			data, err := io.ReadData(dataPath, isBase64Crypto)
+			data, err := io.ReadData(args[1], isBase64Crypto)
 			if err != nil {
 				log.Fatalf("failed to read data: %v", err)
 			}
 
-			sig, err := canton.Sign(data, privKey, signAlgo)
+			sig, err := signer.Sign(s, data, signAlgo)
 			if err != nil {
 				log.Fatalf("signing failed: %v", err)
 			}
 
-			fmt.Print(io.EncodeData(sig, true))
+			writeOutput(io.Value{Bytes: sig}, io.FormatBase64)
 		},
 	}
 	signCmd.Flags().BoolVarP(&isBase64Crypto, "base64", "b", false, "Is input base64 encoded")
 	signCmd.Flags().StringVarP(&signAlgo, "algo", "a", "ed25519", "Signing algorithm (ed25519, ecdsa256, ecdsa384)")
+	addSignerFlags(signCmd)
+
+	var publicKeyCmd = &cobra.Command{
+		Use:   "public-key [key-file]",
+		Short: "Detect the format of a key and normalize it to DER SubjectPublicKeyInfo",
+		Long: `Reads a public key as DER or PEM SubjectPublicKeyInfo, a PEM certificate, an OpenSSH public
+key, a raw 32-byte Ed25519 key or an uncompressed or compressed P-256/P-384 point, or a private key
+(PEM, DER, encrypted PKCS#8 or OpenSSH) to take its public half from. Prints the detected format,
+key spec and fingerprint; --output binary, hex or base64 writes the normalized DER key instead.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := io.ReadData(args[0], isBase64Crypto)
+			if err != nil {
+				log.Fatalf("failed to read key: %v", err)
+			}
+			key, err := canton.ParsePublicKey(data)
+			if errors.Is(err, canton.ErrPassphraseRequired) {
+				var priv *canton.PrivateKey
+				if priv, err = canton.ParsePrivateKey(data, passphraseFor(passphraseFile)); err == nil {
+					key, err = priv.Public()
+				}
+			}
+			if err != nil {
+				log.Fatalf("failed to parse key: %v", err)
+			}
+			info, err := canton.InspectPublicKey(key.DER)
+			if err != nil {
+				log.Fatalf("failed to inspect key: %v", err)
+			}
+			fp := canton.Fingerprint(key.DER)
+
+			writeOutput(io.Value{
+				Bytes: key.DER,
+				JSON: map[string]interface{}{
+					"detectedFormat": key.Format,
+					"format":         info.Format,
+					"keySpec":        info.KeySpec,
+					"fingerprint":    fp,
+					"publicKey":      key.DER,
+				},
+				Text: fmt.Sprintf("Detected format: %s\nKey spec:        %s\nFingerprint:     %s", key.Format, info.KeySpec, fp),
+			}, io.FormatText)
+		},
+	}
+	publicKeyCmd.Flags().BoolVarP(&isBase64Crypto, "base64", "b", false, "Is input base64 encoded")
+	publicKeyCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase of an encrypted private key (prompted for if not given)")
+
+	var keygenCmd = &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a Canton signing key pair",
+		Long: `Generates a key pair and writes <prefix>.priv (PKCS#8, DER or --pem) and <prefix>.pub (DER
+SubjectPublicKeyInfo), and prints the Canton fingerprint. --proto also writes
+<prefix>.public-key.binpb and <prefix>.key-pair.binpb, the serialized
+com.digitalasset.canton.crypto.v30.SigningPublicKey and SigningKeyPair with the given --usage.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if keygenPrefix == "" {
+				log.Fatal("missing required flag: --out-prefix")
+			}
+			usage, err := canton.ParseKeyUsage(keygenUsage)
+			if err != nil {
+				log.Fatalf("invalid --usage: %v", err)
+			}
+			priv, err := canton.GenerateKey(keygenSpec)
+			if err != nil {
+				log.Fatalf("failed to generate key: %v", err)
+			}
+			pub, err := priv.Public()
+			if err != nil {
+				log.Fatalf("failed to derive public key: %v", err)
+			}
+
+			privData, err := priv.PKCS8()
+			if keygenPEM {
+				privData, err = priv.PEM()
+			}
+			if err != nil {
+				log.Fatalf("failed to encode private key: %v", err)
+			}
+			files := map[string]interface{}{}
+			writeKeyFile := func(kind, path string, data []byte, perm os.FileMode) {
+				if err := os.WriteFile(path, data, perm); err != nil {
+					log.Fatalf("failed to write %s: %v", path, err)
+				}
+				files[kind] = path
+				fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+			}
+			writeKeyFile("privateKey", keygenPrefix+".priv", privData, 0600)
+			writeKeyFile("publicKey", keygenPrefix+".pub", pub.DER, 0644)
+
+			if keygenProto {
+				schemaFile := os.Getenv("PROTO_IMAGE")
+				if schemaFile == "" {
+					log.Fatal("PROTO_IMAGE must be set to point to Canton crypto image")
+				}
+				pubJSON, err := canton.SigningPublicKeyJSON(pub, usage)
+				if err != nil {
+					log.Fatalf("failed to build SigningPublicKey: %v", err)
+				}
+				pairJSON, err := canton.SigningKeyPairJSON(priv, usage)
+				if err != nil {
+					log.Fatalf("failed to build SigningKeyPair: %v", err)
+				}
+				for _, m := range []struct {
+					kind, msgName, path string
+					value               map[string]interface{}
+				}{
+					{"signingPublicKey", "com.digitalasset.canton.crypto.v30.SigningPublicKey", keygenPrefix + ".public-key.binpb", pubJSON},
+					{"signingKeyPair", "com.digitalasset.canton.crypto.v30.SigningKeyPair", keygenPrefix + ".key-pair.binpb", pairJSON},
+				} {
+					jsonData, _ := json.Marshal(m.value)
+					data, err := e.Generate(context.Background(), schemaFile, m.msgName, jsonData, nil)
+					if err != nil {
+						log.Fatalf("failed to generate %s: %v", m.msgName, err)
+					}
+					perm := os.FileMode(0644)
+					if m.kind == "signingKeyPair" {
+						perm = 0600
+					}
+					writeKeyFile(m.kind, m.path, data, perm)
+				}
+			}
+
+			info, err := canton.InspectPublicKey(pub.DER)
+			if err != nil {
+				log.Fatalf("failed to inspect public key: %v", err)
+			}
+			fp := canton.Fingerprint(pub.DER)
+			fpBytes, _ := hex.DecodeString(fp)
+			writeOutput(io.Value{
+				Text:  fp,
+				Bytes: fpBytes,
+				JSON: map[string]interface{}{
+					"fingerprint": fp,
+					"keySpec":     info.KeySpec,
+					"usage":       usage,
+					"publicKey":   pub.DER,
+					"files":       files,
+				},
+			}, io.FormatText)
+		},
+	}
+	keygenCmd.Flags().StringVar(&keygenSpec, "spec", "ed25519", "Key spec: ed25519, ec-p256 or ec-p384")
+	keygenCmd.Flags().StringVar(&keygenUsage, "usage", "namespace", "Comma-separated key usages for --proto: namespace, identity-delegation, sequencer-authentication, protocol, proof-of-ownership")
+	keygenCmd.Flags().StringVar(&keygenPrefix, "out-prefix", "", "Write <prefix>.priv and <prefix>.pub")
+	keygenCmd.Flags().BoolVar(&keygenPEM, "pem", false, "Write the private key as PEM rather than DER")
+	keygenCmd.Flags().BoolVar(&keygenProto, "proto", false, "Also write the SigningPublicKey and SigningKeyPair protos (requires PROTO_IMAGE)")
 
 	cryptoCmd.AddCommand(fingerprintCmd)
 	cryptoCmd.AddCommand(signCmd)
+	cryptoCmd.AddCommand(publicKeyCmd)
+	cryptoCmd.AddCommand(keygenCmd)
+
+	var convertSignatureCmd = &cobra.Command{
+		Use:   "convert-signature [signature]",
+		Short: "Convert an ECDSA signature between DER and r||s (concat) form",
+		Long: `Converts an ECDSA signature between ASN.1 DER, which Canton declares as SIGNATURE_FORMAT_DER, and the
+fixed-size r||s form returned by many HSMs, SIGNATURE_FORMAT_CONCAT. The input form is detected;
+non-canonical DER and out-of-range values are rejected. -o json also reports the input form and
+whether s is high.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			sig, err := io.ReadData(args[0], isBase64Crypto)
+			if err != nil {
+				log.Fatalf("failed to read signature: %v", err)
+			}
+			meta, err := canton.GetSignatureMetadata(convertAlgo)
+			if err != nil {
+				log.Fatalf("invalid signature algorithm: %v", err)
+			}
+			to, err := canton.ParseSignatureFormat(convertTo)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			curve, err := canton.SignatureCurve(meta.Algorithm)
+			if err != nil || curve == nil {
+				log.Fatalf("only ECDSA signatures can be converted, not %s", convertAlgo)
+			}
+			r, sv, from, err := canton.ParseECDSASignature(sig, curve)
+			if err != nil {
+				log.Fatalf("invalid signature: %v", err)
+			}
+			highS := canton.IsHighS(sv, curve)
+			if convertLowS {
+				sv = canton.LowS(sv, curve)
+			}
+			out, err := canton.EncodeECDSASignature(r, sv, curve, to)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			writeOutput(io.Value{Bytes: out, JSON: map[string]interface{}{
+				"from":                 from,
+				"to":                   to,
+				"signature":            out,
+				"signingAlgorithmSpec": meta.Algorithm,
+				"highS":                highS,
+			}}, io.FormatBase64)
+		},
+	}
+	convertSignatureCmd.Flags().BoolVarP(&isBase64Crypto, "base64", "b", false, "Is input base64 encoded")
+	convertSignatureCmd.Flags().StringVarP(&convertAlgo, "algo", "a", "ecdsa256", "Signing algorithm (ecdsa256, ecdsa384)")
+	convertSignatureCmd.Flags().StringVar(&convertTo, "to", "der", "Target format: der or concat")
+	convertSignatureCmd.Flags().BoolVar(&convertLowS, "low-s", false, "Replace a high s by n - s")
+
+	cryptoCmd.AddCommand(convertSignatureCmd)
+
+	var hashCmd = &cobra.Command{
+		Use:   "hash [data]",
+		Short: "Compute a Canton hash of data for a hash purpose",
+		Long: `Computes SHA-256 over the 4-byte hash purpose followed by the data, as Canton does, and prints the
+resulting multihash (12 20 followed by the digest) as hex; -o base64 or binary change the encoding
+and --digest drops the multihash header. --check compares the result with a hash given as hex or
+bytes (e.g. @tx.hash) after validating its multihash header.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if hashPurpose == "" {
+				log.Fatal("missing required flag: --purpose")
+			}
+			purpose, err := canton.ParseHashPurpose(hashPurpose)
+			if err != nil {
+				log.Fatal(err)
+			}
+			data, err := io.ReadData(args[0], isBase64Crypto)
+			if err != nil {
+				log.Fatalf("failed to read data: %v", err)
+			}
+
+			hash := canton.ComputeHash(data, purpose)
+			if hashCheck != "" {
+				expected, err := io.ReadData(hashCheck, false)
+				if err != nil {
+					log.Fatalf("failed to read --check hash: %v", err)
+				}
+				digest, err := canton.ParseMultihash(expected)
+				if err != nil {
+					log.Fatalf("invalid --check hash: %v", err)
+				}
+				if !bytes.Equal(digest, hash[2:]) {
+					log.Fatalf("hash mismatch: computed %x for purpose %s, expected 1220%x", hash, purpose, digest)
+				}
+			}
+
+			out := hash
+			if hashDigest {
+				out = hash[2:]
+			}
+			writeOutput(io.Value{Bytes: out, JSON: map[string]interface{}{
+				"purpose":     uint32(purpose),
+				"purposeName": purpose.String(),
+				"hash":        hex.EncodeToString(hash),
+				"digest":      hex.EncodeToString(hash[2:]),
+			}}, io.FormatHex)
+		},
+	}
+	var purposeNames []string
+	for _, p := range canton.HashPurposes() {
+		purposeNames = append(purposeNames, fmt.Sprintf("%s (%d)", p, uint32(p)))
+	}
+	hashCmd.Flags().StringVarP(&hashPurpose, "purpose", "p", "", "Hash purpose: a number or "+strings.Join(purposeNames, ", "))
+	hashCmd.Flags().BoolVar(&hashDigest, "digest", false, "Output the 32-byte SHA-256 digest without the multihash header")
+	hashCmd.Flags().StringVar(&hashCheck, "check", "", "Fail unless the hash equals this one (hex or @file)")
+	hashCmd.Flags().BoolVarP(&isBase64Crypto, "base64", "b", false, "Is input base64 encoded")
+
+	cryptoCmd.AddCommand(hashCmd)
 
-	var outputFormat string
 	var hashNonceCmd = &cobra.Command{
 		Use:   "hash-nonce [synchronizer-id] [nonce]",
 		Short: "Compute Canton authentication token hash",
@@ -80,15 +371,63 @@ func initCryptoCommands(cryptoCmd *cobra.Command) {
 			}
 
 			hash := canton.ComputeAuthenticationTokenHash(nonce, synchronizerId)
-			if outputFormat == "base64" {
-				fmt.Print(io.EncodeData(hash, true))
-			} else {
-				fmt.Println(hex.EncodeToString(hash))
-			}
+			writeOutput(io.Value{Bytes: hash}, io.FormatHex)
 		},
 	}
 	hashNonceCmd.Flags().BoolVarP(&isBase64Crypto, "base64", "b", false, "Is nonce base64 encoded")
-	hashNonceCmd.Flags().StringVarP(&outputFormat, "output", "o", "hex", "Output format (hex, base64)")
 
 	cryptoCmd.AddCommand(hashNonceCmd)
 }
+
+// passphraseFor returns the passphrase source for encrypted private keys: the first line of the
+// file at path, or a prompt on the terminal if path is empty.
+func passphraseFor(path string) canton.Passphrase {
+	return func() ([]byte, error) {
+		if path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			first, _, _ := strings.Cut(string(data), "\n")
+			return []byte(strings.TrimSuffix(first, "\r")), nil
+		}
+		return promptPassphrase("Enter passphrase for private key: ")
+	}
+}
+
+// promptPassphrase reads a line from the controlling terminal with echo turned off.
+func promptPassphrase(prompt string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to prompt on, use --passphrase-file")
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	pass, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	return pass, err
+}
+
+// addSignerFlags adds the flags configuring the signer opened by openSigner.
+func addSignerFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase of an encrypted private key (prompted for if not given)")
+	cmd.Flags().StringVar(&signerPubKey, "signer-public-key", "", "Public key of an exec:, pkcs11: or HTTP signer, if it cannot provide it itself (e.g. @signer.pub)")
+}
+
+// openSigner opens the private key file or signer backend named by spec; see signer.Open.
+func openSigner(spec string, isBase64 bool) signer.Signer {
+	opts := signer.Options{Passphrase: passphraseFor(passphraseFile), Base64: isBase64}
+	if signerPubKey != "" {
+		pub, err := io.ReadData(signerPubKey, false)
+		if err != nil {
+			log.Fatalf("failed to read signer public key: %v", err)
+		}
+		opts.PublicKey = pub
+	}
+	s, err := signer.Open(spec, opts)
+	if err != nil {
+		log.Fatalf("failed to open signer: %v", err)
+	}
+	return s
+}
@@ -1,22 +1,18 @@
 package main
 
 import (
-	"fmt"
 	"log"
 
+	"buf-lib-poc/pkg/canton"
 	"buf-lib-poc/pkg/daml/hash"
 	interactive "buf-lib-poc/pkg/daml/proto/com/daml/ledger/api/v2/interactive"
 	"buf-lib-poc/pkg/io"
+	"buf-lib-poc/pkg/signer"
 
 	"github.com/spf13/cobra"
-	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
-var (
-	base64HashFlag bool
-)
-
 func initDamlCommands(rootCmd *cobra.Command) {
 	var damlCmd = &cobra.Command{
 		Use:   "daml",
@@ -46,10 +42,9 @@ func initDamlCommands(rootCmd *cobra.Command) {
 				log.Fatalf("failed to compute hash: %v", err)
 			}
 
-			fmt.Printf("%x\n", h)
+			writeOutput(io.Value{Bytes: h}, io.FormatHex)
 		},
 	}
-	// hashCmd.Flags().BoolVarP(&base64HashFlag, "base64", "b", false, "Output hash as base64")
 
 	var decodeCmd = &cobra.Command{
 		Use:   "decode [file]",
@@ -67,22 +62,59 @@ func initDamlCommands(rootCmd *cobra.Command) {
 				log.Fatalf("failed to unmarshal prepared transaction: %v", err)
 			}
 
-			// Marshal to JSON using protojson for proper enum/field name handling
-			m := protojson.MarshalOptions{
-				Multiline:       true,
-				Indent:          "  ",
-				EmitUnpopulated: false,
+			// JSON output uses protojson for proper enum/field name handling
+			writeOutput(io.Value{Bytes: data, Message: &preparedTx}, io.FormatJSON)
+		},
+	}
+
+	var signCmd = &cobra.Command{
+		Use:   "sign [file] [private-key-file|signer]",
+		Short: "Sign the V2 hash of a prepared transaction",
+		Long: `Computes the V2 hash of a prepared transaction and signs it with a private key file or signer
+backend (see 'crypto sign'). The output is the signature; -o json prints the Ledger API Signature
+with the fingerprint of the signer.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := io.ReadData(args[0], false)
+			if err != nil {
+				log.Fatalf("failed to read input file: %v", err)
+			}
+
+			var preparedTx interactive.PreparedTransaction
+			if err := proto.Unmarshal(data, &preparedTx); err != nil {
+				log.Fatalf("failed to unmarshal prepared transaction: %v", err)
+			}
+			h, err := hash.HashPreparedTransaction(&preparedTx)
+			if err != nil {
+				log.Fatalf("failed to compute hash: %v", err)
+			}
+
+			s := openSigner(args[1], false)
+			sig, err := signer.Sign(s, h, signAlgo)
+			if err != nil {
+				log.Fatalf("signing failed: %v", err)
 			}
-			jsonBytes, err := m.Marshal(&preparedTx)
+			sigMeta, err := canton.GetSignatureMetadata(signAlgo)
 			if err != nil {
-				log.Fatalf("failed to marshal to JSON: %v", err)
+				log.Fatalf("invalid signature algorithm: %v", err)
 			}
 
-			fmt.Println(string(jsonBytes))
+			signature := map[string]interface{}{
+				"format":               sigMeta.Format,
+				"signature":            sig,
+				"signingAlgorithmSpec": sigMeta.Algorithm,
+			}
+			if pub, err := s.PublicKey(); err == nil {
+				signature["signedBy"] = canton.Fingerprint(pub.DER)
+			}
+			writeOutput(io.Value{Bytes: sig, JSON: signature}, io.FormatBase64)
 		},
 	}
+	signCmd.Flags().StringVarP(&signAlgo, "algo", "a", "ed25519", "Signing algorithm (ed25519, ecdsa256, ecdsa384)")
+	addSignerFlags(signCmd)
 
 	damlCmd.AddCommand(hashCmd)
 	damlCmd.AddCommand(decodeCmd)
+	damlCmd.AddCommand(signCmd)
 	rootCmd.AddCommand(damlCmd)
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"buf-lib-poc/pkg/canton"
+	"buf-lib-poc/pkg/diff"
+	"buf-lib-poc/pkg/io"
+	"buf-lib-poc/pkg/patch"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	paramsSynchronizer string
+	paramsBase         string
+	paramsSequencing   bool
+)
+
+func initParamsCommands(prepareCmd *cobra.Command) {
+	var synchronizerParamsCmd = &cobra.Command{
+		Use:   "synchronizer-params",
+		Short: "Prepare a change of the dynamic synchronizer or sequencing parameters",
+		Long: `Prepares a SynchronizerParametersState, or with --sequencing a DynamicSequencingParametersState,
+starting from --base (an existing transaction, .prep or SignedTopologyTransaction) or from the
+defaults of a new synchronizer, and applying --set path=value to the parameters, e.g.
+  --set confirmationResponseTimeout=45s --set trafficControl.enforceRateLimiting=true
+Durations are given in seconds (30s) or as 5m, 48h. The kind of a --base is detected. The synchronizer parameters are validated
+before the changes are shown and <prefix>.prep and <prefix>.hash are written; sequencing
+parameters are opaque to all but the sequencers and are not checked.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if outputPrefix == "" {
+				log.Fatal("missing required flag: --out-prefix")
+			}
+			schemaFile := os.Getenv("PROTO_IMAGE")
+			if schemaFile == "" {
+				log.Fatal("PROTO_IMAGE must be set to point to Canton topology image")
+			}
+
+			// 1. Start from the base, or from the defaults
+			tx := map[string]interface{}{}
+			if paramsBase != "" {
+				data, err := io.ReadData(paramsBase, false)
+				if err != nil {
+					log.Fatalf("failed to read base: %v", err)
+				}
+				if tx, err = decodeTopologyTransaction(data); err != nil {
+					log.Fatalf("failed to decode base: %v", err)
+				}
+				mapping, _ := tx["mapping"].(map[string]interface{})
+				if _, ok := mapping["sequencingDynamicParametersState"]; ok {
+					paramsSequencing = true
+				} else if _, ok := mapping["synchronizerParametersState"]; !ok {
+					log.Fatal("the base is neither a SynchronizerParametersState nor a DynamicSequencingParametersState transaction")
+				} else if paramsSequencing {
+					log.Fatal("--sequencing does not apply to a SynchronizerParametersState base")
+				}
+				if !cmd.Flags().Changed("serial") {
+					serial, _ := tx["serial"].(float64)
+					serialFlag = int64(serial) + 1
+				}
+			}
+			kind, field := "synchronizerParametersState", "synchronizerParameters"
+			if paramsSequencing {
+				kind, field = "sequencingDynamicParametersState", "sequencingParameters"
+			}
+			if paramsBase == "" {
+				var params interface{} = map[string]interface{}{}
+				if !paramsSequencing {
+					params = normalizeJSON(canton.SynchronizerParameterDefaults())
+				}
+				patch.Set(tx, "mapping."+kind+"."+field, params)
+			}
+			mapping, _ := tx["mapping"].(map[string]interface{})
+			state, ok := mapping[kind].(map[string]interface{})
+			if !ok {
+				log.Fatalf("the base has no %s mapping", kind)
+			}
+			switch id, _ := state["synchronizerId"].(string); {
+			case id == "" && paramsSynchronizer == "":
+				log.Fatal("missing required flag: --synchronizer-id")
+			case id == "":
+				state["synchronizerId"] = paramsSynchronizer
+			case paramsSynchronizer != "" && id != paramsSynchronizer:
+				log.Fatalf("--synchronizer-id %s does not match the synchronizer %s of the base", paramsSynchronizer, id)
+			}
+			tx["operation"] = "TOPOLOGY_CHANGE_OP_ADD_REPLACE"
+			tx["serial"] = serialFlag
+
+			// 2. Apply the changes to a copy of the parameters
+			before := normalizeJSON(state[field])
+
+			patcher, err := e.Patcher(context.Background(), schemaFile, "com.digitalasset.canton.protocol.v30.TopologyTransaction")
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, set := range setFlags {
+				path, value, ok := patch.SplitAssignment(set)
+				if !ok {
+					log.Fatalf("invalid assignment %q, expected path=value", set)
+				}
+				if err := patcher.Set(tx, "mapping."+kind+"."+field+"."+path, value); err != nil {
+					log.Fatal(err)
+				}
+			}
+			after, _ := patch.Get(tx, "mapping."+kind+"."+field)
+
+			// 3. Validate and show the changes
+			if !paramsSequencing {
+				params, _ := after.(map[string]interface{})
+				warnings, err := canton.CheckSynchronizerParameters(params)
+				for _, w := range warnings {
+					fmt.Printf("WARNING: %s\n", w)
+				}
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			if changes := diff.Compare(before, after); len(changes) > 0 {
+				fmt.Print(diff.Format(changes))
+			} else {
+				fmt.Println("No parameter changes")
+			}
+
+			label := "Synchronizer parameters"
+			if paramsSequencing {
+				label = "Sequencing parameters"
+			}
+			jsonData, _ := json.Marshal(tx)
+			reportPrepared(outputPrefix, label, prepareTransaction(jsonData, outputPrefix))
+		},
+	}
+	synchronizerParamsCmd.Flags().StringVar(&paramsSynchronizer, "synchronizer-id", "", "Synchronizer the parameters apply to (default: that of --base)")
+	synchronizerParamsCmd.Flags().StringVar(&paramsBase, "base", "", "Existing transaction to change (.prep or SignedTopologyTransaction)")
+	synchronizerParamsCmd.Flags().BoolVar(&paramsSequencing, "sequencing", false, "Prepare a DynamicSequencingParametersState instead")
+	synchronizerParamsCmd.Flags().StringArrayVarP(&setFlags, "set", "s", nil, "Set a parameter using path=value, e.g. confirmationResponseTimeout=45s (can be repeated)")
+	synchronizerParamsCmd.Flags().Int64Var(&serialFlag, "serial", 1, "Transaction serial number (default with --base: the next one)")
+	synchronizerParamsCmd.Flags().StringVar(&outputPrefix, "out-prefix", "", "Write <prefix>.prep and <prefix>.hash")
+
+	prepareCmd.AddCommand(synchronizerParamsCmd)
+}
+
+// normalizeJSON returns v as decoded from its JSON encoding, so that values compare as in JSON.
+func normalizeJSON(v interface{}) interface{} {
+	var out interface{}
+	jsonData, _ := json.Marshal(v)
+	json.Unmarshal(jsonData, &out)
+	return out
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"buf-lib-poc/pkg/canton"
+	"buf-lib-poc/pkg/io"
+	"buf-lib-poc/pkg/signer"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	uidNamespace string
+	uidMember    string
+	uidKey       string
+	partyKeyPath string
+
+	onboardParticipants []string
+	onboardThreshold    int
+	onboardSigningKeys  []string
+	onboardKeyThreshold int
+	onboardAlgo         string
+)
+
+func initPartyCommands(cantonCmd *cobra.Command) {
+	uidCmd := &cobra.Command{
+		Use:   "uid",
+		Short: "Build and validate unique identifiers (identifier::namespace)",
+	}
+
+	var buildCmd = &cobra.Command{
+		Use:   "build [identifier]",
+		Short: "Build a unique identifier or party ID",
+		Long: `Builds identifier::namespace, where --namespace is a fingerprint or the root key of the namespace
+(e.g. @ns.pub), whose fingerprint is computed. --member PAR, MED or SEQ builds a member ID.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if uidNamespace == "" {
+				log.Fatal("missing required flag: --namespace")
+			}
+			uid, err := canton.NewUID(args[0], resolveNamespace(uidNamespace))
+			if err != nil {
+				log.Fatal(err)
+			}
+			id := uid.String()
+			if uidMember != "" {
+				member, err := canton.ParseMember(strings.ToUpper(uidMember) + canton.UIDDelimiter + id)
+				if err != nil {
+					log.Fatal(err)
+				}
+				id = member.String()
+			}
+			writeOutput(io.Value{Text: id, JSON: map[string]interface{}{"id": id, "identifier": uid.Identifier, "namespace": uid.Namespace}}, io.FormatText)
+		},
+	}
+	buildCmd.Flags().StringVar(&uidNamespace, "namespace", "", "Namespace fingerprint, or the namespace root key (e.g. @ns.pub)")
+	buildCmd.Flags().StringVar(&uidMember, "member", "", "Build a member ID with this code: PAR, MED or SEQ")
+
+	var parseCmd = &cobra.Command{
+		Use:   "parse [id]",
+		Short: "Parse and validate a unique identifier, party ID or member ID",
+		Long: `Parses a unique identifier or party ID (identifier::namespace) or a member ID
+(PAR::, MED:: or SEQ:: followed by a unique identifier) and fails if it is invalid. --key checks
+that the namespace is the fingerprint of a key, which catches mistyped namespaces.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id := strings.TrimSpace(args[0])
+			result := map[string]interface{}{"id": id}
+			var uid canton.UID
+			if member, err := canton.ParseMember(id); err == nil {
+				uid = member.UID
+				result["member"] = canton.MemberCodes[member.Code]
+			} else if uid, err = canton.ParseUID(id); err != nil {
+				log.Fatal(err)
+			}
+			result["identifier"] = uid.Identifier
+			result["namespace"] = uid.Namespace
+
+			if uidKey != "" {
+				if fp := resolveNamespace(uidKey); fp != uid.Namespace {
+					log.Fatalf("namespace mismatch: %s is in namespace %s, but the key has fingerprint %s", id, uid.Namespace, fp)
+				}
+			}
+
+			text := fmt.Sprintf("Identifier: %s\nNamespace:  %s", uid.Identifier, uid.Namespace)
+			if kind, ok := result["member"]; ok {
+				text = fmt.Sprintf("Member:     %s\n%s", kind, text)
+			}
+			writeOutput(io.Value{Text: text, JSON: result}, io.FormatText)
+		},
+	}
+	parseCmd.Flags().StringVar(&uidKey, "key", "", "Check that the namespace is the fingerprint of this key (e.g. @ns.pub)")
+
+	uidCmd.AddCommand(buildCmd)
+	uidCmd.AddCommand(parseCmd)
+	cantonCmd.AddCommand(uidCmd)
+
+	partyCmd := &cobra.Command{
+		Use:   "party",
+		Short: "External party commands",
+	}
+
+	var idCmd = &cobra.Command{
+		Use:   "id [hint]",
+		Short: "Derive the ID of an external party from its key",
+		Long: `Derives the party ID hint::fingerprint of an external party, whose namespace is rooted in the key
+it signs with (--key, in any format of 'crypto public-key'). -o json adds the key spec.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if partyKeyPath == "" {
+				log.Fatal("missing required flag: --key")
+			}
+			data, err := io.ReadData(partyKeyPath, false)
+			if err != nil {
+				log.Fatalf("failed to read key: %v", err)
+			}
+			info, err := canton.InspectPublicKey(data)
+			if err != nil {
+				log.Fatal(err)
+			}
+			party, err := canton.PartyID(args[0], data)
+			if err != nil {
+				log.Fatal(err)
+			}
+			writeOutput(io.Value{Text: party.String(), JSON: map[string]interface{}{
+				"partyId":   party.String(),
+				"hint":      party.Identifier,
+				"namespace": party.Namespace,
+				"keySpec":   info.KeySpec,
+			}}, io.FormatText)
+		},
+	}
+	idCmd.Flags().StringVar(&partyKeyPath, "key", "", "Public key of the party (e.g. @party.pub)")
+
+	var onboardCmd = &cobra.Command{
+		Use:   "onboard [hint]",
+		Short: "Prepare and sign the topology transactions that onboard an external party",
+		Long: `Prepares the three topology transactions that onboard the external party hint::<fingerprint of --key>:
+  - the root NamespaceDelegation of its namespace (<prefix>-namespace.prep),
+  - a PartyToKeyMapping with its signing keys and --key-threshold (<prefix>-keys.prep),
+  - a PartyToParticipant with the --participant list and --threshold (<prefix>-hosting.prep),
+all with --serial, and writes their multi-transaction hash to <prefix>.hash. The party key authorizes
+all three with a single signature of that hash: --signer signs it with a private key file or signer
+backend, or --signature takes a signature made elsewhere (run the same command again to add it). Once
+signed, the SignedTopologyTransactions bundle is written (--out-file bundle.bin) for upload.
+
+Participants are given as uid:permission, with permission submission, confirmation (the default) or
+observation. The hosting participants must still authorize the PartyToParticipant, and signing keys
+other than --key the PartyToKeyMapping, so these are marked as proposals.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if partyKeyPath == "" || len(onboardParticipants) == 0 || outputPrefix == "" {
+				log.Fatal("missing required flags: --key, --participant, --out-prefix")
+			}
+			if signaturePath != "" && signerSpec != "" {
+				log.Fatal("--signature and --signer are mutually exclusive")
+			}
+			if (signaturePath != "" || signerSpec != "") && onboardAlgo == "" {
+				log.Fatal("missing required flag: --signature-algorithm")
+			}
+
+			// 1. The party and its keys
+			keyData, err := io.ReadData(partyKeyPath, false)
+			if err != nil {
+				log.Fatalf("failed to read key: %v", err)
+			}
+			party, err := canton.PartyID(args[0], keyData)
+			if err != nil {
+				log.Fatal(err)
+			}
+			info, err := canton.InspectPublicKey(keyData)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Fprintf(os.Stderr, "Party: %s\n", party)
+
+			keyPaths := onboardSigningKeys
+			if len(keyPaths) == 0 {
+				keyPaths = []string{partyKeyPath}
+			}
+			var signingKeys []interface{}
+			extraKeys := false
+			for _, path := range keyPaths {
+				data, err := io.ReadData(path, false)
+				if err != nil {
+					log.Fatalf("failed to read signing key %s: %v", path, err)
+				}
+				pub, err := canton.ParsePublicKey(data)
+				if err != nil {
+					log.Fatalf("invalid signing key %s: %v", path, err)
+				}
+				key, err := canton.SigningPublicKeyJSON(pub, []string{"SIGNING_KEY_USAGE_PROTOCOL"})
+				if err != nil {
+					log.Fatalf("invalid signing key %s: %v", path, err)
+				}
+				signingKeys = append(signingKeys, key)
+				extraKeys = extraKeys || canton.Fingerprint(pub.DER) != party.Namespace
+			}
+			if onboardKeyThreshold < 1 || onboardKeyThreshold > len(signingKeys) {
+				log.Fatalf("--key-threshold must be between 1 and the %d signing keys", len(signingKeys))
+			}
+
+			// 2. The hosting participants
+			var participants []canton.HostingParticipant
+			for _, spec := range onboardParticipants {
+				p, err := canton.ParseHostingParticipant(spec)
+				if err != nil {
+					log.Fatal(err)
+				}
+				participants = append(participants, p)
+			}
+			if err := canton.ValidateHosting(participants, onboardThreshold); err != nil {
+				log.Fatal(err)
+			}
+
+			// 3. Prepare the transactions and their multi-transaction hash
+			mappings := []struct {
+				suffix, label string
+				mapping       map[string]interface{}
+				proposal      bool
+			}{
+				{"-namespace", "Namespace delegation", map[string]interface{}{
+					"namespaceDelegation": delegationMapping(party.Namespace, info, "all"),
+				}, false},
+				{"-keys", "Party to key mapping", map[string]interface{}{
+					"partyToKeyMapping": map[string]interface{}{
+						"party":       party.String(),
+						"threshold":   onboardKeyThreshold,
+						"signingKeys": signingKeys,
+					},
+				}, extraKeys},
+				{"-hosting", "Party to participant", map[string]interface{}{
+					"partyToParticipant": map[string]interface{}{
+						"party":        party.String(),
+						"threshold":    onboardThreshold,
+						"participants": participants,
+					},
+				}, true},
+			}
+			prepared := make([][]byte, len(mappings))
+			hashes := make([][]byte, len(mappings))
+			for i, m := range mappings {
+				jsonData, _ := json.Marshal(map[string]interface{}{
+					"operation": "TOPOLOGY_CHANGE_OP_ADD_REPLACE",
+					"serial":    serialFlag,
+					"mapping":   m.mapping,
+				})
+				prepared[i] = prepareTransaction(jsonData, outputPrefix+m.suffix)
+				fmt.Fprintln(os.Stderr, preparedText(outputPrefix+m.suffix, m.label))
+				hashes[i] = canton.ComputeHash(prepared[i], canton.HashPurposeTopologyTransaction)
+			}
+			multiHash := canton.MultiTransactionHash(hashes)
+			if err := os.WriteFile(outputPrefix+".hash", multiHash, 0644); err != nil {
+				log.Fatalf("failed to write .hash file: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "Multi-transaction hash %s written to %s.hash\n", hex.EncodeToString(multiHash), outputPrefix)
+
+			if signaturePath == "" && signerSpec == "" {
+				fmt.Fprintf(os.Stderr, "Sign %s.hash with the party key and run again with --signature, or use --signer\n", outputPrefix)
+				return
+			}
+
+			// 4. Sign the multi-transaction hash with the party key, or check the given signature
+			sigMeta, err := canton.GetSignatureMetadata(onboardAlgo)
+			if err != nil {
+				log.Fatalf("invalid signature algorithm: %v", err)
+			}
+			var sigData []byte
+			if signerSpec != "" {
+				s := openSigner(signerSpec, false)
+				if pub, err := s.PublicKey(); err == nil && canton.Fingerprint(pub.DER) != party.Namespace {
+					log.Fatalf("the signer key %s is not the party key %s", canton.Fingerprint(pub.DER), party.Namespace)
+				}
+				if sigData, err = signer.Sign(s, multiHash, onboardAlgo); err != nil {
+					log.Fatalf("signing failed: %v", err)
+				}
+			} else {
+				if sigData, err = io.ReadData(signaturePath, false); err != nil {
+					log.Fatalf("failed to read signature: %v", err)
+				}
+				if sigData, err = canton.NormalizeSignature(sigData, sigMeta.Algorithm, sigMeta.Format); err != nil {
+					log.Fatalf("invalid signature: %v", err)
+				}
+				valid, err := canton.VerifySignature(multiHash, sigData, info.PublicKey, sigMeta.Algorithm)
+				if err != nil {
+					log.Fatalf("invalid signature: %v", err)
+				}
+				if !valid {
+					log.Fatalf("the signature is not a signature of %s.hash by the party key %s", outputPrefix, party.Namespace)
+				}
+			}
+
+			// 5. Assemble the signed transactions into a bundle
+			schemaFile := os.Getenv("PROTO_IMAGE")
+			version := int32(30)
+			multiSignatures := []interface{}{
+				map[string]interface{}{
+					"transactionHashes": hashes,
+					"signatures": []interface{}{
+						map[string]interface{}{
+							"format":               sigMeta.Format,
+							"signature":            sigData,
+							"signedBy":             party.Namespace,
+							"signingAlgorithmSpec": sigMeta.Algorithm,
+						},
+					},
+				},
+			}
+			var bundle [][]byte
+			for i, m := range mappings {
+				jsonData, _ := json.Marshal(map[string]interface{}{
+					"transaction":                prepared[i],
+					"proposal":                   m.proposal,
+					"multiTransactionSignatures": multiSignatures,
+				})
+				signedTx, err := e.Generate(context.Background(), schemaFile, "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction", jsonData, &version)
+				if err != nil {
+					log.Fatalf("failed to generate signed transaction: %v", err)
+				}
+				bundle = append(bundle, signedTx)
+			}
+			jsonData, _ := json.Marshal(map[string]interface{}{"signedTransaction": bundle})
+			binaryData, err := e.Generate(context.Background(), schemaFile, "com.digitalasset.canton.protocol.v30.SignedTopologyTransactions", jsonData, &version)
+			if err != nil {
+				log.Fatalf("failed to generate transaction bundle: %v", err)
+			}
+
+			writeOutput(io.Value{Bytes: binaryData}, io.FormatBinary)
+			if output.ToFile() {
+				fmt.Fprintf(os.Stderr, "Signed topology transactions written to %s\n", output.Path)
+			}
+		},
+	}
+	onboardCmd.Flags().StringVar(&partyKeyPath, "key", "", "Public key the party namespace is rooted in (e.g. @party.pub)")
+	onboardCmd.Flags().StringSliceVar(&onboardParticipants, "participant", nil, "Hosting participant as uid:permission (submission, confirmation or observation); repeatable")
+	onboardCmd.Flags().IntVar(&onboardThreshold, "threshold", 1, "Number of hosting participants that must confirm for the party")
+	onboardCmd.Flags().StringSliceVar(&onboardSigningKeys, "signing-key", nil, "Key the party signs Daml transactions with (default: --key); repeatable")
+	onboardCmd.Flags().IntVar(&onboardKeyThreshold, "key-threshold", 1, "Number of signing keys that must sign for the party")
+	onboardCmd.Flags().Int64Var(&serialFlag, "serial", 1, "Serial number of the transactions")
+	onboardCmd.Flags().StringVar(&outputPrefix, "out-prefix", "", "Write <prefix>-{namespace,keys,hosting}.prep/.hash and the multi-transaction hash to <prefix>.hash")
+	onboardCmd.Flags().StringVar(&signerSpec, "signer", "", "Sign with this private key file or signer backend (see 'crypto sign')")
+	onboardCmd.Flags().StringVar(&signaturePath, "signature", "", "Signature of <prefix>.hash by the party key, made elsewhere")
+	onboardCmd.Flags().StringVar(&onboardAlgo, "signature-algorithm", "", "Signature algorithm (ed25519, ecdsa256, ecdsa384)")
+	addSignerFlags(onboardCmd)
+
+	partyCmd.AddCommand(idCmd)
+	partyCmd.AddCommand(onboardCmd)
+	cantonCmd.AddCommand(partyCmd)
+}
+
+// resolveNamespace returns spec if it is a fingerprint, or else the fingerprint of the key it reads.
+func resolveNamespace(spec string) string {
+	if canton.ValidateFingerprint(spec) == nil {
+		return spec
+	}
+	data, err := io.ReadData(spec, false)
+	if err != nil {
+		log.Fatalf("failed to read namespace key: %v", err)
+	}
+	info, err := canton.InspectPublicKey(data)
+	if err != nil {
+		log.Fatalf("namespace %q is neither a fingerprint nor a key: %v", spec, err)
+	}
+	return canton.Fingerprint(info.PublicKey)
+}
+
+// resolveParty returns the party ID of spec: a party ID, or the shorthand hint@<key>, such as
+// alice@@alice.pub, for the party hint in the namespace of a key.
+func resolveParty(spec string) string {
+	if hint, key, ok := strings.Cut(spec, "@"); ok {
+		data, err := io.ReadData(key, false)
+		if err != nil {
+			log.Fatalf("failed to read the key of party %s: %v", hint, err)
+		}
+		party, err := canton.PartyID(hint, data)
+		if err != nil {
+			log.Fatalf("invalid party %s: %v", spec, err)
+		}
+		return party.String()
+	}
+	party, err := canton.ParseUID(spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return party.String()
+}
@@ -1,16 +1,21 @@
 package main
 
 import (
+	"bufio"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 
+	"buf-lib-poc/pkg/batch"
+	"buf-lib-poc/pkg/diff"
+	"buf-lib-poc/pkg/engine"
 	"buf-lib-poc/pkg/io"
 	"buf-lib-poc/pkg/patch"
+	"buf-lib-poc/pkg/processor"
+	"buf-lib-poc/pkg/template"
 
 	"github.com/spf13/cobra"
 )
@@ -22,12 +27,27 @@ var (
 	outputBase64Flag bool
 	versionNumFlag   int32
 	setFlags         []string
+	unsetFlags       []string
+	candidatesFlag   []string
+	topFlag          int
+	decodeBestFlag   bool
+	keepRawFlag      bool
+	patchFlag        string
+	dryRunFlag       bool
+	diffKeyFlags     []string
+	jsonOutputFlag   bool
+	commentsFlag     bool
+	maxRecursionFlag int
+	formatFlag       string
+	delimitedFlag    bool
+	linesFlag        bool
+	workersFlag      int
 )
 
 func initProtoCommands(protoCmd *cobra.Command) {
 	var templateCmd = &cobra.Command{
 		Use:   "template [schema-file] [message-name]",
-		Short: "Generate a JSON template from Protobuf message",
+		Short: "Generate a JSON or YAML template, or a JSON Schema, for a Protobuf message",
 		Args:  cobra.RangeArgs(1, 2),
 		Run: func(cmd *cobra.Command, args []string) {
 			schemaFile, remaining, err := resolveSchemaArgs(args)
@@ -39,15 +59,33 @@ func initProtoCommands(protoCmd *cobra.Command) {
 			}
 			messageName := remaining[0]
 
-			tmpl, err := e.Template(context.Background(), schemaFile, messageName)
+			if formatFlag == "json-schema" {
+				schema, err := e.JSONSchema(context.Background(), schemaFile, messageName)
+				if err != nil {
+					log.Fatalf("failed to generate JSON Schema: %v", err)
+				}
+				writeOutput(io.Value{JSON: schema}, io.FormatJSON)
+				return
+			}
+
+			tmpl, err := e.Template(context.Background(), schemaFile, messageName, template.Options{Comments: commentsFlag, MaxRecursion: maxRecursionFlag})
 			if err != nil {
 				log.Fatalf("failed to generate template: %v", err)
 			}
 
-			templateJSON, _ := json.MarshalIndent(tmpl, "", "  ")
-			fmt.Println(string(templateJSON))
+			switch formatFlag {
+			case "json":
+				writeOutput(io.Value{JSON: tmpl}, io.FormatJSON)
+			case "yaml":
+				writeOutput(io.Value{Text: string(template.YAML(tmpl))}, io.FormatText)
+			default:
+				log.Fatalf("unknown format '%s', expected json, yaml or json-schema", formatFlag)
+			}
 		},
 	}
+	templateCmd.Flags().StringVarP(&formatFlag, "format", "f", "json", "Output format: json, yaml (hints become # comments) or json-schema")
+	templateCmd.Flags().BoolVar(&commentsFlag, "comments", false, "Include proto comments of fields under \"_comments\"")
+	templateCmd.Flags().IntVar(&maxRecursionFlag, "max-recursion", template.DefaultMaxRecursion, "Times a recursive message is expanded on a single path")
 
 	var decodeCmd = &cobra.Command{
 		Use:   "decode [schema-file] [message-name] ([data])",
@@ -72,6 +110,12 @@ func initProtoCommands(protoCmd *cobra.Command) {
 				}
 			}
 
+			e.KeepRaw = keepRawFlag
+			if delimitedFlag || linesFlag {
+				decodeStream(schemaFile, messageName, input)
+				return
+			}
+
 			binaryData, err := io.ReadData(input, isBase64Flag)
 			if err != nil {
 				log.Fatalf("failed to read input data: %v", err)
@@ -82,17 +126,21 @@ func initProtoCommands(protoCmd *cobra.Command) {
 				log.Fatalf("failed to decode: %v", err)
 			}
 
-			outputJSON, _ := json.MarshalIndent(out, "", "  ")
-			fmt.Println(string(outputJSON))
+			v := io.Value{Bytes: binaryData, JSON: out}
+			writeOutput(withMessage(v, io.FormatJSON, schemaFile, messageName, binaryData, versionedFlag), io.FormatJSON)
 		},
 	}
 	decodeCmd.Flags().StringVarP(&dataFlag, "data", "d", "", "Input data (binary or base64)")
 	decodeCmd.Flags().BoolVarP(&isBase64Flag, "base64", "b", false, "Interpret input data as base64")
 	decodeCmd.Flags().BoolVarP(&versionedFlag, "versioned", "V", false, "Unwrap from UntypedVersionedMessage")
+	decodeCmd.Flags().BoolVar(&keepRawFlag, "keep-raw", false, "Annotate expanded fields with their original bytes (@raw/@hash) for byte-exact re-generation")
+	decodeCmd.Flags().BoolVar(&delimitedFlag, "delimited", false, "Input is a stream of varint length-delimited messages; output one JSON line per message")
+	decodeCmd.Flags().BoolVar(&linesFlag, "lines", false, "Input has one base64 message per line; output one JSON line per message")
+	decodeCmd.Flags().IntVar(&workersFlag, "workers", 0, "Messages processed concurrently in --delimited and --lines modes (default: number of CPUs)")
 
 	var generateCmd = &cobra.Command{
 		Use:   "generate [schema-file] [message-name] ([json-data])",
-		Short: "Serialize JSON to binary Protobuf",
+		Short: "Serialize JSON or YAML to binary Protobuf",
 		Args:  cobra.RangeArgs(1, 3),
 		Run: func(cmd *cobra.Command, args []string) {
 			schemaFile, remaining, err := resolveSchemaArgs(args)
@@ -108,12 +156,26 @@ func initProtoCommands(protoCmd *cobra.Command) {
 			if input == "" {
 				if len(remaining) > 1 {
 					input = remaining[1]
+				} else if delimitedFlag || linesFlag {
+					input = "-"
 				} else {
 					// Default to empty object if no data and no file provided
 					input = "{}"
 				}
 			}
 
+			if delimitedFlag || linesFlag {
+				if len(setFlags) > 0 || len(unsetFlags) > 0 {
+					log.Fatal("--set and --unset cannot be combined with --delimited or --lines")
+				}
+				var vPtr *int32
+				if cmd.Flags().Changed("versioned") {
+					vPtr = &versionNumFlag
+				}
+				generateStream(schemaFile, messageName, input, vPtr)
+				return
+			}
+
 			var jsonData []byte
 			if input == "{}" {
 				jsonData = []byte("{}")
@@ -123,24 +185,38 @@ func initProtoCommands(protoCmd *cobra.Command) {
 				if err != nil {
 					log.Fatalf("failed to read JSON data: %v", err)
 				}
+				jsonData, err = io.ToJSON(jsonData)
+				if err != nil {
+					log.Fatalf("failed to parse input data: %v", err)
+				}
 			}
 
-			// Apply --set flags
-			if len(setFlags) > 0 {
+			// Apply --set and --unset flags
+			if len(setFlags) > 0 || len(unsetFlags) > 0 {
 				var data map[string]interface{}
 				if err := json.Unmarshal(jsonData, &data); err != nil {
 					log.Fatalf("failed to parse JSON data for patching: %v", err)
 				}
 
+				patcher, err := e.Patcher(context.Background(), schemaFile, messageName)
+				if err != nil {
+					log.Fatalf("error: %v", err)
+				}
 				for _, set := range setFlags {
-					parts := strings.SplitN(set, "=", 2)
-					if len(parts) != 2 {
+					path, value, ok := patch.SplitAssignment(set)
+					if !ok {
 						log.Fatalf("invalid --set format '%s', expected key=value", set)
 					}
-					patch.Set(data, parts[0], patch.ParseValue(parts[1]))
+					if err := patcher.Set(data, path, value); err != nil {
+						log.Fatalf("invalid --set '%s': %v", set, err)
+					}
+				}
+				for _, unset := range unsetFlags {
+					if err := patcher.Delete(data, unset); err != nil {
+						log.Fatalf("invalid --unset '%s': %v", unset, err)
+					}
 				}
 
-				var err error
 				jsonData, err = json.Marshal(data)
 				if err != nil {
 					log.Fatalf("failed to marshal patched JSON: %v", err)
@@ -157,19 +233,363 @@ func initProtoCommands(protoCmd *cobra.Command) {
 				log.Fatalf("failed to generate: %v", err)
 			}
 
+			format := io.FormatBinary
 			if outputBase64Flag {
-				fmt.Println(base64.StdEncoding.EncodeToString(binaryData))
+				format = io.FormatBase64
+			}
+			// The data is wrapped for --versioned, or for an @version key in the input
+			versioned := vPtr != nil
+			var obj map[string]interface{}
+			if json.Unmarshal(jsonData, &obj) == nil {
+				if _, ok, _ := processor.VersionOf(obj); ok {
+					versioned = true
+				}
+			}
+			v := io.Value{Bytes: binaryData}
+			writeOutput(withMessage(v, format, schemaFile, messageName, binaryData, versioned), format)
+		},
+	}
+	generateCmd.Flags().StringVarP(&dataFlag, "data", "d", "", "Input JSON or YAML data")
+	generateCmd.Flags().BoolVarP(&outputBase64Flag, "base64", "b", false, "Output base64 encoded binary (same as --output base64)")
+	generateCmd.Flags().Int32VarP(&versionNumFlag, "versioned", "V", 30, "Wrap in UntypedVersionedMessage with this version (an @version key in the input is honored otherwise)")
+	generateCmd.Flags().StringArrayVarP(&setFlags, "set", "s", nil, "Set fields using path=value, checked and converted against the message schema, e.g. a.b[0].c=1, list[]=x to append, list=x,y, or a JSONPath such as $..serial=2 (can be repeated)")
+	generateCmd.Flags().StringArrayVar(&unsetFlags, "unset", nil, "Remove fields or list elements by path, e.g. signatures[-1] or a JSONPath (can be repeated)")
+	generateCmd.Flags().BoolVar(&delimitedFlag, "delimited", false, "Input has one JSON message per line; output a stream of varint length-delimited messages")
+	generateCmd.Flags().BoolVar(&linesFlag, "lines", false, "Input has one JSON message per line; output one encoded message per line (base64 unless --output is given)")
+	generateCmd.Flags().IntVar(&workersFlag, "workers", 0, "Messages processed concurrently in --delimited and --lines modes (default: number of CPUs)")
+
+	var identifyCmd = &cobra.Command{
+		Use:   "identify [schema-file] ([data])",
+		Short: "Guess the message type of binary Protobuf data",
+		Args:  cobra.RangeArgs(0, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			schemaFile, remaining, err := resolveSchemaArgs(args)
+			if err != nil {
+				log.Fatalf("error: %v", err)
+			}
+
+			input := dataFlag
+			if input == "" {
+				if len(remaining) > 0 {
+					input = remaining[0]
+				} else {
+					input = "-"
+				}
+			}
+
+			binaryData, err := io.ReadData(input, isBase64Flag)
+			if err != nil {
+				log.Fatalf("failed to read input data: %v", err)
+			}
+
+			candidates, err := e.Identify(context.Background(), schemaFile, binaryData, candidatesFlag)
+			if err != nil {
+				log.Fatalf("failed to identify: %v", err)
+			}
+			if len(candidates) == 0 {
+				log.Fatal("no candidate message parses the input data")
+			}
+
+			if topFlag > 0 && len(candidates) > topFlag {
+				candidates = candidates[:topFlag]
+			}
+			var sb strings.Builder
+			for i, c := range candidates {
+				name := c.Name
+				if c.Versioned {
+					name = fmt.Sprintf("%s (versioned v%d)", c.Name, c.Version)
+				}
+				fmt.Fprintf(&sb, "%2d. %6.3f  %s\n", i+1, c.Score, name)
+				fmt.Fprintf(&sb, "             fields=%d unknown_bytes=%d invalid_enums=%d invalid_strings=%d mapped=%d/%d\n",
+					c.KnownFields, c.UnknownBytes, c.InvalidEnums, c.InvalidStrings, c.MappedOK, c.MappedOK+c.MappedFailed)
+			}
+			v := io.Value{Text: sb.String(), JSON: candidates}
+
+			if decodeBestFlag {
+				best := candidates[0]
+				out, err := e.Decode(context.Background(), schemaFile, best.Name, binaryData, best.Versioned)
+				if err != nil {
+					log.Fatalf("failed to decode as %s: %v", best.Name, err)
+				}
+				outputJSON, _ := json.MarshalIndent(out, "", "  ")
+				v.Text += string(outputJSON)
+				v.JSON = map[string]interface{}{"candidates": candidates, "decoded": out}
+			}
+			writeOutput(v, io.FormatText)
+		},
+	}
+	identifyCmd.Flags().StringVarP(&dataFlag, "data", "d", "", "Input data (binary or base64)")
+	identifyCmd.Flags().BoolVarP(&isBase64Flag, "base64", "b", false, "Interpret input data as base64")
+	identifyCmd.Flags().StringSliceVar(&candidatesFlag, "candidates", nil, "Candidate message names or aliases (default: config identify_candidates, then all messages)")
+	identifyCmd.Flags().IntVarP(&topFlag, "top", "n", 10, "Number of ranked candidates to output (0 for all)")
+	identifyCmd.Flags().BoolVar(&decodeBestFlag, "decode", false, "Decode the data with the best match")
+
+	var editCmd = &cobra.Command{
+		Use:   "edit [schema-file] [message-name] ([data])",
+		Short: "Apply a JSON Patch, merge patch or --set changes to binary Protobuf data",
+		Long: `Decode binary data (including config mappings), apply an RFC 6902 JSON Patch (a JSON array)
+or an RFC 7396 merge patch (a JSON object), then --set and --unset changes, and re-encode it.
+Paths of --set and --unset starting with '$' are JSONPaths that apply to every value they select,
+e.g. --unset '$.signatures[?(@.signedBy=="1220ab")]'. Unchanged nested payloads keep their
+original bytes. The changes are printed to stderr.`,
+		Args: cobra.RangeArgs(1, 4),
+		Run: func(cmd *cobra.Command, args []string) {
+			schemaFile, remaining, err := resolveSchemaArgs(args)
+			if err != nil {
+				log.Fatalf("error: %v", err)
+			}
+			if len(remaining) == 0 {
+				log.Fatal("missing message name")
+			}
+			messageName := remaining[0]
+
+			input := dataFlag
+			if input == "" {
+				if len(remaining) > 1 {
+					input = remaining[1]
+				} else {
+					input = "-"
+				}
+			}
+
+			binaryData, err := io.ReadData(input, isBase64Flag)
+			if err != nil {
+				log.Fatalf("failed to read input data: %v", err)
+			}
+
+			edit := engine.Edit{Set: setFlags, Unset: unsetFlags}
+			if patchFlag != "" {
+				edit.Patch, err = io.ReadData(patchFlag, false)
+				if err != nil {
+					log.Fatalf("failed to read patch: %v", err)
+				}
+				edit.Patch, err = io.ToJSON(edit.Patch)
+				if err != nil {
+					log.Fatalf("failed to parse patch: %v", err)
+				}
+			}
+
+			out, changes, err := e.Edit(context.Background(), schemaFile, messageName, binaryData, versionedFlag, edit)
+			if err != nil {
+				log.Fatalf("failed to edit: %v", err)
+			}
+
+			if len(changes) == 0 {
+				fmt.Fprintln(os.Stderr, "no changes")
 			} else {
-				os.Stdout.Write(binaryData)
+				fmt.Fprint(os.Stderr, diff.Format(changes))
 			}
+			if dryRunFlag {
+				return
+			}
+
+			format := io.FormatBinary
+			if isBase64Flag {
+				format = io.FormatBase64
+			}
+			writeOutput(withMessage(io.Value{Bytes: out}, format, schemaFile, messageName, out, versionedFlag), format)
 		},
 	}
-	generateCmd.Flags().StringVarP(&dataFlag, "data", "d", "", "Input JSON data")
-	generateCmd.Flags().BoolVarP(&outputBase64Flag, "base64", "b", false, "Output base64 encoded binary")
-	generateCmd.Flags().Int32VarP(&versionNumFlag, "versioned", "V", 30, "Wrap in UntypedVersionedMessage with this version")
-	generateCmd.Flags().StringSliceVarP(&setFlags, "set", "s", nil, "Set fields using path=value (can be repeated)")
+	editCmd.Flags().StringVarP(&dataFlag, "data", "d", "", "Input data (binary or base64)")
+	editCmd.Flags().BoolVarP(&isBase64Flag, "base64", "b", false, "Read base64 input and write base64 output (unless --output is given)")
+	editCmd.Flags().BoolVarP(&versionedFlag, "versioned", "V", false, "Input is wrapped in an UntypedVersionedMessage (kept on output)")
+	editCmd.Flags().StringVarP(&patchFlag, "patch", "p", "", "JSON Patch (array) or merge patch (object), in JSON or YAML, e.g. @patch.yaml")
+	editCmd.Flags().StringArrayVarP(&setFlags, "set", "s", nil, "Set fields using path=value after the patch; a $ path is a JSONPath (can be repeated)")
+	editCmd.Flags().StringArrayVar(&unsetFlags, "unset", nil, "Remove fields or list elements by path after the patch; a $ path is a JSONPath (can be repeated)")
+	editCmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Only print the changes")
+
+	var diffCmd = &cobra.Command{
+		Use:   "diff-msg [schema-file] [message-name] [data-a] [data-b]",
+		Short: "Show the field-level differences between two binary Protobuf messages",
+		Long: `Decode two payloads with the same message type (expanding config mappings) and print
+the added (+), removed (-) and changed (~) values by field path. Exits with status 1 when they differ.`,
+		Args: cobra.RangeArgs(3, 4),
+		Run: func(cmd *cobra.Command, args []string) {
+			schemaFile, remaining, err := resolveSchemaArgs(args)
+			if err != nil {
+				log.Fatalf("error: %v", err)
+			}
+			if len(remaining) != 3 {
+				log.Fatal("expected a message name and two inputs")
+			}
+			messageName := remaining[0]
+
+			var inputs [2][]byte
+			for i, input := range remaining[1:] {
+				inputs[i], err = io.ReadData(input, isBase64Flag)
+				if err != nil {
+					log.Fatalf("failed to read input data: %v", err)
+				}
+			}
+
+			opts := diff.Options{Keys: map[string]string{}}
+			for _, k := range diffKeyFlags {
+				list, key, ok := strings.Cut(k, "=")
+				if !ok || list == "" || key == "" {
+					log.Fatalf("invalid --key '%s', expected list=field", k)
+				}
+				opts.Keys[list] = key
+			}
+
+			changes, err := e.Diff(context.Background(), schemaFile, messageName, inputs[0], inputs[1], versionedFlag, opts)
+			if err != nil {
+				log.Fatalf("failed to diff: %v", err)
+			}
+
+			format := io.FormatText
+			if jsonOutputFlag {
+				format = io.FormatJSON
+			}
+			if changes == nil {
+				changes = []diff.Change{}
+			}
+			// an empty text diff prints nothing
+			if output.FormatFor(format) != io.FormatText || len(changes) > 0 {
+				writeOutput(io.Value{Text: diff.Format(changes), JSON: changes}, format)
+			}
+			if len(changes) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	diffCmd.Flags().BoolVarP(&isBase64Flag, "base64", "b", false, "Interpret input data as base64")
+	diffCmd.Flags().BoolVarP(&versionedFlag, "versioned", "V", false, "Unwrap both inputs from UntypedVersionedMessage")
+	diffCmd.Flags().StringArrayVarP(&diffKeyFlags, "key", "k", nil, "Match elements of a list field by a key field, e.g. signatures=signedBy (can be repeated)")
+	diffCmd.Flags().BoolVar(&jsonOutputFlag, "json", false, "Print the changes as JSON (same as --output json)")
 
 	protoCmd.AddCommand(templateCmd)
 	protoCmd.AddCommand(decodeCmd)
 	protoCmd.AddCommand(generateCmd)
+	protoCmd.AddCommand(identifyCmd)
+	protoCmd.AddCommand(editCmd)
+	protoCmd.AddCommand(diffCmd)
+}
+
+// withMessage adds the parsed message to v when the selected output format renders a message
+// structure that v does not already carry as JSON.
+func withMessage(v io.Value, defaultFormat, schemaFile, messageName string, data []byte, versioned bool) io.Value {
+	format := output.FormatFor(defaultFormat)
+	if !io.Structured(format) || (format != io.FormatProtoText && v.JSON != nil) {
+		return v
+	}
+	msg, types, err := e.Message(context.Background(), schemaFile, messageName, data, versioned)
+	if err != nil {
+		log.Fatalf("failed to parse %s for output: %v", messageName, err)
+	}
+	v.Message, v.Resolver = msg, types
+	return v
+}
+
+// openRecords opens input as a stream of records, varint length-delimited or newline-separated.
+func openRecords(input string, delimited bool) (io.RecordReader, func() error) {
+	r, err := io.OpenInput(input)
+	if err != nil {
+		log.Fatalf("failed to open input: %v", err)
+	}
+	if delimited {
+		return io.NewDelimitedReader(r, 0), r.Close
+	}
+	return io.NewLineReader(r, 0), r.Close
+}
+
+// runStream processes the records of input with fn in a worker pool and writes the output of each
+// record, or what onError returns for its failure, to the shared output in input order. Records are
+// numbered from 1. It exits with status 1 if any record failed.
+func runStream(records io.RecordReader, fn func(record []byte) ([]byte, error), onError func(number int, err error) []byte) {
+	if delimitedFlag && linesFlag {
+		log.Fatal("--delimited and --lines are mutually exclusive")
+	}
+	w, err := output.Create()
+	if err != nil {
+		log.Fatalf("failed to write output: %v", err)
+	}
+	bw := bufio.NewWriter(w)
+
+	failed := 0
+	err = batch.Run(records.Next, func(_ int, record []byte) ([]byte, error) {
+		return fn(record)
+	}, func(r batch.Result) error {
+		out := r.Output
+		if r.Err != nil {
+			failed++
+			log.Printf("record %d: %v", r.Index+1, r.Err)
+			out = onError(r.Index+1, r.Err)
+		}
+		_, err := bw.Write(out)
+		return err
+	}, batch.Options{Workers: workersFlag})
+
+	if flushErr := bw.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatalf("stream failed: %v", err)
+	}
+	if failed > 0 {
+		log.Printf("%d records failed", failed)
+		os.Exit(1)
+	}
+}
+
+// decodeStream decodes every record of input and writes one JSON line per record. Failed records
+// are written as {"@record": number, "@error": message} lines.
+func decodeStream(schemaFile, messageName, input string) {
+	if format := output.FormatFor(io.FormatJSONL); format != io.FormatJSONL && format != io.FormatCompact {
+		log.Fatalf("--delimited and --lines write JSON lines, not %s", format)
+	}
+	records, closeInput := openRecords(input, delimitedFlag)
+	defer closeInput()
+
+	runStream(records, func(record []byte) ([]byte, error) {
+		if linesFlag {
+			var err error
+			if record, err = io.DecodeBase64(string(record)); err != nil {
+				return nil, err
+			}
+		}
+		out, err := e.Decode(context.Background(), schemaFile, messageName, record, versionedFlag)
+		if err != nil {
+			return nil, err
+		}
+		return io.Render(io.Value{JSON: out}, io.FormatJSONL)
+	}, func(number int, err error) []byte {
+		line, _ := io.Render(io.Value{JSON: map[string]interface{}{"@record": number, "@error": err.Error()}}, io.FormatJSONL)
+		return line
+	})
+}
+
+// generateStream serializes every JSON line of input. With --delimited the messages are written as
+// a varint length-delimited stream, and failed records are left out: the stream has no way to mark
+// them, and an empty message would read as a valid one. With --lines each message is written on its
+// own line, encoded per --output, and a failed record as an empty line so that the lines stay aligned
+// with the input.
+func generateStream(schemaFile, messageName, input string, versionNum *int32) {
+	format := output.FormatFor(io.FormatBase64)
+	if linesFlag && format != io.FormatBase64 && format != io.FormatBase64URL && format != io.FormatHex {
+		log.Fatalf("--lines writes base64, base64url or hex, not %s", format)
+	}
+	if delimitedFlag && output.Format != "" && output.Format != io.FormatBinary {
+		log.Fatalf("--delimited writes a binary stream, not %s", output.Format)
+	}
+	records, closeInput := openRecords(input, false)
+	defer closeInput()
+
+	runStream(records, func(record []byte) ([]byte, error) {
+		binaryData, err := e.Generate(context.Background(), schemaFile, messageName, record, versionNum)
+		if err != nil {
+			return nil, err
+		}
+		if delimitedFlag {
+			return io.AppendDelimited(nil, binaryData), nil
+		}
+		return io.Render(io.Value{Bytes: binaryData}, format)
+	}, func(int, error) []byte {
+		if delimitedFlag {
+			return nil
+		}
+		return []byte("\n")
+	})
 }
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"buf-lib-poc/pkg/canton"
+	"buf-lib-poc/pkg/daml/dar"
+	"buf-lib-poc/pkg/io"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	vettingParticipant string
+	vettingPackages    []string
+	vettingDars        []string
+	vettingValidFrom   string
+	vettingValidUntil  string
+	vettingBase        string
+	vettingRemove      bool
+	vettingRemoveDeps  bool
+)
+
+func initVettingCommands(prepareCmd *cobra.Command) {
+	var vettedPackagesCmd = &cobra.Command{
+		Use:   "vetted-packages",
+		Short: "Prepare a VettedPackages transaction",
+		Long: `Prepares the VettedPackages mapping of --participant. Packages are given by ID (--package) or
+taken from DARs (--dar @app.dar): all DALFs the manifest lists, with their IDs computed from the
+DALFs. --valid-from and --valid-until (RFC 3339) bound the validity of the packages given.
+
+With --base, an existing VettedPackages transaction (.prep or SignedTopologyTransaction) is
+updated instead: the packages given are added to it, or removed with --remove, and the serial
+defaults to the next one. --remove --dar removes only the main package of the DAR, as its
+dependencies (daml-stdlib, daml-prim, ...) are usually shared with other DARs; add
+--with-dependencies to remove them too. Writes <prefix>.prep and <prefix>.hash.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if outputPrefix == "" || len(vettingPackages)+len(vettingDars) == 0 {
+				log.Fatal("missing required flags: --package or --dar, --out-prefix")
+			}
+			if vettingRemove && (vettingBase == "" || vettingValidFrom != "" || vettingValidUntil != "") {
+				log.Fatal("--remove needs --base and takes no validity")
+			}
+			if vettingRemoveDeps && (!vettingRemove || len(vettingDars) == 0) {
+				log.Fatal("--with-dependencies applies to --remove --dar")
+			}
+
+			// 1. Packages given
+			ids := append([]string(nil), vettingPackages...)
+			for _, id := range ids {
+				if err := dar.ValidatePackageID(id); err != nil {
+					log.Fatal(err)
+				}
+			}
+			for _, spec := range vettingDars {
+				data, err := io.ReadData(spec, false)
+				if err != nil {
+					log.Fatalf("failed to read DAR: %v", err)
+				}
+				packages, err := dar.Read(data)
+				if err != nil {
+					log.Fatalf("%s: %v", spec, err)
+				}
+				kept := 0
+				for _, p := range packages {
+					if p.Main {
+						fmt.Printf("DAR %s: main package %s\n", spec, p.ID)
+					}
+					if vettingRemove && !p.Main && !vettingRemoveDeps {
+						kept++
+						continue
+					}
+					ids = append(ids, p.ID)
+				}
+				fmt.Printf("DAR %s: %d packages\n", spec, len(packages))
+				if kept > 0 {
+					fmt.Printf("DAR %s: keeping its %d dependencies (remove them with --with-dependencies)\n", spec, kept)
+				}
+			}
+			validity, err := validityWindow(vettingValidFrom, vettingValidUntil)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// 2. Vetted set of the base
+			var vetted []map[string]interface{}
+			participant := vettingParticipant
+			if vettingBase != "" {
+				data, err := io.ReadData(vettingBase, false)
+				if err != nil {
+					log.Fatalf("failed to read base: %v", err)
+				}
+				base, err := decodeTopologyTransaction(data)
+				if err != nil {
+					log.Fatalf("failed to decode base: %v", err)
+				}
+				mapping, _ := base["mapping"].(map[string]interface{})
+				current, ok := mapping["vettedPackages"].(map[string]interface{})
+				if !ok {
+					log.Fatal("the base is not a VettedPackages transaction")
+				}
+				baseParticipant, _ := current["participantUid"].(string)
+				if participant != "" && participant != baseParticipant {
+					log.Fatalf("--participant %s does not match the participant %s of the base", participant, baseParticipant)
+				}
+				participant = baseParticipant
+				vetted = vettedPackages(current)
+				if !cmd.Flags().Changed("serial") {
+					serial, _ := base["serial"].(float64)
+					serialFlag = int64(serial) + 1
+				}
+				fmt.Printf("Base: %d vetted packages at serial %v\n", len(vetted), base["serial"])
+			}
+			if participant == "" {
+				log.Fatal("missing required flag: --participant")
+			}
+			if _, err := canton.ParseUID(participant); err != nil {
+				log.Fatal(err)
+			}
+
+			// 3. Merge
+			index := map[string]int{}
+			for i, p := range vetted {
+				id, _ := p["packageId"].(string)
+				if id == "" {
+					log.Fatalf("vetted package %d of the base has no packageId", i)
+				}
+				index[id] = i
+			}
+			added, removed := 0, 0
+			for _, id := range ids {
+				i, ok := index[id]
+				switch {
+				case vettingRemove && !ok:
+					fmt.Printf("Package %s is not vetted\n", id)
+				case vettingRemove:
+					fmt.Printf("Removing package %s\n", id)
+					vetted[i] = nil
+					delete(index, id)
+					removed++
+				case ok:
+					vetted[i] = packageEntry(id, validity)
+				default:
+					index[id] = len(vetted)
+					vetted = append(vetted, packageEntry(id, validity))
+					added++
+				}
+			}
+			packages := []interface{}{}
+			for _, p := range vetted {
+				if p != nil {
+					packages = append(packages, p)
+				}
+			}
+			fmt.Printf("Vetting %d packages (%d added, %d removed)\n", len(packages), added, removed)
+
+			jsonData, _ := json.Marshal(map[string]interface{}{
+				"operation": "TOPOLOGY_CHANGE_OP_ADD_REPLACE",
+				"serial":    serialFlag,
+				"mapping": map[string]interface{}{
+					"vettedPackages": map[string]interface{}{
+						"participantUid": participant,
+						"packages":       packages,
+					},
+				},
+			})
+			reportPrepared(outputPrefix, "Vetted packages", prepareTransaction(jsonData, outputPrefix))
+		},
+	}
+	vettedPackagesCmd.Flags().StringVar(&vettingParticipant, "participant", "", "UID of the participant vetting the packages (default: that of --base)")
+	vettedPackagesCmd.Flags().StringSliceVar(&vettingPackages, "package", nil, "Package ID; repeatable")
+	vettedPackagesCmd.Flags().StringSliceVar(&vettingDars, "dar", nil, "DAR whose packages to vet (e.g. @app.dar); repeatable")
+	vettedPackagesCmd.Flags().StringVar(&vettingValidFrom, "valid-from", "", "Ledger time from which the packages are valid (RFC 3339, inclusive)")
+	vettedPackagesCmd.Flags().StringVar(&vettingValidUntil, "valid-until", "", "Ledger time until which the packages are valid (RFC 3339, exclusive)")
+	vettedPackagesCmd.Flags().StringVar(&vettingBase, "base", "", "Existing VettedPackages transaction to update (.prep or SignedTopologyTransaction)")
+	vettedPackagesCmd.Flags().BoolVar(&vettingRemove, "remove", false, "Remove the packages from --base instead of adding them (only the main package of a --dar)")
+	vettedPackagesCmd.Flags().BoolVar(&vettingRemoveDeps, "with-dependencies", false, "With --remove, also remove the dependencies of each --dar")
+	vettedPackagesCmd.Flags().Int64Var(&serialFlag, "serial", 1, "Transaction serial number (default with --base: the next one)")
+	vettedPackagesCmd.Flags().StringVar(&outputPrefix, "out-prefix", "", "Write <prefix>.prep and <prefix>.hash")
+
+	prepareCmd.AddCommand(vettedPackagesCmd)
+}
+
+// validityWindow returns the validFromInclusive and validUntilExclusive fields for RFC 3339 times,
+// either of which may be empty.
+func validityWindow(from, until string) (map[string]interface{}, error) {
+	window := map[string]interface{}{}
+	var times [2]time.Time
+	for i, field := range []struct{ name, value string }{{"validFromInclusive", from}, {"validUntilExclusive", until}} {
+		if field.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, field.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q: expected RFC 3339, e.g. 2025-06-01T00:00:00Z", field.value)
+		}
+		times[i] = t
+		window[field.name] = t.UTC().Format(time.RFC3339Nano)
+	}
+	if from != "" && until != "" && times[1].Before(times[0]) {
+		return nil, fmt.Errorf("--valid-until %s is before --valid-from %s", until, from)
+	}
+	return window, nil
+}
+
+// vettedPackages returns the packages of a VettedPackages mapping in JSON form, with those of the
+// deprecated packageIds field as packages without a validity window.
+func vettedPackages(mapping map[string]interface{}) []map[string]interface{} {
+	var packages []map[string]interface{}
+	ids, _ := mapping["packageIds"].([]interface{})
+	for _, id := range ids {
+		packages = append(packages, map[string]interface{}{"packageId": id})
+	}
+	list, _ := mapping["packages"].([]interface{})
+	for _, p := range list {
+		if p, ok := p.(map[string]interface{}); ok {
+			packages = append(packages, p)
+		}
+	}
+	return packages
+}
+
+func packageEntry(id string, validity map[string]interface{}) map[string]interface{} {
+	entry := map[string]interface{}{"packageId": id}
+	for k, v := range validity {
+		entry[k] = v
+	}
+	return entry
+}
@@ -4,19 +4,24 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"buf-lib-poc/pkg/config"
 	"buf-lib-poc/pkg/engine"
+	"buf-lib-poc/pkg/io"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	e *engine.Engine
+	e      *engine.Engine
+	output = &io.Output{}
 )
 
 func main() {
 	var configPath string
+	var strictInput bool
 
 	var rootCmd = &cobra.Command{
 		Use:   "proton",
@@ -38,9 +43,17 @@ func main() {
 				}
 			}
 			e = engine.NewEngine(cfg)
+
+			io.Strict = strictInput
+			if env, err := strconv.ParseBool(os.Getenv("PROTON_STRICT_INPUT")); err == nil && env {
+				io.Strict = true
+			}
 		},
 	}
 	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Path to configuration")
+	rootCmd.PersistentFlags().StringVarP(&output.Format, "output", "o", "", "Output format: "+strings.Join(io.Formats, ", ")+" (default depends on the command)")
+	rootCmd.PersistentFlags().StringVar(&output.Path, "out-file", "", "Write output to this file instead of stdout")
+	rootCmd.PersistentFlags().BoolVar(&strictInput, "strict-input", false, "Never guess the encoding of literal inputs; use hex:, base64:, base64url: or text: (also PROTON_STRICT_INPUT=1)")
 
 	// --- Command Groups ---
 
@@ -62,6 +75,8 @@ func main() {
 	// --- Initialize Subcommands ---
 	initProtoCommands(protoCmd)
 	initCantonCommands(cantonCmd)
+	initAuthCommands(cantonCmd)
+	initPartyCommands(cantonCmd)
 	initCryptoCommands(cryptoCmd)
 	initDamlCommands(rootCmd)
 
@@ -119,3 +134,19 @@ func resolveSchemaArgs(args []string) (string, []string, error) {
 
 	return "", nil, fmt.Errorf("missing schema file (checked PROTO_IMAGE, ~/.proton/proton.binpb, and current directory)")
 }
+
+// writeOutput writes a command result through the shared --output and --out-file settings.
+func writeOutput(v io.Value, defaultFormat string) {
+	if err := output.Write(v, defaultFormat); err != nil {
+		log.Fatalf("failed to write output: %v", err)
+	}
+}
+
+// deprecatedOutputFlag keeps --output as a deprecated alias of the flag named replacement, as it was
+// before --output selected the output format. The alias shadows the shared --output on cmd, so the
+// format stays selectable as -o or --output-format.
+func deprecatedOutputFlag(cmd *cobra.Command, p *string, replacement string) {
+	cmd.Flags().StringVar(p, "output", "", "Deprecated alias of --"+replacement)
+	cmd.Flags().MarkDeprecated("output", "use --"+replacement+" instead")
+	cmd.Flags().StringVarP(&output.Format, "output-format", "o", "", "Output format: "+strings.Join(io.Formats, ", ")+" (default depends on the command)")
+}
@@ -0,0 +1,222 @@
+// Package auth implements the challenge-response authentication of members towards a Canton
+// sequencer: a member asks for a challenge, signs the authentication token hash of its nonce with
+// one of the keys the sequencer expects, and exchanges the signature for a token.
+//
+// The messages are those of com/digitalasset/canton/sequencer/api/v30/sequencer_authentication_service.proto.
+// The types of this package are their JSON form; a Schema loaded from the Buf image encodes and
+// decodes them with the descriptors of the service's methods.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"buf-lib-poc/pkg/canton"
+	"buf-lib-poc/pkg/loader"
+	"buf-lib-poc/pkg/signer"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const serviceName = "com.digitalasset.canton.sequencer.api.v30.SequencerAuthenticationService"
+
+// ChallengeRequest asks the sequencer for a challenge for a member.
+type ChallengeRequest struct {
+	Member                 string  `json:"member,omitempty"`
+	MemberProtocolVersions []int32 `json:"memberProtocolVersions,omitempty"`
+}
+
+// ChallengeResponse carries the nonce to sign and the fingerprints of the keys the sequencer
+// accepts for the member.
+type ChallengeResponse struct {
+	Nonce        []byte   `json:"nonce,omitempty"`
+	Fingerprints []string `json:"fingerprints,omitempty"`
+}
+
+// Signature is a Canton signature, a com.digitalasset.canton.crypto.v30.Signature.
+type Signature struct {
+	Format               string `json:"format,omitempty"`
+	Signature            []byte `json:"signature,omitempty"`
+	SignedBy             string `json:"signedBy,omitempty"`
+	SigningAlgorithmSpec string `json:"signingAlgorithmSpec,omitempty"`
+}
+
+// AuthenticateRequest answers a challenge with a signature over its nonce.
+type AuthenticateRequest struct {
+	Member    string     `json:"member,omitempty"`
+	Signature *Signature `json:"signature,omitempty"`
+	Nonce     []byte     `json:"nonce,omitempty"`
+}
+
+// AuthenticateResponse carries the token for an authenticated member. Sequencer calls send it
+// hex-encoded.
+type AuthenticateResponse struct {
+	Token     []byte     `json:"token,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Respond answers a challenge for member on synchronizerID: it signs the authentication token hash
+// of the nonce with s (see canton.ComputeAuthenticationTokenHash) and returns the request to send.
+// The key of s must be one of the fingerprints of the challenge; signedBy names it when s cannot
+// tell its public key.
+func Respond(challenge *ChallengeResponse, member, synchronizerID string, s signer.Signer, algo, signedBy string) (*AuthenticateRequest, error) {
+	if len(challenge.Nonce) == 0 {
+		return nil, fmt.Errorf("the challenge has no nonce")
+	}
+	meta, err := canton.GetSignatureMetadata(algo)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := s.PublicKey()
+	switch {
+	case err == nil:
+		fp := canton.Fingerprint(pub.DER)
+		if signedBy != "" && signedBy != fp {
+			return nil, fmt.Errorf("the signer key is %s, not %s", fp, signedBy)
+		}
+		signedBy = fp
+	case !errors.Is(err, signer.ErrNoPublicKey):
+		return nil, err
+	case signedBy == "":
+		return nil, fmt.Errorf("the fingerprint of the signer key is required: %v", err)
+	}
+	if !slices.Contains(challenge.Fingerprints, signedBy) {
+		return nil, fmt.Errorf("the sequencer does not expect key %s for %s (expected one of %v)", signedBy, member, challenge.Fingerprints)
+	}
+
+	hash := canton.ComputeAuthenticationTokenHash(challenge.Nonce, synchronizerID)
+	sig, err := signer.Sign(s, hash, algo)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthenticateRequest{
+		Member: member,
+		Signature: &Signature{
+			Format:               meta.Format,
+			Signature:            sig,
+			SignedBy:             signedBy,
+			SigningAlgorithmSpec: meta.Algorithm,
+		},
+		Nonce: challenge.Nonce,
+	}, nil
+}
+
+// Message is implemented by the requests and responses of the service.
+type Message interface {
+	// rpc returns the method the message belongs to, and whether it is its response.
+	rpc() (method string, response bool)
+}
+
+func (*ChallengeRequest) rpc() (string, bool)     { return "Challenge", false }
+func (*ChallengeResponse) rpc() (string, bool)    { return "Challenge", true }
+func (*AuthenticateRequest) rpc() (string, bool)  { return "Authenticate", false }
+func (*AuthenticateResponse) rpc() (string, bool) { return "Authenticate", true }
+
+// Schema encodes the messages of this package as those of the sequencer authentication service of
+// a Buf image.
+type Schema struct {
+	service protoreflect.ServiceDescriptor
+}
+
+// LoadSchema loads the sequencer authentication service from the Buf image at imagePath.
+func LoadSchema(ctx context.Context, imagePath string) (*Schema, error) {
+	files, err := (&loader.SchemaLoader{}).LoadSchema(ctx, imagePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if sd := f.Services().ByName(protoreflect.FullName(serviceName).Name()); sd != nil && sd.FullName() == serviceName {
+			return &Schema{service: sd}, nil
+		}
+	}
+	return nil, fmt.Errorf("service %s not found in %s", serviceName, imagePath)
+}
+
+// descriptor returns the message descriptor of m.
+func (s *Schema) descriptor(m Message) (protoreflect.MessageDescriptor, error) {
+	name, response := m.rpc()
+	method := s.service.Methods().ByName(protoreflect.Name(name))
+	if method == nil {
+		return nil, fmt.Errorf("service %s has no method %s", serviceName, name)
+	}
+	if response {
+		return method.Output(), nil
+	}
+	return method.Input(), nil
+}
+
+// Marshal returns the protobuf encoding of m.
+func (s *Schema) Marshal(m Message) ([]byte, error) {
+	msg, err := s.toProto(m)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+// Unmarshal reads m from its protobuf encoding.
+func (s *Schema) Unmarshal(data []byte, m Message) error {
+	md, err := s.descriptor(m)
+	if err != nil {
+		return err
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("invalid %s: %v", md.Name(), err)
+	}
+	return fromProto(msg, m)
+}
+
+// Decode reads m from its protobuf encoding, or from JSON as written by the CLI.
+func (s *Schema) Decode(data []byte, m Message) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return s.Unmarshal(data, m)
+	}
+	md, err := s.descriptor(m)
+	if err != nil {
+		return err
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal(trimmed, msg); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	return fromProto(msg, m)
+}
+
+// toProto converts m to the message of the image through its JSON form.
+func (s *Schema) toProto(m Message) (*dynamicpb.Message, error) {
+	md, err := s.descriptor(m)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("cannot encode %s: %v", md.Name(), err)
+	}
+	return msg, nil
+}
+
+// fromProto converts msg to m through its JSON form.
+func fromProto(msg proto.Message, m Message) error {
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return fmt.Errorf("cannot decode %s: %v", msg.ProtoReflect().Descriptor().Name(), err)
+	}
+	return nil
+}
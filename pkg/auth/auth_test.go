@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"buf-lib-poc/pkg/canton"
+	"buf-lib-poc/pkg/signer"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestSchema(t *testing.T) {
+	schema := loadSchema(t)
+
+	// the fields the package fills in, as numbered by the image
+	tests := []struct {
+		m      Message
+		fields map[string]protoreflect.FieldNumber
+	}{
+		{&ChallengeRequest{}, map[string]protoreflect.FieldNumber{"member": 1, "member_protocol_versions": 2}},
+		{&ChallengeResponse{}, map[string]protoreflect.FieldNumber{"nonce": 1, "fingerprints": 2}},
+		{&AuthenticateRequest{}, map[string]protoreflect.FieldNumber{"member": 1, "signature": 2, "nonce": 3}},
+		{&AuthenticateResponse{}, map[string]protoreflect.FieldNumber{"token": 1, "expires_at": 2}},
+	}
+	for _, tt := range tests {
+		md, err := schema.descriptor(tt.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, number := range tt.fields {
+			if fd := md.Fields().ByName(protoreflect.Name(name)); fd == nil || fd.Number() != number {
+				t.Errorf("%s.%s: got %v, want field %d", md.FullName(), name, fd, number)
+			}
+		}
+	}
+	md, _ := schema.descriptor(&AuthenticateRequest{})
+	if sig := md.Fields().ByName("signature").Message(); sig.FullName() != "com.digitalasset.canton.crypto.v30.Signature" {
+		t.Errorf("signature is a %s", sig.FullName())
+	}
+}
+
+func TestMessages(t *testing.T) {
+	schema := loadSchema(t)
+	expiresAt := time.Unix(1700000000, 5).UTC()
+	messages := []struct {
+		m     Message
+		empty Message
+	}{
+		{&ChallengeRequest{Member: "PAR::p1::1220ab", MemberProtocolVersions: []int32{33, 34}}, &ChallengeRequest{}},
+		{&ChallengeResponse{Nonce: []byte{1, 2, 3}, Fingerprints: []string{"1220ab", "1220cd"}}, &ChallengeResponse{}},
+		{&AuthenticateRequest{
+			Member: "PAR::p1::1220ab",
+			Signature: &Signature{
+				Format:               canton.SignatureFormatDER,
+				Signature:            []byte{4, 5},
+				SignedBy:             "1220ab",
+				SigningAlgorithmSpec: "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_256",
+			},
+			Nonce: []byte{1, 2, 3},
+		}, &AuthenticateRequest{}},
+		{&AuthenticateResponse{Token: []byte{6, 7}, ExpiresAt: &expiresAt}, &AuthenticateResponse{}},
+	}
+	for _, tt := range messages {
+		data, err := schema.Marshal(tt.m)
+		if err != nil {
+			t.Fatalf("Marshal(%T) error = %v", tt.m, err)
+		}
+		if err := schema.Unmarshal(data, tt.empty); err != nil {
+			t.Fatalf("Unmarshal(%T) error = %v", tt.m, err)
+		}
+		if !reflect.DeepEqual(tt.empty, tt.m) {
+			t.Errorf("round trip = %+v, want %+v", tt.empty, tt.m)
+		}
+	}
+
+	var resp ChallengeResponse
+	if err := schema.Decode([]byte(`{"nonce": "AQID", "fingerprints": ["1220ab"]}`), &resp); err != nil || len(resp.Nonce) != 3 {
+		t.Errorf("Decode(JSON) = %+v, %v", resp, err)
+	}
+	if err := schema.Decode([]byte(`{"nonce": "AQID", "fingerprint": "1220ab"}`), &resp); err == nil {
+		t.Error("expected a field of another message to be rejected")
+	}
+	var req AuthenticateRequest
+	if err := schema.Decode([]byte(`{"signature": {"format": "SIGNATURE_FORMAT_RAW", "signingAlgorithmSpec": "RSA"}}`), &req); err == nil {
+		t.Error("expected an unknown signing algorithm to be rejected")
+	}
+}
+
+func TestFlow(t *testing.T) {
+	priv, err := canton.GenerateKey("ec-p256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := priv.Public()
+	member := "PAR::participant1::" + canton.Fingerprint(pub.DER)
+
+	schema := loadSchema(t)
+	service := NewService("synchronizer::1220ef")
+	if err := service.AddMember(member, pub.DER); err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(service, schema)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	defer server.Stop()
+
+	client, err := Dial(lis.Addr().String(), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	challenge, err := client.Challenge(ctx, &ChallengeRequest{Member: member})
+	if err != nil {
+		t.Fatalf("Challenge() error = %v", err)
+	}
+	req, err := Respond(challenge, member, service.SynchronizerID, keySigner(t, priv), "ecdsa256", "")
+	if err != nil {
+		t.Fatalf("Respond() error = %v", err)
+	}
+	resp, err := client.Authenticate(ctx, req)
+	if err != nil || len(resp.Token) != 20 || resp.ExpiresAt == nil || resp.ExpiresAt.Before(time.Now()) {
+		t.Fatalf("Authenticate() = %+v, %v", resp, err)
+	}
+
+	// nonces are single-use
+	if _, err := client.Authenticate(ctx, req); err == nil {
+		t.Error("expected a replayed answer to be rejected")
+	}
+
+	// answers signed for another synchronizer do not verify
+	challenge, _ = client.Challenge(ctx, &ChallengeRequest{Member: member})
+	req, _ = Respond(challenge, member, "other::1220ef", keySigner(t, priv), "ecdsa256", "")
+	if _, err := client.Authenticate(ctx, req); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("expected an answer for another synchronizer to be rejected, got %v", err)
+	}
+
+	// keys the sequencer does not expect are refused before signing
+	other, _ := canton.GenerateKey("ed25519")
+	if _, err := Respond(challenge, member, service.SynchronizerID, keySigner(t, other), "ed25519", ""); err == nil {
+		t.Error("expected an unexpected key to be refused")
+	}
+}
+
+func loadSchema(t *testing.T) *Schema {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+	schema, err := LoadSchema(context.Background(), imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func keySigner(t *testing.T, priv *canton.PrivateKey) signer.Signer {
+	data, err := priv.PKCS8()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := signer.NewKey(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"strings"
+	"sync"
+	"time"
+
+	"buf-lib-poc/pkg/canton"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Client calls the authentication service of a sequencer.
+type Client struct {
+	conn   *grpc.ClientConn
+	schema *Schema
+}
+
+// Dial connects to the sequencer at target: host:port in plain text, or https://host:port with TLS.
+func Dial(target string, schema *Schema) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if strings.HasPrefix(target, "https://") {
+		target = strings.TrimPrefix(target, "https://")
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, schema: schema}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Challenge requests a challenge.
+func (c *Client) Challenge(ctx context.Context, req *ChallengeRequest) (*ChallengeResponse, error) {
+	resp := &ChallengeResponse{}
+	return resp, c.invoke(ctx, req, resp)
+}
+
+// Authenticate exchanges the answer to a challenge for a token.
+func (c *Client) Authenticate(ctx context.Context, req *AuthenticateRequest) (*AuthenticateResponse, error) {
+	resp := &AuthenticateResponse{}
+	return resp, c.invoke(ctx, req, resp)
+}
+
+// invoke calls the method of req with the messages of the image.
+func (c *Client) invoke(ctx context.Context, req, resp Message) error {
+	in, err := c.schema.toProto(req)
+	if err != nil {
+		return err
+	}
+	md, err := c.schema.descriptor(resp)
+	if err != nil {
+		return err
+	}
+	out := dynamicpb.NewMessage(md)
+	method, _ := req.rpc()
+	if err := c.conn.Invoke(ctx, "/"+serviceName+"/"+method, in, out); err != nil {
+		return err
+	}
+	return fromProto(out, resp)
+}
+
+// Service is a stand-in for the authentication service of a sequencer, for tests. It hands out
+// single-use nonces to registered members and tokens for valid answers.
+type Service struct {
+	SynchronizerID string
+	TokenTTL       time.Duration
+
+	mu      sync.Mutex
+	members map[string]map[string][]byte // member -> fingerprint -> public key
+	nonces  map[string][]byte            // member -> outstanding nonce
+}
+
+// NewService returns a service for the synchronizer with no members.
+func NewService(synchronizerID string) *Service {
+	return &Service{
+		SynchronizerID: synchronizerID,
+		TokenTTL:       time.Hour,
+		members:        map[string]map[string][]byte{},
+		nonces:         map[string][]byte{},
+	}
+}
+
+// AddMember registers a member with the public keys it may authenticate with.
+func (s *Service) AddMember(member string, publicKeys ...[]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := s.members[member]
+	if keys == nil {
+		keys = map[string][]byte{}
+		s.members[member] = keys
+	}
+	for _, data := range publicKeys {
+		pub, err := canton.ParsePublicKey(data)
+		if err != nil {
+			return err
+		}
+		keys[canton.Fingerprint(pub.DER)] = pub.DER
+	}
+	return nil
+}
+
+// Challenge issues a nonce for a registered member.
+func (s *Service) Challenge(req *ChallengeRequest) (*ChallengeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, ok := s.members[req.Member]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "member %s is not known", req.Member)
+	}
+	nonce := make([]byte, 20)
+	rand.Read(nonce)
+	s.nonces[req.Member] = nonce
+	resp := &ChallengeResponse{Nonce: nonce}
+	for fp := range keys {
+		resp.Fingerprints = append(resp.Fingerprints, fp)
+	}
+	return resp, nil
+}
+
+// Authenticate checks the answer to the outstanding challenge of a member and returns a token.
+func (s *Service) Authenticate(req *AuthenticateRequest) (*AuthenticateResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nonce, ok := s.nonces[req.Member]
+	if !ok || !bytes.Equal(nonce, req.Nonce) {
+		return nil, status.Errorf(codes.Unauthenticated, "no challenge is outstanding for member %s with this nonce", req.Member)
+	}
+	delete(s.nonces, req.Member)
+
+	sig := req.Signature
+	if sig == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing signature")
+	}
+	pub, ok := s.members[req.Member][sig.SignedBy]
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "key %s is not a key of member %s", sig.SignedBy, req.Member)
+	}
+	if err := canton.CheckSignatureFormat(sig.Signature, sig.SigningAlgorithmSpec, sig.Format); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	hash := canton.ComputeAuthenticationTokenHash(nonce, s.SynchronizerID)
+	valid, err := canton.VerifySignature(hash, sig.Signature, pub, sig.SigningAlgorithmSpec)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !valid {
+		return nil, status.Error(codes.Unauthenticated, "invalid signature")
+	}
+
+	token := make([]byte, 20)
+	rand.Read(token)
+	expiresAt := time.Now().Add(s.TokenTTL).UTC().Truncate(time.Second)
+	return &AuthenticateResponse{Token: token, ExpiresAt: &expiresAt}, nil
+}
+
+// NewServer returns a gRPC server that serves s under the name of the sequencer authentication
+// service, with the messages of schema.
+func NewServer(s *Service, schema *Schema) *grpc.Server {
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: serviceName,
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "Challenge", Handler: schema.handler(func() Message { return &ChallengeRequest{} }, func(req Message) (Message, error) {
+				return s.Challenge(req.(*ChallengeRequest))
+			})},
+			{MethodName: "Authenticate", Handler: schema.handler(func() Message { return &AuthenticateRequest{} }, func(req Message) (Message, error) {
+				return s.Authenticate(req.(*AuthenticateRequest))
+			})},
+		},
+	}, s)
+	return server
+}
+
+// handler decodes the requests of a method into new messages of newReq and encodes the responses
+// of serve.
+func (schema *Schema) handler(newReq func() Message, serve func(Message) (Message, error)) grpc.MethodHandler {
+	return func(_ any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+		req := newReq()
+		md, err := schema.descriptor(req)
+		if err != nil {
+			return nil, status.Error(codes.Unimplemented, err.Error())
+		}
+		in := dynamicpb.NewMessage(md)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if err := fromProto(in, req); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		resp, err := serve(req)
+		if err != nil {
+			return nil, err
+		}
+		out, err := schema.toProto(resp)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return out, nil
+	}
+}
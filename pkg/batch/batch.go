@@ -0,0 +1,80 @@
+package batch
+
+import (
+	"io"
+	"runtime"
+)
+
+// Result is the outcome of processing one record.
+type Result struct {
+	Index  int // position of the record in the input, from 0
+	Output []byte
+	Err    error
+}
+
+// Options controls a batch run.
+type Options struct {
+	// Workers is the number of records processed concurrently (GOMAXPROCS if zero).
+	Workers int
+}
+
+// Run reads records with next until it returns io.EOF and processes each with fn on a bounded
+// pool of workers. Results are passed to emit in input order; an error from fn only fails its own
+// record. At most twice the number of workers records are held in memory at a time.
+//
+// Run stops early, returning the error, if next fails or emit returns an error. Records read before
+// a failure of next are still processed and emitted.
+func Run(next func() ([]byte, error), fn func(index int, record []byte) ([]byte, error), emit func(Result) error, opts Options) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// pending holds one channel per record in input order; its capacity bounds the records in flight
+	pending := make(chan chan Result, workers)
+	sem := make(chan struct{}, workers)
+	stop := make(chan struct{})
+	readErr := make(chan error, 1)
+
+	go func() {
+		defer close(pending)
+		for index := 0; ; index++ {
+			record, err := next()
+			if err != nil {
+				if err != io.EOF {
+					readErr <- err
+				}
+				return
+			}
+			result := make(chan Result, 1)
+			select {
+			case pending <- result:
+			case <-stop:
+				return
+			}
+			sem <- struct{}{}
+			go func(index int, record []byte) {
+				defer func() { <-sem }()
+				out, err := fn(index, record)
+				result <- Result{Index: index, Output: out, Err: err}
+			}(index, record)
+		}
+	}()
+
+	for result := range pending {
+		if err := emit(<-result); err != nil {
+			close(stop)
+			// let the reader and the workers in flight finish
+			for r := range pending {
+				<-r
+			}
+			return err
+		}
+	}
+	select {
+	case err := <-readErr:
+		return err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,112 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func records(n int) func() ([]byte, error) {
+	i := 0
+	return func() ([]byte, error) {
+		if i == n {
+			return nil, io.EOF
+		}
+		i++
+		return []byte(fmt.Sprint(i - 1)), nil
+	}
+}
+
+func TestRun_Order(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var got []Result
+	err := Run(records(200), func(index int, record []byte) ([]byte, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+		if index%7 == 3 {
+			return nil, fmt.Errorf("bad record %s", record)
+		}
+		return record, nil
+	}, func(r Result) error {
+		got = append(got, r)
+		return nil
+	}, Options{Workers: 4})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(got) != 200 {
+		t.Fatalf("expected 200 results, got %d", len(got))
+	}
+	for i, r := range got {
+		if r.Index != i {
+			t.Fatalf("result %d has index %d", i, r.Index)
+		}
+		if i%7 == 3 {
+			if r.Err == nil {
+				t.Errorf("expected record %d to fail", i)
+			}
+		} else if r.Err != nil || string(r.Output) != fmt.Sprint(i) {
+			t.Errorf("record %d: got %q, %v", i, r.Output, r.Err)
+		}
+	}
+	if maxInFlight > 4 {
+		t.Errorf("expected at most 4 records in flight, got %d", maxInFlight)
+	}
+}
+
+func TestRun_ReadError(t *testing.T) {
+	readErr := errors.New("truncated")
+	i := 0
+	next := func() ([]byte, error) {
+		if i == 3 {
+			return nil, readErr
+		}
+		i++
+		return []byte{byte(i)}, nil
+	}
+	emitted := 0
+	err := Run(next, func(_ int, record []byte) ([]byte, error) {
+		return record, nil
+	}, func(Result) error {
+		emitted++
+		return nil
+	}, Options{Workers: 2})
+	if err != readErr {
+		t.Errorf("expected the read error, got %v", err)
+	}
+	if emitted != 3 {
+		t.Errorf("expected the records read before the error to be emitted, got %d", emitted)
+	}
+}
+
+func TestRun_EmitError(t *testing.T) {
+	emitErr := errors.New("disk full")
+	emitted := 0
+	err := Run(records(100), func(_ int, record []byte) ([]byte, error) {
+		return record, nil
+	}, func(r Result) error {
+		emitted++
+		if r.Index == 5 {
+			return emitErr
+		}
+		return nil
+	}, Options{Workers: 3})
+	if err != emitErr {
+		t.Errorf("expected the emit error, got %v", err)
+	}
+	if emitted != 6 {
+		t.Errorf("expected emitting to stop at the error, got %d results", emitted)
+	}
+}
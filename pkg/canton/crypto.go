@@ -1,11 +1,11 @@
 package canton
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -15,7 +15,7 @@ import (
 // 1. Prefix with 4-byte BigEndian purpose
 // 2. SHA256
 // 3. Prefix with 0x12 (SHA256 multicodec) and 0x20 (length)
-func ComputeHash(data []byte, purpose int) []byte {
+func ComputeHash(data []byte, purpose HashPurpose) []byte {
 	prefix := make([]byte, 4)
 	binary.BigEndian.PutUint32(prefix, uint32(purpose))
 
@@ -25,45 +25,55 @@ func ComputeHash(data []byte, purpose int) []byte {
 	sum := h.Sum(nil)
 
 	// Prefix with 0x12 0x20 (multihash header for SHA256)
-	result := append([]byte{0x12, 0x20}, sum...)
+	result := append([]byte{multihashSHA256, multihashSize}, sum...)
 	return result
 }
 
 type PublicKeyInfo struct {
 	KeySpec   string
 	Format    string
-	PublicKey []byte
+	PublicKey []byte // normalized DER SubjectPublicKeyInfo
+	Detected  string // format the key was given in, one of the KeyFormat constants
 }
 
-// InspectPublicKey parses a DER-encoded public key and returns its specification.
+// InspectPublicKey parses a public key in any format accepted by ParsePublicKey and returns its
+// specification, with the key normalized to the DER SubjectPublicKeyInfo that Canton expects.
 func InspectPublicKey(data []byte) (*PublicKeyInfo, error) {
-	pub, err := x509.ParsePKIXPublicKey(data)
+	key, err := ParsePublicKey(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse public key: %v", err)
 	}
 
 	info := &PublicKeyInfo{
 		Format:    "CRYPTO_KEY_FORMAT_DER_X509_SUBJECT_PUBLIC_KEY_INFO",
-		PublicKey: data,
+		PublicKey: key.DER,
+		Detected:  key.Format,
 	}
 
+	info.KeySpec, err = keySpec(key.Key)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// keySpec returns the Canton SigningKeySpec of a public key.
+func keySpec(pub crypto.PublicKey) (string, error) {
 	switch k := pub.(type) {
 	case ed25519.PublicKey:
-		info.KeySpec = "SIGNING_KEY_SPEC_EC_CURVE25519"
+		return "SIGNING_KEY_SPEC_EC_CURVE25519", nil
 	case *ecdsa.PublicKey:
 		switch k.Curve.Params().Name {
 		case "P-256":
-			info.KeySpec = "SIGNING_KEY_SPEC_EC_P256"
+			return "SIGNING_KEY_SPEC_EC_P256", nil
 		case "P-384":
-			info.KeySpec = "SIGNING_KEY_SPEC_EC_P384"
+			return "SIGNING_KEY_SPEC_EC_P384", nil
 		default:
-			return nil, fmt.Errorf("unsupported elliptic curve: %s", k.Curve.Params().Name)
+			return "", fmt.Errorf("unsupported elliptic curve: %s", k.Curve.Params().Name)
 		}
 	default:
-		return nil, fmt.Errorf("unsupported key type: %T", k)
+		return "", fmt.Errorf("unsupported key type: %T", k)
 	}
-
-	return info, nil
 }
 
 type SignatureMetadata struct {
@@ -77,17 +87,17 @@ func GetSignatureMetadata(algo string) (*SignatureMetadata, error) {
 	case "ed25519":
 		return &SignatureMetadata{
 			Algorithm: "SIGNING_ALGORITHM_SPEC_ED25519",
-			Format:    "SIGNATURE_FORMAT_CONCAT",
+			Format:    SignatureFormatConcat,
 		}, nil
 	case "ecdsa256":
 		return &SignatureMetadata{
 			Algorithm: "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_256",
-			Format:    "SIGNATURE_FORMAT_DER",
+			Format:    SignatureFormatDER,
 		}, nil
 	case "ecdsa384":
 		return &SignatureMetadata{
 			Algorithm: "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_384",
-			Format:    "SIGNATURE_FORMAT_DER",
+			Format:    SignatureFormatDER,
 		}, nil
 	default:
 		return nil, fmt.Errorf("unsupported signature algorithm: %s", algo)
@@ -95,96 +105,92 @@ func GetSignatureMetadata(algo string) (*SignatureMetadata, error) {
 }
 
 // Fingerprint computes the Canton fingerprint for a public key.
-// It auto-detects Ed25519 keys to extract the raw 32-byte key material.
+// It auto-detects the key format; Ed25519 keys are fingerprinted by their raw 32-byte key
+// material and other keys by their DER SubjectPublicKeyInfo.
 func Fingerprint(data []byte) string {
 	var keyData []byte
 
 	// Auto-detect key type
-	pub, err := x509.ParsePKIXPublicKey(data)
+	key, err := ParsePublicKey(data)
 	if err == nil {
-		if edPub, ok := pub.(ed25519.PublicKey); ok {
+		if edPub, ok := key.Key.(ed25519.PublicKey); ok {
 			// For Ed25519, use the raw 32 bytes
 			keyData = edPub
 		} else {
-			// For other parsed keys (RSA/ECDSA), use the full raw input as per script
-			keyData = data
+			// For ECDSA keys, use the normalized DER
+			keyData = key.DER
 		}
 	} else {
 		// If parsing fails, fall back to the raw input
 		keyData = data
 	}
 
-	// 12 is the hash purpose for public key fingerprints
-	hash := ComputeHash(keyData, 12)
+	hash := ComputeHash(keyData, HashPurposePublicKeyFingerprint)
 	return hex.EncodeToString(hash)
 }
 
 // VerifySignature verifies a signature against a message and public key.
-// VerifySignature verifies a signature against a message and public key.
+// The public key may be in any format accepted by ParsePublicKey, and ECDSA signatures may be DER
+// or r||s; see CheckSignatureFormat to check them against a declared SignatureFormat.
 func VerifySignature(message, signature, publicKeyData []byte, algoSpec string) (bool, error) {
-	pub, err := x509.ParsePKIXPublicKey(publicKeyData)
+	key, err := ParsePublicKey(publicKeyData)
 	if err != nil {
 		return false, fmt.Errorf("failed to parse public key: %v", err)
 	}
+	pub := key.Key
+	if err := CheckSigningKey(pub, algoSpec); err != nil {
+		return false, err
+	}
+	input, err := SigningInput(message, algoSpec)
+	if err != nil {
+		return false, err
+	}
 
-	switch algoSpec {
-	case "SIGNING_ALGORITHM_SPEC_ED25519":
-		edPub, ok := pub.(ed25519.PublicKey)
-		if !ok {
-			return false, fmt.Errorf("not an Ed25519 public key")
-		}
-		return ed25519.Verify(edPub, message, signature), nil
-
-	case "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_256", "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_384":
-		ecPub, ok := pub.(*ecdsa.PublicKey)
-		if !ok {
-			return false, fmt.Errorf("not an ECDSA public key")
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, input, signature), nil
+	case *ecdsa.PublicKey:
+		// Accept both DER and r||s signatures
+		der, err := NormalizeSignature(signature, algoSpec, SignatureFormatDER)
+		if err != nil {
+			return false, err
 		}
-		// Hash the message (which is likely the Canton multihash) to ensure it fits the curve order
-		hash := sha256.Sum256(message)
-		return ecdsa.VerifyASN1(ecPub, hash[:], signature), nil
-
-	default:
-		return false, fmt.Errorf("unsupported signing algorithm spec: %s", algoSpec)
+		return ecdsa.VerifyASN1(pub, input, der), nil
 	}
+	return false, fmt.Errorf("unsupported key type: %T", pub)
 }
 
 // Sign signs a message using a private key (helper for testing).
+// The private key may be in any unencrypted format accepted by ParsePrivateKey.
 func Sign(message, privateKeyData []byte, algo string) ([]byte, error) {
-	switch algo {
-	case "ed25519":
-		if len(privateKeyData) == 32 {
-			priv := ed25519.NewKeyFromSeed(privateKeyData)
-			return ed25519.Sign(priv, message), nil
-		} else if len(privateKeyData) == 64 {
-			return ed25519.Sign(ed25519.PrivateKey(privateKeyData), message), nil
-		}
-		priv, err := x509.ParsePKCS8PrivateKey(privateKeyData)
-		if err == nil {
-			if edPriv, ok := priv.(ed25519.PrivateKey); ok {
-				return ed25519.Sign(edPriv, message), nil
-			}
-		}
-		return nil, fmt.Errorf("invalid ed25519 private key data")
-	case "ecdsa256", "ecdsa384":
-		priv, err := x509.ParseECPrivateKey(privateKeyData)
-		if err != nil {
-			p8, err2 := x509.ParsePKCS8PrivateKey(privateKeyData)
-			if err2 != nil {
-				return nil, fmt.Errorf("failed to parse ECDSA private key: %v", err)
-			}
-			var ok bool
-			priv, ok = p8.(*ecdsa.PrivateKey)
-			if !ok {
-				return nil, fmt.Errorf("not an ECDSA private key in PKCS8")
-			}
-		}
-		// Hash the message (which is likely the Canton multihash) to ensure it fits the curve order
-		hash := sha256.Sum256(message)
-		return ecdsa.SignASN1(rand.Reader, priv, hash[:])
-	default:
-		return nil, fmt.Errorf("unsupported signing algorithm: %s", algo)
+	key, err := ParsePrivateKey(privateKeyData, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	return key.Sign(message, algo)
+}
+
+// Sign signs a message with the key using algo (ed25519, ecdsa256, ecdsa384). It fails if the key
+// does not match the algorithm.
+func (k *PrivateKey) Sign(message []byte, algo string) ([]byte, error) {
+	meta, err := GetSignatureMetadata(algo)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckSigningKey(k.Key.Public(), meta.Algorithm); err != nil {
+		return nil, err
+	}
+	input, err := SigningInput(message, meta.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	switch priv := k.Key.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(priv, input), nil
+	case *ecdsa.PrivateKey:
+		return ecdsa.SignASN1(rand.Reader, priv, input)
 	}
+	return nil, fmt.Errorf("unsupported key type: %T", k.Key)
 }
 
 // ComputeAuthenticationTokenHash computes the hash for an authentication token.
@@ -202,7 +208,7 @@ func ComputeAuthenticationTokenHash(nonce []byte, synchronizerId string) []byte
 	payload = append(payload, lenBytes...)
 	payload = append(payload, synchIdBytes...)
 
-	// ComputeHash will prepend the 4-byte purpose (14) and hash the whole thing,
+	// ComputeHash will prepend the 4-byte purpose and hash the whole thing,
 	// then prepend the multihash header.
-	return ComputeHash(payload, 14)
+	return ComputeHash(payload, HashPurposeAuthenticationToken)
 }
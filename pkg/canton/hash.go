@@ -0,0 +1,108 @@
+package canton
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HashPurpose is the 4-byte prefix ComputeHash hashes before the data, which keeps hashes of
+// different kinds of Canton artifacts apart.
+type HashPurpose uint32
+
+// Canton hash purposes, as numbered by com.digitalasset.canton.crypto.HashPurpose. Only the
+// purposes of artifacts that are hashed or signed outside a node are listed; any other purpose of
+// that registry can be given by number.
+const (
+	HashPurposeTopologyTransaction      HashPurpose = 11
+	HashPurposePublicKeyFingerprint     HashPurpose = 12
+	HashPurposeAuthenticationToken      HashPurpose = 14
+	HashPurposePreparedSubmission       HashPurpose = 48
+	HashPurposeMultiTopologyTransaction HashPurpose = 55
+)
+
+var hashPurposeNames = map[HashPurpose]string{
+	HashPurposeTopologyTransaction:      "topology-transaction",
+	HashPurposePublicKeyFingerprint:     "public-key-fingerprint",
+	HashPurposeAuthenticationToken:      "authentication-token",
+	HashPurposePreparedSubmission:       "prepared-submission",
+	HashPurposeMultiTopologyTransaction: "multi-topology-transaction",
+}
+
+// String returns the name of a known purpose, or its number.
+func (p HashPurpose) String() string {
+	if name, ok := hashPurposeNames[p]; ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(p), 10)
+}
+
+// HashPurposes returns the known purposes in numeric order.
+func HashPurposes() []HashPurpose {
+	purposes := make([]HashPurpose, 0, len(hashPurposeNames))
+	for p := range hashPurposeNames {
+		purposes = append(purposes, p)
+	}
+	sort.Slice(purposes, func(i, j int) bool { return purposes[i] < purposes[j] })
+	return purposes
+}
+
+// ParseHashPurpose reads a purpose name, such as topology-transaction (or TopologyTransaction), or
+// a number.
+func ParseHashPurpose(s string) (HashPurpose, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return HashPurpose(n), nil
+	}
+	key := strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(s))
+	for p, name := range hashPurposeNames {
+		if strings.ReplaceAll(name, "-", "") == key {
+			return p, nil
+		}
+	}
+	names := make([]string, 0, len(hashPurposeNames))
+	for _, p := range HashPurposes() {
+		names = append(names, p.String())
+	}
+	return 0, fmt.Errorf("unknown hash purpose %q (expected a number or one of %s)", s, strings.Join(names, ", "))
+}
+
+// SHA-256 multihash header: the sha2-256 code and the digest length.
+const (
+	multihashSHA256 = 0x12
+	multihashSize   = 0x20
+)
+
+// ParseMultihash validates a Canton hash, a SHA-256 multihash given as 34 bytes or as their hex
+// form (e.g. a fingerprint), and returns its 32-byte digest.
+func ParseMultihash(data []byte) ([]byte, error) {
+	// a binary multihash starts with 0x12, which is never a hex digit
+	if decoded, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil && len(decoded) > 0 {
+		data = decoded
+	}
+	if len(data) < 2 || data[0] != multihashSHA256 {
+		return nil, fmt.Errorf("not a SHA-256 multihash: expected it to start with 12 20")
+	}
+	if data[1] != multihashSize || len(data) != 2+multihashSize {
+		return nil, fmt.Errorf("invalid SHA-256 multihash: expected a 32-byte digest, got length %d with %d bytes", data[1], len(data)-2)
+	}
+	return data[2:], nil
+}
+
+// MultiTransactionHash combines the hashes of several topology transactions into the hash that a
+// single signature authorizes them all with: the hashes are sorted, prefixed with their count and
+// each with its length (4-byte big endian), and hashed for HashPurposeMultiTopologyTransaction.
+func MultiTransactionHash(hashes [][]byte) []byte {
+	sorted := append([][]byte(nil), hashes...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(sorted)))
+	for _, h := range sorted {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(h)))
+		data = append(data, h...)
+	}
+	return ComputeHash(data, HashPurposeMultiTopologyTransaction)
+}
@@ -0,0 +1,118 @@
+package canton
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseHashPurpose(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    HashPurpose
+		wantErr bool
+	}{
+		{input: "topology-transaction", want: HashPurposeTopologyTransaction},
+		{input: "TopologyTransaction", want: HashPurposeTopologyTransaction},
+		{input: "MULTI_TOPOLOGY_TRANSACTION", want: HashPurposeMultiTopologyTransaction},
+		{input: "12", want: HashPurposePublicKeyFingerprint},
+		{input: "42", want: 42},
+		{input: "fingerprint", wantErr: true},
+		{input: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseHashPurpose(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHashPurpose() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseHashPurpose() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if s := HashPurpose(42).String(); s != "42" {
+		t.Errorf("String() = %s, want 42", s)
+	}
+}
+
+// TestHashPurposes pins the ids and names of the registry: the ids are part of every hash.
+//
+// The registry does not yet mirror every purpose of com.digitalasset.canton.crypto.HashPurpose:
+// only the ids above have been checked against Canton. Add the others here together with their
+// constants, each id copied from the upstream HashPurpose object, never renumbered.
+func TestHashPurposes(t *testing.T) {
+	want := []struct {
+		purpose HashPurpose
+		id      uint32
+		name    string
+	}{
+		{HashPurposeTopologyTransaction, 11, "topology-transaction"},
+		{HashPurposePublicKeyFingerprint, 12, "public-key-fingerprint"},
+		{HashPurposeAuthenticationToken, 14, "authentication-token"},
+		{HashPurposePreparedSubmission, 48, "prepared-submission"},
+		{HashPurposeMultiTopologyTransaction, 55, "multi-topology-transaction"},
+	}
+	got := HashPurposes()
+	if len(got) != len(want) {
+		t.Fatalf("HashPurposes() = %v, want %d purposes", got, len(want))
+	}
+	for i, w := range want {
+		if got[i] != w.purpose || uint32(w.purpose) != w.id || w.purpose.String() != w.name {
+			t.Errorf("purpose %d = %d %s, want %d %s", i, uint32(got[i]), got[i], w.id, w.name)
+		}
+		if p, err := ParseHashPurpose(w.name); err != nil || p != w.purpose {
+			t.Errorf("ParseHashPurpose(%s) = %d, %v", w.name, p, err)
+		}
+	}
+}
+
+func TestParseMultihash(t *testing.T) {
+	hash := ComputeHash([]byte("data"), HashPurposeTopologyTransaction)
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr bool
+	}{
+		{name: "binary", input: hash},
+		{name: "hex", input: []byte(hex.EncodeToString(hash) + "\n")},
+		{name: "digest without header", input: hash[2:], wantErr: true},
+		{name: "other hash function", input: append([]byte{0x13, 0x20}, hash[2:]...), wantErr: true},
+		{name: "wrong length", input: hash[:33], wantErr: true},
+		{name: "short hex", input: []byte("1220abcd"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest, err := ParseMultihash(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMultihash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(digest, hash[2:]) {
+				t.Errorf("ParseMultihash() = %x, want %x", digest, hash[2:])
+			}
+		})
+	}
+}
+
+func TestMultiTransactionHash(t *testing.T) {
+	h1 := ComputeHash([]byte("tx1"), HashPurposeTopologyTransaction)
+	h2 := ComputeHash([]byte("tx2"), HashPurposeTopologyTransaction)
+	first, second := h1, h2
+	if bytes.Compare(h1, h2) > 0 {
+		first, second = h2, h1
+	}
+
+	// count, then each hash prefixed with its length, in sorted order
+	data := []byte{0, 0, 0, 2, 0, 0, 0, 34}
+	data = append(data, first...)
+	data = append(data, 0, 0, 0, 34)
+	data = append(data, second...)
+	want := ComputeHash(data, HashPurposeMultiTopologyTransaction)
+
+	if got := MultiTransactionHash([][]byte{h1, h2}); !bytes.Equal(got, want) {
+		t.Errorf("MultiTransactionHash() = %x, want %x", got, want)
+	}
+	if got := MultiTransactionHash([][]byte{h2, h1}); !bytes.Equal(got, want) {
+		t.Errorf("MultiTransactionHash() depends on the order of the hashes: %x", got)
+	}
+}
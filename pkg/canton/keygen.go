@@ -0,0 +1,145 @@
+package canton
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KeygenSpecs maps the key specs accepted by GenerateKey to Canton SigningKeySpec values.
+var KeygenSpecs = map[string]string{
+	"ed25519": "SIGNING_KEY_SPEC_EC_CURVE25519",
+	"ec-p256": "SIGNING_KEY_SPEC_EC_P256",
+	"ec-p384": "SIGNING_KEY_SPEC_EC_P384",
+}
+
+// keyUsages maps short usage names to Canton SigningKeyUsage values.
+var keyUsages = map[string]string{
+	"namespace":                "SIGNING_KEY_USAGE_NAMESPACE",
+	"identity-delegation":      "SIGNING_KEY_USAGE_IDENTITY_DELEGATION",
+	"sequencer-authentication": "SIGNING_KEY_USAGE_SEQUENCER_AUTHENTICATION",
+	"protocol":                 "SIGNING_KEY_USAGE_PROTOCOL",
+	"proof-of-ownership":       "SIGNING_KEY_USAGE_PROOF_OF_OWNERSHIP",
+}
+
+// GenerateKey creates a new signing key of the given spec: ed25519, ec-p256 or ec-p384.
+func GenerateKey(spec string) (*PrivateKey, error) {
+	switch spec {
+	case "ed25519":
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &PrivateKey{Key: priv}, nil
+	case "ec-p256", "ec-p384":
+		curve := elliptic.P256()
+		if spec == "ec-p384" {
+			curve = elliptic.P384()
+		}
+		priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &PrivateKey{Key: priv}, nil
+	}
+	return nil, fmt.Errorf("unsupported key spec %q, expected one of %s", spec, strings.Join(sortedKeys(KeygenSpecs), ", "))
+}
+
+// PKCS8 returns the key as DER PKCS#8 PrivateKeyInfo.
+func (k *PrivateKey) PKCS8() ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(k.Key)
+}
+
+// PEM returns the key as an unencrypted PEM PKCS#8 private key.
+func (k *PrivateKey) PEM() ([]byte, error) {
+	der, err := k.PKCS8()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseKeyUsage converts a comma-separated list of usages, given by short name (namespace, protocol,
+// ...) or as SigningKeyUsage values, into SigningKeyUsage values.
+func ParseKeyUsage(list string) ([]string, error) {
+	var usages []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if usage, ok := keyUsages[strings.ToLower(name)]; ok {
+			usages = append(usages, usage)
+			continue
+		}
+		found := false
+		for _, usage := range keyUsages {
+			if usage == name {
+				usages, found = append(usages, usage), true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown key usage %q, expected one of %s", name, strings.Join(sortedKeys(keyUsages), ", "))
+		}
+	}
+	if len(usages) == 0 {
+		return nil, fmt.Errorf("at least one key usage is required")
+	}
+	return usages, nil
+}
+
+// SigningPublicKeyJSON returns the protojson form of a com.digitalasset.canton.crypto.v30.SigningPublicKey.
+func SigningPublicKeyJSON(pub *PublicKey, usage []string) (map[string]interface{}, error) {
+	spec, err := keySpec(pub.Key)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"format":    "CRYPTO_KEY_FORMAT_DER_X509_SUBJECT_PUBLIC_KEY_INFO",
+		"publicKey": pub.DER,
+		"keySpec":   spec,
+		"usage":     usage,
+	}, nil
+}
+
+// SigningKeyPairJSON returns the protojson form of a com.digitalasset.canton.crypto.v30.SigningKeyPair,
+// with the private key as PKCS#8 and identified by the fingerprint of its public key.
+func SigningKeyPairJSON(priv *PrivateKey, usage []string) (map[string]interface{}, error) {
+	pub, err := priv.Public()
+	if err != nil {
+		return nil, err
+	}
+	spec, err := keySpec(pub.Key)
+	if err != nil {
+		return nil, err
+	}
+	der, err := priv.PKCS8()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"privateKey": map[string]interface{}{
+			"id":         Fingerprint(pub.DER),
+			"format":     "CRYPTO_KEY_FORMAT_DER_PKCS8_PRIVATE_KEY_INFO",
+			"privateKey": der,
+			"keySpec":    spec,
+			"usage":      usage,
+		},
+	}, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package canton
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerateKey(t *testing.T) {
+	message := ComputeHash([]byte("transaction"), HashPurposeTopologyTransaction)
+	tests := []struct {
+		spec string
+		algo string
+		alg  string
+	}{
+		{"ed25519", "ed25519", "SIGNING_ALGORITHM_SPEC_ED25519"},
+		{"ec-p256", "ecdsa256", "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_256"},
+		{"ec-p384", "ecdsa384", "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_384"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			priv, err := GenerateKey(tt.spec)
+			if err != nil {
+				t.Fatalf("GenerateKey() error = %v", err)
+			}
+			pub, err := priv.Public()
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := InspectPublicKey(pub.DER)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.KeySpec != KeygenSpecs[tt.spec] {
+				t.Errorf("KeySpec = %s, want %s", info.KeySpec, KeygenSpecs[tt.spec])
+			}
+
+			// the encoded private keys must read back and sign for the public key
+			for _, encode := range []func() ([]byte, error){priv.PKCS8, priv.PEM} {
+				data, err := encode()
+				if err != nil {
+					t.Fatal(err)
+				}
+				sig, err := Sign(message, data, tt.algo)
+				if err != nil {
+					t.Fatalf("Sign() error = %v", err)
+				}
+				if valid, err := VerifySignature(message, sig, pub.DER, tt.alg); err != nil || !valid {
+					t.Errorf("VerifySignature() = %v, %v", valid, err)
+				}
+			}
+
+			pair, err := SigningKeyPairJSON(priv, []string{"SIGNING_KEY_USAGE_NAMESPACE"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id := pair["privateKey"].(map[string]interface{})["id"]; id != Fingerprint(pub.DER) {
+				t.Errorf("key pair id = %v, want the fingerprint %s", id, Fingerprint(pub.DER))
+			}
+		})
+	}
+
+	if _, err := GenerateKey("rsa"); err == nil {
+		t.Error("expected an error for an unsupported spec")
+	}
+}
+
+func TestParseKeyUsage(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{"namespace", []string{"SIGNING_KEY_USAGE_NAMESPACE"}, false},
+		{"namespace, Protocol", []string{"SIGNING_KEY_USAGE_NAMESPACE", "SIGNING_KEY_USAGE_PROTOCOL"}, false},
+		{"SIGNING_KEY_USAGE_SEQUENCER_AUTHENTICATION", []string{"SIGNING_KEY_USAGE_SEQUENCER_AUTHENTICATION"}, false},
+		{"", nil, true},
+		{"signing", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseKeyUsage(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseKeyUsage(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseKeyUsage(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
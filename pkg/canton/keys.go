@@ -0,0 +1,428 @@
+package canton
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Key formats detected on input.
+const (
+	KeyFormatDERSPKI             = "der-spki"
+	KeyFormatDERPKCS8            = "der-pkcs8"
+	KeyFormatDERSEC1             = "der-sec1"
+	KeyFormatPEMSPKI             = "pem-spki"
+	KeyFormatPEMCertificate      = "pem-certificate"
+	KeyFormatPEMPKCS8            = "pem-pkcs8"
+	KeyFormatPEMEncryptedPKCS8   = "pem-encrypted-pkcs8"
+	KeyFormatPEMSEC1             = "pem-sec1"
+	KeyFormatOpenSSHPublic       = "openssh-public"
+	KeyFormatOpenSSHPrivate      = "openssh-private"
+	KeyFormatRawEd25519          = "raw-ed25519"
+	KeyFormatRawEd25519Seed      = "raw-ed25519-seed"
+	KeyFormatRawEd25519Private   = "raw-ed25519-private"
+	KeyFormatECPointUncompressed = "ec-point-uncompressed"
+	KeyFormatECPointCompressed   = "ec-point-compressed"
+)
+
+// ErrPassphraseRequired is returned for an encrypted private key when no passphrase is available.
+var ErrPassphraseRequired = errors.New("private key is encrypted, a passphrase is required")
+
+// PublicKey is a public key parsed from any supported format.
+type PublicKey struct {
+	Key    crypto.PublicKey
+	DER    []byte // DER X.509 SubjectPublicKeyInfo
+	Format string // detected input format, one of the KeyFormat constants
+}
+
+// PrivateKey is a private key parsed from any supported format.
+type PrivateKey struct {
+	Key    crypto.Signer // ed25519.PrivateKey or *ecdsa.PrivateKey
+	Format string        // detected input format, one of the KeyFormat constants
+}
+
+// Public returns the public half of the key.
+func (k *PrivateKey) Public() (*PublicKey, error) {
+	return newPublicKey(k.Key.Public(), k.Format)
+}
+
+// Passphrase supplies the passphrase of an encrypted private key when one is found.
+type Passphrase func() ([]byte, error)
+
+// ParsePublicKey reads a public key in any of the supported formats: DER or PEM
+// SubjectPublicKeyInfo, a PEM certificate, an OpenSSH public key line, a raw 32-byte Ed25519 key,
+// or an uncompressed or compressed P-256/P-384 point. Unencrypted private keys are also accepted
+// and yield their public key.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	if isPEM(data) {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid PEM data")
+		}
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse PEM public key: %v", err)
+			}
+			return newPublicKey(pub, KeyFormatPEMSPKI)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse PEM certificate: %v", err)
+			}
+			return newPublicKey(cert.PublicKey, KeyFormatPEMCertificate)
+		}
+		priv, err := ParsePrivateKey(data, nil)
+		if err != nil {
+			return nil, err
+		}
+		return priv.Public()
+	}
+	if isOpenSSHPublic(data) {
+		return parseOpenSSHPublic(data)
+	}
+	if pub, err := x509.ParsePKIXPublicKey(data); err == nil {
+		return newPublicKey(pub, KeyFormatDERSPKI)
+	}
+	switch {
+	case len(data) == ed25519.PublicKeySize:
+		return newPublicKey(ed25519.PublicKey(data), KeyFormatRawEd25519)
+	case (len(data) == 65 || len(data) == 97) && data[0] == 4:
+		return parseECPoint(data)
+	case (len(data) == 33 || len(data) == 49) && (data[0] == 2 || data[0] == 3):
+		return parseECPoint(data)
+	}
+	if priv, err := parseDERPrivateKey(data); err == nil {
+		return priv.Public()
+	}
+	return nil, fmt.Errorf("unrecognized public key format (%d bytes): expected DER or PEM SubjectPublicKeyInfo, an OpenSSH public key, a raw Ed25519 key or an EC point", len(data))
+}
+
+// ParsePrivateKey reads a private key in any of the supported formats: DER or PEM PKCS#8 or SEC1,
+// encrypted PEM PKCS#8 (PBES2), an OpenSSH private key, or a raw Ed25519 seed or
+// 64-byte private key. passphrase is called only for encrypted keys and may be nil.
+func ParsePrivateKey(data []byte, passphrase Passphrase) (*PrivateKey, error) {
+	if isPEM(data) {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid PEM data")
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			return parsePKCS8(block.Bytes, KeyFormatPEMPKCS8)
+		case "EC PRIVATE KEY":
+			if x509.IsEncryptedPEMBlock(block) {
+				return nil, fmt.Errorf("legacy encrypted PEM keys are not supported, convert to encrypted PKCS#8 with 'openssl pkcs8 -topk8'")
+			}
+			key, err := x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse PEM EC private key: %v", err)
+			}
+			return &PrivateKey{Key: key, Format: KeyFormatPEMSEC1}, nil
+		case "ENCRYPTED PRIVATE KEY":
+			if passphrase == nil {
+				return nil, ErrPassphraseRequired
+			}
+			pass, err := passphrase()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read passphrase: %v", err)
+			}
+			der, err := decryptPKCS8(block.Bytes, pass)
+			if err != nil {
+				return nil, err
+			}
+			return parsePKCS8(der, KeyFormatPEMEncryptedPKCS8)
+		case "OPENSSH PRIVATE KEY":
+			return parseOpenSSHPrivate(data, passphrase)
+		case "PUBLIC KEY", "CERTIFICATE":
+			return nil, fmt.Errorf("expected a private key, found a PEM %s", strings.ToLower(block.Type))
+		default:
+			return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+		}
+	}
+	if priv, err := parseDERPrivateKey(data); err == nil {
+		return priv, nil
+	}
+	switch len(data) {
+	case ed25519.SeedSize:
+		return &PrivateKey{Key: ed25519.NewKeyFromSeed(data), Format: KeyFormatRawEd25519Seed}, nil
+	case ed25519.PrivateKeySize:
+		return &PrivateKey{Key: ed25519.PrivateKey(data), Format: KeyFormatRawEd25519Private}, nil
+	}
+	return nil, fmt.Errorf("unrecognized private key format (%d bytes): expected DER or PEM PKCS#8 or SEC1, an OpenSSH private key or a raw Ed25519 key", len(data))
+}
+
+func newPublicKey(pub crypto.PublicKey, format string) (*PublicKey, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+	case *ecdsa.PublicKey:
+		if name := k.Curve.Params().Name; name != "P-256" && name != "P-384" {
+			return nil, fmt.Errorf("unsupported elliptic curve: %s", name)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type: %T", k)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %v", err)
+	}
+	return &PublicKey{Key: pub, DER: der, Format: format}, nil
+}
+
+func isPEM(data []byte) bool {
+	return bytes.Contains(data, []byte("-----BEGIN "))
+}
+
+func parsePKCS8(der []byte, format string) (*PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#8 private key: %v", err)
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return &PrivateKey{Key: k, Format: format}, nil
+	case *ecdsa.PrivateKey:
+		return &PrivateKey{Key: k, Format: format}, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type: %T", key)
+}
+
+func parseDERPrivateKey(data []byte) (*PrivateKey, error) {
+	if key, err := x509.ParseECPrivateKey(data); err == nil {
+		return &PrivateKey{Key: key, Format: KeyFormatDERSEC1}, nil
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(data); err != nil {
+		return nil, err
+	}
+	return parsePKCS8(data, KeyFormatDERPKCS8)
+}
+
+func parseECPoint(data []byte) (*PublicKey, error) {
+	var curve elliptic.Curve
+	switch len(data) {
+	case 65, 33:
+		curve = elliptic.P256()
+	default:
+		curve = elliptic.P384()
+	}
+	var x, y *big.Int
+	format := KeyFormatECPointUncompressed
+	if data[0] == 4 {
+		x, y = elliptic.Unmarshal(curve, data)
+	} else {
+		format = KeyFormatECPointCompressed
+		x, y = elliptic.UnmarshalCompressed(curve, data)
+	}
+	if x == nil {
+		return nil, fmt.Errorf("invalid %s point", curve.Params().Name)
+	}
+	return newPublicKey(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, format)
+}
+
+// OpenSSH keys
+
+func isOpenSSHPublic(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("ssh-ed25519 ")) || bytes.HasPrefix(data, []byte("ecdsa-sha2-nistp"))
+}
+
+func parseOpenSSHPublic(data []byte) (*PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenSSH public key: %v", err)
+	}
+	// ParseAuthorizedKey reads the type from the key data, not from the line
+	if keyType := strings.Fields(string(data))[0]; keyType != key.Type() {
+		return nil, fmt.Errorf("OpenSSH key type %q does not match its data (%q)", keyType, key.Type())
+	}
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported OpenSSH key type %q", key.Type())
+	}
+	pub := cryptoKey.CryptoPublicKey()
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() && k.Curve != elliptic.P384() {
+			return nil, fmt.Errorf("unsupported OpenSSH key type %q", key.Type())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported OpenSSH key type %q", key.Type())
+	}
+	return newPublicKey(pub, KeyFormatOpenSSHPublic)
+}
+
+// parseOpenSSHPrivate reads the openssh-key-v1 format written by ssh-keygen, which checks that the
+// private key matches the public key stored with it.
+func parseOpenSSHPrivate(data []byte, passphrase Passphrase) (*PrivateKey, error) {
+	raw, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == nil {
+			return nil, ErrPassphraseRequired
+		}
+		pass, perr := passphrase()
+		if perr != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %v", perr)
+		}
+		raw, err = ssh.ParseRawPrivateKeyWithPassphrase(data, pass)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenSSH private key: %v", err)
+	}
+	var key crypto.Signer
+	switch k := raw.(type) {
+	case *ed25519.PrivateKey:
+		key = *k
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() && k.Curve != elliptic.P384() {
+			return nil, fmt.Errorf("unsupported OpenSSH ECDSA curve %s", k.Curve.Params().Name)
+		}
+		key = k
+	default:
+		return nil, fmt.Errorf("unsupported OpenSSH key type %T", raw)
+	}
+	return &PrivateKey{Key: key, Format: KeyFormatOpenSSHPrivate}, nil
+}
+
+// Encrypted PKCS#8 (RFC 5958 EncryptedPrivateKeyInfo with PBES2 from RFC 8018)
+
+var (
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// maxPBKDF2Iterations bounds the iteration count taken from an encrypted key file, which would
+// otherwise let a crafted key keep the CPU busy for hours. OpenSSL uses 2048 by default.
+const maxPBKDF2Iterations = 10_000_000
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %s, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s, only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("invalid PBKDF2 parameters: %v", err)
+	}
+	if kdf.IterationCount < 1 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("unsupported PBKDF2 iteration count %d (expected 1 to %d)", kdf.IterationCount, maxPBKDF2Iterations)
+	}
+
+	var prf func() hash.Hash
+	switch alg := kdf.PRF.Algorithm; {
+	case len(alg) == 0 || alg.Equal(oidHMACSHA1):
+		prf = sha1.New
+	case alg.Equal(oidHMACSHA224):
+		prf = sha256.New224
+	case alg.Equal(oidHMACSHA256):
+		prf = sha256.New
+	case alg.Equal(oidHMACSHA384):
+		prf = sha512.New384
+	case alg.Equal(oidHMACSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudo-random function %s", alg)
+	}
+
+	var keyLen int
+	var newCipher func([]byte) (cipher.Block, error)
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case alg.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case alg.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case alg.Equal(oidDESEDE3CBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, fmt.Errorf("unsupported private key cipher %s", alg)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("invalid cipher parameters: %v", err)
+	}
+
+	key, err := pbkdf2.Key(prf, string(passphrase), kdf.Salt, kdf.IterationCount, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := info.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("invalid encrypted private key data")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// a wrong passphrase shows up as invalid padding, or as data that is not a private key
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, fmt.Errorf("failed to decrypt private key: incorrect passphrase")
+	}
+	plain = plain[:len(plain)-pad]
+	if _, err := x509.ParsePKCS8PrivateKey(plain); err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: incorrect passphrase")
+	}
+	return plain, nil
+}
@@ -0,0 +1,155 @@
+package canton
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SynchronizerParameterDefaults returns the JSON form of the DynamicSynchronizerParameters a
+// synchronizer starts with: the initial values of com.digitalasset.canton.protocol.DynamicSynchronizerParameters
+// in Canton 3 (initialValues and its default* constants). Traffic control is off.
+func SynchronizerParameterDefaults() map[string]interface{} {
+	return map[string]interface{}{
+		"confirmationResponseTimeout":         "30s",
+		"mediatorReactionTimeout":             "30s",
+		"assignmentExclusivityTimeout":        "60s",
+		"ledgerTimeRecordTimeTolerance":       "60s",
+		"reconciliationInterval":              "60s",
+		"mediatorDeduplicationTimeout":        "172800s",
+		"maxRequestSize":                      10485760,
+		"onboardingRestriction":               "ONBOARDING_RESTRICTION_UNRESTRICTED_OPEN",
+		"participantSynchronizerLimits":       map[string]interface{}{"confirmationRequestsMaxRate": 1000000},
+		"sequencerAggregateSubmissionTimeout": "3600s",
+		"acsCommitmentsCatchup":               map[string]interface{}{"catchupIntervalSkip": 5, "nrIntervalsToTriggerCatchup": 2},
+		"preparationTimeRecordTimeTolerance":  "86400s",
+	}
+}
+
+// CheckSynchronizerParameters validates DynamicSynchronizerParameters in JSON form. It returns an
+// error listing the values a synchronizer would reject or that would stall it, and warnings for
+// values that are valid but unusual.
+func CheckSynchronizerParameters(params map[string]interface{}) (warnings []string, err error) {
+	var problems []string
+	fail := func(format string, args ...interface{}) { problems = append(problems, fmt.Sprintf(format, args...)) }
+	warn := func(format string, args ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, args...)) }
+
+	durations := map[string]time.Duration{}
+	for _, name := range []string{
+		"confirmationResponseTimeout", "mediatorReactionTimeout", "assignmentExclusivityTimeout",
+		"ledgerTimeRecordTimeTolerance", "reconciliationInterval", "mediatorDeduplicationTimeout",
+		"sequencerAggregateSubmissionTimeout", "preparationTimeRecordTimeTolerance",
+	} {
+		d, present, err := jsonDuration(params[name])
+		if err != nil {
+			fail("%s: %v", name, err)
+			continue
+		}
+		if !present {
+			// a synchronizer rejects parameters without any of these durations
+			fail("%s must be set", name)
+			continue
+		}
+		if d < 0 {
+			fail("%s must not be negative, got %s", name, d)
+		}
+		durations[name] = d
+	}
+
+	// confirmation requests time out after the confirmation response and mediator reaction timeouts
+	for _, name := range []string{"confirmationResponseTimeout", "mediatorReactionTimeout", "reconciliationInterval"} {
+		if d, ok := durations[name]; ok && d <= 0 {
+			fail("%s must be positive", name)
+		} else if ok && name != "reconciliationInterval" && d > 5*time.Minute {
+			warn("%s is %s: requests that are not confirmed hold the resources of every participant involved this long", name, d)
+		}
+	}
+	// DynamicSynchronizerParameters requires the mediator to deduplicate requests for as long as
+	// their preparation time may lie before or after the record time
+	dedup, ok := durations["mediatorDeduplicationTimeout"]
+	if tolerance, toleranceOk := durations["preparationTimeRecordTimeTolerance"]; ok && toleranceOk && dedup < 2*tolerance {
+		fail("mediatorDeduplicationTimeout (%s) must be at least twice preparationTimeRecordTimeTolerance (%s)", dedup, tolerance)
+	}
+
+	if size, err := jsonInt(params["maxRequestSize"]); err != nil || size <= 0 {
+		fail("maxRequestSize must be a positive number of bytes")
+	}
+	if restriction, _ := params["onboardingRestriction"].(string); restriction == "" || strings.HasSuffix(restriction, "_UNSPECIFIED") {
+		fail("onboardingRestriction must be set")
+	}
+	if catchup, ok := params["acsCommitmentsCatchup"].(map[string]interface{}); ok {
+		for _, name := range []string{"catchupIntervalSkip", "nrIntervalsToTriggerCatchup"} {
+			if n, err := jsonInt(catchup[name]); err != nil || n < 1 {
+				fail("acsCommitmentsCatchup.%s must be at least 1", name)
+			}
+		}
+	}
+
+	if traffic, ok := params["trafficControl"].(map[string]interface{}); ok {
+		amount, err := jsonInt(traffic["maxBaseTrafficAmount"])
+		if err != nil || amount < 0 {
+			fail("trafficControl.maxBaseTrafficAmount must be a non-negative number of bytes")
+		}
+		if cost, err := jsonInt(traffic["baseEventCost"]); err != nil || cost < 0 {
+			fail("trafficControl.baseEventCost must be a non-negative number of bytes")
+		}
+		if factor, err := jsonInt(traffic["readVsWriteScalingFactor"]); err != nil || factor < 0 {
+			fail("trafficControl.readVsWriteScalingFactor must be a non-negative number of parts per 10000")
+		} else if factor > 10000 {
+			warn("trafficControl.readVsWriteScalingFactor is %d: reads cost more than writes", factor)
+		}
+		accumulation, present, err := jsonDuration(traffic["maxBaseTrafficAccumulationDuration"])
+		if err != nil || accumulation < 0 {
+			fail("trafficControl.maxBaseTrafficAccumulationDuration must be a non-negative duration")
+		} else if !present {
+			fail("trafficControl.maxBaseTrafficAccumulationDuration must be set")
+		} else if amount > 0 && accumulation == 0 {
+			fail("trafficControl.maxBaseTrafficAccumulationDuration must be positive with a base traffic amount, which accumulates over it")
+		}
+		if window, present, err := jsonDuration(traffic["setBalanceRequestSubmissionWindowSize"]); err != nil || !present || window <= 0 {
+			fail("trafficControl.setBalanceRequestSubmissionWindowSize must be positive")
+		}
+		if enforce, _ := traffic["enforceRateLimiting"].(bool); enforce && amount == 0 {
+			warn("trafficControl enforces rate limiting without base traffic: members can only submit with purchased traffic")
+		}
+	}
+
+	if len(problems) > 0 {
+		return warnings, fmt.Errorf("invalid synchronizer parameters:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return warnings, nil
+}
+
+// jsonDuration reads a google.protobuf.Duration in JSON form, such as "1.5s". A Duration is a
+// message, so a zero duration is written as "0s" and present reports whether v was given at all.
+func jsonDuration(v interface{}) (d time.Duration, present bool, err error) {
+	if v == nil {
+		return 0, false, nil
+	}
+	s, ok := v.(string)
+	if !ok || !strings.HasSuffix(s, "s") {
+		return 0, true, fmt.Errorf("invalid duration %v", v)
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSuffix(s, "s"), 64)
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid duration %v", v)
+	}
+	return time.Duration(seconds * float64(time.Second)), true, nil
+}
+
+// jsonInt reads an integer in JSON form: a number, or a string for 64-bit fields. Absent values are
+// 0, as proto3 JSON omits scalar fields with their zero value.
+func jsonInt(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return int64(n), nil
+	case int:
+		return int64(n), nil
+	case string:
+		return strconv.ParseInt(n, 10, 64)
+	}
+	return 0, fmt.Errorf("invalid integer %v", v)
+}
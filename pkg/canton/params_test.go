@@ -0,0 +1,95 @@
+package canton
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckSynchronizerParameters(t *testing.T) {
+	traffic := func() map[string]interface{} {
+		return map[string]interface{}{
+			"maxBaseTrafficAmount":                  "20000",
+			"maxBaseTrafficAccumulationDuration":    "600s",
+			"readVsWriteScalingFactor":              float64(200),
+			"setBalanceRequestSubmissionWindowSize": "300s",
+			"enforceRateLimiting":                   true,
+		}
+	}
+	tests := []struct {
+		name    string
+		set     map[string]interface{}
+		wantErr string
+		warning string
+	}{
+		{name: "defaults"},
+		{name: "traffic control", set: map[string]interface{}{"trafficControl": traffic()}},
+		{name: "long confirmation timeout", set: map[string]interface{}{"confirmationResponseTimeout": "900s"}, warning: "confirmationResponseTimeout"},
+		{name: "zero confirmation timeout", set: map[string]interface{}{"confirmationResponseTimeout": "0s"}, wantErr: "confirmationResponseTimeout must be positive"},
+		{name: "missing mediator timeout", set: map[string]interface{}{"mediatorReactionTimeout": nil}, wantErr: "mediatorReactionTimeout must be set"},
+		{name: "zero tolerance", set: map[string]interface{}{"preparationTimeRecordTimeTolerance": "0s"}},
+		{name: "deduplication of the tolerance", set: map[string]interface{}{"mediatorDeduplicationTimeout": "7200s", "preparationTimeRecordTimeTolerance": "3600s"}},
+		{name: "missing tolerance", set: map[string]interface{}{"preparationTimeRecordTimeTolerance": nil}, wantErr: "preparationTimeRecordTimeTolerance must be set"},
+		{name: "missing deduplication", set: map[string]interface{}{"mediatorDeduplicationTimeout": nil}, wantErr: "mediatorDeduplicationTimeout must be set"},
+		{name: "negative duration", set: map[string]interface{}{"assignmentExclusivityTimeout": "-1s"}, wantErr: "must not be negative"},
+		{name: "invalid duration", set: map[string]interface{}{"reconciliationInterval": "1m"}, wantErr: "invalid duration"},
+		{name: "deduplication too short", set: map[string]interface{}{"mediatorDeduplicationTimeout": "3600s"}, wantErr: "at least twice"},
+		{name: "no request size", set: map[string]interface{}{"maxRequestSize": float64(0)}, wantErr: "maxRequestSize"},
+		{name: "unspecified onboarding", set: map[string]interface{}{"onboardingRestriction": "ONBOARDING_RESTRICTION_UNSPECIFIED"}, wantErr: "onboardingRestriction"},
+		{name: "no catch-up skip", set: map[string]interface{}{"acsCommitmentsCatchup": map[string]interface{}{"nrIntervalsToTriggerCatchup": float64(2)}}, wantErr: "catchupIntervalSkip"},
+		{name: "traffic without accumulation", set: map[string]interface{}{"trafficControl": func() map[string]interface{} {
+			tc := traffic()
+			delete(tc, "maxBaseTrafficAccumulationDuration")
+			return tc
+		}()}, wantErr: "maxBaseTrafficAccumulationDuration must be set"},
+		{name: "traffic without accumulation time", set: map[string]interface{}{"trafficControl": func() map[string]interface{} {
+			tc := traffic()
+			tc["maxBaseTrafficAccumulationDuration"] = "0s"
+			return tc
+		}()}, wantErr: "maxBaseTrafficAccumulationDuration must be positive"},
+		{name: "traffic without window", set: map[string]interface{}{"trafficControl": func() map[string]interface{} {
+			tc := traffic()
+			tc["setBalanceRequestSubmissionWindowSize"] = "0s"
+			return tc
+		}()}, wantErr: "setBalanceRequestSubmissionWindowSize"},
+		{name: "rate limiting without base traffic", set: map[string]interface{}{"trafficControl": func() map[string]interface{} {
+			tc := traffic()
+			tc["maxBaseTrafficAmount"] = "0"
+			return tc
+		}()}, warning: "purchased traffic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := normalized(SynchronizerParameterDefaults())
+			for k, v := range tt.set {
+				if v == nil {
+					delete(params, k)
+				} else {
+					params[k] = v
+				}
+			}
+			warnings, err := CheckSynchronizerParameters(params)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected an error about %s, got %v", tt.wantErr, err)
+			}
+			if got := strings.Join(warnings, "\n"); (tt.warning == "") != (got == "") || !strings.Contains(got, tt.warning) {
+				t.Errorf("expected a warning about %q, got %q", tt.warning, got)
+			}
+		})
+	}
+}
+
+// normalized converts the integers of the defaults to the float64 of decoded JSON.
+func normalized(params map[string]interface{}) map[string]interface{} {
+	for k, v := range params {
+		switch v := v.(type) {
+		case int:
+			params[k] = float64(v)
+		case map[string]interface{}:
+			params[k] = normalized(v)
+		}
+	}
+	return params
+}
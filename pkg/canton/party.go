@@ -0,0 +1,88 @@
+package canton
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParticipantPermissions maps short names to the Enums.ParticipantPermission values a participant
+// can host a party with.
+var ParticipantPermissions = map[string]string{
+	"submission":   "PARTICIPANT_PERMISSION_SUBMISSION",
+	"confirmation": "PARTICIPANT_PERMISSION_CONFIRMATION",
+	"observation":  "PARTICIPANT_PERMISSION_OBSERVATION",
+}
+
+// HostingParticipant is a participant that hosts a party, as in a PartyToParticipant mapping.
+type HostingParticipant struct {
+	ParticipantUID string `json:"participantUid"`
+	Permission     string `json:"permission"`
+}
+
+// ParseHostingParticipant parses uid:permission, where uid is the UID of the participant (or its
+// member ID, PAR::uid) and permission is submission, confirmation or observation, or an
+// Enums.ParticipantPermission value. Without a permission, the participant confirms.
+func ParseHostingParticipant(spec string) (HostingParticipant, error) {
+	uid, permission := spec, ParticipantPermissions["confirmation"]
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		if p, ok := parsePermission(spec[i+1:]); ok {
+			uid, permission = spec[:i], p
+		}
+	}
+	if member, err := ParseMember(uid); err == nil {
+		if member.Code != "PAR" {
+			return HostingParticipant{}, fmt.Errorf("%s is not a participant", uid)
+		}
+		uid = member.UID.String()
+	}
+	if _, err := ParseUID(uid); err != nil {
+		return HostingParticipant{}, fmt.Errorf("invalid participant %q: %v", spec, err)
+	}
+	return HostingParticipant{ParticipantUID: uid, Permission: permission}, nil
+}
+
+func parsePermission(name string) (string, bool) {
+	if p, ok := ParticipantPermissions[strings.ToLower(name)]; ok {
+		return p, true
+	}
+	for _, p := range ParticipantPermissions {
+		if p == name {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// ValidateHosting checks the participants and confirmation threshold of a PartyToParticipant
+// mapping: the participants are distinct, the threshold is between 1 and the number of
+// participants that confirm, and with a threshold above 1 no participant has submission
+// permission. Parties hosted only by observers need no confirmation, so any threshold of 1 passes.
+func ValidateHosting(participants []HostingParticipant, threshold int) error {
+	if len(participants) == 0 {
+		return fmt.Errorf("at least one hosting participant is required")
+	}
+	seen := map[string]bool{}
+	confirming := 0
+	for _, p := range participants {
+		if seen[p.ParticipantUID] {
+			return fmt.Errorf("participant %s is listed more than once", p.ParticipantUID)
+		}
+		seen[p.ParticipantUID] = true
+		if p.Permission != ParticipantPermissions["observation"] {
+			confirming++
+		}
+		if threshold > 1 && p.Permission == ParticipantPermissions["submission"] {
+			return fmt.Errorf("participant %s cannot have submission permission with a threshold of %d (use confirmation)", p.ParticipantUID, threshold)
+		}
+	}
+	if threshold < 1 {
+		return fmt.Errorf("threshold must be at least 1, got %d", threshold)
+	}
+	if confirming > 0 && threshold > confirming {
+		return fmt.Errorf("threshold %d exceeds the %d confirming participants", threshold, confirming)
+	}
+	if confirming == 0 && threshold > 1 {
+		return fmt.Errorf("threshold %d needs confirming participants, but all participants observe", threshold)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package canton
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHostingParticipant(t *testing.T) {
+	ns := "1220" + strings.Repeat("ab", 32)
+	tests := []struct {
+		input   string
+		want    HostingParticipant
+		wantErr bool
+	}{
+		{input: "participant1::" + ns + ":submission", want: HostingParticipant{"participant1::" + ns, "PARTICIPANT_PERMISSION_SUBMISSION"}},
+		{input: "participant1::" + ns + ":Observation", want: HostingParticipant{"participant1::" + ns, "PARTICIPANT_PERMISSION_OBSERVATION"}},
+		{input: "participant1::" + ns + ":PARTICIPANT_PERMISSION_CONFIRMATION", want: HostingParticipant{"participant1::" + ns, "PARTICIPANT_PERMISSION_CONFIRMATION"}},
+		{input: "participant1::" + ns, want: HostingParticipant{"participant1::" + ns, "PARTICIPANT_PERMISSION_CONFIRMATION"}},
+		{input: "PAR::participant1::" + ns + ":confirmation", want: HostingParticipant{"participant1::" + ns, "PARTICIPANT_PERMISSION_CONFIRMATION"}},
+		{input: "MED::mediator1::" + ns, wantErr: true},
+		{input: "participant1::" + ns + ":admin", wantErr: true},
+		{input: "participant1:submission", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseHostingParticipant(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHostingParticipant() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseHostingParticipant() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateHosting(t *testing.T) {
+	p := func(name, permission string) HostingParticipant {
+		return HostingParticipant{name + "::1220ab", ParticipantPermissions[permission]}
+	}
+	tests := []struct {
+		name         string
+		participants []HostingParticipant
+		threshold    int
+		wantErr      bool
+	}{
+		{name: "single submitter", participants: []HostingParticipant{p("p1", "submission")}, threshold: 1},
+		{name: "consortium", participants: []HostingParticipant{p("p1", "confirmation"), p("p2", "confirmation"), p("p3", "observation")}, threshold: 2},
+		{name: "observers only", participants: []HostingParticipant{p("p1", "observation")}, threshold: 1},
+		{name: "no participants", threshold: 1, wantErr: true},
+		{name: "zero threshold", participants: []HostingParticipant{p("p1", "confirmation")}, threshold: 0, wantErr: true},
+		{name: "threshold above confirmers", participants: []HostingParticipant{p("p1", "confirmation"), p("p2", "observation")}, threshold: 2, wantErr: true},
+		{name: "submitter in consortium", participants: []HostingParticipant{p("p1", "submission"), p("p2", "confirmation")}, threshold: 2, wantErr: true},
+		{name: "duplicate", participants: []HostingParticipant{p("p1", "confirmation"), p("p1", "observation")}, threshold: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateHosting(tt.participants, tt.threshold); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateHosting() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package canton
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Canton SignatureFormat values.
+const (
+	SignatureFormatDER    = "SIGNATURE_FORMAT_DER"    // ASN.1 DER SEQUENCE { r, s } for ECDSA
+	SignatureFormatConcat = "SIGNATURE_FORMAT_CONCAT" // fixed-size r||s for ECDSA, R||S for Ed25519
+	SignatureFormatRaw    = "SIGNATURE_FORMAT_RAW"    // legacy: DER for ECDSA, R||S for Ed25519
+)
+
+// signingKeySpecs maps each SigningAlgorithmSpec to the SigningKeySpec it signs with.
+var signingKeySpecs = map[string]string{
+	"SIGNING_ALGORITHM_SPEC_ED25519":        "SIGNING_KEY_SPEC_EC_CURVE25519",
+	"SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_256": "SIGNING_KEY_SPEC_EC_P256",
+	"SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_384": "SIGNING_KEY_SPEC_EC_P384",
+}
+
+// CheckSigningKey reports an error if pub cannot be used with algoSpec, as Canton would reject
+// the signature, e.g. a P-384 key with SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_256.
+func CheckSigningKey(pub crypto.PublicKey, algoSpec string) error {
+	want, ok := signingKeySpecs[algoSpec]
+	if !ok {
+		return fmt.Errorf("unsupported signing algorithm spec: %s", algoSpec)
+	}
+	spec, err := keySpec(pub)
+	if err != nil {
+		return err
+	}
+	if spec != want {
+		return fmt.Errorf("%s key cannot be used with %s (requires %s)", spec, algoSpec, want)
+	}
+	return nil
+}
+
+// SigningInput returns what the signature primitive signs for message under algoSpec. Canton signs
+// the bytes of a hash (e.g. ComputeHash) as a message: Ed25519 signs it directly, ECDSA its SHA-256
+// or SHA-384 digest (JCA SHA256withECDSA and SHA384withECDSA).
+func SigningInput(message []byte, algoSpec string) ([]byte, error) {
+	switch algoSpec {
+	case "SIGNING_ALGORITHM_SPEC_ED25519":
+		return message, nil
+	case "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_256":
+		digest := sha256.Sum256(message)
+		return digest[:], nil
+	case "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_384":
+		digest := sha512.Sum384(message)
+		return digest[:], nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm spec: %s", algoSpec)
+}
+
+// ParseSignatureFormat maps der, concat or raw, or a full SignatureFormat enum name, to the enum name.
+func ParseSignatureFormat(name string) (string, error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIGNATURE_FORMAT_") {
+	case "DER":
+		return SignatureFormatDER, nil
+	case "CONCAT":
+		return SignatureFormatConcat, nil
+	case "RAW":
+		return SignatureFormatRaw, nil
+	}
+	return "", fmt.Errorf("unsupported signature format: %s (expected der, concat or raw)", name)
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// SignatureCurve returns the curve of an ECDSA SigningAlgorithmSpec, or nil for Ed25519.
+func SignatureCurve(algoSpec string) (elliptic.Curve, error) {
+	switch algoSpec {
+	case "SIGNING_ALGORITHM_SPEC_ED25519":
+		return nil, nil
+	case "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_256":
+		return elliptic.P256(), nil
+	case "SIGNING_ALGORITHM_SPEC_EC_DSA_SHA_384":
+		return elliptic.P384(), nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm spec: %s", algoSpec)
+}
+
+// ParseECDSASignature reads an ECDSA signature on curve in DER or concat (r||s) form and returns
+// r, s and the format it was in. DER signatures must be canonical: minimally encoded, with no
+// trailing data. r and s must be in [1, n-1].
+func ParseECDSASignature(sig []byte, curve elliptic.Curve) (r, s *big.Int, format string, err error) {
+	size := (curve.Params().BitSize + 7) / 8
+	var parsed ecdsaSignature
+	if rest, derErr := asn1.Unmarshal(sig, &parsed); derErr == nil {
+		if len(rest) > 0 {
+			return nil, nil, "", fmt.Errorf("DER signature has %d bytes of trailing data", len(rest))
+		}
+		// re-encoding detects non-canonical DER, such as long-form lengths
+		if canonical, _ := asn1.Marshal(parsed); !bytes.Equal(canonical, sig) {
+			return nil, nil, "", fmt.Errorf("DER signature is not canonically encoded")
+		}
+		r, s, format = parsed.R, parsed.S, SignatureFormatDER
+	} else if len(sig) == 2*size {
+		r, s, format = new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:]), SignatureFormatConcat
+	} else {
+		return nil, nil, "", fmt.Errorf("invalid %s ECDSA signature: neither DER nor %d-byte r||s (%d bytes)", curve.Params().Name, 2*size, len(sig))
+	}
+
+	n := curve.Params().N
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return nil, nil, "", fmt.Errorf("ECDSA signature values are out of range for %s", curve.Params().Name)
+	}
+	return r, s, format, nil
+}
+
+// EncodeECDSASignature encodes r and s in format: SIGNATURE_FORMAT_DER (or RAW) or SIGNATURE_FORMAT_CONCAT.
+func EncodeECDSASignature(r, s *big.Int, curve elliptic.Curve, format string) ([]byte, error) {
+	switch format {
+	case SignatureFormatDER, SignatureFormatRaw:
+		return asn1.Marshal(ecdsaSignature{R: r, S: s})
+	case SignatureFormatConcat:
+		size := (curve.Params().BitSize + 7) / 8
+		out := make([]byte, 2*size)
+		r.FillBytes(out[:size])
+		s.FillBytes(out[size:])
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported ECDSA signature format: %s", format)
+}
+
+// IsHighS reports whether s is in the upper half of the curve order. Such signatures are valid
+// ECDSA and accepted by Canton, but some verifiers require the low-S form n - s.
+func IsHighS(s *big.Int, curve elliptic.Curve) bool {
+	half := new(big.Int).Rsh(curve.Params().N, 1)
+	return s.Cmp(half) > 0
+}
+
+// LowS returns the low-S form of s.
+func LowS(s *big.Int, curve elliptic.Curve) *big.Int {
+	if !IsHighS(s, curve) {
+		return s
+	}
+	return new(big.Int).Sub(curve.Params().N, s)
+}
+
+// DetectSignatureFormat returns the form a signature for algoSpec is in: SIGNATURE_FORMAT_DER or
+// SIGNATURE_FORMAT_CONCAT.
+func DetectSignatureFormat(sig []byte, algoSpec string) (string, error) {
+	curve, err := SignatureCurve(algoSpec)
+	if err != nil {
+		return "", err
+	}
+	if curve == nil {
+		if len(sig) != 64 {
+			return "", fmt.Errorf("invalid Ed25519 signature: expected 64 bytes, got %d", len(sig))
+		}
+		return SignatureFormatConcat, nil
+	}
+	_, _, format, err := ParseECDSASignature(sig, curve)
+	return format, err
+}
+
+// NormalizeSignature converts a signature for algoSpec, in either DER or concat form, into format.
+// An empty format selects the default of the algorithm (see GetSignatureMetadata). Ed25519 signatures
+// only exist in concat form, which SIGNATURE_FORMAT_RAW also denotes for them.
+func NormalizeSignature(sig []byte, algoSpec, format string) ([]byte, error) {
+	curve, err := SignatureCurve(algoSpec)
+	if err != nil {
+		return nil, err
+	}
+	if curve == nil {
+		if format != "" && format != SignatureFormatConcat && format != SignatureFormatRaw {
+			return nil, fmt.Errorf("Ed25519 signatures cannot be in %s", format)
+		}
+		if _, err := DetectSignatureFormat(sig, algoSpec); err != nil {
+			return nil, err
+		}
+		return sig, nil
+	}
+	if format == "" {
+		format = SignatureFormatDER
+	}
+	r, s, _, err := ParseECDSASignature(sig, curve)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeECDSASignature(r, s, curve, format)
+}
+
+// CheckSignatureFormat reports an error if sig is not in the declared format, as Canton would
+// reject it. SIGNATURE_FORMAT_RAW is the legacy format: DER for ECDSA, concat for Ed25519.
+func CheckSignatureFormat(sig []byte, algoSpec, format string) error {
+	detected, err := DetectSignatureFormat(sig, algoSpec)
+	if err != nil {
+		return err
+	}
+	want := format
+	if format == SignatureFormatRaw {
+		want = SignatureFormatDER
+		if algoSpec == "SIGNING_ALGORITHM_SPEC_ED25519" {
+			want = SignatureFormatConcat
+		}
+	}
+	if detected != want {
+		return fmt.Errorf("signature is in %s form but declared as %s", detected, format)
+	}
+	return nil
+}
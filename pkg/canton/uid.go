@@ -0,0 +1,122 @@
+package canton
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UIDDelimiter separates the identifier and namespace of a unique identifier, and the code and
+// unique identifier of a member.
+const UIDDelimiter = "::"
+
+// MaxIdentifierLength is the longest identifier Canton accepts in a unique identifier, which leaves
+// room for the delimiter and a 68-character namespace fingerprint within the 255 characters of a
+// Daml party ID.
+const MaxIdentifierLength = 185
+
+// MemberCodes maps the prefixes of member IDs to the kind of member.
+var MemberCodes = map[string]string{
+	"PAR": "participant",
+	"MED": "mediator",
+	"SEQ": "sequencer",
+}
+
+// UID is a Canton unique identifier, identifier::namespace. Party IDs are UIDs; the namespace is
+// the fingerprint of the root key of the namespace.
+type UID struct {
+	Identifier string `json:"identifier"`
+	Namespace  string `json:"namespace"`
+}
+
+func (u UID) String() string {
+	return u.Identifier + UIDDelimiter + u.Namespace
+}
+
+// NewUID validates identifier and namespace and returns their UID.
+func NewUID(identifier, namespace string) (UID, error) {
+	if err := ValidateIdentifier(identifier); err != nil {
+		return UID{}, err
+	}
+	if err := ValidateFingerprint(namespace); err != nil {
+		return UID{}, fmt.Errorf("invalid namespace: %v", err)
+	}
+	return UID{Identifier: identifier, Namespace: namespace}, nil
+}
+
+// ParseUID parses and validates identifier::namespace.
+func ParseUID(s string) (UID, error) {
+	i := strings.LastIndex(s, UIDDelimiter)
+	if i < 0 {
+		return UID{}, fmt.Errorf("invalid unique identifier %q: expected identifier::namespace", s)
+	}
+	uid, err := NewUID(s[:i], s[i+len(UIDDelimiter):])
+	if err != nil {
+		return UID{}, fmt.Errorf("invalid unique identifier %q: %v", s, err)
+	}
+	return uid, nil
+}
+
+// PartyID returns the party ID for hint in the namespace of a public key (in any format accepted by
+// ParsePublicKey). For an external party this is the key the party signs its topology with.
+func PartyID(hint string, namespaceKey []byte) (UID, error) {
+	key, err := ParsePublicKey(namespaceKey)
+	if err != nil {
+		return UID{}, fmt.Errorf("invalid namespace key: %v", err)
+	}
+	return NewUID(hint, Fingerprint(key.DER))
+}
+
+// ValidateIdentifier checks the identifier of a UID, such as a party hint: 1 to 185 characters out
+// of letters, digits, '-', '_', ':' and space, without the "::" delimiter or a trailing ':' that
+// would run into it.
+func ValidateIdentifier(id string) error {
+	if id == "" {
+		return fmt.Errorf("identifier is empty")
+	}
+	if len(id) > MaxIdentifierLength {
+		return fmt.Errorf("identifier is %d characters long, at most %d are allowed", len(id), MaxIdentifierLength)
+	}
+	for i, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == ':' || c == ' ') {
+			return fmt.Errorf("identifier %q has the invalid character %q at %d (allowed: letters, digits, '-', '_', ':' and space)", id, c, i)
+		}
+	}
+	if strings.Contains(id, UIDDelimiter) || strings.HasSuffix(id, ":") {
+		return fmt.Errorf("identifier %q must not contain %q or end with ':'", id, UIDDelimiter)
+	}
+	return nil
+}
+
+// ValidateFingerprint checks that fp is a key fingerprint: a SHA-256 multihash in lowercase hex.
+func ValidateFingerprint(fp string) error {
+	if fp != strings.ToLower(fp) {
+		return fmt.Errorf("fingerprint %q must be lowercase hex", fp)
+	}
+	if _, err := ParseMultihash([]byte(fp)); err != nil || len(fp) != 2*(2+multihashSize) {
+		return fmt.Errorf("%q is not a fingerprint (1220 followed by 64 hex digits)", fp)
+	}
+	return nil
+}
+
+// Member is a member ID, CODE::identifier::namespace.
+type Member struct {
+	Code string `json:"code"`
+	UID  UID    `json:"uid"`
+}
+
+func (m Member) String() string {
+	return m.Code + UIDDelimiter + m.UID.String()
+}
+
+// ParseMember parses and validates a member ID such as PAR::participant1::1220...
+func ParseMember(s string) (Member, error) {
+	code, rest, ok := strings.Cut(s, UIDDelimiter)
+	if _, known := MemberCodes[code]; !ok || !known {
+		return Member{}, fmt.Errorf("invalid member %q: expected PAR::, MED:: or SEQ:: followed by a unique identifier", s)
+	}
+	uid, err := ParseUID(rest)
+	if err != nil {
+		return Member{}, err
+	}
+	return Member{Code: code, UID: uid}, nil
+}
@@ -0,0 +1,74 @@
+package canton
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseUID(t *testing.T) {
+	ns := "1220" + strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		input   string
+		want    UID
+		wantErr bool
+	}{
+		{name: "party", input: "alice::" + ns, want: UID{"alice", ns}},
+		{name: "allowed characters", input: "Alice Smith-1_x:y::" + ns, want: UID{"Alice Smith-1_x:y", ns}},
+		{name: "longest identifier", input: strings.Repeat("a", MaxIdentifierLength) + "::" + ns, want: UID{strings.Repeat("a", MaxIdentifierLength), ns}},
+		{name: "identifier too long", input: strings.Repeat("a", MaxIdentifierLength+1) + "::" + ns, wantErr: true},
+		{name: "empty identifier", input: "::" + ns, wantErr: true},
+		{name: "invalid character", input: "al.ice::" + ns, wantErr: true},
+		{name: "delimiter in identifier", input: "a::b::" + ns, wantErr: true},
+		{name: "trailing colon", input: "alice:::" + ns, wantErr: true},
+		{name: "no delimiter", input: "alice", wantErr: true},
+		{name: "short namespace", input: "alice::" + ns[:66], wantErr: true},
+		{name: "uppercase namespace", input: "alice::" + strings.ToUpper(ns), wantErr: true},
+		{name: "not a multihash", input: "alice::1320" + ns[4:], wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseUID(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseUID() = %v, want %v", got, tt.want)
+			}
+			if err == nil && got.String() != tt.input {
+				t.Errorf("String() = %s, want %s", got, tt.input)
+			}
+		})
+	}
+}
+
+func TestParseMember(t *testing.T) {
+	ns := "1220" + strings.Repeat("cd", 32)
+	member, err := ParseMember("PAR::participant1::" + ns)
+	if err != nil || member.Code != "PAR" || member.UID.Identifier != "participant1" {
+		t.Errorf("ParseMember() = %+v, %v", member, err)
+	}
+	for _, invalid := range []string{"participant1::" + ns, "XYZ::p1::" + ns, "PAR::" + ns} {
+		if _, err := ParseMember(invalid); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
+
+func TestPartyID(t *testing.T) {
+	priv, err := GenerateKey("ed25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := priv.Public()
+	party, err := PartyID("alice", pub.DER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if party.Namespace != Fingerprint(pub.DER) {
+		t.Errorf("namespace = %s, want the key fingerprint %s", party.Namespace, Fingerprint(pub.DER))
+	}
+	if _, err := PartyID("alice", []byte("not a key")); err == nil {
+		t.Error("expected an invalid key to be rejected")
+	}
+}
@@ -2,20 +2,47 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path"
 )
 
+// Mapping describes a bytes field that holds a serialized message.
+// Type and Field accept glob patterns (e.g. "com.digitalasset.canton.protocol.v30.*"), and Field may
+// also name a oneof, in which case the mapping applies to every bytes member of that oneof.
+// Repeated bytes fields and maps with bytes values are expanded element by element.
 type Mapping struct {
-	Type           string `json:"type"`            // Source message type
-	Field          string `json:"field"`           // Field name of type bytes
-	TargetType     string `json:"target_type"`     // Target message type to decode/encode
-	Versioned      bool   `json:"versioned"`       // Whether it uses UntypedVersionedMessage
-	DefaultVersion int32  `json:"default_version"` // Version to use for generate
+	Type           string            `json:"type"`                    // Source message type (or pattern)
+	Field          string            `json:"field"`                   // Field name of type bytes (or pattern, or oneof name)
+	TargetType     string            `json:"target_type"`             // Target message type to decode/encode
+	Versioned      bool              `json:"versioned"`               // Whether it uses UntypedVersionedMessage
+	DefaultVersion int32             `json:"default_version"`         // Version to use for generate
+	Discriminator  string            `json:"discriminator,omitempty"` // Sibling field (or oneof) selecting the target type
+	Targets        map[string]string `json:"targets,omitempty"`       // Discriminator value -> target type
+	SignedBy       []string          `json:"signed_by,omitempty"`     // Sibling fields holding signatures over the bytes
+}
+
+// Renderer formats; see Renderer.
+const (
+	RenderHex       = "hex"        // bytes as lowercase hex (e.g. multihashes, signatures)
+	RenderPublicKey = "public-key" // DER public key bytes as {fingerprint, keySpec, der}
+	RenderTimestamp = "timestamp"  // integer microseconds since epoch as RFC3339
+)
+
+// Renderer selects a human-friendly JSON form for matching fields on decode.
+// Generate accepts the rendered form back as well as the plain protojson form.
+type Renderer struct {
+	Type   string `json:"type"`   // Message type (or pattern)
+	Field  string `json:"field"`  // Field name (or pattern)
+	Format string `json:"format"` // One of hex, public-key, timestamp
 }
 
 type Config struct {
-	Aliases  map[string]string `json:"aliases"`
-	Mappings []Mapping         `json:"mappings"`
+	Aliases            map[string]string  `json:"aliases"`
+	Mappings           []Mapping          `json:"mappings"`
+	Renderers          []Renderer         `json:"renderers"`
+	IdentifyCandidates []string           `json:"identify_candidates"` // Messages tried by `proto identify` (default: all)
+	SupportedVersions  map[string][]int32 `json:"supported_versions"`  // Message type -> allowed UntypedVersionedMessage versions
 }
 
 func (c *Config) ResolveAlias(name string) string {
@@ -28,6 +55,131 @@ func (c *Config) ResolveAlias(name string) string {
 	return name
 }
 
+// FindMapping returns the mapping registered for the given message type and field.
+// oneofName is the name of the oneof containing the field, or empty.
+// Exact matches take precedence over patterns; otherwise the first matching mapping wins.
+func (c *Config) FindMapping(typeName, fieldName, oneofName string) *Mapping {
+	if c == nil {
+		return nil
+	}
+	for i := range c.Mappings {
+		m := &c.Mappings[i]
+		if m.Type == typeName && (m.Field == fieldName || (oneofName != "" && m.Field == oneofName)) {
+			return m
+		}
+	}
+	for i := range c.Mappings {
+		if c.Mappings[i].matches(typeName, fieldName, oneofName) {
+			return &c.Mappings[i]
+		}
+	}
+	return nil
+}
+
+func (m *Mapping) matches(typeName, fieldName, oneofName string) bool {
+	if ok, _ := path.Match(m.Type, typeName); !ok {
+		return false
+	}
+	if ok, _ := path.Match(m.Field, fieldName); ok {
+		return true
+	}
+	return oneofName != "" && m.Field == oneofName
+}
+
+// FindRenderer returns the first renderer matching the given message type and field name, if any.
+func (c *Config) FindRenderer(typeName, fieldName string) *Renderer {
+	if c == nil {
+		return nil
+	}
+	for i := range c.Renderers {
+		r := &c.Renderers[i]
+		if ok, _ := path.Match(r.Type, typeName); !ok {
+			continue
+		}
+		if ok, _ := path.Match(r.Field, fieldName); ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// ResolveTarget returns the target type for the given discriminator value,
+// falling back to TargetType. An empty result means the field is left as bytes.
+func (m *Mapping) ResolveTarget(discriminatorValue string) string {
+	if m.Discriminator != "" {
+		if target, ok := m.Targets[discriminatorValue]; ok {
+			return target
+		}
+	}
+	return m.TargetType
+}
+
+// CheckVersion returns an error if the supported-versions table lists the type without the given version.
+// Types absent from the table accept any version.
+func (c *Config) CheckVersion(typeName string, version int32) error {
+	if c == nil {
+		return nil
+	}
+	versions, ok := c.SupportedVersions[typeName]
+	if !ok {
+		return nil
+	}
+	for _, v := range versions {
+		if v == version {
+			return nil
+		}
+	}
+	return fmt.Errorf("version %d is not supported for %s (supported: %v)", version, typeName, versions)
+}
+
+// Validate checks that every mapping is complete and that its patterns are well-formed.
+func (c *Config) Validate() error {
+	for i, m := range c.Mappings {
+		if m.Type == "" || m.Field == "" {
+			return fmt.Errorf("mapping %d: type and field are required", i)
+		}
+		if _, err := path.Match(m.Type, ""); err != nil {
+			return fmt.Errorf("mapping %d: invalid type pattern %q: %v", i, m.Type, err)
+		}
+		if _, err := path.Match(m.Field, ""); err != nil {
+			return fmt.Errorf("mapping %d: invalid field pattern %q: %v", i, m.Field, err)
+		}
+		if m.TargetType == "" && len(m.Targets) == 0 {
+			return fmt.Errorf("mapping %d (%s.%s): target_type or targets is required", i, m.Type, m.Field)
+		}
+		if len(m.Targets) > 0 && m.Discriminator == "" {
+			return fmt.Errorf("mapping %d (%s.%s): targets requires a discriminator", i, m.Type, m.Field)
+		}
+		for _, field := range m.SignedBy {
+			if field == "" {
+				return fmt.Errorf("mapping %d (%s.%s): signed_by: empty field name", i, m.Type, m.Field)
+			}
+		}
+		if m.Versioned && m.TargetType != "" {
+			if err := c.CheckVersion(m.TargetType, m.DefaultVersion); err != nil {
+				return fmt.Errorf("mapping %d (%s.%s): default_version: %v", i, m.Type, m.Field, err)
+			}
+		}
+	}
+	for i, r := range c.Renderers {
+		if r.Type == "" || r.Field == "" {
+			return fmt.Errorf("renderer %d: type and field are required", i)
+		}
+		if _, err := path.Match(r.Type, ""); err != nil {
+			return fmt.Errorf("renderer %d: invalid type pattern %q: %v", i, r.Type, err)
+		}
+		if _, err := path.Match(r.Field, ""); err != nil {
+			return fmt.Errorf("renderer %d: invalid field pattern %q: %v", i, r.Field, err)
+		}
+		switch r.Format {
+		case RenderHex, RenderPublicKey, RenderTimestamp:
+		default:
+			return fmt.Errorf("renderer %d (%s.%s): unknown format %q", i, r.Type, r.Field, r.Format)
+		}
+	}
+	return nil
+}
+
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -37,5 +189,8 @@ func LoadConfig(path string) (*Config, error) {
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
@@ -67,3 +67,129 @@ func TestLoadConfig(t *testing.T) {
 		t.Errorf("got %v, want %v", cfg, expected)
 	}
 }
+
+func TestFindMapping(t *testing.T) {
+	cfg := &Config{
+		Mappings: []Mapping{
+			{Type: "pkg.*", Field: "payload", TargetType: "Wildcard"},
+			{Type: "pkg.A", Field: "payload", TargetType: "Exact"},
+			{Type: "pkg.A", Field: "g", TargetType: "C"},
+			{Type: "pkg.B", Field: "content", TargetType: "Oneof"},
+			{Type: "pkg.B", Field: "raw_*", TargetType: "Prefixed"},
+		},
+	}
+
+	tests := []struct {
+		name                   string
+		typeName, field, oneof string
+		expected               string
+	}{
+		{"exact wins over pattern", "pkg.A", "payload", "", "Exact"},
+		{"type pattern", "pkg.Other", "payload", "", "Wildcard"},
+		{"exact field", "pkg.A", "g", "", "C"},
+		{"oneof name", "pkg.B", "inline", "content", "Oneof"},
+		{"field pattern", "pkg.B", "raw_tx", "", "Prefixed"},
+		{"no match", "pkg.A", "h", "", ""},
+		{"pattern does not cross packages", "other.A", "payload", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if m := cfg.FindMapping(tt.typeName, tt.field, tt.oneof); m != nil {
+				got = m.TargetType
+			}
+			if got != tt.expected {
+				t.Errorf("FindMapping() target = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+
+	var nilCfg *Config
+	if m := nilCfg.FindMapping("A", "f", ""); m != nil {
+		t.Errorf("nil config FindMapping() = %v, want nil", m)
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	m := &Mapping{
+		TargetType:    "Default",
+		Discriminator: "kind",
+		Targets:       map[string]string{"KIND_A": "A", "2": "B"},
+	}
+
+	for value, expected := range map[string]string{"KIND_A": "A", "2": "B", "KIND_C": "Default", "": "Default"} {
+		if got := m.ResolveTarget(value); got != expected {
+			t.Errorf("ResolveTarget(%q) = %q, want %q", value, got, expected)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping Mapping
+		wantErr bool
+	}{
+		{"valid", Mapping{Type: "A", Field: "f", TargetType: "B"}, false},
+		{"valid discriminated", Mapping{Type: "A", Field: "f", Discriminator: "k", Targets: map[string]string{"x": "B"}}, false},
+		{"missing target", Mapping{Type: "A", Field: "f"}, true},
+		{"targets without discriminator", Mapping{Type: "A", Field: "f", Targets: map[string]string{"x": "B"}}, true},
+		{"bad pattern", Mapping{Type: "A[", Field: "f", TargetType: "B"}, true},
+		{"empty signed_by field", Mapping{Type: "A", Field: "f", TargetType: "B", SignedBy: []string{""}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Mappings: []Mapping{tt.mapping}}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	cfg := &Config{
+		SupportedVersions: map[string][]int32{"A": {30, 31}},
+	}
+
+	if err := cfg.CheckVersion("A", 31); err != nil {
+		t.Errorf("CheckVersion(A, 31) error = %v", err)
+	}
+	if err := cfg.CheckVersion("A", 29); err == nil {
+		t.Error("CheckVersion(A, 29) expected error")
+	}
+	if err := cfg.CheckVersion("B", 1); err != nil {
+		t.Errorf("CheckVersion(B, 1) error = %v, types absent from the table accept any version", err)
+	}
+
+	cfg.Mappings = []Mapping{{Type: "X", Field: "f", TargetType: "A", Versioned: true, DefaultVersion: 1}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() expected error for unsupported default_version")
+	}
+}
+
+func TestFindRenderer(t *testing.T) {
+	cfg := &Config{
+		Renderers: []Renderer{
+			{Type: "pkg.Key", Field: "public_key", Format: RenderPublicKey},
+			{Type: "pkg.*", Field: "*_hash", Format: RenderHex},
+		},
+	}
+
+	if r := cfg.FindRenderer("pkg.Key", "public_key"); r == nil || r.Format != RenderPublicKey {
+		t.Errorf("FindRenderer(pkg.Key, public_key) = %v", r)
+	}
+	if r := cfg.FindRenderer("pkg.Tx", "tx_hash"); r == nil || r.Format != RenderHex {
+		t.Errorf("FindRenderer(pkg.Tx, tx_hash) = %v", r)
+	}
+	if r := cfg.FindRenderer("pkg.Tx", "serial"); r != nil {
+		t.Errorf("FindRenderer(pkg.Tx, serial) = %v, want nil", r)
+	}
+
+	cfg.Renderers = append(cfg.Renderers, Renderer{Type: "A", Field: "f", Format: "base58"})
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() expected error for unknown renderer format")
+	}
+}
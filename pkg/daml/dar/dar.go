@@ -0,0 +1,171 @@
+// Package dar reads Daml archives (.dar): zip files of compiled Daml-LF packages (.dalf) described
+// by a META-INF/MANIFEST.MF.
+package dar
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ManifestPath is the location of the manifest in a DAR.
+const ManifestPath = "META-INF/MANIFEST.MF"
+
+// Package is a DALF of a DAR.
+type Package struct {
+	Path string `json:"path"`
+	ID   string `json:"packageId"`
+	Main bool   `json:"main,omitempty"`
+}
+
+// Read returns the packages of a DAR: those listed under Dalfs in its manifest, with the Main-Dalf
+// marked, or every .dalf entry if it has no manifest. Package IDs are computed from the DALFs.
+func Read(data []byte) ([]Package, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a DAR: %v", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var paths []string
+	var mainPath string
+	if f, ok := files[ManifestPath]; ok {
+		content, err := readFile(f)
+		if err != nil {
+			return nil, err
+		}
+		manifest := ParseManifest(content)
+		mainPath = manifest["Main-Dalf"]
+		for _, p := range strings.Split(manifest["Dalfs"], ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				paths = append(paths, p)
+			}
+		}
+		if len(paths) == 0 && mainPath != "" {
+			paths = []string{mainPath}
+		}
+	} else {
+		for _, f := range zr.File {
+			if path.Ext(f.Name) == ".dalf" {
+				paths = append(paths, f.Name)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("the DAR has no packages")
+	}
+
+	packages := make([]Package, 0, len(paths))
+	for _, p := range paths {
+		f, ok := files[p]
+		if !ok {
+			return nil, fmt.Errorf("the manifest lists %s, which is not in the DAR", p)
+		}
+		content, err := readFile(f)
+		if err != nil {
+			return nil, err
+		}
+		id, err := PackageID(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		packages = append(packages, Package{Path: p, ID: id, Main: p == mainPath})
+	}
+	return packages, nil
+}
+
+// ParseManifest parses a JAR-style manifest into its main attributes. Lines starting with a space
+// continue the previous line.
+func ParseManifest(data []byte) map[string]string {
+	attrs := map[string]string{}
+	var last string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, " ") && last != "" {
+			attrs[last] += line[1:]
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			last = ""
+			continue
+		}
+		last = strings.TrimSpace(name)
+		attrs[last] = strings.TrimSpace(value)
+	}
+	return attrs
+}
+
+// PackageID returns the ID of a DALF, a serialized daml_lf.Archive: the hex SHA-256 of its payload.
+// The hash the archive declares must match.
+func PackageID(dalf []byte) (string, error) {
+	var payload []byte
+	var declared string
+	hasPayload := false
+	for len(dalf) > 0 {
+		num, typ, n := protowire.ConsumeTag(dalf)
+		if n < 0 {
+			return "", fmt.Errorf("not a Daml-LF archive: %v", protowire.ParseError(n))
+		}
+		dalf = dalf[n:]
+		if typ == protowire.BytesType && (num == 3 || num == 4) {
+			v, n := protowire.ConsumeBytes(dalf)
+			if n < 0 {
+				return "", fmt.Errorf("not a Daml-LF archive: %v", protowire.ParseError(n))
+			}
+			if num == 3 {
+				payload, hasPayload = v, true
+			} else {
+				declared = string(v)
+			}
+			dalf = dalf[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, dalf)
+		if n < 0 {
+			return "", fmt.Errorf("not a Daml-LF archive: %v", protowire.ParseError(n))
+		}
+		dalf = dalf[n:]
+	}
+	if !hasPayload {
+		return "", fmt.Errorf("not a Daml-LF archive: no payload")
+	}
+	sum := sha256.Sum256(payload)
+	id := hex.EncodeToString(sum[:])
+	if declared != "" && declared != id {
+		return "", fmt.Errorf("the archive declares package ID %s, but its payload hashes to %s", declared, id)
+	}
+	return id, nil
+}
+
+// ValidatePackageID checks that id is a package ID: 64 lowercase hex digits.
+func ValidatePackageID(id string) error {
+	if len(id) != 64 || strings.ToLower(id) != id {
+		return fmt.Errorf("invalid package ID %q: expected 64 lowercase hex digits", id)
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return fmt.Errorf("invalid package ID %q: expected 64 lowercase hex digits", id)
+	}
+	return nil
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", f.Name, err)
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
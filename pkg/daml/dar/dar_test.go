@@ -0,0 +1,111 @@
+package dar
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// archive returns a DALF with the given payload and its package ID.
+func archive(payload string) ([]byte, string) {
+	sum := sha256.Sum256([]byte(payload))
+	id := hex.EncodeToString(sum[:])
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, 0)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, []byte(payload))
+	b = protowire.AppendTag(b, 4, protowire.BytesType)
+	b = protowire.AppendString(b, id)
+	return b, id
+}
+
+func zipOf(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	mainDalf, mainID := archive("main package")
+	depDalf, depID := archive("dependency")
+	mainPath := "app-1.0.0-" + mainID + "/app-1.0.0-" + mainID + ".dalf"
+	depPath := "app-1.0.0-" + mainID + "/daml-prim-" + depID + ".dalf"
+
+	// manifest lines are wrapped at 72 bytes, continuing with a space
+	dalfs := "Dalfs: " + mainPath + ", " + depPath
+	var wrapped []string
+	for len(dalfs) > 72 {
+		wrapped = append(wrapped, dalfs[:72])
+		dalfs = " " + dalfs[72:]
+	}
+	wrapped = append(wrapped, dalfs)
+	manifest := "Manifest-Version: 1.0\r\nMain-Dalf: " + mainPath + "\r\n" + strings.Join(wrapped, "\r\n") + "\r\nFormat: daml-lf\r\n"
+
+	packages, err := Read(zipOf(t, map[string][]byte{ManifestPath: []byte(manifest), mainPath: mainDalf, depPath: depDalf}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Package{{Path: mainPath, ID: mainID, Main: true}, {Path: depPath, ID: depID}}
+	if len(packages) != 2 || packages[0] != want[0] || packages[1] != want[1] {
+		t.Errorf("Read() = %+v, want %+v", packages, want)
+	}
+
+	// without a manifest, every DALF is a package
+	packages, err = Read(zipOf(t, map[string][]byte{"a.dalf": mainDalf}))
+	if err != nil || len(packages) != 1 || packages[0].ID != mainID {
+		t.Errorf("Read() without manifest = %+v, %v", packages, err)
+	}
+
+	if _, err := Read(zipOf(t, map[string][]byte{ManifestPath: []byte("Main-Dalf: missing.dalf\n")})); err == nil {
+		t.Error("expected a missing DALF to be reported")
+	}
+	if _, err := Read([]byte("not a zip")); err == nil {
+		t.Error("expected a non-zip to be rejected")
+	}
+}
+
+func TestPackageID(t *testing.T) {
+	dalf, id := archive("payload")
+	if got, err := PackageID(dalf); err != nil || got != id {
+		t.Errorf("PackageID() = %s, %v, want %s", got, err, id)
+	}
+
+	tampered := protowire.AppendTag(nil, 3, protowire.BytesType)
+	tampered = protowire.AppendBytes(tampered, []byte("other payload"))
+	tampered = protowire.AppendTag(tampered, 4, protowire.BytesType)
+	tampered = protowire.AppendString(tampered, id)
+	if _, err := PackageID(tampered); err == nil || !strings.Contains(err.Error(), "hashes to") {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+	if _, err := PackageID([]byte{0x08, 0x01}); err == nil {
+		t.Error("expected an archive without payload to be rejected")
+	}
+}
+
+func TestValidatePackageID(t *testing.T) {
+	_, id := archive("payload")
+	if err := ValidatePackageID(id); err != nil {
+		t.Error(err)
+	}
+	for _, invalid := range []string{id[:63], strings.ToUpper(id), strings.Repeat("g", 64)} {
+		if err := ValidatePackageID(invalid); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"buf-lib-poc/pkg/patch"
+)
+
+// Kinds of change between two JSON values.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is a difference at a single path, in the path syntax of the patch package.
+// Elements of lists matched by key appear as list[key=value], with value in JSON, e.g.
+// signatures[signedBy="1220ab"]; patch.Get, Set and Delete accept these paths.
+type Change struct {
+	Path string      `json:"path"`
+	Kind string      `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Options controls how lists are matched.
+type Options struct {
+	// Keys maps the name of a list field to the element field identifying its entries,
+	// e.g. "signatures" to "signedBy". Other lists, and lists whose elements do not all
+	// carry a distinct key, are compared by index.
+	Keys map[string]string
+}
+
+// Compare returns the changes turning a into b. Objects are compared key by key in sorted
+// order and lists element by element.
+func Compare(a, b interface{}) []Change {
+	return CompareWith(a, b, Options{})
+}
+
+// CompareWith is Compare with keyed matching of list elements.
+func CompareWith(a, b interface{}, opts Options) []Change {
+	d := &differ{opts: opts}
+	d.compare("", "", a, b)
+	return d.changes
+}
+
+type differ struct {
+	opts    Options
+	changes []Change
+}
+
+func (d *differ) add(c Change) {
+	d.changes = append(d.changes, c)
+}
+
+// compare records the changes between a and b at path; name is the last key of path.
+func (d *differ) compare(path, name string, a, b interface{}) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			for _, k := range sortedKeys(av, bv) {
+				aval, inA := av[k]
+				bval, inB := bv[k]
+				p := patch.JoinKey(path, k)
+				switch {
+				case !inB:
+					d.add(Change{Path: p, Kind: Removed, Old: aval})
+				case !inA:
+					d.add(Change{Path: p, Kind: Added, New: bval})
+				default:
+					d.compare(p, k, aval, bval)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			if key := d.opts.Keys[name]; key != "" && d.compareKeyed(path, key, av, bv) {
+				return
+			}
+			for i := 0; i < len(av) || i < len(bv); i++ {
+				p := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(bv):
+					d.add(Change{Path: p, Kind: Removed, Old: av[i]})
+				case i >= len(av):
+					d.add(Change{Path: p, Kind: Added, New: bv[i]})
+				default:
+					d.compare(p, name, av[i], bv[i])
+				}
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		d.add(Change{Path: path, Kind: Changed, Old: a, New: b})
+	}
+}
+
+// compareKeyed matches list elements by the value of their key field, reporting them as
+// path[key=value]. It returns false, recording nothing, when the elements are not keyed.
+func (d *differ) compareKeyed(path, key string, a, b []interface{}) bool {
+	aKeys, ok := keysOf(a, key)
+	if !ok {
+		return false
+	}
+	bKeys, ok := keysOf(b, key)
+	if !ok {
+		return false
+	}
+	bIndex := make(map[string]int, len(bKeys))
+	for i, k := range bKeys {
+		bIndex[k] = i
+	}
+	aIndex := make(map[string]bool, len(aKeys))
+	for i, k := range aKeys {
+		aIndex[k] = true
+		p := fmt.Sprintf("%s[%s=%s]", path, key, k)
+		if j, ok := bIndex[k]; ok {
+			d.compare(p, "", a[i], b[j])
+		} else {
+			d.add(Change{Path: p, Kind: Removed, Old: a[i]})
+		}
+	}
+	for j, k := range bKeys {
+		if !aIndex[k] {
+			d.add(Change{Path: fmt.Sprintf("%s[%s=%s]", path, key, k), Kind: Added, New: b[j]})
+		}
+	}
+	return true
+}
+
+// keysOf returns the key of each element, or false if an element is not an object with a
+// unique value for key.
+func keysOf(list []interface{}, key string) ([]string, bool) {
+	keys := make([]string, len(list))
+	seen := make(map[string]bool, len(list))
+	for i, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		v, ok := obj[key]
+		if !ok {
+			return nil, false
+		}
+		k := patch.CompactJSON(v)
+		if seen[k] {
+			return nil, false
+		}
+		seen[k] = true
+		keys[i] = k
+	}
+	return keys, true
+}
+
+// Format renders changes one per line: "+" for added, "-" for removed and "~" for changed values.
+func Format(changes []Change) string {
+	var sb strings.Builder
+	for _, c := range changes {
+		path := c.Path
+		if path == "" {
+			path = "(root)"
+		}
+		switch c.Kind {
+		case Added:
+			fmt.Fprintf(&sb, "+ %s: %s\n", path, patch.CompactJSON(c.New))
+		case Removed:
+			fmt.Fprintf(&sb, "- %s: %s\n", path, patch.CompactJSON(c.Old))
+		default:
+			fmt.Fprintf(&sb, "~ %s: %s -> %s\n", path, patch.CompactJSON(c.Old), patch.CompactJSON(c.New))
+		}
+	}
+	return sb.String()
+}
+
+func sortedKeys(a, b map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]interface{}{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
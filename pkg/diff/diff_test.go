@@ -0,0 +1,113 @@
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"buf-lib-poc/pkg/patch"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		expected []Change
+	}{
+		{"equal", `{"a":1,"b":[1,2]}`, `{"a":1,"b":[1,2]}`, nil},
+		{"changed scalar", `{"a":{"serial":1}}`, `{"a":{"serial":2}}`, []Change{
+			{Path: "a.serial", Kind: Changed, Old: 1.0, New: 2.0},
+		}},
+		{"added and removed keys", `{"a":1,"b":2}`, `{"b":2,"c":3}`, []Change{
+			{Path: "a", Kind: Removed, Old: 1.0},
+			{Path: "c", Kind: Added, New: 3.0},
+		}},
+		{"list by index", `{"l":[1,2]}`, `{"l":[1,3,4]}`, []Change{
+			{Path: "l[1]", Kind: Changed, Old: 2.0, New: 3.0},
+			{Path: "l[2]", Kind: Added, New: 4.0},
+		}},
+		{"type change", `{"a":{"b":1}}`, `{"a":"x"}`, []Change{
+			{Path: "a", Kind: Changed, Old: map[string]interface{}{"b": 1.0}, New: "x"},
+		}},
+		{"quoted key", `{"a.b":1}`, `{"a.b":2}`, []Change{
+			{Path: `"a.b"`, Kind: Changed, Old: 1.0, New: 2.0},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a, b interface{}
+			json.Unmarshal([]byte(tt.a), &a)
+			json.Unmarshal([]byte(tt.b), &b)
+			got := Compare(a, b)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompareWithKeys(t *testing.T) {
+	opts := Options{Keys: map[string]string{"signatures": "signedBy"}}
+	tests := []struct {
+		name     string
+		a, b     string
+		expected []Change
+	}{
+		{"reordered", `{"signatures":[{"signedBy":"a"},{"signedBy":"b"}]}`, `{"signatures":[{"signedBy":"b"},{"signedBy":"a"}]}`, nil},
+		{"changed, removed and added", `{"signatures":[{"signedBy":"a","sig":"1"},{"signedBy":"b"}]}`, `{"signatures":[{"signedBy":"c"},{"signedBy":"a","sig":"2"}]}`, []Change{
+			{Path: `signatures[signedBy="a"].sig`, Kind: Changed, Old: "1", New: "2"},
+			{Path: `signatures[signedBy="b"]`, Kind: Removed, Old: map[string]interface{}{"signedBy": "b"}},
+			{Path: `signatures[signedBy="c"]`, Kind: Added, New: map[string]interface{}{"signedBy": "c"}},
+		}},
+		{"duplicate keys fall back to index", `{"signatures":[{"signedBy":"a"},{"signedBy":"a"}]}`, `{"signatures":[{"signedBy":"a"}]}`, []Change{
+			{Path: "signatures[1]", Kind: Removed, Old: map[string]interface{}{"signedBy": "a"}},
+		}},
+		{"other lists by index", `{"other":[{"signedBy":"a"},{"signedBy":"b"}]}`, `{"other":[{"signedBy":"b"}]}`, []Change{
+			{Path: "other[0].signedBy", Kind: Changed, Old: "a", New: "b"},
+			{Path: "other[1]", Kind: Removed, Old: map[string]interface{}{"signedBy": "b"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a, b interface{}
+			json.Unmarshal([]byte(tt.a), &a)
+			json.Unmarshal([]byte(tt.b), &b)
+			got := CompareWith(a, b, opts)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// Keyed paths address the changed values through the patch package.
+func TestCompareWithKeysPatchPaths(t *testing.T) {
+	var a, b map[string]interface{}
+	json.Unmarshal([]byte(`{"signatures":[{"signedBy":"a]","sig":"1"},{"signedBy":"b"}]}`), &a)
+	json.Unmarshal([]byte(`{"signatures":[{"signedBy":"c"},{"signedBy":"a]","sig":"2"}]}`), &b)
+
+	for _, c := range CompareWith(a, b, Options{Keys: map[string]string{"signatures": "signedBy"}}) {
+		doc, want := b, c.New
+		if c.Kind == Removed {
+			doc, want = a, c.Old
+		}
+		got, err := patch.Get(doc, c.Path)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Get(%s) = %v, %v, want %v", c.Path, got, err, want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	changes := []Change{
+		{Path: "a", Kind: Added, New: "x"},
+		{Path: "b[0]", Kind: Removed, Old: 1.0},
+		{Path: "c", Kind: Changed, Old: 1.0, New: 2.0},
+	}
+	expected := "+ a: \"x\"\n- b[0]: 1\n~ c: 1 -> 2\n"
+	if got := Format(changes); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
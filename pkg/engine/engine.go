@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"sync"
 
 	"buf-lib-poc/pkg/config"
+	"buf-lib-poc/pkg/diff"
+	"buf-lib-poc/pkg/identify"
 	"buf-lib-poc/pkg/loader"
+	"buf-lib-poc/pkg/patch"
 	"buf-lib-poc/pkg/processor"
 	"buf-lib-poc/pkg/template"
 
@@ -19,16 +24,71 @@ import (
 type Engine struct {
 	Loader *loader.SchemaLoader
 	Config *config.Config
+	// KeepRaw makes Decode annotate expanded fields with their original bytes (@raw/@hash),
+	// so that Generate reproduces them byte for byte when they are not edited. Off by default.
+	KeepRaw bool
+
+	procs *processors
+}
+
+// processors holds the processors of an engine, built once per schema so that the type registry is
+// shared by every payload of a stream.
+type processors struct {
+	mu    sync.Mutex
+	procs map[processorKey]*processor.Processor
+}
+
+type processorKey struct {
+	schemaPath string
+	keepRaw    bool
 }
 
 func NewEngine(cfg *config.Config) *Engine {
 	return &Engine{
 		Loader: &loader.SchemaLoader{},
 		Config: cfg,
+		procs:  &processors{},
 	}
 }
 
-func (e *Engine) Template(ctx context.Context, schemaPath, msgName string) (interface{}, error) {
+// processor returns the processor of the schema at schemaPath, with the engine's KeepRaw, and the
+// schema's files. It is safe for concurrent use.
+func (e *Engine) processor(ctx context.Context, schemaPath string) (*processor.Processor, []protoreflect.FileDescriptor, error) {
+	files, err := e.Loader.LoadSchema(ctx, schemaPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	newProcessor := func() (*processor.Processor, error) {
+		proc := &processor.Processor{Loader: e.Loader, Config: e.Config, Files: files, KeepRaw: e.KeepRaw}
+		// Build the type registry now, so that the processor is only read from then on
+		if _, err := proc.Types(); err != nil {
+			return nil, err
+		}
+		return proc, nil
+	}
+	if e.procs == nil {
+		proc, err := newProcessor()
+		return proc, files, err
+	}
+
+	e.procs.mu.Lock()
+	defer e.procs.mu.Unlock()
+	key := processorKey{schemaPath, e.KeepRaw}
+	if proc, ok := e.procs.procs[key]; ok {
+		return proc, files, nil
+	}
+	proc, err := newProcessor()
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.procs.procs == nil {
+		e.procs.procs = map[processorKey]*processor.Processor{}
+	}
+	e.procs.procs[key] = proc
+	return proc, files, nil
+}
+
+func (e *Engine) Template(ctx context.Context, schemaPath, msgName string, opts template.Options) (interface{}, error) {
 	resolvedMsgName := e.Config.ResolveAlias(msgName)
 	files, err := e.Loader.LoadSchema(ctx, schemaPath)
 	if err != nil {
@@ -38,27 +98,58 @@ func (e *Engine) Template(ctx context.Context, schemaPath, msgName string) (inte
 	if foundMsg == nil {
 		return nil, fmt.Errorf("could not find message: %s", resolvedMsgName)
 	}
-	return template.GenerateJSONTemplate(foundMsg), nil
+	return template.Generate(foundMsg, opts), nil
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) for the JSON form of msgName, with the config
+// mappings and renderers applied.
+func (e *Engine) JSONSchema(ctx context.Context, schemaPath, msgName string) (map[string]interface{}, error) {
+	resolvedMsgName := e.Config.ResolveAlias(msgName)
+	proc, files, err := e.processor(ctx, schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	foundMsg := loader.FindMessage(files, resolvedMsgName)
+	if foundMsg == nil {
+		return nil, fmt.Errorf("could not find message: %s", resolvedMsgName)
+	}
+	return template.JSONSchema(foundMsg, proc), nil
+}
+
+// Patcher returns a schema-aware patcher for the JSON form of msgName. Its paths follow the config
+// mappings into expanded nested payloads.
+func (e *Engine) Patcher(ctx context.Context, schemaPath, msgName string) (*patch.Schema, error) {
+	resolvedMsgName := e.Config.ResolveAlias(msgName)
+	proc, files, err := e.processor(ctx, schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	foundMsg := loader.FindMessage(files, resolvedMsgName)
+	if foundMsg == nil {
+		return nil, fmt.Errorf("could not find message: %s", resolvedMsgName)
+	}
+	return &patch.Schema{Message: foundMsg, Resolver: proc}, nil
 }
 
+// Decode converts binary data to its JSON form. When versioned is set, the data is unwrapped from an
+// UntypedVersionedMessage and the wrapper version is kept under the "@version" key.
 func (e *Engine) Decode(ctx context.Context, schemaPath, msgName string, binaryData []byte, versioned bool) (interface{}, error) {
 	resolvedMsgName := e.Config.ResolveAlias(msgName)
 
-	files, err := e.Loader.LoadSchema(ctx, schemaPath)
+	proc, files, err := e.processor(ctx, schemaPath)
 	if err != nil {
 		return nil, err
 	}
 
+	var version int32
 	if versioned {
-		wrapperMsgDesc := loader.FindMessage(files, "com.digitalasset.canton.version.v1.UntypedVersionedMessage")
-		if wrapperMsgDesc == nil {
-			return nil, fmt.Errorf("could not find UntypedVersionedMessage in schema")
+		binaryData, version, err = proc.Unwrap(binaryData)
+		if err != nil {
+			return nil, err
 		}
-		wrapperMsg := dynamicpb.NewMessage(wrapperMsgDesc)
-		if err := proto.Unmarshal(binaryData, wrapperMsg); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal versioned wrapper: %v", err)
+		if err := e.Config.CheckVersion(resolvedMsgName, version); err != nil {
+			log.Printf("warning: %v", err)
 		}
-		binaryData = wrapperMsg.Get(wrapperMsgDesc.Fields().ByName("data")).Bytes()
 	}
 
 	foundMsg := loader.FindMessage(files, resolvedMsgName)
@@ -71,24 +162,85 @@ func (e *Engine) Decode(ctx context.Context, schemaPath, msgName string, binaryD
 		return nil, fmt.Errorf("failed to unmarshal binary data: %v", err)
 	}
 
+	var out interface{}
 	if e.Config != nil {
-		proc := &processor.Processor{Loader: e.Loader, Config: e.Config, Files: files}
-		return proc.ExpandRecursively(ctx, foundMsg, protoreflect.ValueOfMessage(msg))
+		out, err = proc.ExpandRecursively(ctx, foundMsg, protoreflect.ValueOfMessage(msg))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// If no config, just return the standard JSON-friendly map
+		types, err := proc.Types()
+		if err != nil {
+			return nil, err
+		}
+		jsonData, err := protojson.MarshalOptions{Resolver: types}.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(jsonData, &out); err != nil {
+			return nil, err
+		}
 	}
 
-	// If no config, just return the standard JSON-friendly map
-	jsonData, err := protojson.Marshal(msg)
+	if obj, ok := out.(map[string]interface{}); ok && versioned {
+		obj[processor.VersionKey] = version
+	}
+	return out, nil
+}
+
+// Message parses binaryData as msgName without expanding nested payloads, for output in the
+// protobuf formats. The schema's types are returned to resolve Any fields.
+func (e *Engine) Message(ctx context.Context, schemaPath, msgName string, binaryData []byte, versioned bool) (*dynamicpb.Message, *dynamicpb.Types, error) {
+	resolvedMsgName := e.Config.ResolveAlias(msgName)
+	proc, files, err := e.processor(ctx, schemaPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if versioned {
+		if binaryData, _, err = proc.Unwrap(binaryData); err != nil {
+			return nil, nil, err
+		}
+	}
+	foundMsg := loader.FindMessage(files, resolvedMsgName)
+	if foundMsg == nil {
+		return nil, nil, fmt.Errorf("could not find message: %s", resolvedMsgName)
+	}
+	msg := dynamicpb.NewMessage(foundMsg)
+	if err := proto.Unmarshal(binaryData, msg); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal binary data: %v", err)
+	}
+	types, err := proc.Types()
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, types, nil
+}
+
+// Identify ranks the messages of the schema by how cleanly binaryData parses as each of them.
+// Candidates default to the configured identify_candidates, then to every message in the schema.
+func (e *Engine) Identify(ctx context.Context, schemaPath string, binaryData []byte, candidates []string) ([]identify.Candidate, error) {
+	files, err := e.Loader.LoadSchema(ctx, schemaPath)
 	if err != nil {
 		return nil, err
 	}
-	var out interface{}
-	err = json.Unmarshal(jsonData, &out)
-	return out, err
+	if len(candidates) == 0 && e.Config != nil {
+		candidates = e.Config.IdentifyCandidates
+	}
+	resolved := make([]string, len(candidates))
+	for i, c := range candidates {
+		resolved[i] = e.Config.ResolveAlias(c)
+	}
+
+	id := &identify.Identifier{Files: files, Config: e.Config}
+	return id.Identify(binaryData, resolved)
 }
 
+// Generate converts JSON data to binary. The result is wrapped in an UntypedVersionedMessage when
+// versionNum is given or the data carries a "@version" key; both must agree if present.
 func (e *Engine) Generate(ctx context.Context, schemaPath, msgName string, jsonData []byte, versionNum *int32) ([]byte, error) {
 	resolvedMsgName := e.Config.ResolveAlias(msgName)
-	files, err := e.Loader.LoadSchema(ctx, schemaPath)
+	proc, files, err := e.processor(ctx, schemaPath)
 	if err != nil {
 		return nil, err
 	}
@@ -97,39 +249,159 @@ func (e *Engine) Generate(ctx context.Context, schemaPath, msgName string, jsonD
 		return nil, fmt.Errorf("could not find message: %s", resolvedMsgName)
 	}
 
-	if e.Config != nil {
-		var mapData interface{}
-		if err := json.Unmarshal(jsonData, &mapData); err != nil {
-			return nil, fmt.Errorf("failed to parse input JSON: %v", err)
+	var mapData interface{}
+	if err := json.Unmarshal(jsonData, &mapData); err != nil {
+		return nil, fmt.Errorf("failed to parse input JSON: %v", err)
+	}
+
+	// Template hints such as "_oneof" are not fields
+	annotated := template.StripHints(mapData)
+	if obj, ok := mapData.(map[string]interface{}); ok {
+		dataVersion, hasVersion, err := processor.VersionOf(obj)
+		if err != nil {
+			return nil, err
 		}
+		_, hasRaw := obj[processor.RawKey]
+		annotated = annotated || hasVersion || hasRaw
+		delete(obj, processor.VersionKey)
+		delete(obj, processor.RawKey)
+		delete(obj, processor.HashKey)
+		if hasVersion {
+			if versionNum != nil && *versionNum != dataVersion {
+				return nil, fmt.Errorf("requested version %d conflicts with %s %d in the input", *versionNum, processor.VersionKey, dataVersion)
+			}
+			versionNum = &dataVersion
+		}
+	}
 
-		proc := &processor.Processor{Loader: e.Loader, Config: e.Config, Files: files}
+	if e.Config != nil {
 		compressed, err := proc.CompressRecursively(ctx, foundMsg, mapData)
 		if err != nil {
 			return nil, fmt.Errorf("failed to compress message: %v", err)
 		}
 		jsonData, _ = json.Marshal(compressed)
+	} else if annotated {
+		jsonData, _ = json.Marshal(mapData)
 	}
 
+	types, err := proc.Types()
+	if err != nil {
+		return nil, err
+	}
 	msg := dynamicpb.NewMessage(foundMsg)
-	if err := protojson.Unmarshal(jsonData, msg); err != nil {
+	if err := (protojson.UnmarshalOptions{Resolver: types}).Unmarshal(jsonData, msg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
 	}
-	binaryData, err := proto.Marshal(msg)
+	binaryData, err := processor.Marshal(msg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal to binary: %v", err)
 	}
 
 	if versionNum != nil {
-		wrapperDesc := loader.FindMessage(files, "com.digitalasset.canton.version.v1.UntypedVersionedMessage")
-		if wrapperDesc == nil {
-			return nil, fmt.Errorf("could not find UntypedVersionedMessage in schema")
+		if err := e.Config.CheckVersion(resolvedMsgName, *versionNum); err != nil {
+			return nil, err
+		}
+		binaryData, err = proc.Wrap(binaryData, *versionNum)
+		if err != nil {
+			return nil, err
 		}
-		wrapperMsg := dynamicpb.NewMessage(wrapperDesc)
-		wrapperMsg.Set(wrapperDesc.Fields().ByName("data"), protoreflect.ValueOfBytes(binaryData))
-		wrapperMsg.Set(wrapperDesc.Fields().ByName("version"), protoreflect.ValueOfInt32(*versionNum))
-		binaryData, _ = proto.Marshal(wrapperMsg)
 	}
 
 	return binaryData, nil
 }
+
+// Diff decodes two payloads of the same message type, expanding mapped fields, and returns the
+// changes turning a into b. @raw/@hash annotations are not compared.
+func (e *Engine) Diff(ctx context.Context, schemaPath, msgName string, a, b []byte, versioned bool, opts diff.Options) ([]diff.Change, error) {
+	dec := *e
+	dec.KeepRaw = false
+	var docs [2]interface{}
+	for i, data := range [][]byte{a, b} {
+		decoded, err := dec.Decode(ctx, schemaPath, msgName, data, versioned)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s payload: %v", [2]string{"first", "second"}[i], err)
+		}
+		// Normalize to plain JSON values
+		jsonData, _ := json.Marshal(decoded)
+		if err := json.Unmarshal(jsonData, &docs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return diff.CompareWith(docs[0], docs[1], opts), nil
+}
+
+// Edit describes the changes applied by Engine.Edit, in order: the patch document, then the
+// assignments, then the removals.
+type Edit struct {
+	Patch []byte   // RFC 6902 JSON Patch (array) or RFC 7396 merge patch (object)
+	Set   []string // path=value assignments checked against the schema
+	Unset []string // paths to remove
+}
+
+// Edit decodes binaryData, applies the edit to its JSON form and re-encodes it. Unchanged nested
+// payloads keep their original bytes and a versioned input stays wrapped. It returns the new data
+// and the changes made, ignoring @raw/@hash annotations; without changes the input is returned as is.
+func (e *Engine) Edit(ctx context.Context, schemaPath, msgName string, binaryData []byte, versioned bool, edit Edit) ([]byte, []diff.Change, error) {
+	dec := *e
+	dec.KeepRaw = true
+	decoded, err := dec.Decode(ctx, schemaPath, msgName, binaryData, versioned)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Normalize to plain JSON values so that patches compare and diff consistently
+	var doc interface{}
+	jsonData, _ := json.Marshal(decoded)
+	if err := json.Unmarshal(jsonData, &doc); err != nil {
+		return nil, nil, err
+	}
+	before := processor.StripAnnotations(doc)
+	version, _, _ := processor.VersionOf(doc.(map[string]interface{}))
+
+	if len(edit.Patch) > 0 {
+		doc, err = patch.ApplyDocument(doc, edit.Patch)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("patched document is not a JSON object")
+	}
+	if len(edit.Set) > 0 || len(edit.Unset) > 0 {
+		patcher, err := e.Patcher(ctx, schemaPath, msgName)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, set := range edit.Set {
+			path, value, ok := patch.SplitAssignment(set)
+			if !ok {
+				return nil, nil, fmt.Errorf("invalid assignment %q, expected path=value", set)
+			}
+			if err := patcher.Set(obj, path, value); err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, unset := range edit.Unset {
+			if err := patcher.Delete(obj, unset); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	changes := diff.Compare(before, processor.StripAnnotations(obj))
+	if len(changes) == 0 {
+		return binaryData, nil, nil
+	}
+
+	var versionNum *int32
+	if _, hasVersion, _ := processor.VersionOf(obj); versioned && !hasVersion {
+		versionNum = &version
+	}
+	out, _ := json.Marshal(obj)
+	encoded, err := e.Generate(ctx, schemaPath, msgName, out, versionNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encoded, changes, nil
+}
@@ -1,12 +1,24 @@
 package engine
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/x509"
 	"encoding/json"
+	"log"
 	"os"
+	"strings"
 	"testing"
 
+	"buf-lib-poc/pkg/canton"
 	"buf-lib-poc/pkg/config"
+	"buf-lib-poc/pkg/diff"
+	"buf-lib-poc/pkg/processor"
+	"buf-lib-poc/pkg/template"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 func TestEngine_EndToEnd(t *testing.T) {
@@ -25,7 +37,7 @@ func TestEngine_EndToEnd(t *testing.T) {
 	ctx := context.Background()
 
 	// 1. Test Template
-	tmpl, err := e.Template(ctx, imagePath, "TopologyTransaction")
+	tmpl, err := e.Template(ctx, imagePath, "TopologyTransaction", template.Options{})
 	if err != nil {
 		t.Fatalf("Template() error = %v", err)
 	}
@@ -112,3 +124,761 @@ func TestEngine_NestedRecursion(t *testing.T) {
 		t.Errorf("expected MY_NS, got %v", nsDel["namespace"])
 	}
 }
+
+func TestEngine_MappingRules(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	cfg := &config.Config{
+		Mappings: []config.Mapping{
+			{
+				// Wildcard type pattern
+				Type:           "com.digitalasset.canton.protocol.v30.Signed*",
+				Field:          "transaction",
+				TargetType:     "com.digitalasset.canton.protocol.v30.TopologyTransaction",
+				Versioned:      true,
+				DefaultVersion: 30,
+			},
+			{
+				// Repeated bytes field
+				Type:           "com.digitalasset.canton.protocol.v30.SignedTopologyTransactions",
+				Field:          "signed_transaction",
+				TargetType:     "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction",
+				Versioned:      true,
+				DefaultVersion: 30,
+			},
+			{
+				// Target chosen by a sibling enum field
+				Type:          "com.digitalasset.canton.crypto.v30.SymmetricKey",
+				Field:         "key",
+				Discriminator: "format",
+				Targets: map[string]string{
+					"CRYPTO_KEY_FORMAT_RAW": "com.digitalasset.canton.protocol.v30.TopologyTransaction",
+				},
+			},
+		},
+	}
+	e := NewEngine(cfg)
+	ctx := context.Background()
+
+	tx := map[string]interface{}{
+		"operation": "TOPOLOGY_CHANGE_OP_ADD_REPLACE",
+		"serial":    float64(5),
+		"mapping": map[string]interface{}{
+			"namespaceDelegation": map[string]interface{}{"namespace": "NS"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		msgName string
+		input   map[string]interface{}
+		check   func(t *testing.T, decoded map[string]interface{})
+	}{
+		{
+			name:    "repeated bytes",
+			msgName: "com.digitalasset.canton.protocol.v30.SignedTopologyTransactions",
+			input: map[string]interface{}{
+				"signedTransaction": []interface{}{
+					map[string]interface{}{"transaction": tx},
+					map[string]interface{}{"transaction": tx, "proposal": true},
+				},
+			},
+			check: func(t *testing.T, decoded map[string]interface{}) {
+				list := decoded["signedTransaction"].([]interface{})
+				if len(list) != 2 {
+					t.Fatalf("expected 2 signed transactions, got %d", len(list))
+				}
+				second := list[1].(map[string]interface{})
+				if second["proposal"] != true {
+					t.Errorf("expected proposal on second entry, got %v", second)
+				}
+				inner := second["transaction"].(map[string]interface{})
+				if inner["serial"] != float64(5) {
+					t.Errorf("expected nested serial 5, got %v", inner["serial"])
+				}
+			},
+		},
+		{
+			name:    "any expansion",
+			msgName: "google.rpc.Status",
+			input: map[string]interface{}{
+				"code": float64(3),
+				"details": []interface{}{
+					map[string]interface{}{
+						"@type":       "type.googleapis.com/com.digitalasset.canton.protocol.v30.SignedTopologyTransaction",
+						"transaction": tx,
+					},
+				},
+			},
+			check: func(t *testing.T, decoded map[string]interface{}) {
+				detail := decoded["details"].([]interface{})[0].(map[string]interface{})
+				inner, ok := detail["transaction"].(map[string]interface{})
+				if !ok {
+					t.Fatalf("expected expanded transaction inside Any, got %v", detail["transaction"])
+				}
+				if inner["operation"] != "TOPOLOGY_CHANGE_OP_ADD_REPLACE" {
+					t.Errorf("unexpected operation %v", inner["operation"])
+				}
+			},
+		},
+		{
+			name:    "discriminator",
+			msgName: "com.digitalasset.canton.crypto.v30.SymmetricKey",
+			input: map[string]interface{}{
+				"format": "CRYPTO_KEY_FORMAT_RAW",
+				"key":    tx,
+			},
+			check: func(t *testing.T, decoded map[string]interface{}) {
+				if _, ok := decoded["key"].(map[string]interface{}); !ok {
+					t.Errorf("expected key to be expanded, got %v", decoded["key"])
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBytes, _ := json.Marshal(tt.input)
+			binary, err := e.Generate(ctx, imagePath, tt.msgName, jsonBytes, nil)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			decoded, err := e.Decode(ctx, imagePath, tt.msgName, binary, false)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			tt.check(t, decoded.(map[string]interface{}))
+		})
+	}
+
+	// A discriminator value without a target leaves the bytes untouched
+	raw := []byte(`{"format": "CRYPTO_KEY_FORMAT_DER", "key": "AQID"}`)
+	binary, err := e.Generate(ctx, imagePath, "com.digitalasset.canton.crypto.v30.SymmetricKey", raw, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	decoded, err := e.Decode(ctx, imagePath, "com.digitalasset.canton.crypto.v30.SymmetricKey", binary, false)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if key := decoded.(map[string]interface{})["key"]; key != "AQID" {
+		t.Errorf("expected raw key bytes to be preserved, got %v", key)
+	}
+}
+
+func TestEngine_ByteExactRoundTrip(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	cfg := &config.Config{
+		Mappings: []config.Mapping{
+			{
+				Type:           "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction",
+				Field:          "transaction",
+				TargetType:     "com.digitalasset.canton.protocol.v30.TopologyTransaction",
+				Versioned:      true,
+				DefaultVersion: 30,
+				SignedBy:       []string{"signatures"},
+			},
+		},
+	}
+	e := NewEngine(cfg)
+	e.KeepRaw = true
+	ctx := context.Background()
+	signedName := "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction"
+
+	// Non-canonical inner transaction: serial (2) before operation (1), plus an unknown field (99)
+	var tx []byte
+	tx = protowire.AppendTag(tx, 2, protowire.VarintType)
+	tx = protowire.AppendVarint(tx, 7)
+	tx = protowire.AppendTag(tx, 1, protowire.VarintType)
+	tx = protowire.AppendVarint(tx, 1)
+	tx = protowire.AppendTag(tx, 99, protowire.BytesType)
+	tx = protowire.AppendBytes(tx, []byte("extra"))
+
+	var wrapped []byte
+	wrapped = protowire.AppendTag(wrapped, 1, protowire.BytesType)
+	wrapped = protowire.AppendBytes(wrapped, tx)
+	wrapped = protowire.AppendTag(wrapped, 2, protowire.VarintType)
+	wrapped = protowire.AppendVarint(wrapped, 30)
+
+	signedJSON, _ := json.Marshal(map[string]interface{}{
+		"transaction": wrapped,
+		"signatures": []interface{}{
+			map[string]interface{}{"signature": []byte{1, 2, 3}, "signedBy": "1220abcd"},
+		},
+	})
+	original, err := e.Generate(ctx, imagePath, signedName, signedJSON, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	decoded, err := e.Decode(ctx, imagePath, signedName, original, false)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	decodedMap := decoded.(map[string]interface{})
+	inner := decodedMap["transaction"].(map[string]interface{})
+	if inner[processor.RawKey] == nil || inner[processor.HashKey] == nil {
+		t.Fatalf("expected @raw/@hash annotations, got %v", inner)
+	}
+
+	// 1. Unchanged content (signatures edited) reproduces the original transaction bytes
+	decodedMap["signatures"] = []interface{}{
+		map[string]interface{}{"signature": "BAUG", "signedBy": "1220ef01"},
+	}
+	edited, _ := json.Marshal(decodedMap)
+	regenerated, err := e.Generate(ctx, imagePath, signedName, edited, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !bytes.Contains(regenerated, wrapped) {
+		t.Errorf("expected original transaction bytes to be preserved")
+	}
+
+	// 2. Changed content is re-encoded and triggers a warning
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	inner["serial"] = float64(8)
+	edited, _ = json.Marshal(decodedMap)
+	regenerated, err = e.Generate(ctx, imagePath, signedName, edited, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if bytes.Contains(regenerated, wrapped) {
+		t.Errorf("expected edited transaction to be re-encoded")
+	}
+	if !strings.Contains(logs.String(), "WARNING") {
+		t.Errorf("expected a warning about signed bytes changing, got %q", logs.String())
+	}
+}
+
+func TestEngine_Versions(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	txName := "com.digitalasset.canton.protocol.v30.TopologyTransaction"
+	signedName := "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction"
+	cfg := &config.Config{
+		Mappings: []config.Mapping{
+			{Type: signedName, Field: "transaction", TargetType: txName, Versioned: true, DefaultVersion: 30},
+		},
+		SupportedVersions: map[string][]int32{txName: {30, 31}},
+	}
+	e := NewEngine(cfg)
+	ctx := context.Background()
+
+	// 1. Top-level @version is honored and reported back
+	binary, err := e.Generate(ctx, imagePath, txName, []byte(`{"@version": 31, "serial": 1}`), nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	decoded, err := e.Decode(ctx, imagePath, txName, binary, true)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if v := decoded.(map[string]interface{})[processor.VersionKey]; v != int32(31) {
+		t.Errorf("expected @version 31, got %v", v)
+	}
+
+	// 2. Conflicting explicit version is rejected
+	v30 := int32(30)
+	if _, err := e.Generate(ctx, imagePath, txName, []byte(`{"@version": 31}`), &v30); err == nil {
+		t.Error("expected error for conflicting versions")
+	}
+
+	// 3. Unsupported versions are rejected on generate
+	if _, err := e.Generate(ctx, imagePath, txName, []byte(`{"@version": 7}`), nil); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+
+	// 4. Nested @version overrides the mapping default
+	binary, err = e.Generate(ctx, imagePath, signedName, []byte(`{"transaction": {"@version": 31, "serial": 2}}`), nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	decoded, err = e.Decode(ctx, imagePath, signedName, binary, false)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	inner := decoded.(map[string]interface{})["transaction"].(map[string]interface{})
+	if inner[processor.VersionKey] != int32(31) {
+		t.Errorf("expected nested @version 31, got %v", inner[processor.VersionKey])
+	}
+
+	// 5. Strings are used verbatim, while @data is wrapped explicitly
+	txBytes, _ := e.Generate(ctx, imagePath, txName, []byte(`{"serial": 3}`), nil)
+	wrappedTx, _ := e.Generate(ctx, imagePath, txName, []byte(`{"serial": 3}`), &v30)
+	for _, input := range []map[string]interface{}{
+		{"transaction": wrappedTx},
+		{"transaction": map[string]interface{}{processor.DataKey: txBytes}},
+	} {
+		jsonData, _ := json.Marshal(input)
+		binary, err := e.Generate(ctx, imagePath, signedName, jsonData, nil)
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		decoded, err := e.Decode(ctx, imagePath, signedName, binary, false)
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		inner := decoded.(map[string]interface{})["transaction"].(map[string]interface{})
+		if inner["serial"] != float64(3) || inner[processor.VersionKey] != int32(30) {
+			t.Errorf("unexpected nested transaction for input %v: %v", input, inner)
+		}
+	}
+}
+
+func TestEngine_Renderers(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	txName := "com.digitalasset.canton.protocol.v30.TopologyTransaction"
+	signedName := "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction"
+	cfg := &config.Config{
+		Mappings: []config.Mapping{
+			{Type: signedName, Field: "transaction", TargetType: txName, Versioned: true, DefaultVersion: 30},
+		},
+		Renderers: []config.Renderer{
+			{Type: "com.digitalasset.canton.crypto.v30.SigningPublicKey", Field: "public_key", Format: config.RenderPublicKey},
+			{Type: "com.digitalasset.canton.crypto.v30.Signature", Field: "signature", Format: config.RenderHex},
+			{Type: "com.digitalasset.canton.protocol.v30.MultiTransactionSignatures", Field: "transaction_hashes", Format: config.RenderHex},
+		},
+	}
+	e := NewEngine(cfg)
+	ctx := context.Background()
+
+	pub := ed25519.NewKeyFromSeed(make([]byte, 32)).Public().(ed25519.PublicKey)
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+
+	input, _ := json.Marshal(map[string]interface{}{
+		"transaction": map[string]interface{}{
+			"serial": 1,
+			"mapping": map[string]interface{}{
+				"namespaceDelegation": map[string]interface{}{
+					"targetKey": map[string]interface{}{"publicKey": der},
+				},
+			},
+		},
+		"signatures": []interface{}{
+			map[string]interface{}{"signature": "cafe"},
+		},
+		"multiTransactionSignatures": []interface{}{
+			map[string]interface{}{"transactionHashes": []string{"0x122001"}},
+		},
+	})
+	original, err := e.Generate(ctx, imagePath, signedName, input, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	decoded, err := e.Decode(ctx, imagePath, signedName, original, false)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	decodedMap := decoded.(map[string]interface{})
+
+	sig := decodedMap["signatures"].([]interface{})[0].(map[string]interface{})
+	if sig["signature"] != "cafe" {
+		t.Errorf("expected hex signature, got %v", sig["signature"])
+	}
+	hashes := decodedMap["multiTransactionSignatures"].([]interface{})[0].(map[string]interface{})["transactionHashes"].([]interface{})
+	if hashes[0] != "122001" {
+		t.Errorf("expected hex transaction hash, got %v", hashes[0])
+	}
+	key := decodedMap["transaction"].(map[string]interface{})["mapping"].(map[string]interface{})["namespaceDelegation"].(map[string]interface{})["targetKey"].(map[string]interface{})["publicKey"].(map[string]interface{})
+	if key["fingerprint"] != canton.Fingerprint(der) || key["keySpec"] != "SIGNING_KEY_SPEC_EC_CURVE25519" {
+		t.Errorf("unexpected rendered public key: %v", key)
+	}
+
+	// Rendered forms are accepted back; force re-encoding of the nested transaction
+	delete(decodedMap["transaction"].(map[string]interface{}), processor.RawKey)
+	rendered, _ := json.Marshal(decodedMap)
+	regenerated, err := e.Generate(ctx, imagePath, signedName, rendered, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !bytes.Equal(regenerated, original) {
+		t.Errorf("round trip through rendered forms changed the bytes")
+	}
+}
+
+func TestEngine_Patcher(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	txName := "com.digitalasset.canton.protocol.v30.TopologyTransaction"
+	signedName := "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction"
+	cfg := &config.Config{
+		Mappings: []config.Mapping{
+			{Type: signedName, Field: "transaction", TargetType: txName, Versioned: true, DefaultVersion: 30},
+		},
+		Renderers: []config.Renderer{
+			{Type: "com.digitalasset.canton.crypto.v30.Signature", Field: "signature", Format: config.RenderHex},
+		},
+	}
+	e := NewEngine(cfg)
+	ctx := context.Background()
+
+	p, err := e.Patcher(ctx, imagePath, signedName)
+	if err != nil {
+		t.Fatalf("Patcher() error = %v", err)
+	}
+
+	data := map[string]interface{}{}
+	sets := [][2]string{
+		{"transaction.serial", "5"},
+		{"transaction.operation", "2"},
+		{"transaction.mapping.namespace_delegation.namespace", "1220abcd"},
+		{"transaction.mapping.namespaceDelegation.canSignAllMappings", "{}"},
+		{"transaction.mapping.namespaceDelegation.can_sign_specific_mapings.mappings", "TOPOLOGY_MAPPING_CODE_NAMESPACE_DELEGATION,TOPOLOGY_MAPPING_CODE_PARTY_TO_KEY_MAPPING"},
+		{"transaction.mapping.namespaceDelegation.canSignSpecificMapings.mappings[]", "4"},
+		{"signatures[].signed_by", "1220abcd"},
+		{"signatures[0].signature", "0xcafe"},
+		{`signatures[signed_by="1220abcd"].signature`, "cafe01"},
+	}
+	for _, s := range sets {
+		if err := p.Set(data, s[0], s[1]); err != nil {
+			t.Fatalf("Set(%s) error = %v", s[0], err)
+		}
+	}
+
+	tx := data["transaction"].(map[string]interface{})
+	if tx["serial"] != uint64(5) || tx["operation"] != "TOPOLOGY_CHANGE_OP_REMOVE" {
+		t.Errorf("unexpected coerced values: serial=%#v operation=%#v", tx["serial"], tx["operation"])
+	}
+	nd := tx["mapping"].(map[string]interface{})["namespaceDelegation"].(map[string]interface{})
+	if _, ok := nd["canSignAllMappings"]; ok {
+		t.Errorf("setting a oneof member should clear its siblings: %v", nd)
+	}
+	mappings := nd["canSignSpecificMapings"].(map[string]interface{})["mappings"].([]interface{})
+	if len(mappings) != 3 || mappings[2] != "TOPOLOGY_MAPPING_CODE_OWNER_TO_KEY_MAPPING" {
+		t.Errorf("unexpected mappings: %v", mappings)
+	}
+	sig := data["signatures"].([]interface{})[0].(map[string]interface{})
+	if sig["signedBy"] != "1220abcd" || sig["signature"] != "cafe01" {
+		t.Errorf("unexpected signature: %v", sig)
+	}
+
+	input, _ := json.Marshal(data)
+	if _, err := e.Generate(ctx, imagePath, signedName, input, nil); err != nil {
+		t.Fatalf("Generate() of patched data error = %v", err)
+	}
+
+	errorCases := []struct {
+		path, value, want string
+	}{
+		{"transaction.serail", "1", `did you mean "serial"`},
+		{"transaction.serial", "x", "invalid uint32"},
+		{"transaction.operation", "TOPOLOGY_CHANGE_OP_DELETE", "unknown TopologyChangeOp value"},
+		{"transaction.serial.x", "1", "cannot descend"},
+		{"signatures.signedBy", "x", "repeated field"},
+		{"signatures[0].signature", "zz!", "invalid hex"},
+		{`signatures[signedBy="1220ffff"].signature`, "cafe", "no element"},
+		{`signatures[signer="1220abcd"].signature`, "cafe", "unknown field"},
+	}
+	for _, tc := range errorCases {
+		err := p.Set(data, tc.path, tc.value)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Set(%s=%s) error = %v, want %q", tc.path, tc.value, err, tc.want)
+		}
+	}
+
+	if err := p.Delete(data, "transaction.serail"); err == nil {
+		t.Error("Delete() of an unknown field should fail")
+	}
+	if err := p.Delete(data, "signatures[-1]"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+}
+
+func TestEngine_Edit(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	txName := "com.digitalasset.canton.protocol.v30.TopologyTransaction"
+	signedName := "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction"
+	cfg := &config.Config{
+		Mappings: []config.Mapping{
+			{Type: signedName, Field: "transaction", TargetType: txName, Versioned: true, DefaultVersion: 30},
+		},
+	}
+	e := NewEngine(cfg)
+	ctx := context.Background()
+
+	input := []byte(`{"transaction": {"serial": 1, "operation": "TOPOLOGY_CHANGE_OP_ADD_REPLACE"}, "signatures": [{"signedBy": "a"}]}`)
+	version := int32(30)
+	original, err := e.Generate(ctx, imagePath, signedName, input, &version)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	// No-op edits return the input unchanged
+	out, changes, err := e.Edit(ctx, imagePath, signedName, original, true, Edit{Patch: []byte(`{}`)})
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	if len(changes) != 0 || !bytes.Equal(out, original) {
+		t.Errorf("no-op edit changed the data: %v", changes)
+	}
+
+	// Editing only the signatures keeps the signed transaction bytes
+	out, changes, err = e.Edit(ctx, imagePath, signedName, original, true, Edit{
+		Patch: []byte(`[{"op": "add", "path": "/signatures/-", "value": {"signedBy": "b"}}]`),
+		Unset: []string{"signatures[0]"},
+	})
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	if len(changes) != 1 || changes[0].Path != "signatures[0].signedBy" {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+	decoded, err := e.Decode(ctx, imagePath, signedName, out, true)
+	if err != nil {
+		t.Fatalf("Decode() of edited data error = %v", err)
+	}
+	decodedMap := decoded.(map[string]interface{})
+	if v, ok, _ := processor.VersionOf(decodedMap); !ok || v != 30 {
+		t.Errorf("edited data lost its versioned wrapper: %v", decodedMap[processor.VersionKey])
+	}
+	sigs := decodedMap["signatures"].([]interface{})
+	if len(sigs) != 1 || sigs[0].(map[string]interface{})["signedBy"] != "b" {
+		t.Errorf("unexpected signatures: %v", sigs)
+	}
+
+	// A merge patch and --set style assignment on the nested transaction
+	_, changes, err = e.Edit(ctx, imagePath, signedName, original, true, Edit{
+		Patch: []byte(`{"transaction": {"serial": 2}}`),
+		Set:   []string{"transaction.operation=TOPOLOGY_CHANGE_OP_REMOVE"},
+	})
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	paths := []string{}
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	if strings.Join(paths, ",") != "transaction.operation,transaction.serial" {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+
+	// JSONPath selections reach into the nested transaction and filter list elements
+	_, changes, err = e.Edit(ctx, imagePath, signedName, original, true, Edit{
+		Set:   []string{"$..serial=4"},
+		Unset: []string{`$.signatures[?(@.signedBy=="a")]`},
+	})
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	paths = paths[:0]
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	if strings.Join(paths, ",") != "signatures[0],transaction.serial" {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+
+	if _, _, err := e.Edit(ctx, imagePath, signedName, original, true, Edit{Set: []string{"transaction.serail=3"}}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestEngine_Diff(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	txName := "com.digitalasset.canton.protocol.v30.TopologyTransaction"
+	signedName := "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction"
+	cfg := &config.Config{
+		Mappings: []config.Mapping{
+			{Type: signedName, Field: "transaction", TargetType: txName, Versioned: true, DefaultVersion: 30},
+		},
+	}
+	e := NewEngine(cfg)
+	ctx := context.Background()
+
+	a, err := e.Generate(ctx, imagePath, signedName, []byte(`{"transaction": {"serial": 1}, "signatures": [{"signedBy": "x"}, {"signedBy": "y"}]}`), nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	b, err := e.Generate(ctx, imagePath, signedName, []byte(`{"transaction": {"serial": 2}, "signatures": [{"signedBy": "y"}, {"signedBy": "x"}]}`), nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	changes, err := e.Diff(ctx, imagePath, signedName, a, b, false, diff.Options{Keys: map[string]string{"signatures": "signedBy"}})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	// Only the serial of the nested transaction changed; reordered signatures match by key
+	if len(changes) != 1 || changes[0].Path != "transaction.serial" || changes[0].Old != float64(1) || changes[0].New != float64(2) {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+
+	changes, err = e.Diff(ctx, imagePath, signedName, a, a, false, diff.Options{})
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Diff() of identical payloads = %v, %v", changes, err)
+	}
+}
+
+func TestEngine_JSONSchema(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	txName := "com.digitalasset.canton.protocol.v30.TopologyTransaction"
+	signedName := "com.digitalasset.canton.protocol.v30.SignedTopologyTransaction"
+	cfg := &config.Config{
+		Mappings: []config.Mapping{
+			{Type: signedName, Field: "transaction", TargetType: txName, Versioned: true, DefaultVersion: 30},
+		},
+		Renderers: []config.Renderer{
+			{Type: "com.digitalasset.canton.crypto.v30.SigningPublicKey", Field: "public_key", Format: config.RenderPublicKey},
+			{Type: "com.digitalasset.canton.crypto.v30.Signature", Field: "signature", Format: config.RenderHex},
+		},
+	}
+	e := NewEngine(cfg)
+	ctx := context.Background()
+
+	schema, err := e.JSONSchema(ctx, imagePath, signedName)
+	if err != nil {
+		t.Fatalf("JSONSchema() error = %v", err)
+	}
+	raw, _ := json.Marshal(schema)
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("schema is not JSON: %v", err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource("schema.json", doc); err != nil {
+		t.Fatalf("AddResource() error = %v", err)
+	}
+	validator, err := c.Compile("schema.json")
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	validate := func(data []byte) error {
+		inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		return validator.Validate(inst)
+	}
+
+	pub := ed25519.NewKeyFromSeed(make([]byte, 32)).Public().(ed25519.PublicKey)
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	input, _ := json.Marshal(map[string]interface{}{
+		"transaction": map[string]interface{}{
+			"serial": 1,
+			"mapping": map[string]interface{}{
+				"namespace_delegation": map[string]interface{}{
+					"target_key": map[string]interface{}{"public_key": der},
+				},
+			},
+		},
+		"signatures": []interface{}{
+			map[string]interface{}{"signature": "cafe", "signed_by": "1220ab"},
+		},
+	})
+	// 1. Input with proto field names, which generate accepts
+	if err := validate(input); err != nil {
+		t.Errorf("generate input does not validate: %v", err)
+	}
+	binary, err := e.Generate(ctx, imagePath, signedName, input, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	// 2. Decode output, with and without @raw/@hash, and an edit of it
+	for _, keepRaw := range []bool{false, true} {
+		e.KeepRaw = keepRaw
+		decoded, err := e.Decode(ctx, imagePath, signedName, binary, false)
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		out, _ := json.Marshal(decoded)
+		if err := validate(out); err != nil {
+			t.Errorf("decode output (keep raw %v) does not validate: %v\n%s", keepRaw, err, out)
+		}
+	}
+	edited, _, err := e.Edit(ctx, imagePath, signedName, binary, false, Edit{Set: []string{"transaction.serial=2"}})
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	decoded, _ := e.Decode(ctx, imagePath, signedName, edited, false)
+	out, _ := json.Marshal(decoded)
+	if err := validate(out); err != nil {
+		t.Errorf("edited document does not validate: %v\n%s", err, out)
+	}
+
+	// 3. Unknown fields and values not in the configured form are rejected
+	for _, invalid := range []string{
+		`{"transaction": {"serail": 1}}`,
+		`{"signatures": [{"signature": "zz"}]}`,
+		`{"transaction": {"mapping": {"namespaceDelegation": {"targetKey": {"publicKey": {"fingerprint": "1220"}}}}}}`,
+	} {
+		if err := validate([]byte(invalid)); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
+
+func TestEngine_ProcessorReuse(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	e := NewEngine(&config.Config{})
+	ctx := context.Background()
+	first, _, err := e.processor(ctx, imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every record of a stream goes through the same processor and type registry
+	for i := 0; i < 3; i++ {
+		binary, err := e.Generate(ctx, imagePath, "com.digitalasset.canton.protocol.v30.TopologyTransaction", []byte(`{"serial": 1}`), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Decode(ctx, imagePath, "com.digitalasset.canton.protocol.v30.TopologyTransaction", binary, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if proc, _, _ := e.processor(ctx, imagePath); proc != first {
+		t.Error("expected the processor to be built once per schema")
+	}
+
+	// Engines copied with another KeepRaw share the cache but not the processor
+	withRaw := *e
+	withRaw.KeepRaw = true
+	proc, _, err := withRaw.processor(ctx, imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proc == first || !proc.KeepRaw {
+		t.Error("expected a separate processor keeping the raw bytes")
+	}
+	if again, _, _ := withRaw.processor(ctx, imagePath); again != proc {
+		t.Error("expected the KeepRaw processor to be reused")
+	}
+}
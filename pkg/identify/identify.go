@@ -0,0 +1,266 @@
+package identify
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"buf-lib-poc/pkg/config"
+	"buf-lib-poc/pkg/loader"
+	"buf-lib-poc/pkg/processor"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	wrapperName = "com.digitalasset.canton.version.v1.UntypedVersionedMessage"
+	maxDepth    = 32
+)
+
+// Candidate describes how cleanly a payload parses as a given message type.
+type Candidate struct {
+	Name           string  `json:"name"`
+	Score          float64 `json:"score"`
+	Versioned      bool    `json:"versioned"`
+	Version        int32   `json:"version,omitempty"`
+	KnownFields    int     `json:"known_fields"`
+	UnknownBytes   int     `json:"unknown_bytes"`
+	InvalidEnums   int     `json:"invalid_enums"`
+	InvalidStrings int     `json:"invalid_strings"`
+	MappedOK       int     `json:"mapped_ok"`
+	MappedFailed   int     `json:"mapped_failed"`
+}
+
+// Identifier scores binary payloads against the messages of a loaded schema.
+type Identifier struct {
+	Files  []protoreflect.FileDescriptor
+	Config *config.Config
+}
+
+// Identify parses data as every candidate message (all messages in the schema if none
+// are given) and returns the candidates that parse, best match first. If the payload is
+// an UntypedVersionedMessage, the wrapped data is tried as well.
+func (id *Identifier) Identify(data []byte, candidates []string) ([]Candidate, error) {
+	var descs []protoreflect.MessageDescriptor
+	if len(candidates) == 0 {
+		for _, md := range loader.AllMessages(id.Files) {
+			if string(md.FullName()) != wrapperName {
+				descs = append(descs, md)
+			}
+		}
+	} else {
+		for _, name := range candidates {
+			md := loader.FindMessage(id.Files, name)
+			if md == nil {
+				return nil, fmt.Errorf("could not find message: %s", name)
+			}
+			descs = append(descs, md)
+		}
+	}
+
+	inner, version, wrapped := id.unwrap(data)
+
+	var results []Candidate
+	for _, md := range descs {
+		if c, ok := id.score(md, data); ok {
+			results = append(results, c)
+		}
+		if wrapped {
+			if c, ok := id.score(md, inner); ok {
+				c.Versioned = true
+				c.Version = version
+				results = append(results, c)
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].KnownFields != results[j].KnownFields {
+			return results[i].KnownFields > results[j].KnownFields
+		}
+		return results[i].Name < results[j].Name
+	})
+	return results, nil
+}
+
+// unwrap returns the payload of an UntypedVersionedMessage if data cleanly parses as one.
+func (id *Identifier) unwrap(data []byte) ([]byte, int32, bool) {
+	wrapperDesc := loader.FindMessage(id.Files, wrapperName)
+	if wrapperDesc == nil {
+		return nil, 0, false
+	}
+	wrapperMsg := dynamicpb.NewMessage(wrapperDesc)
+	if err := proto.Unmarshal(data, wrapperMsg); err != nil || len(wrapperMsg.GetUnknown()) > 0 {
+		return nil, 0, false
+	}
+	inner := wrapperMsg.Get(wrapperDesc.Fields().ByName("data")).Bytes()
+	version := int32(wrapperMsg.Get(wrapperDesc.Fields().ByName("version")).Int())
+	if len(inner) == 0 || version <= 0 {
+		return nil, 0, false
+	}
+	return inner, version, true
+}
+
+type stats struct {
+	known, unknown, badEnums, badStrings, mappedOK, mappedFailed int
+}
+
+func (id *Identifier) score(md protoreflect.MessageDescriptor, data []byte) (Candidate, bool) {
+	if len(data) == 0 {
+		return Candidate{}, false
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return Candidate{}, false
+	}
+
+	st := &stats{}
+	id.inspect(msg, st, 0)
+	if st.known == 0 {
+		return Candidate{}, false
+	}
+
+	// Fraction of the payload covered by known fields, minus penalties for
+	// values that parse but make no sense, plus a bonus for mapped payloads.
+	score := 1 - float64(st.unknown)/float64(len(data))
+	score -= 0.25 * float64(st.badEnums+st.badStrings)
+	score -= 0.5 * float64(st.mappedFailed)
+	score += 0.05 * float64(st.mappedOK)
+	if score <= 0 {
+		return Candidate{}, false
+	}
+
+	return Candidate{
+		Name:           string(md.FullName()),
+		Score:          score,
+		KnownFields:    st.known,
+		UnknownBytes:   st.unknown,
+		InvalidEnums:   st.badEnums,
+		InvalidStrings: st.badStrings,
+		MappedOK:       st.mappedOK,
+		MappedFailed:   st.mappedFailed,
+	}, true
+}
+
+func (id *Identifier) inspect(m protoreflect.Message, st *stats, depth int) {
+	st.unknown += len(m.GetUnknown())
+	md := m.Descriptor()
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		st.known++
+
+		var mapping *config.Mapping
+		target := ""
+		if fd.Kind() == protoreflect.BytesKind || (fd.IsMap() && fd.MapValue().Kind() == protoreflect.BytesKind) {
+			mapping = id.Config.FindMapping(string(md.FullName()), string(fd.Name()), processor.OneofName(fd))
+			if mapping != nil {
+				target = mapping.ResolveTarget(discriminatorValue(m, mapping.Discriminator))
+			}
+		}
+		visit := func(vfd protoreflect.FieldDescriptor, ev protoreflect.Value) {
+			if target != "" {
+				id.inspectMapped(ev.Bytes(), mapping, target, st, depth)
+			} else {
+				id.inspectValue(vfd, ev, st, depth)
+			}
+		}
+
+		switch {
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				visit(fd, list.Get(i))
+			}
+		case fd.IsMap():
+			v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				if fd.MapKey().Kind() == protoreflect.StringKind && !utf8.ValidString(k.String()) {
+					st.badStrings++
+				}
+				visit(fd.MapValue(), mv)
+				return true
+			})
+		default:
+			visit(fd, v)
+		}
+		return true
+	})
+}
+
+func (id *Identifier) inspectValue(fd protoreflect.FieldDescriptor, v protoreflect.Value, st *stats, depth int) {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if fd.Enum().Values().ByNumber(v.Enum()) == nil {
+			st.badEnums++
+		}
+	case protoreflect.StringKind:
+		if !utf8.ValidString(v.String()) {
+			st.badStrings++
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if depth < maxDepth {
+			id.inspect(v.Message(), st, depth+1)
+		}
+	}
+}
+
+func (id *Identifier) inspectMapped(data []byte, m *config.Mapping, target string, st *stats, depth int) {
+	if depth >= maxDepth {
+		return
+	}
+	nested, ok := id.decodeMapped(data, m, target)
+	if !ok {
+		st.mappedFailed++
+		return
+	}
+	st.mappedOK++
+	id.inspect(nested, st, depth+1)
+}
+
+func (id *Identifier) decodeMapped(data []byte, m *config.Mapping, target string) (protoreflect.Message, bool) {
+	if m.Versioned {
+		inner, _, ok := id.unwrap(data)
+		if !ok {
+			return nil, false
+		}
+		data = inner
+	}
+	targetDesc := loader.FindMessage(id.Files, target)
+	if targetDesc == nil {
+		return nil, false
+	}
+	targetMsg := dynamicpb.NewMessage(targetDesc)
+	if err := proto.Unmarshal(data, targetMsg); err != nil {
+		return nil, false
+	}
+	return targetMsg, true
+}
+
+// discriminatorValue reads the value selecting a mapping's target type, mirroring the JSON-based
+// lookup of the processor: oneofs yield the populated member name and enums their value name.
+func discriminatorValue(m protoreflect.Message, discriminator string) string {
+	if discriminator == "" {
+		return ""
+	}
+	md := m.Descriptor()
+	if od := md.Oneofs().ByName(protoreflect.Name(discriminator)); od != nil {
+		if fd := m.WhichOneof(od); fd != nil {
+			return string(fd.Name())
+		}
+		return ""
+	}
+	fd := md.Fields().ByName(protoreflect.Name(discriminator))
+	if fd == nil {
+		return ""
+	}
+	v := m.Get(fd)
+	if fd.Kind() == protoreflect.EnumKind {
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,80 @@
+package identify
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"buf-lib-poc/pkg/config"
+	"buf-lib-poc/pkg/loader"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestIdentify(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	l := &loader.SchemaLoader{}
+	files, err := l.LoadSchema(context.Background(), imagePath)
+	if err != nil {
+		t.Fatalf("LoadSchema() error = %v", err)
+	}
+
+	txDesc := loader.FindMessage(files, "com.digitalasset.canton.protocol.v30.TopologyTransaction")
+	tx := dynamicpb.NewMessage(txDesc)
+	if err := protojson.Unmarshal([]byte(`{"operation": "TOPOLOGY_CHANGE_OP_ADD_REPLACE", "serial": 7, "mapping": {"namespaceDelegation": {"namespace": "ns"}}}`), tx); err != nil {
+		t.Fatal(err)
+	}
+	txBytes, _ := proto.Marshal(tx)
+
+	wrapperDesc := loader.FindMessage(files, wrapperName)
+	wrapper := dynamicpb.NewMessage(wrapperDesc)
+	wrapper.Set(wrapperDesc.Fields().ByName("data"), protoreflect.ValueOfBytes(txBytes))
+	wrapper.Set(wrapperDesc.Fields().ByName("version"), protoreflect.ValueOfInt32(30))
+	wrappedBytes, _ := proto.Marshal(wrapper)
+
+	candidates := []string{
+		"com.digitalasset.canton.protocol.v30.TopologyTransaction",
+		"com.digitalasset.canton.protocol.v30.SignedTopologyTransaction",
+		"com.digitalasset.canton.crypto.v30.SigningPublicKey",
+	}
+	id := &Identifier{Files: files, Config: &config.Config{}}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		versioned bool
+	}{
+		{"plain", txBytes, false},
+		{"versioned", wrappedBytes, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := id.Identify(tt.data, candidates)
+			if err != nil {
+				t.Fatalf("Identify() error = %v", err)
+			}
+			if len(results) == 0 {
+				t.Fatal("Identify() returned no candidates")
+			}
+			best := results[0]
+			if best.Name != candidates[0] || best.Versioned != tt.versioned {
+				t.Errorf("best match = %s (versioned=%v), want %s (versioned=%v)", best.Name, best.Versioned, candidates[0], tt.versioned)
+			}
+			if best.UnknownBytes != 0 {
+				t.Errorf("expected no unknown bytes for best match, got %d", best.UnknownBytes)
+			}
+		})
+	}
+
+	if _, err := id.Identify(txBytes, []string{"does.not.Exist"}); err == nil {
+		t.Error("expected error for unknown candidate")
+	}
+}
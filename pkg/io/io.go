@@ -2,73 +2,182 @@ package io
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"strings"
 )
 
-// ReadData reads data from a string or file path.
-// If input starts with '@', the rest is treated as a file path.
-// If input matches a file on disk but is missing '@', it returns an error.
-// Otherwise, the input is treated as literal data.
+// Strict disables guessing the encoding of literal inputs: without a scheme they are read as
+// text (or base64 when the caller asks for it).
+var Strict bool
+
+// Input encodings, usable as a scheme prefix of a literal ("hex:00ff") or as a suffix of a file,
+// stdin or environment input ("@key.txt:hex", "-:base64", "env:KEY:base64").
+const (
+	EncodingHex       = "hex"
+	EncodingBase64    = "base64"
+	EncodingBase64URL = "base64url"
+	EncodingText      = "text"
+)
+
+// ReadData reads input data:
+//   - "-" reads stdin and "@path" a file; a ":encoding" suffix decodes the content;
+//   - "env:NAME" reads an environment variable, also with an optional ":encoding" suffix;
+//   - "hex:", "base64:", "base64url:" and "text:" prefixes decode a literal explicitly;
+//   - any other input is a literal. If it matches a file on disk but is missing '@', it returns an error.
+//
+// isBase64 decodes inputs without an explicit encoding as base64. Otherwise a literal that looks
+// like base64 is decoded as such with a warning, unless Strict is set; hex strings are never guessed.
 func ReadData(input string, isBase64 bool) ([]byte, error) {
-	var rawData []byte
-	var err error
+	defaultEncoding := ""
+	if isBase64 {
+		defaultEncoding = EncodingBase64
+	}
 
 	switch {
-	case input == "-":
-		rawData, err = io.ReadAll(os.Stdin)
+	case input == "-" || strings.HasPrefix(input, "-:"):
+		encoding := strings.TrimPrefix(strings.TrimPrefix(input, "-"), ":")
+		if encoding != "" && !isEncoding(encoding) {
+			return nil, fmt.Errorf("unknown encoding %q for stdin", encoding)
+		}
+		rawData, err := io.ReadAll(os.Stdin)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read from stdin: %v", err)
 		}
+		return decode(rawData, firstOf(encoding, defaultEncoding))
+
 	case strings.HasPrefix(input, "@"):
-		path := strings.TrimPrefix(input, "@")
-		rawData, err = os.ReadFile(path)
+		path, encoding := splitEncoding(strings.TrimPrefix(input, "@"))
+		rawData, err := os.ReadFile(path)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read file %s: %v", path, err)
 		}
-	default:
-		// Check if it looks like a file but user forgot '@'
-		if info, fsErr := os.Stat(input); fsErr == nil && !info.IsDir() {
-			return nil, fmt.Errorf("input %q matches a file on disk but is missing '@' prefix. To read from file, use '@%s'", input, input)
-		}
+		return decode(rawData, firstOf(encoding, defaultEncoding))
 
-		// Remove "base64:" prefix if present for convenience
-		if strings.HasPrefix(input, "base64:") {
-			input = strings.TrimPrefix(input, "base64:")
-			isBase64 = true
+	case strings.HasPrefix(input, "env:"):
+		name, encoding := splitEncoding(strings.TrimPrefix(input, "env:"))
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
 		}
-		rawData = []byte(input)
-
-		// Smart autodetection: if not explicitly a file/stdin and not already marked as base64,
-		// try decoding it as base64 if it looks like one.
-		if !isBase64 && len(input) > 0 {
-			// Basic heuristic: check if it's long enough and has base64-like characters,
-			// and attempt decoding. If it fails, we treat it as raw text.
-			if decoded, err := base64.StdEncoding.DecodeString(input); err == nil {
-				// To avoid false positives for very short strings (like "root"),
-				// we only auto-decode if it's long (>16 chars) or contains padding "="
-				if len(input) > 16 || strings.HasSuffix(input, "=") {
-					return decoded, nil
-				}
-			}
+		return decode([]byte(value), firstOf(encoding, defaultEncoding))
+	}
+
+	if scheme, literal, ok := strings.Cut(input, ":"); ok && isEncoding(scheme) {
+		return decode([]byte(literal), scheme)
+	}
+
+	// Check if it looks like a file but user forgot '@'
+	if info, fsErr := os.Stat(input); fsErr == nil && !info.IsDir() {
+		return nil, fmt.Errorf("input %q matches a file on disk but is missing '@' prefix. To read from file, use '@%s'", input, input)
+	}
+	if defaultEncoding != "" {
+		return decode([]byte(input), defaultEncoding)
+	}
+	if !Strict && looksLikeBase64(input) {
+		if decoded, err := base64.StdEncoding.DecodeString(input); err == nil {
+			log.Printf("warning: guessed that input %q is base64; prefix it with base64: or text: to be explicit (--strict-input disables guessing)", abbreviate(input))
+			return decoded, nil
 		}
 	}
+	return []byte(input), nil
+}
 
-	if isBase64 {
-		// Try standard decoding, then URL decoding if it fails
-		decoded, err := base64.StdEncoding.DecodeString(string(rawData))
+// looksLikeBase64 is the guessing heuristic for literals: long enough or padded, and not hex, as
+// hex strings such as fingerprints are also valid base64.
+func looksLikeBase64(s string) bool {
+	if len(s) <= 16 && !strings.HasSuffix(s, "=") {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err != nil
+}
+
+func isEncoding(s string) bool {
+	switch s {
+	case EncodingHex, EncodingBase64, EncodingBase64URL, EncodingText:
+		return true
+	}
+	return false
+}
+
+// splitEncoding splits a known ":encoding" suffix off a path or variable name.
+func splitEncoding(s string) (string, string) {
+	if i := strings.LastIndex(s, ":"); i >= 0 && isEncoding(s[i+1:]) {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+func decode(data []byte, encoding string) ([]byte, error) {
+	text := strings.TrimSpace(string(data))
+	switch encoding {
+	case EncodingHex:
+		text = strings.TrimPrefix(strings.TrimPrefix(text, "0x"), "0X")
+		decoded, err := hex.DecodeString(strings.Join(strings.Fields(text), ""))
 		if err != nil {
-			decoded, err = base64.URLEncoding.DecodeString(string(rawData))
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode base64: %v", err)
-			}
+			return nil, fmt.Errorf("failed to decode hex: %v", err)
+		}
+		return decoded, nil
+	case EncodingBase64:
+		return DecodeBase64(strings.Join(strings.Fields(text), ""))
+	case EncodingBase64URL:
+		text = strings.TrimRight(strings.Join(strings.Fields(text), ""), "=")
+		decoded, err := base64.RawURLEncoding.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64url: %v", err)
 		}
 		return decoded, nil
 	}
+	return data, nil
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func abbreviate(s string) string {
+	if len(s) > 24 {
+		return s[:20] + "..."
+	}
+	return s
+}
 
-	return rawData, nil
+// OpenInput opens an input for streaming: "-" is stdin, "@path" a file and anything else the
+// literal text. The caller closes the result.
+func OpenInput(input string) (io.ReadCloser, error) {
+	switch {
+	case input == "-":
+		return io.NopCloser(os.Stdin), nil
+	case strings.HasPrefix(input, "@"):
+		path := strings.TrimPrefix(input, "@")
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file %s: %v", path, err)
+		}
+		return f, nil
+	}
+	return io.NopCloser(strings.NewReader(input)), nil
+}
+
+// DecodeBase64 decodes standard or URL-safe base64, with or without padding.
+func DecodeBase64(s string) ([]byte, error) {
+	var err error
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		var decoded []byte
+		if decoded, err = enc.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to decode base64: %v", err)
 }
 
 // EncodeData encodes binary data to string (optionally base64).
@@ -3,6 +3,7 @@ package io
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/hex"
 	"os"
 	"testing"
 )
@@ -20,6 +21,16 @@ func TestReadData(t *testing.T) {
 	}
 	tmpfile.Close()
 
+	hexfile, err := os.CreateTemp("", "proton-test-hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(hexfile.Name())
+	hexfile.WriteString(hex.EncodeToString(content) + "\n")
+	hexfile.Close()
+
+	t.Setenv("PROTON_TEST_INPUT", "68656c6c6f")
+
 	tests := []struct {
 		name     string
 		input    string
@@ -58,6 +69,67 @@ func TestReadData(t *testing.T) {
 			input:    "root",
 			expected: []byte("root"),
 		},
+		{
+			name:     "no autodetect for hex fingerprint",
+			input:    "1220" + hex.EncodeToString(bytes.Repeat([]byte{0xab}, 32)),
+			expected: []byte("1220" + hex.EncodeToString(bytes.Repeat([]byte{0xab}, 32))),
+		},
+		{
+			name:     "hex scheme",
+			input:    "hex:68656c6c6f",
+			expected: []byte("hello"),
+		},
+		{
+			name:     "base64url scheme",
+			input:    "base64url:-_8B",
+			expected: []byte{0xfb, 0xff, 0x01},
+		},
+		{
+			name:     "text scheme",
+			input:    "text:" + base64.StdEncoding.EncodeToString([]byte("this is a long enough string for autodetection")),
+			expected: []byte(base64.StdEncoding.EncodeToString([]byte("this is a long enough string for autodetection"))),
+		},
+		{
+			name:     "file with encoding suffix",
+			input:    "@" + hexfile.Name() + ":hex",
+			expected: content,
+		},
+		{
+			name:     "file suffix overrides base64 flag",
+			input:    "@" + hexfile.Name() + ":hex",
+			isBase64: true,
+			expected: content,
+		},
+		{
+			name:     "environment variable",
+			input:    "env:PROTON_TEST_INPUT",
+			expected: []byte("68656c6c6f"),
+		},
+		{
+			name:     "environment variable with encoding",
+			input:    "env:PROTON_TEST_INPUT:hex",
+			expected: []byte("hello"),
+		},
+		{
+			name:    "unset environment variable",
+			input:   "env:PROTON_TEST_UNSET",
+			wantErr: true,
+		},
+		{
+			name:    "invalid hex",
+			input:   "hex:zz",
+			wantErr: true,
+		},
+		{
+			name:    "file without @",
+			input:   tmpfile.Name(),
+			wantErr: true,
+		},
+		{
+			name:     "unknown scheme is a literal",
+			input:    "party::1220ab",
+			expected: []byte("party::1220ab"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -73,3 +145,18 @@ func TestReadData(t *testing.T) {
 		})
 	}
 }
+
+func TestReadData_Strict(t *testing.T) {
+	Strict = true
+	defer func() { Strict = false }()
+
+	encoded := base64.StdEncoding.EncodeToString([]byte("this is a long enough string for autodetection"))
+	got, err := ReadData(encoded, false)
+	if err != nil || string(got) != encoded {
+		t.Errorf("expected the literal in strict mode, got %q, %v", got, err)
+	}
+	got, err = ReadData("base64:"+encoded, false)
+	if err != nil || string(got) != "this is a long enough string for autodetection" {
+		t.Errorf("expected explicit schemes to work in strict mode, got %q, %v", got, err)
+	}
+}
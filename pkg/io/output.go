@@ -0,0 +1,244 @@
+package io
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Output formats selectable with --output.
+const (
+	FormatText      = "text"      // human-readable output of the command
+	FormatBinary    = "binary"    // raw bytes
+	FormatBase64    = "base64"    // standard base64
+	FormatBase64URL = "base64url" // unpadded URL-safe base64
+	FormatHex       = "hex"       // lowercase hex
+	FormatJSON      = "json"      // indented JSON, protojson for messages
+	FormatCompact   = "compact"   // single-line JSON
+	FormatJSONL     = "jsonl"     // one compact JSON value per line; lists are written element by element
+	FormatProtoText = "prototext" // protobuf text format
+
+	FormatProtoJSON = "protojson" // alias of json
+)
+
+// Formats lists the output formats in the order they are documented.
+var Formats = []string{FormatText, FormatBinary, FormatBase64, FormatBase64URL, FormatHex,
+	FormatJSON, FormatCompact, FormatJSONL, FormatProtoText}
+
+// Resolver resolves the types referenced by Any fields when rendering messages.
+type Resolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+// Value is the result of a command in the forms it can be rendered from. Byte formats use Bytes,
+// or the serialized Message; JSON formats use JSON, or the protojson form of Message; prototext
+// needs Message; text uses Text, or falls back to the JSON form.
+type Value struct {
+	Bytes    []byte
+	JSON     interface{}
+	Message  proto.Message
+	Resolver Resolver // optional, for Any fields of Message
+	Text     string
+}
+
+// Output writes command results in a selected format to stdout or a file.
+type Output struct {
+	Format string // one of Formats; empty selects the command's default
+	Path   string // file to write to; empty or "-" for stdout
+	Stdout io.Writer
+}
+
+// FormatFor returns the format in effect for a command whose default is def.
+func (o *Output) FormatFor(def string) string {
+	if o.Format != "" {
+		return o.Format
+	}
+	return def
+}
+
+// Structured reports whether format renders the structure of a value, as JSON or text format,
+// rather than its bytes or text.
+func Structured(format string) bool {
+	switch format {
+	case FormatJSON, FormatCompact, FormatJSONL, FormatProtoText:
+		return true
+	}
+	return false
+}
+
+// ToFile reports whether output goes to a file rather than stdout.
+func (o *Output) ToFile() bool {
+	return o.Path != "" && o.Path != "-"
+}
+
+// Write renders v in the selected format, or def if none was selected, and writes it out.
+func (o *Output) Write(v Value, def string) error {
+	data, err := Render(v, o.FormatFor(def))
+	if err != nil {
+		return err
+	}
+	if o.ToFile() {
+		if err := os.WriteFile(o.Path, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", o.Path, err)
+		}
+		return nil
+	}
+	w := o.Stdout
+	if w == nil {
+		w = os.Stdout
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Create opens the destination for streamed output: the file at Path, or stdout. The caller
+// closes the result.
+func (o *Output) Create() (io.WriteCloser, error) {
+	if o.ToFile() {
+		f, err := os.Create(o.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %v", o.Path, err)
+		}
+		return f, nil
+	}
+	w := o.Stdout
+	if w == nil {
+		w = os.Stdout
+	}
+	return nopWriteCloser{w}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// Render encodes v in format. Every format except binary ends with a newline.
+func Render(v Value, format string) ([]byte, error) {
+	if format == FormatProtoJSON {
+		format = FormatJSON
+	}
+	switch format {
+	case FormatBinary, FormatBase64, FormatBase64URL, FormatHex:
+		data := v.Bytes
+		if data == nil && v.Message != nil {
+			var err error
+			data, err = proto.MarshalOptions{Deterministic: true}.Marshal(v.Message)
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize message: %v", err)
+			}
+		}
+		if data == nil {
+			return nil, unsupported(format)
+		}
+		switch format {
+		case FormatBase64:
+			return line(base64.StdEncoding.EncodeToString(data)), nil
+		case FormatBase64URL:
+			return line(base64.RawURLEncoding.EncodeToString(data)), nil
+		case FormatHex:
+			return line(hex.EncodeToString(data)), nil
+		}
+		return data, nil
+
+	case FormatJSON, FormatCompact, FormatJSONL:
+		if v.JSON == nil && v.Message != nil {
+			jsonData, err := protojson.MarshalOptions{Resolver: v.Resolver}.Marshal(v.Message)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert message to JSON: %v", err)
+			}
+			// reformat rather than re-marshal to keep the field order of protojson
+			var buf bytes.Buffer
+			if format == FormatJSON {
+				err = json.Indent(&buf, jsonData, "", "  ")
+			} else {
+				err = json.Compact(&buf, jsonData)
+			}
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteByte('\n')
+			return buf.Bytes(), nil
+		}
+		if v.JSON == nil && v.Text != "" {
+			v.JSON = v.Text
+		}
+		if v.JSON == nil {
+			return nil, unsupported(format)
+		}
+		return renderJSON(v.JSON, format)
+
+	case FormatProtoText:
+		if v.Message == nil {
+			return nil, unsupported(format)
+		}
+		out, err := prototext.MarshalOptions{Multiline: true, Indent: "  ", Resolver: v.Resolver}.Marshal(v.Message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert message to text format: %v", err)
+		}
+		return out, nil
+
+	case FormatText:
+		if v.Text != "" {
+			return line(strings.TrimSuffix(v.Text, "\n")), nil
+		}
+		if v.JSON != nil || v.Message != nil {
+			return Render(v, FormatJSON)
+		}
+		if v.Bytes != nil {
+			return Render(v, FormatHex)
+		}
+		return nil, unsupported(format)
+	}
+	return nil, fmt.Errorf("unknown output format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+func renderJSON(v interface{}, format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	case FormatJSONL:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+			var buf bytes.Buffer
+			for i := 0; i < rv.Len(); i++ {
+				out, err := json.Marshal(rv.Index(i).Interface())
+				if err != nil {
+					return nil, err
+				}
+				buf.Write(out)
+				buf.WriteByte('\n')
+			}
+			return buf.Bytes(), nil
+		}
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func line(s string) []byte {
+	return []byte(s + "\n")
+}
+
+func unsupported(format string) error {
+	return fmt.Errorf("output format %q is not available for this command", format)
+}
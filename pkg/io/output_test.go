@@ -0,0 +1,88 @@
+package io
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRender(t *testing.T) {
+	data := []byte{0xfb, 0xff, 0x01}
+	msg := wrapperspb.String("hi")
+	list := []interface{}{map[string]interface{}{"a": 1.0}, "b"}
+
+	tests := []struct {
+		name     string
+		value    Value
+		format   string
+		expected string
+		wantErr  bool
+	}{
+		{"binary", Value{Bytes: data}, FormatBinary, string(data), false},
+		{"base64", Value{Bytes: data}, FormatBase64, "+/8B\n", false},
+		{"base64url", Value{Bytes: data}, FormatBase64URL, "-_8B\n", false},
+		{"hex", Value{Bytes: data}, FormatHex, "fbff01\n", false},
+		{"message bytes", Value{Message: msg}, FormatHex, "0a026869\n", false},
+		{"json", Value{JSON: map[string]interface{}{"a": 1}}, FormatJSON, "{\n  \"a\": 1\n}\n", false},
+		{"compact", Value{JSON: map[string]interface{}{"a": []int{1, 2}}}, FormatCompact, "{\"a\":[1,2]}\n", false},
+		{"jsonl list", Value{JSON: list}, FormatJSONL, "{\"a\":1}\n\"b\"\n", false},
+		{"jsonl object", Value{JSON: map[string]interface{}{"a": 1}}, FormatJSONL, "{\"a\":1}\n", false},
+		{"protojson", Value{Message: msg}, FormatProtoJSON, "\"hi\"\n", false},
+		{"prototext", Value{Message: msg}, FormatProtoText, "value: \"hi\"\n", false},
+		{"text", Value{Text: "done", JSON: 1}, FormatText, "done\n", false},
+		{"text falls back to json", Value{JSON: []int{1}}, FormatText, "[\n  1\n]\n", false},
+		{"json of text", Value{Text: "1220ab"}, FormatJSON, "\"1220ab\"\n", false},
+		{"prototext without message", Value{Bytes: data}, FormatProtoText, "", true},
+		{"binary without bytes", Value{JSON: 1}, FormatBinary, "", true},
+		{"unknown format", Value{Bytes: data}, "yaml", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.value, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.format == FormatProtoText {
+				// prototext output has unstable whitespace
+				got = []byte(strings.Join(strings.Fields(string(got)), " ") + "\n")
+			}
+			if !tt.wantErr && string(got) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestOutput_Write(t *testing.T) {
+	var buf bytes.Buffer
+	out := &Output{Stdout: &buf}
+	if err := out.Write(Value{Bytes: []byte{1, 2}}, FormatHex); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "0102\n" {
+		t.Errorf("expected the default format, got %q", buf.String())
+	}
+
+	buf.Reset()
+	out.Format = FormatBase64
+	out.Write(Value{Bytes: []byte{1, 2}}, FormatHex)
+	if buf.String() != "AQI=\n" {
+		t.Errorf("expected the selected format, got %q", buf.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "out.bin")
+	out = &Output{Format: FormatBinary, Path: path, Stdout: &buf}
+	buf.Reset()
+	if err := out.Write(Value{Bytes: []byte{1, 2}}, FormatHex); err != nil {
+		t.Fatal(err)
+	}
+	written, _ := os.ReadFile(path)
+	if !bytes.Equal(written, []byte{1, 2}) || buf.Len() != 0 {
+		t.Errorf("expected the file to hold the output, got %x (stdout %q)", written, buf.String())
+	}
+}
@@ -0,0 +1,104 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DefaultMaxRecordSize bounds the length prefix accepted by NewDelimitedReader.
+const DefaultMaxRecordSize = 64 << 20
+
+// RecordReader yields the records of a stream one at a time. Next returns io.EOF after the last record.
+type RecordReader interface {
+	Next() ([]byte, error)
+}
+
+type delimitedReader struct {
+	r       *bufio.Reader
+	maxSize int
+	offset  int64
+}
+
+// NewDelimitedReader reads varint length-prefixed records, the framing of protodelim and of Java's
+// writeDelimitedTo. Records larger than maxSize (DefaultMaxRecordSize if zero) are rejected.
+func NewDelimitedReader(r io.Reader, maxSize int) RecordReader {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxRecordSize
+	}
+	return &delimitedReader{r: bufio.NewReader(r), maxSize: maxSize}
+}
+
+func (d *delimitedReader) Next() ([]byte, error) {
+	start := d.offset
+	size, err := binary.ReadUvarint(d)
+	if err == io.EOF && d.offset == start {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid length prefix at offset %d: %v", start, unexpectedEOF(err))
+	}
+	if size > uint64(d.maxSize) {
+		return nil, fmt.Errorf("record at offset %d is %d bytes, more than the limit of %d", start, size, d.maxSize)
+	}
+	record := make([]byte, size)
+	n, err := io.ReadFull(d.r, record)
+	d.offset += int64(n)
+	if err != nil {
+		return nil, fmt.Errorf("truncated record at offset %d: %v", start, unexpectedEOF(err))
+	}
+	return record, nil
+}
+
+func (d *delimitedReader) ReadByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err == nil {
+		d.offset++
+	}
+	return b, err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type lineReader struct {
+	s *bufio.Scanner
+}
+
+// NewLineReader reads newline-separated records, trimming surrounding whitespace. Blank lines are
+// skipped.
+func NewLineReader(r io.Reader, maxSize int) RecordReader {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxRecordSize
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxSize)
+	return &lineReader{s: s}
+}
+
+func (l *lineReader) Next() ([]byte, error) {
+	for l.s.Scan() {
+		if line := bytes.TrimSpace(l.s.Bytes()); len(line) > 0 {
+			// copy, as the scanner reuses its buffer
+			return append([]byte(nil), line...), nil
+		}
+	}
+	if err := l.s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// AppendDelimited appends record to b with a varint length prefix.
+func AppendDelimited(b, record []byte) []byte {
+	b = protowire.AppendVarint(b, uint64(len(record)))
+	return append(b, record...)
+}
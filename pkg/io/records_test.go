@@ -0,0 +1,83 @@
+package io
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, r RecordReader) ([][]byte, error) {
+	t.Helper()
+	var out [][]byte
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, rec)
+	}
+}
+
+func TestDelimitedReader(t *testing.T) {
+	long := bytes.Repeat([]byte{7}, 300)
+	var stream []byte
+	for _, rec := range [][]byte{{1, 2}, {}, long} {
+		stream = AppendDelimited(stream, rec)
+	}
+
+	got, err := readAll(t, NewDelimitedReader(bytes.NewReader(stream), 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 3 || !bytes.Equal(got[0], []byte{1, 2}) || len(got[1]) != 0 || !bytes.Equal(got[2], long) {
+		t.Errorf("unexpected records: %v", got)
+	}
+
+	tests := []struct {
+		name   string
+		stream []byte
+		max    int
+	}{
+		{"truncated record", stream[:len(stream)-1], 0},
+		{"truncated length", []byte{0x80}, 0},
+		{"record too large", stream, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readAll(t, NewDelimitedReader(bytes.NewReader(tt.stream), tt.max)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	got, err := readAll(t, NewLineReader(strings.NewReader("a\r\n\n  b  \n \t\nc\n\n"), 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"a", "b", "c"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %q", expected, got)
+	}
+	for i := range expected {
+		if string(got[i]) != expected[i] {
+			t.Errorf("record %d: expected %q, got %q", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestDecodeBase64(t *testing.T) {
+	for _, s := range []string{"+/8B", "-_8B", "+/8=", "+/8"} {
+		if _, err := DecodeBase64(s); err != nil {
+			t.Errorf("DecodeBase64(%q) error = %v", s, err)
+		}
+	}
+	if _, err := DecodeBase64("!!"); err == nil {
+		t.Error("expected an error for invalid base64")
+	}
+}
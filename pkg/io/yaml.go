@@ -0,0 +1,188 @@
+package io
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ToJSON returns data as JSON, converting it from YAML unless it already is valid JSON.
+func ToJSON(data []byte) ([]byte, error) {
+	if json.Valid(data) {
+		return data, nil
+	}
+	return YAMLToJSON(data)
+}
+
+// YAMLToJSON converts a single YAML document to JSON.
+//
+// Plain scalars resolve to null, booleans and numbers as in the YAML 1.2 core schema; quote values
+// that must stay strings. Anchors, aliases and merge keys are resolved. Multiple documents,
+// collections as mapping keys and custom tags have no JSON form and are rejected.
+func YAMLToJSON(data []byte) ([]byte, error) {
+	v, err := ParseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// ParseYAML parses a single YAML document into JSON-compatible values. Integers are kept exactly as
+// json.Number.
+func ParseYAML(data []byte) (interface{}, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var doc yaml.Node
+	if err := dec.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("invalid YAML: %v", err)
+	}
+	var next yaml.Node
+	if err := dec.Decode(&next); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid YAML: expected a single document")
+	}
+	c := &yamlConverter{}
+	return c.value(&doc)
+}
+
+// maxYAMLValues bounds the values an aliased document expands to.
+const maxYAMLValues = 1 << 20
+
+type yamlConverter struct {
+	values int
+}
+
+// value converts a node to the value encoding/json would decode from its JSON form.
+func (c *yamlConverter) value(n *yaml.Node) (interface{}, error) {
+	if c.values++; c.values > maxYAMLValues {
+		return nil, yamlErrorf(n, "document expands to more than %d values", maxYAMLValues)
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return c.value(n.Content[0])
+	case yaml.AliasNode:
+		return c.value(n.Alias)
+	case yaml.SequenceNode:
+		list := make([]interface{}, 0, len(n.Content))
+		for _, item := range n.Content {
+			v, err := c.value(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case yaml.MappingNode:
+		obj := map[string]interface{}{}
+		return obj, c.mapping(obj, n)
+	case yaml.ScalarNode:
+		return yamlScalar(n)
+	}
+	return nil, yamlErrorf(n, "unsupported node")
+}
+
+// mapping adds the entries of a mapping node to obj. Entries of merge keys (<<) do not override
+// the mapping's own, and earlier merged mappings take precedence over later ones.
+func (c *yamlConverter) mapping(obj map[string]interface{}, n *yaml.Node) error {
+	var merged []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind == yaml.ScalarNode && k.ShortTag() == "!!merge" {
+			merged = append(merged, v)
+			continue
+		}
+		if k.Kind != yaml.ScalarNode {
+			return yamlErrorf(k, "mapping keys must be scalars")
+		}
+		if _, ok := obj[k.Value]; ok {
+			return yamlErrorf(k, "duplicate key %q", k.Value)
+		}
+		val, err := c.value(v)
+		if err != nil {
+			return err
+		}
+		obj[k.Value] = val
+	}
+	for _, m := range merged {
+		if m.Kind == yaml.AliasNode {
+			m = m.Alias
+		}
+		sources := []*yaml.Node{m}
+		if m.Kind == yaml.SequenceNode {
+			sources = m.Content
+		}
+		for _, src := range sources {
+			if src.Kind == yaml.AliasNode {
+				src = src.Alias
+			}
+			if src.Kind != yaml.MappingNode {
+				return yamlErrorf(src, "merge keys take a mapping or a list of mappings")
+			}
+			entries := map[string]interface{}{}
+			if err := c.mapping(entries, src); err != nil {
+				return err
+			}
+			for k, v := range entries {
+				if _, ok := obj[k]; !ok {
+					obj[k] = v
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func yamlScalar(n *yaml.Node) (interface{}, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return nil, yamlErrorf(n, "%v", err)
+		}
+		return b, nil
+	case "!!int":
+		var i int64
+		if err := n.Decode(&i); err == nil {
+			return json.Number(strconv.FormatInt(i, 10)), nil
+		}
+		var u uint64
+		if err := n.Decode(&u); err == nil {
+			return json.Number(strconv.FormatUint(u, 10)), nil
+		}
+		return nil, yamlErrorf(n, "integer %s out of range", n.Value)
+	case "!!float":
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, yamlErrorf(n, "%v", err)
+		}
+		// protojson forms of the special values
+		switch {
+		case math.IsNaN(f):
+			return "NaN", nil
+		case math.IsInf(f, 1):
+			return "Infinity", nil
+		case math.IsInf(f, -1):
+			return "-Infinity", nil
+		}
+		return f, nil
+	case "!!str", "!!timestamp", "!!binary":
+		return n.Value, nil
+	}
+	return nil, yamlErrorf(n, "unsupported tag %s", n.Tag)
+}
+
+func yamlErrorf(n *yaml.Node, format string, args ...interface{}) error {
+	return fmt.Errorf("invalid YAML at line %d: %s", n.Line, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,111 @@
+package io
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected string
+	}{
+		{"scalars", "a: 1\nb: -2.5\nc: true\nd: ~\ne: hello world\nf: '0012'\ng: \"x\\ty\"\nh: 0x1f\n",
+			`{"a":1,"b":-2.5,"c":true,"d":null,"e":"hello world","f":"0012","g":"x\ty","h":31}`},
+		{"nested mapping", "transaction:\n  serial: 1\n  mapping:\n    namespaceDelegation:\n      namespace: \"1220ab\"\n",
+			`{"transaction":{"serial":1,"mapping":{"namespaceDelegation":{"namespace":"1220ab"}}}}`},
+		{"sequences", "list:\n  - a\n  - b\nsame_level:\n- 1\n- 2\n",
+			`{"list":["a","b"],"same_level":[1,2]}`},
+		{"sequence of mappings", "signatures:\n  - signedBy: a\n    signature: cafe\n  -\n    signedBy: b\n",
+			`{"signatures":[{"signedBy":"a","signature":"cafe"},{"signedBy":"b"}]}`},
+		{"nested sequences", "- - 1\n  - 2\n- [3, 4]\n", `[[1,2],[3,4]]`},
+		{"flow collections", "a: [x, \"y, z\", {k: v, n: 1}]\nb: {}\nc: []\nd: {url: http://host:8080/x}\n",
+			`{"a":["x","y, z",{"k":"v","n":1}],"b":{},"c":[],"d":{"url":"http://host:8080/x"}}`},
+		{"multi-line flow", "a: [1,\n  2,\n  3]\n", `{"a":[1,2,3]}`},
+		{"comments", "# header\na: 1 # trailing\nb: \"# not a comment\"\n\n# between\nc: x#y\n",
+			`{"a":1,"b":"# not a comment","c":"x#y"}`},
+		{"literal block", "a: |\n  line 1\n    indented\n\n  line 3\nb: 2\n",
+			`{"a":"line 1\n  indented\n\nline 3\n","b":2}`},
+		{"folded block", "a: >-\n  one\n  two\n\n  three\n", `{"a":"one two\nthree"}`},
+		{"document marker", "---\na: 1\n", `{"a":1}`},
+		{"quoted keys", "\"a: b\": 1\n'c': 2\n", `{"a: b":1,"c":2}`},
+		{"empty mapping value", "a:\nb: 1\n", `{"a":null,"b":1}`},
+		{"large integer", "a: 18446744073709551615\nb: 9007199254740993\n", `{"a":18446744073709551615,"b":9007199254740993}`},
+		{"special floats", "a: .inf\nb: -.inf\nc: .nan\n", `{"a":"Infinity","b":"-Infinity","c":"NaN"}`},
+		{"empty document", "# nothing\n", `null`},
+		{"explicit key", "? complex\n", `{"complex":null}`},
+		{"anchors and merge keys", "base: &b {x: 1, y: 2}\nref: *b\nmerged:\n  <<: *b\n  y: 3\n",
+			`{"base":{"x":1,"y":2},"ref":{"x":1,"y":2},"merged":{"x":1,"y":3}}`},
+		{"timestamps stay strings", "a: 2025-06-01T00:00:00Z\n", `{"a":"2025-06-01T00:00:00Z"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := YAMLToJSON([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("YAMLToJSON() error = %v", err)
+			}
+			var got, expected interface{}
+			json.Unmarshal(out, &got)
+			json.Unmarshal([]byte(tt.expected), &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected %s, got %s", tt.expected, out)
+			}
+		})
+	}
+}
+
+func TestYAMLToJSON_LargeIntegersExact(t *testing.T) {
+	out, err := YAMLToJSON([]byte("a: 9007199254740993\n"))
+	if err != nil {
+		t.Fatalf("YAMLToJSON() error = %v", err)
+	}
+	if string(out) != `{"a":9007199254740993}` {
+		t.Errorf("large integer lost precision: %s", out)
+	}
+}
+
+func TestYAMLToJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"tab indentation", "a:\n\tb: 1\n"},
+		{"bad indentation", "a: 1\n  b: 2\n"},
+		{"duplicate key", "a: 1\na: 2\n"},
+		{"multiple documents", "a: 1\n---\nb: 2\n"},
+		{"undefined alias", "a: *x\n"},
+		{"unterminated flow", "a: [1, 2\n"},
+		{"unterminated quote", "a: \"abc\n"},
+		{"nested mapping on one line", "a: b: c\n"},
+		{"sequence key", "? [a, b]\n: 1\n"},
+		{"mapping key", "? {a: 1}\n: 1\n"},
+		{"custom tag", "a: !point 1\n"},
+		{"merge of a scalar", "a:\n  <<: 1\n"},
+		{"alias expansion", "a: &a [x, x, x, x, x, x, x, x, x, x]\nb: &b [*a, *a, *a, *a, *a, *a, *a, *a, *a, *a]\n" +
+			"c: &c [*b, *b, *b, *b, *b, *b, *b, *b, *b, *b]\nd: &d [*c, *c, *c, *c, *c, *c, *c, *c, *c, *c]\n" +
+			"e: &e [*d, *d, *d, *d, *d, *d, *d, *d, *d, *d]\nf: &f [*e, *e, *e, *e, *e, *e, *e, *e, *e, *e]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := YAMLToJSON([]byte(tt.yaml)); err == nil {
+				t.Errorf("expected an error for %q", tt.yaml)
+			}
+		})
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	jsonInput := []byte(`{"a": [1, 2]}`)
+	out, err := ToJSON(jsonInput)
+	if err != nil || string(out) != string(jsonInput) {
+		t.Errorf("JSON input should pass through unchanged, got %s, %v", out, err)
+	}
+	out, err = ToJSON([]byte("a: [1, 2]\n"))
+	if err != nil || string(out) != `{"a":[1,2]}` {
+		t.Errorf("unexpected conversion: %s, %v", out, err)
+	}
+}
@@ -9,28 +9,51 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/bufbuild/protocompile"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 // SchemaLoader defines the interface for loading protobuf schemas
 type SchemaLoader struct {
 	ImportPaths []string
+
+	mu    sync.Mutex
+	cache map[string][]protoreflect.FileDescriptor // loaded schemas by path
 }
 
-// LoadSchema loads a schema from a file (proto, binary image, or JSON image)
+// LoadSchema loads a schema from a file (proto, binary image, or JSON image). Schemas are loaded
+// once per path; it is safe for concurrent use.
 func (l *SchemaLoader) LoadSchema(ctx context.Context, path string) ([]protoreflect.FileDescriptor, error) {
-	if strings.HasSuffix(path, ".proto") {
-		return l.loadFromProto(ctx, path)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if files, ok := l.cache[path]; ok {
+		return files, nil
 	}
 
-	// Try loading as a Buf image (FileDescriptorSet)
-	return l.loadFromImage(path)
+	var files []protoreflect.FileDescriptor
+	var err error
+	if strings.HasSuffix(path, ".proto") {
+		files, err = l.loadFromProto(ctx, path)
+	} else {
+		// Try loading as a Buf image (FileDescriptorSet)
+		files, err = l.loadFromImage(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if l.cache == nil {
+		l.cache = map[string][]protoreflect.FileDescriptor{}
+	}
+	l.cache[path] = files
+	return files, nil
 }
 
 func (l *SchemaLoader) loadFromProto(ctx context.Context, path string) ([]protoreflect.FileDescriptor, error) {
@@ -145,3 +168,43 @@ func findNested(m protoreflect.MessageDescriptor, name string) protoreflect.Mess
 	}
 	return nil
 }
+
+// AllMessages returns every message (including nested ones) defined in the given files
+func AllMessages(files []protoreflect.FileDescriptor) []protoreflect.MessageDescriptor {
+	var result []protoreflect.MessageDescriptor
+	var walk func(msgs protoreflect.MessageDescriptors)
+	walk = func(msgs protoreflect.MessageDescriptors) {
+		for i := 0; i < msgs.Len(); i++ {
+			m := msgs.Get(i)
+			if m.IsMapEntry() {
+				continue
+			}
+			result = append(result, m)
+			walk(m.Messages())
+		}
+	}
+	for _, f := range files {
+		walk(f.Messages())
+	}
+	return result
+}
+
+// NewTypes builds a type registry over the given files, used to resolve google.protobuf.Any type URLs
+func NewTypes(files []protoreflect.FileDescriptor) (*dynamicpb.Types, error) {
+	reg := &protoregistry.Files{}
+	for _, f := range files {
+		if err := reg.RegisterFile(f); err != nil {
+			return nil, fmt.Errorf("failed to register %s: %v", f.Path(), err)
+		}
+	}
+	return dynamicpb.NewTypes(reg), nil
+}
+
+// FindMessageByURL resolves a google.protobuf.Any type URL (e.g. "type.googleapis.com/pkg.Msg")
+func FindMessageByURL(files []protoreflect.FileDescriptor, url string) protoreflect.MessageDescriptor {
+	name := url
+	if i := strings.LastIndex(url, "/"); i >= 0 {
+		name = url[i+1:]
+	}
+	return FindMessage(files, name)
+}
@@ -0,0 +1,309 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Operation is a single RFC 6902 JSON Patch operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ApplyDocument applies a patch document to doc: a JSON array is read as an RFC 6902 JSON Patch,
+// a JSON object as an RFC 7396 merge patch.
+func ApplyDocument(doc interface{}, patchDoc []byte) (interface{}, error) {
+	trimmed := bytes.TrimSpace(patchDoc)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var ops []Operation
+		if err := json.Unmarshal(trimmed, &ops); err != nil {
+			return nil, fmt.Errorf("invalid JSON Patch: %v", err)
+		}
+		return ApplyJSONPatch(doc, ops)
+	}
+	var merge interface{}
+	if err := json.Unmarshal(trimmed, &merge); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %v", err)
+	}
+	return MergePatch(doc, merge), nil
+}
+
+// MergePatch applies an RFC 7396 merge patch: objects are merged recursively, null removes a key
+// and any other value replaces the target.
+func MergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = MergePatch(targetObj[k], v)
+	}
+	return targetObj
+}
+
+// ApplyJSONPatch applies RFC 6902 operations in order. The patch is atomic only in that an error
+// is returned at the first failing operation; doc may have been partially modified.
+func ApplyJSONPatch(doc interface{}, ops []Operation) (interface{}, error) {
+	for i, op := range ops {
+		var err error
+		doc, err = applyOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %v", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyOperation(doc interface{}, op Operation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (interface{}, error) {
+		if op.Value == nil {
+			return nil, fmt.Errorf("missing value")
+		}
+		var v interface{}
+		if err := json.Unmarshal(op.Value, &v); err != nil {
+			return nil, fmt.Errorf("invalid value: %v", err)
+		}
+		return v, nil
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "remove":
+		doc, _, err := pointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		doc, _, err = pointerRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if op.Op == "move" {
+			if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+				return nil, fmt.Errorf("cannot move %s into its own child", op.From)
+			}
+			doc, v, err = pointerRemove(doc, from)
+		} else {
+			v, err = pointerGet(doc, from)
+			v = deepCopy(v)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(actual, v) {
+			return nil, fmt.Errorf("test failed: value is %s", CompactJSON(actual))
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped reference tokens.
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must start with '/'", ptr)
+	}
+	parts := strings.Split(ptr[1:], "/")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(p, "~1", "/"), "~0", "~")
+	}
+	return parts, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	curr := doc
+	for _, tok := range path {
+		switch c := curr.(type) {
+		case map[string]interface{}:
+			v, ok := c[tok]
+			if !ok {
+				return nil, fmt.Errorf("%q not found", tok)
+			}
+			curr = v
+		case []interface{}:
+			idx, err := arrayIndex(tok, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			curr = c[idx]
+		default:
+			return nil, fmt.Errorf("cannot descend into %s with %q", CompactJSON(curr), tok)
+		}
+	}
+	return curr, nil
+}
+
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[last] = value
+		return doc, nil
+	case []interface{}:
+		idx, err := arrayIndex(last, len(c), true)
+		if err != nil {
+			return nil, err
+		}
+		updated := append(c[:idx:idx], append([]interface{}{value}, c[idx:]...)...)
+		return replaceAt(doc, path[:len(path)-1], updated)
+	}
+	return nil, fmt.Errorf("cannot add %q to %s", last, CompactJSON(parent))
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		v, ok := c[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("%q not found", last)
+		}
+		delete(c, last)
+		return doc, v, nil
+	case []interface{}:
+		idx, err := arrayIndex(last, len(c), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := c[idx]
+		updated, err := replaceAt(doc, path[:len(path)-1], append(c[:idx:idx], c[idx+1:]...))
+		return updated, v, err
+	}
+	return nil, nil, fmt.Errorf("cannot remove %q from %s", last, CompactJSON(parent))
+}
+
+// replaceAt stores value at path, which must exist; used to write back resized arrays.
+func replaceAt(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[last] = value
+	case []interface{}:
+		idx, err := arrayIndex(last, len(c), false)
+		if err != nil {
+			return nil, err
+		}
+		c[idx] = value
+	}
+	return doc, nil
+}
+
+// arrayIndex parses an array reference token; "-" (the end of the array) is only valid when adding.
+func arrayIndex(tok string, length int, adding bool) (int, error) {
+	if tok == "-" {
+		if adding {
+			return length, nil
+		}
+		return 0, fmt.Errorf("\"-\" does not reference an existing element")
+	}
+	if len(tok) > 1 && tok[0] == '0' {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	idx, err := strconv.Atoi(tok)
+	if err != nil || idx < 0 {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	limit := length - 1
+	if adding {
+		limit = length
+	}
+	if idx > limit {
+		return 0, fmt.Errorf("array index %d out of range (length %d)", idx, length)
+	}
+	return idx, nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(c))
+		for k, val := range c {
+			out[k] = deepCopy(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(c))
+		for i, val := range c {
+			out[i] = deepCopy(val)
+		}
+		return out
+	}
+	return v
+}
+
+// CompactJSON renders a value as compact JSON for messages, falling back to its Go form.
+func CompactJSON(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(out)
+}
@@ -0,0 +1,92 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+		wantErr  bool
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, false},
+		{"add array element", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`, false},
+		{"append", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`, false},
+		{"remove", `{"a":{"b":1,"c":2}}`, `[{"op":"remove","path":"/a/b"}]`, `{"a":{"c":2}}`, false},
+		{"remove element", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/0"}]`, `{"a":[2,3]}`, false},
+		{"replace", `{"a":1}`, `[{"op":"replace","path":"/a","value":"x"}]`, `{"a":"x"}`, false},
+		{"move", `{"a":{"b":1},"c":{}}`, `[{"op":"move","from":"/a/b","path":"/c/d"}]`, `{"a":{},"c":{"d":1}}`, false},
+		{"copy", `{"a":[1]}`, `[{"op":"copy","from":"/a","path":"/b"}]`, `{"a":[1],"b":[1]}`, false},
+		{"escaped pointer", `{"a/b":{"c~d":1}}`, `[{"op":"replace","path":"/a~1b/c~0d","value":2}]`, `{"a/b":{"c~d":2}}`, false},
+		{"test passes", `{"a":[1,{"b":"x"}]}`, `[{"op":"test","path":"/a/1/b","value":"x"}]`, `{"a":[1,{"b":"x"}]}`, false},
+		{"test fails", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, "", true},
+		{"replace missing", `{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, "", true},
+		{"remove end marker", `{"a":[1]}`, `[{"op":"remove","path":"/a/-"}]`, "", true},
+		{"index out of range", `{"a":[1]}`, `[{"op":"add","path":"/a/3","value":2}]`, "", true},
+		{"leading zero index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/01"}]`, "", true},
+		{"move into child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, "", true},
+		{"missing value", `{"a":1}`, `[{"op":"add","path":"/b"}]`, "", true},
+		{"unknown op", `{"a":1}`, `[{"op":"frobnicate","path":"/a"}]`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc interface{}
+			json.Unmarshal([]byte(tt.doc), &doc)
+			got, err := ApplyDocument(doc, []byte(tt.patch))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyDocument() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var expected interface{}
+			json.Unmarshal([]byte(tt.expected), &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected %v, got %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396, Appendix A
+	tests := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.patch, func(t *testing.T) {
+			var doc interface{}
+			json.Unmarshal([]byte(tt.doc), &doc)
+			got, err := ApplyDocument(doc, []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("ApplyDocument() error = %v", err)
+			}
+			var expected interface{}
+			json.Unmarshal([]byte(tt.expected), &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected %v, got %v", expected, got)
+			}
+		})
+	}
+}
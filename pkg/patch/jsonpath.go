@@ -0,0 +1,315 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPath syntax, for paths starting with '$'. Such a path selects existing values, which Set and
+// Delete then change one by one; use the path syntax above to create new fields.
+//
+//	$.a.b  $['a.b']        child keys
+//	$.a[0]  $.a[-1]        list index (negative indexes count from the end)
+//	$.a[*]  $.a.*          every element of a list or field of an object
+//	$..k  $..[0]           k (or [0]) at any depth
+//	$.a[?(@.k=="v")]       the elements whose field k has the JSON value "v" (also 'v', and !=);
+//	                       @.k may be a path such as @.k.m, and [?(@.k)] tests that k is present
+//
+// Annotations such as @raw and @version are never selected by * and ..
+type selector struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+	filter   *filter
+	descend  bool // match at any depth below the current values
+}
+
+type filter struct {
+	path  string // relative to the element, without "@."
+	op    string // "==", "!=", or "" for presence
+	value string // compact JSON
+}
+
+// IsJSONPath reports whether path is a JSONPath expression rather than a plain path.
+func IsJSONPath(path string) bool {
+	return strings.HasPrefix(path, "$")
+}
+
+// Select returns the plain paths of the values of data that the JSONPath expression matches, in
+// document order and with object keys sorted.
+func Select(data map[string]interface{}, expr string) ([]string, error) {
+	selectors, err := parseJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	type node struct {
+		path  string
+		value interface{}
+	}
+	nodes := []node{{value: data}}
+	for _, sel := range selectors {
+		var next []node
+		visit := func(n node) {
+			for _, c := range selectChildren(n.path, n.value, sel) {
+				next = append(next, node{c.path, c.value})
+			}
+		}
+		for _, n := range nodes {
+			if !sel.descend {
+				visit(n)
+				continue
+			}
+			var walk func(n node)
+			walk = func(n node) {
+				visit(n)
+				for _, c := range selectChildren(n.path, n.value, selector{wildcard: true}) {
+					walk(node{c.path, c.value})
+				}
+			}
+			walk(n)
+		}
+		nodes = next
+	}
+
+	seen := map[string]bool{}
+	var paths []string
+	for _, n := range nodes {
+		if n.path == "" || seen[n.path] {
+			continue
+		}
+		seen[n.path] = true
+		paths = append(paths, n.path)
+	}
+	return paths, nil
+}
+
+// selectSome is Select, failing when nothing matches.
+func selectSome(data map[string]interface{}, expr string) ([]string, error) {
+	paths, err := Select(data, expr)
+	if err == nil && len(paths) == 0 {
+		err = fmt.Errorf("JSONPath %q matches nothing", expr)
+	}
+	return paths, err
+}
+
+type selected struct {
+	path  string
+	value interface{}
+}
+
+// selectChildren returns the children of value at path that sel matches.
+func selectChildren(path string, value interface{}, sel selector) []selected {
+	var out []selected
+	switch c := value.(type) {
+	case map[string]interface{}:
+		if sel.isIndex {
+			return nil
+		}
+		if !sel.wildcard && sel.filter == nil {
+			if v, ok := c[sel.key]; ok {
+				out = append(out, selected{JoinKey(path, sel.key), v})
+			}
+			return out
+		}
+		keys := make([]string, 0, len(c))
+		for k := range c {
+			if !strings.HasPrefix(k, "@") {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if sel.filter == nil || sel.filter.matches(c[k]) {
+				out = append(out, selected{JoinKey(path, k), c[k]})
+			}
+		}
+	case []interface{}:
+		if sel.isIndex {
+			if idx, err := resolveIndex(sel.index, len(c)); err == nil {
+				out = append(out, selected{fmt.Sprintf("%s[%d]", path, idx), c[idx]})
+			}
+			return out
+		}
+		if !sel.wildcard && sel.filter == nil {
+			return nil
+		}
+		for i, v := range c {
+			if sel.filter == nil || sel.filter.matches(v) {
+				out = append(out, selected{fmt.Sprintf("%s[%d]", path, i), v})
+			}
+		}
+	}
+	return out
+}
+
+func (f *filter) matches(v interface{}) bool {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	got, err := Get(obj, f.path)
+	if err != nil {
+		return false
+	}
+	if f.op == "" {
+		return true
+	}
+	data, err := json.Marshal(got)
+	return err == nil && (string(data) == f.value) == (f.op == "==")
+}
+
+func parseJSONPath(expr string) ([]selector, error) {
+	if !IsJSONPath(expr) {
+		return nil, fmt.Errorf("JSONPath %q: must start with '$'", expr)
+	}
+	var selectors []selector
+	s := expr[1:]
+	for len(s) > 0 {
+		var sel selector
+		switch {
+		case strings.HasPrefix(s, ".."):
+			sel.descend = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				break
+			}
+			fallthrough
+		case s[0] == '.':
+			if !sel.descend {
+				s = s[1:]
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			if name == "" {
+				return nil, fmt.Errorf("JSONPath %q: empty key", expr)
+			}
+			if name == "*" {
+				sel.wildcard = true
+			} else {
+				sel.key = name
+			}
+			s = s[end:]
+			selectors = append(selectors, sel)
+			continue
+		case s[0] != '[':
+			return nil, fmt.Errorf("JSONPath %q: expected '.' or '[' at %q", expr, s)
+		}
+
+		// A bracketed selector
+		n, err := readBracket(s, &sel)
+		if err != nil {
+			return nil, fmt.Errorf("JSONPath %q: %v", expr, err)
+		}
+		s = s[n:]
+		selectors = append(selectors, sel)
+	}
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("JSONPath %q: selects the whole message", expr)
+	}
+	return selectors, nil
+}
+
+// readBracket reads a bracketed selector starting at s[0] == '[' into sel and returns the number of
+// bytes consumed.
+func readBracket(s string, sel *selector) (int, error) {
+	inner := s[1:]
+	switch {
+	case strings.HasPrefix(inner, "'") || strings.HasPrefix(inner, `"`):
+		key, n, err := readQuoted(inner)
+		if err != nil {
+			return 0, err
+		}
+		if n >= len(inner) || inner[n] != ']' {
+			return 0, fmt.Errorf("expected ']' after quoted key")
+		}
+		sel.key = key
+		return n + 2, nil
+	case strings.HasPrefix(inner, "?("):
+		end := closingFilter(inner)
+		if end < 0 {
+			return 0, fmt.Errorf("unterminated filter, expected ')]'")
+		}
+		f, err := parseFilter(strings.TrimSpace(inner[2:end]))
+		if err != nil {
+			return 0, err
+		}
+		sel.filter = f
+		return end + 3, nil
+	}
+	end := strings.IndexByte(inner, ']')
+	if end < 0 {
+		return 0, fmt.Errorf("unterminated '['")
+	}
+	switch tok := strings.TrimSpace(inner[:end]); tok {
+	case "*":
+		sel.wildcard = true
+	default:
+		idx, err := strconv.Atoi(tok)
+		if err != nil {
+			return 0, fmt.Errorf("invalid index %q", tok)
+		}
+		sel.isIndex, sel.index = true, idx
+	}
+	return end + 2, nil
+}
+
+// closingFilter returns the position of the ")]" that ends a filter starting with "?(", skipping
+// quoted literals.
+func closingFilter(s string) int {
+	var quote byte
+	for i := 2; i < len(s)-1; i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ')' && s[i+1] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseFilter reads a filter expression: @.path, or @.path followed by == or != and a JSON value.
+func parseFilter(expr string) (*filter, error) {
+	if !strings.HasPrefix(expr, "@.") {
+		return nil, fmt.Errorf("filter %q: expected @.field", expr)
+	}
+	rest := expr[2:]
+	f := &filter{path: strings.TrimSpace(rest)}
+	if i := strings.IndexAny(rest, "=!"); i >= 0 {
+		if i+1 >= len(rest) || rest[i+1] != '=' {
+			return nil, fmt.Errorf("filter %q: expected == or !=", expr)
+		}
+		f.path, f.op = strings.TrimSpace(rest[:i]), rest[i:i+2]
+		literal := strings.TrimSpace(rest[i+2:])
+		if strings.HasPrefix(literal, "'") {
+			s, n, err := readQuoted(literal)
+			if err != nil || n != len(literal) {
+				return nil, fmt.Errorf("filter %q: invalid value %s", expr, literal)
+			}
+			quoted, _ := json.Marshal(s)
+			literal = string(quoted)
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(literal), &v); err != nil {
+			return nil, fmt.Errorf("filter %q: invalid value %s: expected JSON, e.g. \"abc\"", expr, literal)
+		}
+		compact, _ := json.Marshal(v)
+		f.value = string(compact)
+	}
+	if _, err := parsePath(f.path); err != nil {
+		return nil, fmt.Errorf("filter %q: %v", expr, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,126 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestSelect(t *testing.T) {
+	var data map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"signatures": [{"signedBy": "a", "format": 1}, {"signedBy": "b]", "format": 2}, {"format": 1}],
+		"mapping": {"party": "p", "signedBy": "c", "a.b": {"signedBy": "d"}},
+		"@raw": {"signedBy": "e"}
+	}`), &data)
+
+	tests := []struct {
+		expr    string
+		want    []string
+		wantErr bool
+	}{
+		{expr: "$.mapping.party", want: []string{"mapping.party"}},
+		{expr: "$['mapping']['a.b'].signedBy", want: []string{`mapping."a.b".signedBy`}},
+		{expr: "$.signatures[-1]", want: []string{"signatures[2]"}},
+		{expr: "$.signatures[*].signedBy", want: []string{"signatures[0].signedBy", "signatures[1].signedBy"}},
+		{expr: "$.mapping.*", want: []string{`mapping."a.b"`, "mapping.party", "mapping.signedBy"}},
+		{expr: "$..signedBy", want: []string{"mapping.signedBy", `mapping."a.b".signedBy`, "signatures[0].signedBy", "signatures[1].signedBy"}},
+		{expr: `$.signatures[?(@.signedBy=="b]")].format`, want: []string{"signatures[1].format"}},
+		{expr: `$.signatures[?(@.signedBy == 'a')]`, want: []string{"signatures[0]"}},
+		{expr: `$.signatures[?(@.format!=1)]`, want: []string{"signatures[1]"}},
+		{expr: `$.signatures[?(@.signedBy)]`, want: []string{"signatures[0]", "signatures[1]"}},
+		{expr: `$..[?(@.signedBy=="d")]`, want: []string{`mapping."a.b"`}},
+		{expr: "$.missing", want: nil},
+		{expr: "$.signatures[5]", want: nil},
+		{expr: "$", wantErr: true},
+		{expr: "mapping.party", wantErr: true},
+		{expr: "$.", wantErr: true},
+		{expr: "$.signatures[x]", wantErr: true},
+		{expr: `$.signatures[?(@.signedBy=a)]`, wantErr: true},
+		{expr: `$.signatures[?(signedBy=="a")]`, wantErr: true},
+		{expr: `$.signatures[?(@.signedBy=="a"]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Select(data, tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select() = %q, want %q", got, tt.want)
+			}
+			// Every selected path addresses the value in the plain path syntax
+			for _, p := range got {
+				if _, err := Get(data, p); err != nil {
+					t.Errorf("Get(%s) error = %v", p, err)
+				}
+			}
+		})
+	}
+}
+
+// testMessage returns the descriptor of a message Tx with a name and a list of Sig elements, each
+// with a signed_by and a format.
+func testMessage(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		fd := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), Label: label.Enum()}
+		if typeName != "" {
+			fd.TypeName = proto.String(typeName)
+		}
+		return fd
+	}
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Tx"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+				field("signatures", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, repeated, ".test.Sig"),
+			}},
+			{Name: proto.String("Sig"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("signed_by", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+				field("format", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, optional, ""),
+			}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Messages().ByName("Tx")
+}
+
+func TestSchemaJSONPath(t *testing.T) {
+	s := &Schema{Message: testMessage(t)}
+	var data map[string]interface{}
+	json.Unmarshal([]byte(`{"name": "tx", "signatures": [
+		{"signedBy": "a", "format": 1}, {"signedBy": "b", "format": 1}, {"signedBy": "c", "format": 2}
+	]}`), &data)
+
+	if err := s.Set(data, `$.signatures[?(@.signedBy=="b")].signedBy`, "d"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := s.Set(data, "$..format", "3"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := s.Delete(data, `$.signatures[?(@.signedBy!="d")]`); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	want := `{"name":"tx","signatures":[{"format":3,"signedBy":"d"}]}`
+	if got := CompactJSON(data); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if err := s.Set(data, "$.signatures[*].nope", "1"); err == nil {
+		t.Error("expected a JSONPath that matches nothing to be refused")
+	}
+	if err := s.Set(data, "$..format", "x"); err == nil {
+		t.Error("expected an invalid value to be refused")
+	}
+}
@@ -1,30 +1,454 @@
 package patch
 
 import (
+	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
 )
 
-// Set nested map value using dot-notation.
-// e.g., Set(data, "a.b.c", 1) results in {"a": {"b": {"c": 1}}}
-func Set(data map[string]interface{}, path string, value interface{}) {
-	parts := strings.Split(path, ".")
-	curr := data
+// Path syntax:
+//
+//	a.b.c          nested map keys
+//	a[0].b         list index (negative indexes count from the end, e.g. a[-1])
+//	a[] / a[+]     append to a list (Set only)
+//	a[k="v"].b     the list element whose field k has the JSON value "v", as diff reports it
+//	"a.b".c        quoted key containing dots (also a["a.b"] or a['a.b'])
+type token struct {
+	key     string
+	index   int
+	isIndex bool
+	append  bool
+	// match and matchValue select a list element by the compact JSON value of one of its fields
+	match      string
+	matchValue string
+}
+
+func (t token) String() string {
+	switch {
+	case t.append:
+		return "[]"
+	case t.match != "":
+		return fmt.Sprintf("[%s=%s]", t.match, t.matchValue)
+	case t.isIndex:
+		return fmt.Sprintf("[%d]", t.index)
+	default:
+		return strconv.Quote(t.key)
+	}
+}
+
+// Set sets a nested value using the path syntax above, creating intermediate maps and lists.
+// e.g., Set(data, "a.b[].c", 1) results in {"a": {"b": [{"c": 1}]}}
+// Existing values that are not of the container type required by the path are never overwritten.
+func Set(data map[string]interface{}, path string, value interface{}) error {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	_, err = setIn(data, tokens, value, path)
+	return err
+}
+
+// Delete removes the value at the given path. The path must exist.
+func Delete(data map[string]interface{}, path string) error {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	_, err = deleteIn(data, tokens, path)
+	return err
+}
+
+// Get returns the value at the given path.
+func Get(data map[string]interface{}, path string) (interface{}, error) {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	var curr interface{} = data
+	for i, tok := range tokens {
+		next, ok, err := child(curr, tok)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %v at %s", path, err, prefix(tokens, i))
+		}
+		if !ok {
+			return nil, fmt.Errorf("path %q: %s not found", path, prefix(tokens, i+1))
+		}
+		curr = next
+	}
+	return curr, nil
+}
+
+func setIn(container interface{}, tokens []token, value interface{}, path string) (interface{}, error) {
+	tok := tokens[0]
+	rest := tokens[1:]
+
+	// Compute the new value for this step, creating containers along the way
+	build := func(existing interface{}, exists bool) (interface{}, error) {
+		if len(rest) == 0 {
+			return value, nil
+		}
+		if !exists || existing == nil {
+			if rest[0].isIndex {
+				existing = []interface{}{}
+			} else {
+				existing = map[string]interface{}{}
+			}
+		}
+		return setIn(existing, rest, value, path)
+	}
+
+	switch c := container.(type) {
+	case map[string]interface{}:
+		if tok.isIndex {
+			return nil, fmt.Errorf("path %q: cannot index %s into an object", path, tok)
+		}
+		existing, exists := c[tok.key]
+		updated, err := build(existing, exists)
+		if err != nil {
+			return nil, err
+		}
+		c[tok.key] = updated
+		return c, nil
+	case []interface{}:
+		if !tok.isIndex {
+			return nil, fmt.Errorf("path %q: cannot use key %s on a list", path, tok)
+		}
+		if tok.append {
+			updated, err := build(nil, false)
+			if err != nil {
+				return nil, err
+			}
+			return append(c, updated), nil
+		}
+		idx, err := elementIndex(c, tok)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %v", path, err)
+		}
+		updated, err := build(c[idx], true)
+		if err != nil {
+			return nil, err
+		}
+		c[idx] = updated
+		return c, nil
+	default:
+		return nil, fmt.Errorf("path %q: cannot set %s inside a %T value", path, tok, container)
+	}
+}
+
+func deleteIn(container interface{}, tokens []token, path string) (interface{}, error) {
+	tok := tokens[0]
+	if tok.append {
+		return nil, fmt.Errorf("path %q: cannot delete an append position", path)
+	}
+
+	if len(tokens) > 1 {
+		next, ok, err := child(container, tok)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %v", path, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("path %q: %s not found", path, tok)
+		}
+		updated, err := deleteIn(next, tokens[1:], path)
+		if err != nil {
+			return nil, err
+		}
+		return replaceChild(container, tok, updated), nil
+	}
+
+	switch c := container.(type) {
+	case map[string]interface{}:
+		if tok.isIndex {
+			return nil, fmt.Errorf("path %q: cannot index %s into an object", path, tok)
+		}
+		if _, ok := c[tok.key]; !ok {
+			return nil, fmt.Errorf("path %q: %s not found", path, tok)
+		}
+		delete(c, tok.key)
+		return c, nil
+	case []interface{}:
+		if !tok.isIndex {
+			return nil, fmt.Errorf("path %q: cannot use key %s on a list", path, tok)
+		}
+		idx, err := elementIndex(c, tok)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %v", path, err)
+		}
+		return append(c[:idx:idx], c[idx+1:]...), nil
+	default:
+		return nil, fmt.Errorf("path %q: cannot delete %s inside a %T value", path, tok, container)
+	}
+}
+
+// child returns the value of a single path step, and whether it exists.
+func child(container interface{}, tok token) (interface{}, bool, error) {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		if tok.isIndex {
+			return nil, false, fmt.Errorf("cannot index %s into an object", tok)
+		}
+		v, ok := c[tok.key]
+		return v, ok, nil
+	case []interface{}:
+		if !tok.isIndex || tok.append {
+			return nil, false, fmt.Errorf("cannot use %s on a list", tok)
+		}
+		if tok.match != "" {
+			idx, ok, err := matchIndex(c, tok)
+			if !ok {
+				return nil, false, err
+			}
+			return c[idx], true, nil
+		}
+		idx, err := resolveIndex(tok.index, len(c))
+		if err != nil {
+			return nil, false, err
+		}
+		return c[idx], true, nil
+	default:
+		return nil, false, fmt.Errorf("cannot descend into a %T value", container)
+	}
+}
+
+func replaceChild(container interface{}, tok token, value interface{}) interface{} {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		c[tok.key] = value
+	case []interface{}:
+		idx, _ := elementIndex(c, tok)
+		c[idx] = value
+	}
+	return container
+}
+
+// elementIndex returns the position in list of the element an index or match token addresses.
+func elementIndex(list []interface{}, tok token) (int, error) {
+	if tok.match == "" {
+		return resolveIndex(tok.index, len(list))
+	}
+	idx, ok, err := matchIndex(list, tok)
+	if !ok && err == nil {
+		err = fmt.Errorf("no element %s", tok)
+	}
+	return idx, err
+}
+
+// matchIndex finds the single element of list whose match field has the token's value. It reports
+// false without error when there is none.
+func matchIndex(list []interface{}, tok token) (int, bool, error) {
+	found := -1
+	for i, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		v, ok := obj[tok.match]
+		if !ok {
+			continue
+		}
+		if data, err := json.Marshal(v); err != nil || string(data) != tok.matchValue {
+			continue
+		}
+		if found >= 0 {
+			return 0, false, fmt.Errorf("%s matches more than one element", tok)
+		}
+		found = i
+	}
+	return found, found >= 0, nil
+}
 
-	for i := 0; i < len(parts)-1; i++ {
-		part := parts[i]
-		if next, ok := curr[part].(map[string]interface{}); ok {
-			curr = next
-		} else {
-			// If path doesn't exist or is not a map, create it
-			newMap := make(map[string]interface{})
-			curr[part] = newMap
-			curr = newMap
+func resolveIndex(index, length int) (int, error) {
+	idx := index
+	if idx < 0 {
+		idx += length
+	}
+	if idx < 0 || idx >= length {
+		return 0, fmt.Errorf("index %d out of range (length %d)", index, length)
+	}
+	return idx, nil
+}
+
+func prefix(tokens []token, n int) string {
+	var sb strings.Builder
+	for i, tok := range tokens[:n] {
+		if !tok.isIndex && i > 0 {
+			sb.WriteByte('.')
 		}
+		sb.WriteString(tok.String())
 	}
+	return sb.String()
+}
 
-	last := parts[len(parts)-1]
-	curr[last] = value
+func parsePath(path string) ([]token, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var tokens []token
+	i := 0
+	expectKey := true
+	for i < len(path) {
+		switch {
+		case path[i] == '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unterminated '['", path)
+			}
+			inner := path[i+1 : i+end]
+			if eq := strings.IndexByte(inner, '='); eq > 0 && inner[0] != '"' && inner[0] != '\'' {
+				tok, n, err := readMatch(path[i+1:])
+				if err != nil {
+					return nil, fmt.Errorf("path %q: %v", path, err)
+				}
+				tokens = append(tokens, tok)
+				i += n + 1
+			} else if q := inner; len(q) >= 2 && (q[0] == '"' || q[0] == '\'') {
+				key, n, err := readQuoted(path[i+1:])
+				if err != nil {
+					return nil, fmt.Errorf("path %q: %v", path, err)
+				}
+				if i+1+n >= len(path) || path[i+1+n] != ']' {
+					return nil, fmt.Errorf("path %q: expected ']' after quoted key", path)
+				}
+				tokens = append(tokens, token{key: key})
+				i += n + 2
+			} else {
+				tok := token{isIndex: true}
+				switch inner {
+				case "", "+":
+					tok.append = true
+				default:
+					idx, err := strconv.Atoi(inner)
+					if err != nil {
+						return nil, fmt.Errorf("path %q: invalid index %q", path, inner)
+					}
+					tok.index = idx
+				}
+				tokens = append(tokens, tok)
+				i += end + 1
+			}
+			expectKey = false
+		case path[i] == '.':
+			if expectKey {
+				return nil, fmt.Errorf("path %q: empty key at offset %d", path, i)
+			}
+			expectKey = true
+			i++
+		default:
+			if !expectKey {
+				return nil, fmt.Errorf("path %q: expected '.' or '[' at offset %d", path, i)
+			}
+			if path[i] == '"' || path[i] == '\'' {
+				key, n, err := readQuoted(path[i:])
+				if err != nil {
+					return nil, fmt.Errorf("path %q: %v", path, err)
+				}
+				tokens = append(tokens, token{key: key})
+				i += n
+			} else {
+				end := strings.IndexAny(path[i:], ".[")
+				if end < 0 {
+					end = len(path) - i
+				}
+				tokens = append(tokens, token{key: path[i : i+end]})
+				i += end
+			}
+			expectKey = false
+		}
+	}
+	if expectKey {
+		return nil, fmt.Errorf("path %q: trailing '.'", path)
+	}
+	if tokens[0].isIndex {
+		return nil, fmt.Errorf("path %q: must start with a key", path)
+	}
+	return tokens, nil
+}
+
+// readQuoted reads a quoted key starting at s[0] and returns it with the number of bytes consumed.
+func readQuoted(s string) (string, int, error) {
+	quote := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			}
+		case quote:
+			return sb.String(), i + 1, nil
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted key")
+}
+
+// readMatch reads an element match `field=value]` following a '[', with value in JSON, and returns
+// it with the number of bytes consumed.
+func readMatch(s string) (token, int, error) {
+	eq := strings.IndexByte(s, '=')
+	name := s[:eq]
+	end := -1
+	if eq+1 < len(s) && s[eq+1] == '"' {
+		// A JSON string may contain ']'
+		for i := eq + 2; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				end = i + 1
+				break
+			}
+		}
+		if end < 0 || end >= len(s) || s[end] != ']' {
+			return token{}, 0, fmt.Errorf("expected ']' after the value of %s", name)
+		}
+	} else {
+		end = strings.IndexByte(s, ']')
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(s[eq+1:end]), &v); err != nil {
+		return token{}, 0, fmt.Errorf("invalid value %s for %s: expected JSON, e.g. [%s=\"abc\"]", s[eq+1:end], name, name)
+	}
+	compact, _ := json.Marshal(v)
+	return token{isIndex: true, match: name, matchValue: string(compact)}, end + 1, nil
+}
+
+// JoinKey appends a key to a path, quoting keys that the path syntax would split.
+func JoinKey(path, key string) string {
+	if key == "" || strings.ContainsAny(key, `.[]"'`) {
+		key = strconv.Quote(key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// SplitAssignment splits "path=value" at the first '=' outside a quoted key or an element match.
+func SplitAssignment(s string) (string, string, bool) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '[':
+			depth++
+		case quote == 0 && c == ']' && depth > 0:
+			depth--
+		case quote == 0 && depth == 0 && c == '=':
+			return s[:i], s[i+1:], true
+		}
+	}
+	return "", "", false
 }
 
 // ParseValue attempts to parse strings into typed values (bool, int)
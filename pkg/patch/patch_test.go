@@ -66,11 +66,74 @@ func TestSet(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "list index",
+			initial: map[string]interface{}{
+				"sigs": []interface{}{
+					map[string]interface{}{"signedBy": "a"},
+					map[string]interface{}{"signedBy": "b"},
+				},
+			},
+			path:  "sigs[0].signedBy",
+			value: "x",
+			expected: map[string]interface{}{
+				"sigs": []interface{}{
+					map[string]interface{}{"signedBy": "x"},
+					map[string]interface{}{"signedBy": "b"},
+				},
+			},
+		},
+		{
+			name: "negative index",
+			initial: map[string]interface{}{
+				"list": []interface{}{1, 2, 3},
+			},
+			path:  "list[-1]",
+			value: 4,
+			expected: map[string]interface{}{
+				"list": []interface{}{1, 2, 4},
+			},
+		},
+		{
+			name: "append to existing list",
+			initial: map[string]interface{}{
+				"a": map[string]interface{}{"mappings": []interface{}{"X"}},
+			},
+			path:  "a.mappings[]",
+			value: "Y",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{"mappings": []interface{}{"X", "Y"}},
+			},
+		},
+		{
+			name:    "append creates list and object",
+			initial: make(map[string]interface{}),
+			path:    "a.b[+].c",
+			value:   1,
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": []interface{}{map[string]interface{}{"c": 1}},
+				},
+			},
+		},
+		{
+			name:    "quoted key",
+			initial: make(map[string]interface{}),
+			path:    `"a.b".c['d.e']`,
+			value:   true,
+			expected: map[string]interface{}{
+				"a.b": map[string]interface{}{
+					"c": map[string]interface{}{"d.e": true},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			Set(tt.initial, tt.path, tt.value)
+			if err := Set(tt.initial, tt.path, tt.value); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 			if !reflect.DeepEqual(tt.initial, tt.expected) {
 				t.Errorf("expected %v, got %v", tt.expected, tt.initial)
 			}
@@ -78,6 +141,199 @@ func TestSet(t *testing.T) {
 	}
 }
 
+func TestSetErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"descend into scalar", "s.x"},
+		{"index into object", "m[0]"},
+		{"key on list", "l.x"},
+		{"index out of range", "l[2]"},
+		{"negative out of range", "l[-3]"},
+		{"invalid index", "l[x]"},
+		{"unterminated bracket", "l[0"},
+		{"unterminated quote", `"a.b`},
+		{"empty key", "m..x"},
+		{"trailing dot", "m."},
+		{"leading index", "[0]"},
+		{"empty path", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]interface{}{
+				"s": "scalar",
+				"m": map[string]interface{}{},
+				"l": []interface{}{1, 2},
+			}
+			if err := Set(data, tt.path, 1); err == nil {
+				t.Errorf("expected error for path %q", tt.path)
+			}
+			if data["s"] != "scalar" {
+				t.Errorf("existing value was clobbered: %v", data["s"])
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name: "delete key",
+			path: "a.b",
+			expected: map[string]interface{}{
+				"a":    map[string]interface{}{},
+				"list": []interface{}{1, 2, 3},
+			},
+		},
+		{
+			name: "delete list element",
+			path: "list[1]",
+			expected: map[string]interface{}{
+				"a":    map[string]interface{}{"b": 1},
+				"list": []interface{}{1, 3},
+			},
+		},
+		{
+			name: "delete last element",
+			path: "list[-1]",
+			expected: map[string]interface{}{
+				"a":    map[string]interface{}{"b": 1},
+				"list": []interface{}{1, 2},
+			},
+		},
+		{name: "missing key", path: "a.c", wantErr: true},
+		{name: "missing parent", path: "x.y", wantErr: true},
+		{name: "append position", path: "list[]", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]interface{}{
+				"a":    map[string]interface{}{"b": 1},
+				"list": []interface{}{1, 2, 3},
+			}
+			err := Delete(data, tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error for path %q", tt.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(data, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, data)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	data := map[string]interface{}{
+		"a": map[string]interface{}{
+			"list": []interface{}{"x", map[string]interface{}{"k.v": 2}},
+		},
+	}
+	got, err := Get(data, `a.list[-1]["k.v"]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 2 {
+		t.Errorf("expected 2, got %v", got)
+	}
+	if _, err := Get(data, "a.missing"); err == nil {
+		t.Error("expected error for missing path")
+	}
+}
+
+func TestMatchPaths(t *testing.T) {
+	newData := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sigs": []interface{}{
+				map[string]interface{}{"signedBy": "a", "sig": "1"},
+				map[string]interface{}{"signedBy": "b]", "sig": "2"},
+				map[string]interface{}{"n": 3.0},
+			},
+		}
+	}
+
+	data := newData()
+	if got, err := Get(data, `sigs[signedBy="b]"].sig`); err != nil || got != "2" {
+		t.Errorf("Get() = %v, %v, want 2", got, err)
+	}
+	if got, err := Get(data, `sigs[n=3]`); err != nil || got.(map[string]interface{})["n"] != 3.0 {
+		t.Errorf("Get() by number = %v, %v", got, err)
+	}
+	if err := Set(data, `sigs[signedBy="a"].sig`, "x"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, _ := Get(data, "sigs[0].sig"); got != "x" {
+		t.Errorf("expected sigs[0].sig to be set, got %v", got)
+	}
+	if err := Delete(data, `sigs[signedBy="a"]`); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got := data["sigs"].([]interface{}); len(got) != 2 {
+		t.Errorf("expected 2 elements after Delete, got %v", got)
+	}
+
+	errorCases := []struct {
+		name string
+		run  func(map[string]interface{}) error
+	}{
+		{"get missing", func(d map[string]interface{}) error { _, err := Get(d, `sigs[signedBy="z"]`); return err }},
+		{"set missing", func(d map[string]interface{}) error { return Set(d, `sigs[signedBy="z"].sig`, "x") }},
+		{"delete missing", func(d map[string]interface{}) error { return Delete(d, `sigs[signedBy="z"]`) }},
+		{"value not JSON", func(d map[string]interface{}) error { _, err := Get(d, `sigs[signedBy=a]`); return err }},
+		{"unterminated string", func(d map[string]interface{}) error { _, err := Get(d, `sigs[signedBy="a]`); return err }},
+		{"ambiguous", func(d map[string]interface{}) error {
+			d["sigs"] = append(d["sigs"].([]interface{}), map[string]interface{}{"signedBy": "a"})
+			_, err := Get(d, `sigs[signedBy="a"]`)
+			return err
+		}},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.run(newData()); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestSplitAssignment(t *testing.T) {
+	tests := []struct {
+		input string
+		path  string
+		value string
+		ok    bool
+	}{
+		{"a.b=1", "a.b", "1", true},
+		{"a=b=c", "a", "b=c", true},
+		{`"x=y".z=1`, `"x=y".z`, "1", true},
+		{`sigs[signedBy="a=b"].sig=1`, `sigs[signedBy="a=b"].sig`, "1", true},
+		{`sigs[n=2]=x`, `sigs[n=2]`, "x", true},
+		{"novalue", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			path, value, ok := SplitAssignment(tt.input)
+			if path != tt.path || value != tt.value || ok != tt.ok {
+				t.Errorf("got (%q, %q, %v), expected (%q, %q, %v)", path, value, ok, tt.path, tt.value, tt.ok)
+			}
+		})
+	}
+}
+
 func TestParseValue(t *testing.T) {
 	tests := []struct {
 		input    string
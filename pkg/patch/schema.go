@@ -0,0 +1,550 @@
+package patch
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"buf-lib-poc/pkg/config"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FieldResolver describes how fields appear in the JSON form beyond their descriptor:
+// bytes fields expanded into nested messages, rendered fields and resolved Any values.
+type FieldResolver interface {
+	MappedTarget(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor, data map[string]interface{}) protoreflect.MessageDescriptor
+	RenderFormat(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) string
+	ResolveAny(data map[string]interface{}) protoreflect.MessageDescriptor
+}
+
+// Schema applies paths to the JSON form of a message, validating them against its descriptor.
+// Field names may be given as proto or JSON names; values are coerced to the protojson form of the field.
+type Schema struct {
+	Message protoreflect.MessageDescriptor
+	// Resolver is optional; without it mapped bytes fields cannot be descended into.
+	Resolver FieldResolver
+}
+
+// leaf is the position a path resolves to.
+type leaf struct {
+	md   protoreflect.MessageDescriptor // message containing fd
+	fd   protoreflect.FieldDescriptor   // nil when the position is not described by the schema
+	elem bool                           // a single list element or map value rather than the whole field
+}
+
+// Set parses value according to the field at path and sets it. A JSONPath sets every value it
+// selects. Setting a oneof member removes the other members of the same oneof.
+func (s *Schema) Set(data map[string]interface{}, path, value string) error {
+	if IsJSONPath(path) {
+		paths, err := selectSome(data, path)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			if err := s.Set(data, p, value); err != nil {
+				return fmt.Errorf("JSONPath %q: %v", path, err)
+			}
+		}
+		return nil
+	}
+	tokens, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	resolved, l, clears, err := s.resolve(data, tokens, path)
+	if err != nil {
+		return err
+	}
+	v, err := s.coerce(l, value)
+	if err != nil {
+		return fmt.Errorf("path %q: %v", path, err)
+	}
+	if _, err := setIn(data, resolved, v, path); err != nil {
+		return err
+	}
+	for _, clear := range clears {
+		clear()
+	}
+	return nil
+}
+
+// Delete validates path against the schema and removes its value. A JSONPath removes every value
+// it selects.
+func (s *Schema) Delete(data map[string]interface{}, path string) error {
+	if IsJSONPath(path) {
+		paths, err := selectSome(data, path)
+		if err != nil {
+			return err
+		}
+		// Last first, so that removing list elements does not shift the ones still to remove
+		for i := len(paths) - 1; i >= 0; i-- {
+			if err := s.Delete(data, paths[i]); err != nil {
+				return fmt.Errorf("JSONPath %q: %v", path, err)
+			}
+		}
+		return nil
+	}
+	tokens, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	resolved, _, _, err := s.resolve(data, tokens, path)
+	if err != nil {
+		return err
+	}
+	_, err = deleteIn(data, resolved, path)
+	return err
+}
+
+// resolve walks the path through the schema, returning the tokens with field names replaced by the
+// keys used in data, the resolved position, and the oneof siblings to clear once the value is set.
+func (s *Schema) resolve(data map[string]interface{}, tokens []token, path string) ([]token, leaf, []func(), error) {
+	out := append([]token(nil), tokens...)
+	var clears []func()
+
+	md := s.Message
+	var curr interface{} = data
+	for i := 0; i < len(tokens); {
+		if md == nil {
+			// Untyped content, e.g. an Any of unknown type or a google.protobuf.Struct
+			return out, leaf{}, clears, nil
+		}
+		tok := tokens[i]
+		if tok.isIndex {
+			return nil, leaf{}, nil, fmt.Errorf("path %q: %s is a message, not a list", path, prefix(tokens, i))
+		}
+		obj, _ := curr.(map[string]interface{})
+		if strings.HasPrefix(tok.key, "@") {
+			// Annotations (@version, @data, @type) are not schema fields
+			return out, leaf{md: md}, clears, nil
+		}
+
+		fd := lookupField(md, tok.key)
+		if fd == nil {
+			return nil, leaf{}, nil, fmt.Errorf("path %q: %s", path, unknownField(md, tok.key))
+		}
+		key := keyFor(obj, fd)
+		out[i].key = key
+		if obj != nil {
+			if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+				clears = append(clears, clearOneof(obj, od, fd))
+			}
+		}
+		var val interface{}
+		if obj != nil {
+			val = obj[key]
+		}
+		parent := md
+		parentObj := obj
+		i++
+
+		elem := false
+		if (fd.IsList() || fd.IsMap()) && i < len(tokens) {
+			t := tokens[i]
+			if fd.IsList() && !t.isIndex {
+				return nil, leaf{}, nil, fmt.Errorf("path %q: %s is a repeated field; use [n] or [] to address its elements", path, fd.Name())
+			}
+			if t.match != "" {
+				em := fd.Message()
+				if em == nil {
+					return nil, leaf{}, nil, fmt.Errorf("path %q: elements of %s are not messages; use [n] to address them", path, fd.Name())
+				}
+				mf := lookupField(em, t.match)
+				if mf == nil {
+					return nil, leaf{}, nil, fmt.Errorf("path %q: %s", path, unknownField(em, t.match))
+				}
+				first, _ := val.([]interface{})
+				var firstObj map[string]interface{}
+				if len(first) > 0 {
+					firstObj, _ = first[0].(map[string]interface{})
+				}
+				t.match = keyFor(firstObj, mf)
+				out[i] = t
+			}
+			if fd.IsMap() {
+				if t.isIndex {
+					return nil, leaf{}, nil, fmt.Errorf("path %q: %s is a map; use .key to address its entries", path, fd.Name())
+				}
+				if _, err := coerceScalar(fd.MapKey(), "", t.key); err != nil {
+					return nil, leaf{}, nil, fmt.Errorf("path %q: invalid key for map %s: %v", path, fd.Name(), err)
+				}
+			}
+			val, _, _ = child(val, t)
+			elem = true
+			i++
+		}
+		if i == len(tokens) {
+			return out, leaf{md: parent, fd: fd, elem: elem}, clears, nil
+		}
+
+		next, untyped, err := s.nested(parent, fd, parentObj, val)
+		if err != nil {
+			return nil, leaf{}, nil, fmt.Errorf("path %q: %v", path, err)
+		}
+		if next == nil && !untyped {
+			return nil, leaf{}, nil, fmt.Errorf("path %q: cannot descend into %s field %s", path, kindName(fd), fd.Name())
+		}
+		md = next
+		curr = val
+	}
+	return out, leaf{md: md}, clears, nil
+}
+
+// nested returns the message type whose fields the next path element names.
+// untyped is set for content that is not described by the schema.
+func (s *Schema) nested(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor, obj map[string]interface{}, val interface{}) (protoreflect.MessageDescriptor, bool, error) {
+	vd := valueField(fd)
+	if vd.Kind() == protoreflect.BytesKind && s.Resolver != nil {
+		return s.Resolver.MappedTarget(md, fd, obj), false, nil
+	}
+	msg := vd.Message()
+	if msg == nil {
+		return nil, false, nil
+	}
+	switch msg.FullName() {
+	case "google.protobuf.Any":
+		if m, ok := val.(map[string]interface{}); ok && s.Resolver != nil {
+			if resolved := s.Resolver.ResolveAny(m); resolved != nil {
+				return resolved, false, nil
+			}
+		}
+		return nil, true, nil
+	case "google.protobuf.Struct", "google.protobuf.Value", "google.protobuf.ListValue":
+		return nil, true, nil
+	}
+	if msg.ParentFile().Package() == "google.protobuf" {
+		return nil, false, fmt.Errorf("%s is a %s; set it as a whole", fd.Name(), msg.FullName())
+	}
+	return msg, false, nil
+}
+
+// coerce converts a command-line value to the protojson form of the resolved field.
+func (s *Schema) coerce(l leaf, raw string) (interface{}, error) {
+	if l.fd == nil {
+		return ParseValue(raw), nil
+	}
+	format := ""
+	if s.Resolver != nil {
+		format = s.Resolver.RenderFormat(l.md, l.fd)
+	}
+
+	switch {
+	case l.fd.IsMap() && !l.elem:
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &obj); err != nil {
+			return nil, fmt.Errorf("map field %s expects a JSON object", l.fd.Name())
+		}
+		return obj, nil
+	case l.fd.IsList() && !l.elem:
+		if strings.HasPrefix(strings.TrimSpace(raw), "[") {
+			var list []interface{}
+			if err := json.Unmarshal([]byte(raw), &list); err != nil {
+				return nil, fmt.Errorf("invalid JSON list: %v", err)
+			}
+			for i, item := range list {
+				if str, ok := item.(string); ok {
+					v, err := coerceScalar(l.fd, format, str)
+					if err != nil {
+						return nil, fmt.Errorf("element %d: %v", i, err)
+					}
+					list[i] = v
+				}
+			}
+			return list, nil
+		}
+		list := []interface{}{}
+		if raw == "" {
+			return list, nil
+		}
+		for _, item := range strings.Split(raw, ",") {
+			v, err := coerceScalar(l.fd, format, item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	return coerceScalar(valueField(l.fd), format, raw)
+}
+
+// coerceScalar converts a single value of the kind of fd.
+func coerceScalar(fd protoreflect.FieldDescriptor, format, raw string) (interface{}, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q", raw)
+		}
+		return b, nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int32 %q", raw)
+		}
+		return n, nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uint32 %q", raw)
+		}
+		return n, nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			if format == config.RenderTimestamp {
+				if _, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+					return raw, nil
+				}
+			}
+			return nil, fmt.Errorf("invalid int64 %q", raw)
+		}
+		// protojson represents 64-bit integers as strings
+		return strconv.FormatInt(n, 10), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uint64 %q", raw)
+		}
+		return strconv.FormatUint(n, 10), nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		switch raw {
+		case "NaN", "Infinity", "-Infinity":
+			return raw, nil
+		}
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("invalid number %q", raw)
+		}
+		return f, nil
+	case protoreflect.StringKind:
+		return raw, nil
+	case protoreflect.BytesKind:
+		data, err := parseBytes(raw, format == config.RenderHex)
+		if err != nil {
+			return nil, err
+		}
+		if format == config.RenderHex {
+			return hex.EncodeToString(data), nil
+		}
+		return base64.StdEncoding.EncodeToString(data), nil
+	case protoreflect.EnumKind:
+		return coerceEnum(fd.Enum(), raw)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return coerceMessage(fd.Message(), raw)
+	}
+	return nil, fmt.Errorf("unsupported field kind %s", fd.Kind())
+}
+
+// parseBytes reads "@file", "hex:"/"0x" or "base64:" prefixed values. Unprefixed values are never
+// guessed: they are hex in fields rendered as hex and base64 (the protojson form) otherwise.
+func parseBytes(raw string, hexField bool) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(raw, "@"):
+		data, err := os.ReadFile(raw[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %v", raw[1:], err)
+		}
+		return data, nil
+	case strings.HasPrefix(raw, "hex:"), strings.HasPrefix(raw, "0x"):
+		data, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(raw, "hex:"), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex %q", raw)
+		}
+		return data, nil
+	case strings.HasPrefix(raw, "base64:"):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(raw, "base64:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 %q", raw)
+		}
+		return data, nil
+	case hexField:
+		data, err := hex.DecodeString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex %q: prefix base64 values with base64:", raw)
+		}
+		return data, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 %q: prefix hex values with 0x or hex:, or give @file", raw)
+	}
+	return data, nil
+}
+
+func coerceEnum(ed protoreflect.EnumDescriptor, raw string) (interface{}, error) {
+	values := ed.Values()
+	if ev := values.ByName(protoreflect.Name(raw)); ev != nil {
+		return raw, nil
+	}
+	if n, err := strconv.ParseInt(raw, 10, 32); err == nil {
+		if ev := values.ByNumber(protoreflect.EnumNumber(n)); ev != nil {
+			return string(ev.Name()), nil
+		}
+		return n, nil
+	}
+	names := make([]string, values.Len())
+	for i := range names {
+		names[i] = string(values.Get(i).Name())
+	}
+	return nil, fmt.Errorf("unknown %s value %q%s", ed.Name(), raw, didYouMean(raw, names))
+}
+
+func coerceMessage(md protoreflect.MessageDescriptor, raw string) (interface{}, error) {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		if _, err := time.Parse(time.RFC3339Nano, raw); err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q, expected RFC3339", raw)
+		}
+		return raw, nil
+	case "google.protobuf.Duration":
+		if _, err := strconv.ParseFloat(strings.TrimSuffix(raw, "s"), 64); err == nil && strings.HasSuffix(raw, "s") {
+			return raw, nil
+		}
+		// Go durations such as "5m" or "1h30m", in the seconds protojson expects
+		if d, err := time.ParseDuration(raw); err == nil {
+			return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s", nil
+		}
+		return nil, fmt.Errorf("invalid duration %q, expected seconds such as \"1.5s\" or a duration such as \"5m\"", raw)
+	case "google.protobuf.FieldMask":
+		return raw, nil
+	case "google.protobuf.Struct", "google.protobuf.Value", "google.protobuf.ListValue":
+		var v interface{}
+		if err := json.Unmarshal([]byte(raw), &v); err == nil {
+			return v, nil
+		}
+		return raw, nil
+	}
+	if isWrapper(md) {
+		return coerceScalar(md.Fields().ByName("value"), "", raw)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &obj); err != nil {
+		return nil, fmt.Errorf("message %s expects a JSON object such as {}", md.Name())
+	}
+	return obj, nil
+}
+
+func isWrapper(md protoreflect.MessageDescriptor) bool {
+	return md.ParentFile().Package() == "google.protobuf" && strings.HasSuffix(string(md.Name()), "Value") &&
+		md.Fields().Len() == 1 && md.Fields().ByName("value") != nil
+}
+
+// valueField returns the descriptor of a map field's values, or the field itself.
+func valueField(fd protoreflect.FieldDescriptor) protoreflect.FieldDescriptor {
+	if fd.IsMap() {
+		return fd.MapValue()
+	}
+	return fd
+}
+
+func kindName(fd protoreflect.FieldDescriptor) string {
+	if md := valueField(fd).Message(); md != nil {
+		return string(md.FullName())
+	}
+	return valueField(fd).Kind().String()
+}
+
+// lookupField finds a field by proto or JSON name.
+func lookupField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if fd := md.Fields().ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return md.Fields().ByJSONName(name)
+}
+
+// keyFor returns the key holding fd in obj: the name already in use, otherwise the JSON name.
+func keyFor(obj map[string]interface{}, fd protoreflect.FieldDescriptor) string {
+	if _, ok := obj[string(fd.Name())]; ok {
+		return string(fd.Name())
+	}
+	return fd.JSONName()
+}
+
+func clearOneof(obj map[string]interface{}, od protoreflect.OneofDescriptor, keep protoreflect.FieldDescriptor) func() {
+	return func() {
+		for i := 0; i < od.Fields().Len(); i++ {
+			f := od.Fields().Get(i)
+			if f.Number() == keep.Number() {
+				continue
+			}
+			delete(obj, string(f.Name()))
+			delete(obj, f.JSONName())
+		}
+	}
+}
+
+func unknownField(md protoreflect.MessageDescriptor, name string) string {
+	var names []string
+	for i := 0; i < md.Fields().Len(); i++ {
+		names = append(names, md.Fields().Get(i).JSONName())
+	}
+	msg := fmt.Sprintf("unknown field %q in %s", name, md.FullName())
+	if hint := didYouMean(name, names); hint != "" {
+		return msg + hint
+	}
+	if len(names) > 0 {
+		return msg + fmt.Sprintf(" (fields: %s)", strings.Join(names, ", "))
+	}
+	return msg
+}
+
+// didYouMean suggests up to three candidates close to name.
+func didYouMean(name string, candidates []string) string {
+	type match struct {
+		name string
+		dist int
+	}
+	lower := strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	var matches []match
+	for _, c := range candidates {
+		cl := strings.ToLower(strings.ReplaceAll(c, "_", ""))
+		d := levenshtein(lower, cl)
+		if strings.HasSuffix(cl, lower) || strings.HasPrefix(cl, lower) {
+			d = 0
+		}
+		if d <= 2 || d <= len(lower)/3 {
+			matches = append(matches, match{c, d})
+		}
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].dist < matches[j].dist })
+	if len(matches) > 3 {
+		matches = matches[:3]
+	}
+	quoted := make([]string, len(matches))
+	for i, m := range matches {
+		quoted[i] = strconv.Quote(m.name)
+	}
+	return fmt.Sprintf(" (did you mean %s?)", strings.Join(quoted, " or "))
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
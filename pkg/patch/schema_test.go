@@ -0,0 +1,106 @@
+package patch
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestParseBytes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data.bin")
+	os.WriteFile(file, []byte{0x01, 0x02}, 0644)
+
+	tests := []struct {
+		input    string
+		hexField bool
+		expected []byte
+		wantErr  bool
+	}{
+		{"cafe", false, []byte{0x71, 0xa7, 0xde}, false},
+		{"cafe", true, []byte{0xca, 0xfe}, false},
+		{"0xcafe", false, []byte{0xca, 0xfe}, false},
+		{"hex:cafe", false, []byte{0xca, 0xfe}, false},
+		{"base64:cafe", true, []byte{0x71, 0xa7, 0xde}, false},
+		{"AQID", false, []byte{0x01, 0x02, 0x03}, false},
+		{"AQID", true, nil, true},
+		{"abc", false, nil, true},
+		{"@" + file, false, []byte{0x01, 0x02}, false},
+		{"@missing.bin", false, nil, true},
+		{"0xzz", false, nil, true},
+		{"not bytes!", false, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/hex=%v", tt.input, tt.hexField), func(t *testing.T) {
+			got, err := parseBytes(tt.input, tt.hexField)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBytes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.expected) {
+				t.Errorf("expected %x, got %x", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	candidates := []string{"serial", "operation", "mapping", "TOPOLOGY_CHANGE_OP_REMOVE"}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"serail", `"serial"`},
+		{"mappings", `"mapping"`},
+		{"REMOVE", `"TOPOLOGY_CHANGE_OP_REMOVE"`},
+		{"signatures", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := didYouMean(tt.input, candidates)
+			if tt.expected == "" {
+				if got != "" {
+					t.Errorf("expected no suggestion, got %q", got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.expected) {
+				t.Errorf("expected suggestion %s, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCoerceDuration(t *testing.T) {
+	md := (&durationpb.Duration{}).ProtoReflect().Descriptor()
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"30s", "30s", false},
+		{"1.5s", "1.5s", false},
+		{"5m", "300s", false},
+		{"1h30m", "5400s", false},
+		{"250ms", "0.25s", false},
+		{"30", "", true},
+		{"soon", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := coerceMessage(md, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("coerceMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.expected {
+				t.Errorf("expected %s, got %v", tt.expected, got)
+			}
+		})
+	}
+}
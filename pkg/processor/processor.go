@@ -1,10 +1,17 @@
 package processor
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
 
 	"buf-lib-poc/pkg/config"
 	"buf-lib-poc/pkg/loader"
@@ -15,10 +22,41 @@ import (
 	"google.golang.org/protobuf/types/dynamicpb"
 )
 
+const anyFullName = "google.protobuf.Any"
+
+// Annotation keys attached to expanded mapped fields. They are not proto fields and are
+// stripped before serialization.
+const (
+	RawKey     = "@raw"     // Original bytes of the field (base64), reused when the content is unchanged
+	HashKey    = "@hash"    // ContentHash of the expanded content at decode time
+	VersionKey = "@version" // UntypedVersionedMessage version of a versioned payload
+	DataKey    = "@data"    // Explicit unwrapped payload (base64) to wrap instead of serializing the object
+)
+
+const wrapperName = "com.digitalasset.canton.version.v1.UntypedVersionedMessage"
+
 type Processor struct {
 	Loader *loader.SchemaLoader
 	Config *config.Config
 	Files  []protoreflect.FileDescriptor
+
+	// KeepRaw annotates expanded fields with their original bytes so that
+	// CompressRecursively reproduces them exactly when the content is unchanged.
+	KeepRaw bool
+
+	types *dynamicpb.Types
+}
+
+// Types returns the registry used to resolve google.protobuf.Any type URLs against the loaded files.
+func (p *Processor) Types() (*dynamicpb.Types, error) {
+	if p.types == nil {
+		types, err := loader.NewTypes(p.Files)
+		if err != nil {
+			return nil, err
+		}
+		p.types = types
+	}
+	return p.types, nil
 }
 
 // ExpandRecursively takes a message and expands its fields according to the config.
@@ -28,7 +66,11 @@ func (p *Processor) ExpandRecursively(ctx context.Context, md protoreflect.Messa
 	}
 
 	// 1. Convert message to JSON map using protojson to get standard behavior
-	jsonData, err := protojson.Marshal(msg.Message().Interface())
+	types, err := p.Types()
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := protojson.MarshalOptions{Resolver: types}.Marshal(msg.Message().Interface())
 	if err != nil {
 		return nil, err
 	}
@@ -40,11 +82,23 @@ func (p *Processor) ExpandRecursively(ctx context.Context, md protoreflect.Messa
 
 	// 2. If it's a map, walk it and expand
 	if m, ok := data.(map[string]interface{}); ok {
-		return p.expandMap(ctx, md, m)
+		return p.expandMessage(ctx, md, m)
 	}
 	return data, nil
 }
 
+// expandMessage expands a message, descending into the resolved type of google.protobuf.Any values.
+func (p *Processor) expandMessage(ctx context.Context, md protoreflect.MessageDescriptor, data map[string]interface{}) (map[string]interface{}, error) {
+	if md.FullName() == anyFullName {
+		resolved := p.ResolveAny(data)
+		if resolved == nil {
+			return data, nil
+		}
+		md = resolved
+	}
+	return p.expandMap(ctx, md, data)
+}
+
 func (p *Processor) expandMap(ctx context.Context, md protoreflect.MessageDescriptor, data map[string]interface{}) (map[string]interface{}, error) {
 	fields := md.Fields()
 	for i := 0; i < fields.Len(); i++ {
@@ -56,78 +110,87 @@ func (p *Processor) expandMap(ctx context.Context, md protoreflect.MessageDescri
 		}
 
 		// Check for mapping
-		var mapped *config.Mapping
-		for _, m := range p.Config.Mappings {
-			if m.Type == string(md.FullName()) && m.Field == string(fd.Name()) {
-				mapped = &m
-				break
-			}
-		}
-
-		if mapped != nil && fd.Kind() == protoreflect.BytesKind {
+		if mapped := p.findMapping(md, fd); mapped != nil && isBytesField(fd) {
 			// Field is a nested message in bytes
-			str, ok := val.(string)
-			if !ok {
-				continue // Should be base64 string from protojson
-			}
-			bytes, err := base64.StdEncoding.DecodeString(str)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode base64 field %s: %v", jsonName, err)
+			target := mapped.ResolveTarget(discriminatorValue(md, mapped.Discriminator, data))
+			if target == "" {
+				continue
 			}
-
-			expanded, err := p.expandBytes(ctx, bytes, mapped)
+			expanded, err := forEachValue(fd, val, func(item interface{}) (interface{}, error) {
+				str, ok := item.(string)
+				if !ok {
+					return item, nil // Should be base64 string from protojson
+				}
+				bytes, err := base64.StdEncoding.DecodeString(str)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode base64 field %s: %v", jsonName, err)
+				}
+				return p.expandBytes(ctx, bytes, mapped, target)
+			})
 			if err != nil {
 				return nil, err
 			}
 			data[jsonName] = expanded
-		} else if fd.Kind() == protoreflect.MessageKind {
-			// Nested message - if it's a map, recurse
-			if subMap, ok := val.(map[string]interface{}); ok {
-				expanded, err := p.expandMap(ctx, fd.Message(), subMap)
-				if err != nil {
-					return nil, err
-				}
-				data[jsonName] = expanded
-			} else if subList, ok := val.([]interface{}); ok && fd.IsList() {
-				for j, item := range subList {
-					if itemMap, ok := item.(map[string]interface{}); ok {
-						expanded, err := p.expandMap(ctx, fd.Message(), itemMap)
-						if err != nil {
-							return nil, err
-						}
-						subList[j] = expanded
-					}
+		} else if r := p.findRenderer(md, fd); r != nil {
+			rendered, _ := forEachValue(fd, val, func(item interface{}) (interface{}, error) {
+				return Render(r.Format, item), nil
+			})
+			data[jsonName] = rendered
+		} else if nestedDesc := messageOf(fd); nestedDesc != nil {
+			// Nested message (or list/map of messages) - recurse into each map
+			expanded, err := forEachValue(fd, val, func(item interface{}) (interface{}, error) {
+				itemMap, ok := item.(map[string]interface{})
+				if !ok {
+					return item, nil
 				}
+				return p.expandMessage(ctx, nestedDesc, itemMap)
+			})
+			if err != nil {
+				return nil, err
 			}
+			data[jsonName] = expanded
 		}
 	}
 	return data, nil
 }
 
-func (p *Processor) expandBytes(ctx context.Context, data []byte, m *config.Mapping) (interface{}, error) {
+func (p *Processor) expandBytes(ctx context.Context, data []byte, m *config.Mapping, target string) (interface{}, error) {
 	binaryData := data
+	var version int32
 	if m.Versioned {
-		wrapperMsgDesc := loader.FindMessage(p.Files, "com.digitalasset.canton.version.v1.UntypedVersionedMessage")
-		if wrapperMsgDesc == nil {
-			return nil, fmt.Errorf("wrapper descriptor (UntypedVersionedMessage) not found in schema")
-		}
-		wrapperMsg := dynamicpb.NewMessage(wrapperMsgDesc)
-		if err := proto.Unmarshal(binaryData, wrapperMsg); err != nil {
+		var err error
+		binaryData, version, err = p.Unwrap(data)
+		if err != nil {
 			return nil, err
 		}
-		binaryData = wrapperMsg.Get(wrapperMsgDesc.Fields().ByName("data")).Bytes()
+		if err := p.Config.CheckVersion(target, version); err != nil {
+			log.Printf("warning: %v", err)
+		}
 	}
 
-	targetDesc := loader.FindMessage(p.Files, m.TargetType)
+	targetDesc := loader.FindMessage(p.Files, target)
 	if targetDesc == nil {
-		return nil, fmt.Errorf("target type %s not found", m.TargetType)
+		return nil, fmt.Errorf("target type %s not found", target)
 	}
 	targetMsg := dynamicpb.NewMessage(targetDesc)
 	if err := proto.Unmarshal(binaryData, targetMsg); err != nil {
 		return nil, err
 	}
 
-	return p.ExpandRecursively(ctx, targetDesc, protoreflect.ValueOfMessage(targetMsg))
+	expanded, err := p.ExpandRecursively(ctx, targetDesc, protoreflect.ValueOfMessage(targetMsg))
+	if err != nil {
+		return nil, err
+	}
+	if obj, ok := expanded.(map[string]interface{}); ok {
+		if m.Versioned {
+			obj[VersionKey] = version
+		}
+		if p.KeepRaw {
+			obj[HashKey] = ContentHash(obj)
+			obj[RawKey] = base64.StdEncoding.EncodeToString(data)
+		}
+	}
+	return expanded, nil
 }
 
 // CompressRecursively takes a JSON map and compresses fields into bytes according to the config.
@@ -136,6 +199,13 @@ func (p *Processor) CompressRecursively(ctx context.Context, md protoreflect.Mes
 	if !ok {
 		return data, nil
 	}
+	if md.FullName() == anyFullName {
+		resolved := p.ResolveAny(m)
+		if resolved == nil {
+			return m, nil
+		}
+		md = resolved
+	}
 
 	fields := md.Fields()
 	for i := 0; i < fields.Len(); i++ {
@@ -147,66 +217,112 @@ func (p *Processor) CompressRecursively(ctx context.Context, md protoreflect.Mes
 		}
 
 		// Check for mapping
-		var mapped *config.Mapping
-		for _, mapping := range p.Config.Mappings {
-			if mapping.Type == string(md.FullName()) && mapping.Field == string(fd.Name()) {
-				mapped = &mapping
-				break
-			}
-		}
-
-		if mapped != nil && fd.Kind() == protoreflect.BytesKind {
-			// Pre-compress the nested object
-			compressedBytes, err := p.compressBytes(ctx, val, mapped)
-			if err != nil {
-				return nil, err
+		if mapped := p.findMapping(md, fd); mapped != nil && isBytesField(fd) {
+			target := mapped.ResolveTarget(discriminatorValue(md, mapped.Discriminator, m))
+			if target == "" {
+				continue
 			}
-			// Replace with base64 string so protojson.Unmarshal can handle it
-			m[jsonName] = base64.StdEncoding.EncodeToString(compressedBytes)
-		} else if fd.Kind() == protoreflect.MessageKind {
-			if subMap, ok := val.(map[string]interface{}); ok {
-				compressed, err := p.CompressRecursively(ctx, fd.Message(), subMap)
+			// Pre-compress the nested object(s)
+			compressed, err := forEachValue(fd, val, func(item interface{}) (interface{}, error) {
+				original := rawBytes(item)
+				if _, isObject := item.(map[string]interface{}); isObject && original == nil && hasSignatures(md, mapped, m) {
+					// Without the original bytes there is no way to tell whether re-encoding preserves them
+					log.Printf("WARNING: %s.%s is re-encoded without %s but is covered by signatures; existing signatures may NOT verify",
+						md.FullName(), fd.Name(), RawKey)
+				}
+				compressedBytes, err := p.compressBytes(ctx, item, mapped, target)
 				if err != nil {
 					return nil, err
 				}
-				m[jsonName] = compressed
-			} else if subList, ok := val.([]interface{}); ok && fd.IsList() {
-				for j, item := range subList {
-					compressed, err := p.CompressRecursively(ctx, fd.Message(), item)
-					if err != nil {
-						return nil, err
-					}
-					subList[j] = compressed
+				if original != nil && !bytes.Equal(original, compressedBytes) && hasSignatures(md, mapped, m) {
+					log.Printf("WARNING: %s.%s differs from its original bytes but is covered by signatures; existing signatures will NOT verify",
+						md.FullName(), fd.Name())
 				}
+				// Replace with base64 string so protojson.Unmarshal can handle it
+				return base64.StdEncoding.EncodeToString(compressedBytes), nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			m[jsonName] = compressed
+		} else if r := p.findRenderer(md, fd); r != nil {
+			unrendered, err := forEachValue(fd, val, func(item interface{}) (interface{}, error) {
+				return Unrender(r.Format, item)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", jsonName, err)
+			}
+			m[jsonName] = unrendered
+		} else if nestedDesc := messageOf(fd); nestedDesc != nil {
+			compressed, err := forEachValue(fd, val, func(item interface{}) (interface{}, error) {
+				return p.CompressRecursively(ctx, nestedDesc, item)
+			})
+			if err != nil {
+				return nil, err
 			}
+			m[jsonName] = compressed
 		}
 	}
 	return m, nil
 }
 
-func (p *Processor) compressBytes(ctx context.Context, data interface{}, m *config.Mapping) ([]byte, error) {
-	var binaryData []byte
-	var err error
-
+// compressBytes serializes the value of a mapped field. Strings (base64) and []byte are used
+// verbatim as the field's bytes. Objects are serialized as the target type, unless they carry an
+// explicit "@data" payload; for versioned mappings both are then wrapped in an UntypedVersionedMessage
+// using their "@version" (or the mapping's default version).
+func (p *Processor) compressBytes(ctx context.Context, data interface{}, m *config.Mapping, target string) ([]byte, error) {
 	if bytes, ok := data.([]byte); ok {
 		// Data is already binary, use it as is
-		binaryData = bytes
-	} else if str, ok := data.(string); ok {
-		// Data is a string, could be base64-encoded binary
-		if decoded, err := base64.StdEncoding.DecodeString(str); err == nil {
-			binaryData = decoded
-		} else {
+		return bytes, nil
+	}
+	if str, ok := data.(string); ok {
+		// Data is a base64 string holding the exact field bytes
+		decoded, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
 			return nil, fmt.Errorf("failed to decode base64 string for mapped field: %v", err)
 		}
+		return decoded, nil
+	}
+
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected value for mapped field of type %s: %v", target, data)
+	}
+
+	// Reuse the original bytes if the expanded content was not edited
+	raw := rawBytes(obj)
+	rawHash, _ := obj[HashKey].(string)
+	delete(obj, RawKey)
+	delete(obj, HashKey)
+	if raw != nil && rawHash == ContentHash(obj) {
+		return raw, nil
+	}
+
+	version, hasVersion, err := VersionOf(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(obj, VersionKey)
+	if !hasVersion {
+		version = m.DefaultVersion
+	}
+
+	var binaryData []byte
+	if payload, ok := obj[DataKey]; ok {
+		// Explicit unwrapped payload
+		str, _ := payload.(string)
+		binaryData, err = base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s for mapped field: %v", DataKey, err)
+		}
 	} else {
-		targetDesc := loader.FindMessage(p.Files, m.TargetType)
+		targetDesc := loader.FindMessage(p.Files, target)
 		if targetDesc == nil {
-			return nil, fmt.Errorf("target type %s not found", m.TargetType)
+			return nil, fmt.Errorf("target type %s not found", target)
 		}
 
 		// 1. Recursively compress the target data
-		var finalData interface{}
-		finalData, err = p.CompressRecursively(ctx, targetDesc, data)
+		finalData, err := p.CompressRecursively(ctx, targetDesc, obj)
 		if err != nil {
 			return nil, err
 		}
@@ -216,43 +332,330 @@ func (p *Processor) compressBytes(ctx context.Context, data interface{}, m *conf
 		if err != nil {
 			return nil, err
 		}
+		types, err := p.Types()
+		if err != nil {
+			return nil, err
+		}
 		targetMsg := dynamicpb.NewMessage(targetDesc)
-		if err := protojson.Unmarshal(jsonData, targetMsg); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal JSON for %s: %v", m.TargetType, err)
+		if err := (protojson.UnmarshalOptions{Resolver: types}).Unmarshal(jsonData, targetMsg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON for %s: %v", target, err)
 		}
-		binaryData, err = proto.Marshal(targetMsg)
+		binaryData, err = Marshal(targetMsg)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	// 3. Wrap if versioned
-	if m.Versioned {
-		wrapperDesc := loader.FindMessage(p.Files, "com.digitalasset.canton.version.v1.UntypedVersionedMessage")
-		if wrapperDesc == nil {
-			return nil, fmt.Errorf("wrapper descriptor (UntypedVersionedMessage) not found in schema")
-		}
-
-		// Check if it's already wrapped to avoid double wrapping
-		alreadyWrapped := false
-		testMsg := dynamicpb.NewMessage(wrapperDesc)
-		if err := proto.Unmarshal(binaryData, testMsg); err == nil {
-			// Basic check: if it has data and version fields successfully set, it's likely already wrapped
-			if len(testMsg.Get(wrapperDesc.Fields().ByName("data")).Bytes()) > 0 {
-				alreadyWrapped = true
+	if !m.Versioned {
+		if hasVersion {
+			return nil, fmt.Errorf("%s given for %s, but the mapping is not versioned", VersionKey, target)
+		}
+		return binaryData, nil
+	}
+	if err := p.Config.CheckVersion(target, version); err != nil {
+		return nil, err
+	}
+	return p.Wrap(binaryData, version)
+}
+
+// Marshal serializes a message with a stable field order, so that identical content
+// always produces identical bytes (dynamic messages are otherwise emitted in random order).
+func Marshal(m proto.Message) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(m)
+}
+
+// Wrap serializes data inside an UntypedVersionedMessage with the given version.
+func (p *Processor) Wrap(data []byte, version int32) ([]byte, error) {
+	wrapperDesc := loader.FindMessage(p.Files, wrapperName)
+	if wrapperDesc == nil {
+		return nil, fmt.Errorf("wrapper descriptor (UntypedVersionedMessage) not found in schema")
+	}
+	wrapperMsg := dynamicpb.NewMessage(wrapperDesc)
+	wrapperMsg.Set(wrapperDesc.Fields().ByName("data"), protoreflect.ValueOfBytes(data))
+	wrapperMsg.Set(wrapperDesc.Fields().ByName("version"), protoreflect.ValueOfInt32(version))
+	return Marshal(wrapperMsg)
+}
+
+// Unwrap parses an UntypedVersionedMessage and returns its payload and version.
+func (p *Processor) Unwrap(data []byte) ([]byte, int32, error) {
+	wrapperDesc := loader.FindMessage(p.Files, wrapperName)
+	if wrapperDesc == nil {
+		return nil, 0, fmt.Errorf("wrapper descriptor (UntypedVersionedMessage) not found in schema")
+	}
+	wrapperMsg := dynamicpb.NewMessage(wrapperDesc)
+	if err := proto.Unmarshal(data, wrapperMsg); err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal versioned wrapper: %v", err)
+	}
+	payload := wrapperMsg.Get(wrapperDesc.Fields().ByName("data")).Bytes()
+	version := int32(wrapperMsg.Get(wrapperDesc.Fields().ByName("version")).Int())
+	return payload, version, nil
+}
+
+// VersionOf reads the "@version" annotation of a message in JSON form.
+func VersionOf(obj map[string]interface{}) (int32, bool, error) {
+	v, ok := obj[VersionKey]
+	if !ok {
+		return 0, false, nil
+	}
+	switch val := v.(type) {
+	case float64:
+		if val != float64(int32(val)) {
+			return 0, false, fmt.Errorf("invalid %s: %v", VersionKey, val)
+		}
+		return int32(val), true, nil
+	case int32:
+		return val, true, nil
+	case int:
+		if val != int(int32(val)) {
+			return 0, false, fmt.Errorf("invalid %s: %v", VersionKey, val)
+		}
+		return int32(val), true, nil
+	case string:
+		n, err := strconv.ParseInt(val, 10, 32)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s: %q", VersionKey, val)
+		}
+		return int32(n), true, nil
+	default:
+		return 0, false, fmt.Errorf("invalid %s: %v", VersionKey, v)
+	}
+}
+
+// ContentHash returns a digest of the JSON form of an expanded message, ignoring annotations.
+func ContentHash(v interface{}) string {
+	data, _ := json.Marshal(StripAnnotations(v))
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// StripAnnotations returns a copy of v without @raw/@hash annotations at any depth.
+// The @version annotation is kept since it is part of the serialized payload.
+func StripAnnotations(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			if k == RawKey || k == HashKey {
+				continue
+			}
+			out[k] = StripAnnotations(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = StripAnnotations(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// rawBytes returns the decoded @raw annotation of an expanded value, if any.
+func rawBytes(v interface{}) []byte {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	str, ok := obj[RawKey].(string)
+	if !ok {
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// hasSignatures reports whether a message in JSON form carries signatures over the bytes of a
+// mapped field, in the sibling fields that the mapping lists as signed_by.
+func hasSignatures(md protoreflect.MessageDescriptor, mapped *config.Mapping, data map[string]interface{}) bool {
+	for _, name := range mapped.SignedBy {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			continue
+		}
+		switch v := data[fd.JSONName()].(type) {
+		case []interface{}:
+			if len(v) > 0 {
+				return true
+			}
+		case map[string]interface{}:
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Processor) findMapping(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) *config.Mapping {
+	return p.Config.FindMapping(string(md.FullName()), string(fd.Name()), OneofName(fd))
+}
+
+func (p *Processor) findRenderer(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) *config.Renderer {
+	r := p.Config.FindRenderer(string(md.FullName()), string(fd.Name()))
+	if r == nil || !renderable(r, fd) {
+		return nil
+	}
+	return r
+}
+
+// MappedTarget returns the message type that the mapped bytes field fd expands to, given data as the
+// JSON form of md, or nil when fd is not mapped.
+func (p *Processor) MappedTarget(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor, data map[string]interface{}) protoreflect.MessageDescriptor {
+	mapped := p.findMapping(md, fd)
+	if mapped == nil || !isBytesField(fd) {
+		return nil
+	}
+	target := mapped.ResolveTarget(discriminatorValue(md, mapped.Discriminator, data))
+	if target == "" {
+		return nil
+	}
+	return loader.FindMessage(p.Files, target)
+}
+
+// MappedTargets returns every message type the mapped bytes field fd may expand to, whatever its
+// discriminator, or nil when fd is not mapped.
+func (p *Processor) MappedTargets(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) []protoreflect.MessageDescriptor {
+	mapped := p.findMapping(md, fd)
+	if mapped == nil || !isBytesField(fd) {
+		return nil
+	}
+	names := []string{mapped.TargetType}
+	for _, target := range mapped.Targets {
+		names = append(names, target)
+	}
+	sort.Strings(names)
+	var targets []protoreflect.MessageDescriptor
+	for i, name := range names {
+		if name == "" || (i > 0 && name == names[i-1]) {
+			continue
+		}
+		if target := loader.FindMessage(p.Files, name); target != nil {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// RenderFormat returns the renderer format applied to fd, or an empty string.
+func (p *Processor) RenderFormat(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) string {
+	if r := p.findRenderer(md, fd); r != nil {
+		return r.Format
+	}
+	return ""
+}
+
+// ResolveAny returns the descriptor named by the "@type" of an Any in its JSON form.
+// Well-known types are skipped since protojson renders them under a "value" key.
+func (p *Processor) ResolveAny(data map[string]interface{}) protoreflect.MessageDescriptor {
+	url, _ := data["@type"].(string)
+	if url == "" {
+		return nil
+	}
+	md := loader.FindMessageByURL(p.Files, url)
+	if md == nil || strings.HasPrefix(string(md.FullName()), "google.protobuf.") {
+		return nil
+	}
+	return md
+}
+
+// OneofName returns the name of the (non-synthetic) oneof containing fd, or an empty string.
+func OneofName(fd protoreflect.FieldDescriptor) string {
+	if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+		return string(od.Name())
+	}
+	return ""
+}
+
+// discriminatorValue reads the value selecting a mapping's target type from the JSON form of a message.
+// A discriminator naming a oneof yields the name of the populated member; enum values are normalized to
+// their names, and absent fields yield their default value.
+func discriminatorValue(md protoreflect.MessageDescriptor, discriminator string, data map[string]interface{}) string {
+	if discriminator == "" {
+		return ""
+	}
+	if od := md.Oneofs().ByName(protoreflect.Name(discriminator)); od != nil {
+		for i := 0; i < od.Fields().Len(); i++ {
+			f := od.Fields().Get(i)
+			if _, ok := data[f.JSONName()]; ok {
+				return string(f.Name())
+			}
+		}
+		return ""
+	}
+
+	fd := md.Fields().ByName(protoreflect.Name(discriminator))
+	if fd == nil {
+		return ""
+	}
+	val, ok := data[fd.JSONName()]
+	if !ok {
+		val, ok = data[string(fd.Name())]
+	}
+	if fd.Kind() == protoreflect.EnumKind {
+		if !ok {
+			return string(fd.DefaultEnumValue().Name())
+		}
+		if num, isNum := val.(float64); isNum {
+			if ev := fd.Enum().Values().ByNumber(protoreflect.EnumNumber(num)); ev != nil {
+				return string(ev.Name())
 			}
 		}
+	}
+	if !ok {
+		return fmt.Sprint(fd.Default().Interface())
+	}
+	return fmt.Sprint(val)
+}
+
+func isBytesField(fd protoreflect.FieldDescriptor) bool {
+	if fd.IsMap() {
+		return fd.MapValue().Kind() == protoreflect.BytesKind
+	}
+	return fd.Kind() == protoreflect.BytesKind
+}
 
-		if !alreadyWrapped {
-			wrapperMsg := dynamicpb.NewMessage(wrapperDesc)
-			wrapperMsg.Set(wrapperDesc.Fields().ByName("data"), protoreflect.ValueOfBytes(binaryData))
-			wrapperMsg.Set(wrapperDesc.Fields().ByName("version"), protoreflect.ValueOfInt32(m.DefaultVersion))
-			binaryData, err = proto.Marshal(wrapperMsg)
+// messageOf returns the message type held by a field, list element or map value, if any.
+func messageOf(fd protoreflect.FieldDescriptor) protoreflect.MessageDescriptor {
+	if fd.IsMap() {
+		return fd.MapValue().Message()
+	}
+	return fd.Message()
+}
+
+// forEachValue applies fn to a singular value, each element of a list or each value of a map.
+func forEachValue(fd protoreflect.FieldDescriptor, val interface{}, fn func(interface{}) (interface{}, error)) (interface{}, error) {
+	switch {
+	case fd.IsList():
+		list, ok := val.([]interface{})
+		if !ok {
+			return val, nil
+		}
+		for j, item := range list {
+			out, err := fn(item)
 			if err != nil {
 				return nil, err
 			}
+			list[j] = out
+		}
+		return list, nil
+	case fd.IsMap():
+		entries, ok := val.(map[string]interface{})
+		if !ok {
+			return val, nil
 		}
+		for k, item := range entries {
+			out, err := fn(item)
+			if err != nil {
+				return nil, err
+			}
+			entries[k] = out
+		}
+		return entries, nil
+	default:
+		return fn(val)
 	}
-
-	return binaryData, nil
 }
@@ -0,0 +1,137 @@
+package processor
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"buf-lib-poc/pkg/canton"
+	"buf-lib-poc/pkg/config"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// renderable reports whether a renderer format applies to the kind of a field.
+func renderable(r *config.Renderer, fd protoreflect.FieldDescriptor) bool {
+	kind := fd.Kind()
+	if fd.IsMap() {
+		kind = fd.MapValue().Kind()
+	}
+	switch r.Format {
+	case config.RenderHex, config.RenderPublicKey:
+		return kind == protoreflect.BytesKind
+	case config.RenderTimestamp:
+		switch kind {
+		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+			protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+			return true
+		}
+	}
+	return false
+}
+
+// Render converts a protojson value into the renderer's format.
+// Values that cannot be rendered are returned unchanged.
+func Render(format string, val interface{}) interface{} {
+	switch format {
+	case config.RenderHex:
+		if data, ok := base64Value(val); ok {
+			return hex.EncodeToString(data)
+		}
+	case config.RenderPublicKey:
+		if data, ok := base64Value(val); ok {
+			out := map[string]interface{}{
+				"fingerprint": canton.Fingerprint(data),
+				"der":         base64.StdEncoding.EncodeToString(data),
+			}
+			if info, err := canton.InspectPublicKey(data); err == nil {
+				out["keySpec"] = info.KeySpec
+			}
+			return out
+		}
+	case config.RenderTimestamp:
+		if micros, ok := integerValue(val); ok {
+			return time.UnixMicro(micros).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return val
+}
+
+// Unrender converts a rendered value back into its protojson form, also accepting the protojson form.
+// Hex fields take hex, optionally prefixed with "0x"; their protojson base64 form must be prefixed
+// with "base64:", as a value such as "cafe" is valid in both.
+func Unrender(format string, val interface{}) (interface{}, error) {
+	switch format {
+	case config.RenderHex:
+		str, ok := val.(string)
+		if !ok {
+			return val, nil
+		}
+		if strings.HasPrefix(str, "base64:") {
+			if _, ok := base64Value(strings.TrimPrefix(str, "base64:")); !ok {
+				return nil, fmt.Errorf("invalid base64 value %q", str)
+			}
+			return strings.TrimPrefix(str, "base64:"), nil
+		}
+		data, err := hex.DecodeString(strings.TrimPrefix(str, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex value %q: prefix base64 values with base64:", str)
+		}
+		return base64.StdEncoding.EncodeToString(data), nil
+	case config.RenderPublicKey:
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return val, nil
+		}
+		der, ok := obj["der"].(string)
+		if !ok {
+			return nil, fmt.Errorf("rendered public key is missing its \"der\" value")
+		}
+		data, err := base64.StdEncoding.DecodeString(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key der: %v", err)
+		}
+		if fp, ok := obj["fingerprint"].(string); ok && fp != canton.Fingerprint(data) {
+			return nil, fmt.Errorf("public key fingerprint %s does not match its der value (%s)", fp, canton.Fingerprint(data))
+		}
+		return der, nil
+	case config.RenderTimestamp:
+		str, ok := val.(string)
+		if !ok {
+			return val, nil
+		}
+		if _, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return val, nil
+		}
+		ts, err := time.Parse(time.RFC3339Nano, str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q: %v", str, err)
+		}
+		return strconv.FormatInt(ts.UnixMicro(), 10), nil
+	}
+	return val, nil
+}
+
+func base64Value(val interface{}) ([]byte, bool) {
+	str, ok := val.(string)
+	if !ok {
+		return nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(str)
+	return data, err == nil
+}
+
+// integerValue reads a 64-bit integer, which protojson renders as a string.
+func integerValue(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"buf-lib-poc/pkg/canton"
+	"buf-lib-poc/pkg/config"
+)
+
+func TestRenderRoundTrip(t *testing.T) {
+	pub := ed25519.NewKeyFromSeed(make([]byte, 32)).Public().(ed25519.PublicKey)
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	derB64 := base64.StdEncoding.EncodeToString(der)
+
+	tests := []struct {
+		name     string
+		format   string
+		input    interface{}
+		rendered interface{}
+	}{
+		{
+			name:     "hex",
+			format:   config.RenderHex,
+			input:    base64.StdEncoding.EncodeToString([]byte{0x12, 0x20, 0xab}),
+			rendered: "1220ab",
+		},
+		{
+			name:   "public key",
+			format: config.RenderPublicKey,
+			input:  derB64,
+			rendered: map[string]interface{}{
+				"fingerprint": canton.Fingerprint(der),
+				"keySpec":     "SIGNING_KEY_SPEC_EC_CURVE25519",
+				"der":         derB64,
+			},
+		},
+		{
+			name:     "timestamp",
+			format:   config.RenderTimestamp,
+			input:    "1700000000123456",
+			rendered: "2023-11-14T22:13:20.123456Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered := Render(tt.format, tt.input)
+			if !reflect.DeepEqual(rendered, tt.rendered) {
+				t.Fatalf("Render() = %v, want %v", rendered, tt.rendered)
+			}
+			back, err := Unrender(tt.format, rendered)
+			if err != nil {
+				t.Fatalf("Unrender() error = %v", err)
+			}
+			if !reflect.DeepEqual(back, tt.input) {
+				t.Errorf("Unrender() = %v, want %v", back, tt.input)
+			}
+		})
+	}
+}
+
+func TestUnrender(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		input    interface{}
+		expected interface{}
+		wantErr  bool
+	}{
+		{"hex with 0x", config.RenderHex, "0x0102", "AQI=", false},
+		{"forced base64", config.RenderHex, "base64:AQI=", "AQI=", false},
+		{"hex that is also base64", config.RenderHex, "cafe", "yv4=", false},
+		{"unprefixed base64", config.RenderHex, "yv4=", nil, true},
+		{"invalid forced base64", config.RenderHex, "base64:zz!", nil, true},
+		{"invalid hex", config.RenderHex, "zz!", nil, true},
+		{"protojson timestamp", config.RenderTimestamp, "42", "42", false},
+		{"invalid timestamp", config.RenderTimestamp, "yesterday", nil, true},
+		{"protojson public key", config.RenderPublicKey, "AQI=", "AQI=", false},
+		{"fingerprint mismatch", config.RenderPublicKey, map[string]interface{}{"der": "AQI=", "fingerprint": "1220"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Unrender(tt.format, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unrender() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Unrender() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
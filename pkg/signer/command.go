@@ -0,0 +1,41 @@
+package signer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"buf-lib-poc/pkg/canton"
+)
+
+// commandSigner runs an external program for each signature.
+type commandSigner struct {
+	knownKey
+	command string
+}
+
+// NewCommand returns a signer that runs command with "sh -c". The program gets the message on
+// stdin and the algorithm (ed25519, ecdsa256 or ecdsa384) in PROTON_SIGN_ALGORITHM, and prints the
+// signature, as hex, base64 or raw bytes, on stdout. pub is its public key, if known.
+func NewCommand(command string, pub *canton.PublicKey) Signer {
+	return &commandSigner{knownKey: knownKey{pub}, command: command}
+}
+
+func (s *commandSigner) Sign(message []byte, algo string) ([]byte, error) {
+	cmd := exec.Command("sh", "-c", s.command)
+	cmd.Stdin = bytes.NewReader(message)
+	cmd.Env = append(os.Environ(), "PROTON_SIGN_ALGORITHM="+algo)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("signing command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	sig, err := decodeSignature(out)
+	if err != nil {
+		return nil, fmt.Errorf("signing command printed no signature")
+	}
+	return sig, nil
+}
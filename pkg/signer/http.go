@@ -0,0 +1,159 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"buf-lib-poc/pkg/canton"
+)
+
+// SignRequest is the body POSTed to an HTTP signer.
+type SignRequest struct {
+	Algorithm            string `json:"algorithm"`            // ed25519, ecdsa256 or ecdsa384
+	SigningAlgorithmSpec string `json:"signingAlgorithmSpec"` // the Canton SigningAlgorithmSpec of Algorithm
+	Message              []byte `json:"message"`              // base64
+}
+
+// SignResponse is the reply of an HTTP signer to a SignRequest.
+type SignResponse struct {
+	Signature []byte `json:"signature"` // base64; DER for ECDSA
+}
+
+// PublicKeyResponse is the reply of an HTTP signer to a GET request.
+type PublicKeyResponse struct {
+	PublicKey []byte `json:"publicKey"` // base64, in any format accepted by canton.ParsePublicKey
+}
+
+// httpSigner calls a remote signing service.
+type httpSigner struct {
+	url    string
+	pub    *canton.PublicKey
+	client *http.Client
+}
+
+// NewHTTP returns a signer backed by the service at url. Signing POSTs a SignRequest and expects a
+// SignResponse; a GET of the same url returns a PublicKeyResponse, or 404 if the service does not
+// publish its key, in which case pub is used. PROTON_SIGNER_TOKEN, if set, is sent as a bearer
+// token.
+func NewHTTP(url string, pub *canton.PublicKey) Signer {
+	return &httpSigner{url: url, pub: pub, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *httpSigner) Sign(message []byte, algo string) ([]byte, error) {
+	meta, err := canton.GetSignatureMetadata(algo)
+	if err != nil {
+		return nil, err
+	}
+	body, _ := json.Marshal(SignRequest{Algorithm: algo, SigningAlgorithmSpec: meta.Algorithm, Message: message})
+	var resp SignResponse
+	if err := s.do(http.MethodPost, body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Signature) == 0 {
+		return nil, fmt.Errorf("signing service %s returned no signature", s.url)
+	}
+	return resp.Signature, nil
+}
+
+func (s *httpSigner) PublicKey() (*canton.PublicKey, error) {
+	if s.pub != nil {
+		return s.pub, nil
+	}
+	var resp PublicKeyResponse
+	if err := s.do(http.MethodGet, nil, &resp); err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, ErrNoPublicKey
+		}
+		return nil, err
+	}
+	pub, err := canton.ParsePublicKey(resp.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("signing service %s returned an invalid public key: %v", s.url, err)
+	}
+	s.pub = pub
+	return pub, nil
+}
+
+var errNotFound = errors.New("not found")
+
+func (s *httpSigner) do(method string, body []byte, result interface{}) error {
+	req, err := http.NewRequest(method, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if token := os.Getenv("PROTON_SIGNER_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("signing service request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read signing service response: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("signing service %s returned %s: %s", s.url, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("invalid signing service response: %v", err)
+	}
+	return nil
+}
+
+// Handler serves the HTTP signer protocol with s, as a stand-in for a signing service in tests and
+// ceremonies. It checks requests against token when it is not empty.
+func Handler(s Signer, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var result interface{}
+		switch r.Method {
+		case http.MethodGet:
+			pub, err := s.PublicKey()
+			if errors.Is(err, ErrNoPublicKey) {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result = PublicKeyResponse{PublicKey: pub.DER}
+		case http.MethodPost:
+			var req SignRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			sig, err := s.Sign(req.Message, req.Algorithm)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			result = SignResponse{Signature: sig}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
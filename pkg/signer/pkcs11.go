@@ -0,0 +1,181 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"buf-lib-poc/pkg/canton"
+)
+
+// pkcs11Signer signs on a PKCS#11 token with OpenSC's pkcs11-tool, so that no cgo binding is needed.
+type pkcs11Signer struct {
+	tool   string
+	module string
+	token  string
+	slot   string
+	label  string
+	id     string // hex
+	pin    string
+	pub    *canton.PublicKey
+}
+
+// NewPKCS11 returns a signer for the key named by an RFC 7512 PKCS#11 URI, such as
+//
+//	pkcs11:token=canton;object=namespace-key?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=/run/pin
+//
+// The path attributes token, slot-id, object and id select the token and key; the query attributes
+// module-path (required), pin-value and pin-source give the module and user PIN, which is passed to
+// pkcs11-tool on its stdin. Without a PIN, pkcs11-tool prompts for it. Signing runs pkcs11-tool, or the program in PROTON_PKCS11_TOOL.
+func NewPKCS11(uri string, pub *canton.PublicKey) (Signer, error) {
+	path, query, _ := strings.Cut(strings.TrimPrefix(uri, "pkcs11:"), "?")
+	s := &pkcs11Signer{tool: "pkcs11-tool", pub: pub}
+	if tool := os.Getenv("PROTON_PKCS11_TOOL"); tool != "" {
+		s.tool = tool
+	}
+
+	attrs := map[string]string{}
+	for _, sep := range []struct {
+		list, by string
+	}{{path, ";"}, {query, "&"}} {
+		for _, attr := range strings.Split(sep.list, sep.by) {
+			if attr == "" {
+				continue
+			}
+			name, value, ok := strings.Cut(attr, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid PKCS#11 URI attribute %q", attr)
+			}
+			decoded, err := url.PathUnescape(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PKCS#11 URI attribute %q: %v", attr, err)
+			}
+			attrs[name] = decoded
+		}
+	}
+
+	s.module = attrs["module-path"]
+	s.token = attrs["token"]
+	s.slot = attrs["slot-id"]
+	s.label = attrs["object"]
+	if id, ok := attrs["id"]; ok {
+		s.id = hex.EncodeToString([]byte(id))
+	}
+	s.pin = attrs["pin-value"]
+	if source, ok := attrs["pin-source"]; ok {
+		data, err := os.ReadFile(strings.TrimPrefix(source, "file:"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PKCS#11 PIN: %v", err)
+		}
+		s.pin = strings.TrimRight(string(data), "\r\n")
+	}
+	if s.module == "" {
+		return nil, fmt.Errorf("PKCS#11 URI is missing the module-path query attribute")
+	}
+	if s.label == "" && s.id == "" {
+		return nil, fmt.Errorf("PKCS#11 URI must select a key with object or id")
+	}
+	return s, nil
+}
+
+func (s *pkcs11Signer) Sign(message []byte, algo string) ([]byte, error) {
+	meta, err := canton.GetSignatureMetadata(algo)
+	if err != nil {
+		return nil, err
+	}
+	// the token signs the digest of ECDSA, and the message itself for EdDSA
+	mechanism := "ECDSA"
+	if algo == "ed25519" {
+		mechanism = "EDDSA"
+	}
+	input, err := canton.SigningInput(message, meta.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "proton-pkcs11")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "message"), filepath.Join(dir, "signature")
+	if err := os.WriteFile(in, input, 0600); err != nil {
+		return nil, err
+	}
+
+	// without --pin, pkcs11-tool reads the PIN from stdin, which keeps it out of the process list
+	args := append(s.tokenArgs(), "--login", "--sign", "--mechanism", mechanism, "--input-file", in, "--output-file", out)
+	if mechanism == "ECDSA" {
+		// DER, as Canton expects, rather than the raw r||s of PKCS#11
+		args = append(args, "--signature-format", "openssl")
+	}
+	var stdin io.Reader = os.Stdin // for the PIN prompt
+	if s.pin != "" {
+		stdin = strings.NewReader(s.pin + "\n")
+	}
+	if err := s.run(args, stdin); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(out)
+}
+
+func (s *pkcs11Signer) PublicKey() (*canton.PublicKey, error) {
+	if s.pub != nil {
+		return s.pub, nil
+	}
+	dir, err := os.MkdirTemp("", "proton-pkcs11")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "public-key")
+	if err := s.run(append(s.tokenArgs(), "--read-object", "--type", "pubkey", "--output-file", out), os.Stdin); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := canton.ParsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key on PKCS#11 token: %v", err)
+	}
+	s.pub = pub
+	return pub, nil
+}
+
+// tokenArgs selects the module, token and key.
+func (s *pkcs11Signer) tokenArgs() []string {
+	args := []string{"--module", s.module}
+	if s.token != "" {
+		args = append(args, "--token-label", s.token)
+	}
+	if s.slot != "" {
+		args = append(args, "--slot", s.slot)
+	}
+	if s.label != "" {
+		args = append(args, "--label", s.label)
+	}
+	if s.id != "" {
+		args = append(args, "--id", s.id)
+	}
+	return args
+}
+
+func (s *pkcs11Signer) run(args []string, stdin io.Reader) error {
+	cmd := exec.Command(s.tool, args...)
+	cmd.Stdin = stdin
+	var combined bytes.Buffer
+	cmd.Stdout = &combined
+	cmd.Stderr = &combined
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %v: %s", s.tool, err, strings.TrimSpace(combined.String()))
+	}
+	return nil
+}
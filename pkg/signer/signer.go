@@ -0,0 +1,153 @@
+// Package signer signs Canton hashes with keys held in local files, external programs, PKCS#11
+// tokens or remote signing services, so that private keys need not be handled by Proton itself.
+package signer
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"buf-lib-poc/pkg/canton"
+	"buf-lib-poc/pkg/io"
+)
+
+// ErrNoPublicKey is returned by PublicKey when a backend cannot tell its public key and none was
+// configured.
+var ErrNoPublicKey = errors.New("the public key of the signer is unknown, provide it with --signer-public-key")
+
+// Signer signs messages, usually Canton hashes, with a key it holds.
+type Signer interface {
+	// Sign signs message with algo: ed25519, ecdsa256 or ecdsa384. ECDSA signatures are DER.
+	Sign(message []byte, algo string) ([]byte, error)
+	// PublicKey returns the public key of the signer, or ErrNoPublicKey.
+	PublicKey() (*canton.PublicKey, error)
+}
+
+// Options configures the backends opened by Open.
+type Options struct {
+	// Passphrase decrypts encrypted private key files.
+	Passphrase canton.Passphrase
+	// PublicKey is the public key of the signer, in any format accepted by canton.ParsePublicKey.
+	// It is required by backends that cannot tell their public key to sign with a known identity.
+	PublicKey []byte
+	// Base64 reads private key inputs without an explicit encoding as base64.
+	Base64 bool
+}
+
+// Open returns the signer described by spec:
+//   - "exec:COMMAND" runs COMMAND with the shell, see NewCommand;
+//   - "pkcs11:..." signs on a PKCS#11 token, see NewPKCS11;
+//   - "http://..." or "https://..." calls a signing service, see NewHTTP;
+//   - anything else is a private key input read with io.ReadData, such as "@key.pem" or "env:KEY".
+func Open(spec string, opts Options) (Signer, error) {
+	var pub *canton.PublicKey
+	if opts.PublicKey != nil {
+		var err error
+		if pub, err = canton.ParsePublicKey(opts.PublicKey); err != nil {
+			return nil, fmt.Errorf("invalid signer public key: %v", err)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(spec, "exec:"):
+		return NewCommand(strings.TrimPrefix(spec, "exec:"), pub), nil
+	case strings.HasPrefix(spec, "pkcs11:"):
+		return NewPKCS11(spec, pub)
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return NewHTTP(spec, pub), nil
+	}
+
+	data, err := io.ReadData(spec, opts.Base64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %v", err)
+	}
+	return NewKey(data, opts.Passphrase)
+}
+
+// Sign signs message with s and brings the signature into the default SignatureFormat of algo, so
+// that backends may return ECDSA signatures as DER or r||s. When the public key of s is known, it
+// must match algo, and the signature is checked against it, so that a misconfigured backend is
+// caught before its signature is used.
+func Sign(s Signer, message []byte, algo string) ([]byte, error) {
+	meta, err := canton.GetSignatureMetadata(algo)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := s.PublicKey()
+	if err != nil && !errors.Is(err, ErrNoPublicKey) {
+		return nil, err
+	}
+	if pub != nil {
+		if err := canton.CheckSigningKey(pub.Key, meta.Algorithm); err != nil {
+			return nil, err
+		}
+	}
+	sig, err := s.Sign(message, algo)
+	if err != nil {
+		return nil, err
+	}
+	if sig, err = canton.NormalizeSignature(sig, meta.Algorithm, meta.Format); err != nil {
+		return nil, fmt.Errorf("the signer returned an invalid signature: %v", err)
+	}
+	if pub == nil {
+		return sig, nil
+	}
+	valid, err := canton.VerifySignature(message, sig, pub.DER, meta.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check signature: %v", err)
+	}
+	if !valid {
+		return nil, fmt.Errorf("the signer returned a signature that does not verify against its public key %s", canton.Fingerprint(pub.DER))
+	}
+	return sig, nil
+}
+
+// keySigner signs with a private key in memory.
+type keySigner struct {
+	key *canton.PrivateKey
+}
+
+// NewKey returns a signer for a private key in any format accepted by canton.ParsePrivateKey.
+func NewKey(data []byte, passphrase canton.Passphrase) (Signer, error) {
+	key, err := canton.ParsePrivateKey(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	return &keySigner{key: key}, nil
+}
+
+func (s *keySigner) Sign(message []byte, algo string) ([]byte, error) {
+	return s.key.Sign(message, algo)
+}
+
+func (s *keySigner) PublicKey() (*canton.PublicKey, error) {
+	return s.key.Public()
+}
+
+// knownKey implements PublicKey for backends whose key is configured rather than queried.
+type knownKey struct {
+	pub *canton.PublicKey
+}
+
+func (k knownKey) PublicKey() (*canton.PublicKey, error) {
+	if k.pub == nil {
+		return nil, ErrNoPublicKey
+	}
+	return k.pub, nil
+}
+
+// decodeSignature reads a signature printed by an external program: hex or base64 text, or raw bytes.
+func decodeSignature(out []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(out))
+	if text == "" {
+		return nil, fmt.Errorf("empty signature")
+	}
+	if data, err := hex.DecodeString(text); err == nil {
+		return data, nil
+	}
+	if data, err := io.DecodeBase64(text); err == nil {
+		return data, nil
+	}
+	return out, nil
+}
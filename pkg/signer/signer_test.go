@@ -0,0 +1,247 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"buf-lib-poc/pkg/canton"
+)
+
+func newKey(t *testing.T, spec string) (*canton.PrivateKey, *canton.PublicKey, []byte) {
+	t.Helper()
+	priv, err := canton.GenerateKey(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := priv.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := priv.PEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, pub, data
+}
+
+func TestOpen_Key(t *testing.T) {
+	_, pub, data := newKey(t, "ec-p256")
+	path := filepath.Join(t.TempDir(), "key.pem")
+	os.WriteFile(path, data, 0600)
+	t.Setenv("PROTON_TEST_KEY", string(data))
+
+	message := canton.ComputeHash([]byte("transaction"), canton.HashPurposeTopologyTransaction)
+	for _, spec := range []string{"@" + path, "env:PROTON_TEST_KEY"} {
+		s, err := Open(spec, Options{})
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", spec, err)
+		}
+		got, err := s.PublicKey()
+		if err != nil || !bytes.Equal(got.DER, pub.DER) {
+			t.Errorf("PublicKey() = %v, %v", got, err)
+		}
+		if _, err := Sign(s, message, "ecdsa256"); err != nil {
+			t.Errorf("Sign() error = %v", err)
+		}
+	}
+
+	if _, err := Open("@"+path, Options{PublicKey: []byte("not a key")}); err == nil {
+		t.Error("expected an error for an invalid public key")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	priv, pub, _ := newKey(t, "ed25519")
+	_, otherPub, _ := newKey(t, "ed25519")
+	message := canton.ComputeHash([]byte("transaction"), canton.HashPurposeTopologyTransaction)
+	sig := ed25519.Sign(priv.Key.(ed25519.PrivateKey), message)
+
+	// the command checks its input and prints the (deterministic) Ed25519 signature
+	command := `[ "$PROTON_SIGN_ALGORITHM" = ed25519 ] && [ "$(od -An -tx1 | tr -d ' \n')" = ` + hex.EncodeToString(message) + ` ] && echo ` + hex.EncodeToString(sig)
+
+	s, err := Open("exec:"+command, Options{PublicKey: pub.DER})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Sign(s, message, "ed25519")
+	if err != nil || !bytes.Equal(got, sig) {
+		t.Fatalf("Sign() = %x, %v; want %x", got, err, sig)
+	}
+
+	if _, err := Sign(s, []byte("other message"), "ed25519"); err == nil {
+		t.Error("expected an error when the command fails")
+	}
+
+	// without a public key the signature is passed through; with the wrong one it is rejected
+	if _, err := Sign(NewCommand(command, nil), message, "ed25519"); err != nil {
+		t.Errorf("Sign() without public key error = %v", err)
+	}
+	if _, err := Sign(NewCommand(command, otherPub), message, "ed25519"); err == nil || !strings.Contains(err.Error(), "does not verify") {
+		t.Errorf("Sign() with the wrong public key error = %v", err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	_, pub, data := newKey(t, "ec-p384")
+	backend, err := NewKey(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(Handler(backend, "secret-token"))
+	defer server.Close()
+	message := canton.ComputeHash([]byte("transaction"), canton.HashPurposeTopologyTransaction)
+
+	t.Setenv("PROTON_SIGNER_TOKEN", "secret-token")
+	s, err := Open(server.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.PublicKey()
+	if err != nil || !bytes.Equal(got.DER, pub.DER) {
+		t.Fatalf("PublicKey() = %v, %v", got, err)
+	}
+	if _, err := Sign(s, message, "ecdsa384"); err != nil {
+		t.Errorf("Sign() error = %v", err)
+	}
+	if _, err := Sign(s, message, "ed25519"); err == nil {
+		t.Error("expected an error for an algorithm that does not match the key")
+	}
+
+	t.Setenv("PROTON_SIGNER_TOKEN", "wrong")
+	if _, err := NewHTTP(server.URL, nil).Sign(message, "ecdsa384"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Sign() with a wrong token error = %v", err)
+	}
+}
+
+func TestPKCS11_URI(t *testing.T) {
+	tests := []struct {
+		uri     string
+		want    []string
+		wantErr bool
+	}{
+		{
+			uri:  "pkcs11:token=canton;object=ns%20key?module-path=/lib/softhsm2.so&pin-value=1234",
+			want: []string{"--module", "/lib/softhsm2.so", "--token-label", "canton", "--label", "ns key"},
+		},
+		{
+			uri:  "pkcs11:slot-id=3;id=%01%02?module-path=/lib/p11.so",
+			want: []string{"--module", "/lib/p11.so", "--slot", "3", "--id", "0102"},
+		},
+		{uri: "pkcs11:token=canton;object=key", wantErr: true},
+		{uri: "pkcs11:token=canton?module-path=/lib/p11.so", wantErr: true},
+		{uri: "pkcs11:token?module-path=/lib/p11.so", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		s, err := NewPKCS11(tt.uri, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewPKCS11(%s) error = %v, wantErr %v", tt.uri, err, tt.wantErr)
+			continue
+		}
+		if err == nil {
+			if got := s.(*pkcs11Signer).tokenArgs(); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("NewPKCS11(%s) args = %q, want %q", tt.uri, got, tt.want)
+			}
+		}
+	}
+}
+
+// TestPKCS11_Tool runs the PKCS#11 backend against a stand-in for pkcs11-tool.
+func TestPKCS11_Tool(t *testing.T) {
+	priv, pub, _ := newKey(t, "ed25519")
+	message := canton.ComputeHash([]byte("transaction"), canton.HashPurposeTopologyTransaction)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "signature"), ed25519.Sign(priv.Key.(ed25519.PrivateKey), message), 0644)
+	os.WriteFile(filepath.Join(dir, "public-key"), pub.DER, 0644)
+	os.WriteFile(filepath.Join(dir, "expected-input"), message, 0644)
+
+	tool := filepath.Join(dir, "pkcs11-tool")
+	script := `#!/bin/sh
+echo "$@" >> ` + dir + `/args
+case " $* " in *" --login "*) cat > ` + dir + `/stdin ;; esac
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --input-file) cmp -s "$2" ` + dir + `/expected-input || { echo "unexpected input" >&2; exit 1; } ;;
+    --output-file) out="$2" ;;
+    --sign) src=signature ;;
+    --read-object) src=public-key ;;
+  esac
+  shift
+done
+cp ` + dir + `/$src "$out"
+`
+	if err := os.WriteFile(tool, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PROTON_PKCS11_TOOL", tool)
+
+	s, err := Open("pkcs11:token=canton;object=ns?module-path=/lib/softhsm2.so&pin-value=token-pin", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sign(s, message, "ed25519"); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	for _, want := range []string{"--login --sign --mechanism EDDSA", "--label ns"} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("pkcs11-tool args %q are missing %q", args, want)
+		}
+	}
+	if strings.Contains(string(args), "token-pin") {
+		t.Errorf("pkcs11-tool args %q contain the PIN", args)
+	}
+	if stdin, _ := os.ReadFile(filepath.Join(dir, "stdin")); string(stdin) != "token-pin\n" {
+		t.Errorf("pkcs11-tool read %q from stdin, want the PIN", stdin)
+	}
+}
+
+// TestPKCS11_SoftHSM signs with a key generated on a SoftHSM token, when SoftHSM and OpenSC are installed.
+func TestPKCS11_SoftHSM(t *testing.T) {
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		module = "/usr/lib/softhsm/libsofthsm2.so"
+	}
+	for _, tool := range []string{"softhsm2-util", "pkcs11-tool"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not installed", tool)
+		}
+	}
+	if _, err := os.Stat(module); err != nil {
+		t.Skipf("SoftHSM module not found at %s, set SOFTHSM2_MODULE", module)
+	}
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	os.Mkdir(filepath.Join(dir, "tokens"), 0700)
+	os.WriteFile(conf, []byte("directories.tokendir = "+filepath.Join(dir, "tokens")+"\n"), 0600)
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	run := func(name string, args ...string) {
+		t.Helper()
+		if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+			t.Fatalf("%s failed: %v\n%s", name, err, out)
+		}
+	}
+	run("softhsm2-util", "--init-token", "--free", "--label", "proton", "--pin", "1234", "--so-pin", "5678")
+	run("pkcs11-tool", "--module", module, "--token-label", "proton", "--login", "--pin", "1234",
+		"--keypairgen", "--key-type", "EC:prime256v1", "--label", "ns")
+
+	s, err := Open("pkcs11:token=proton;object=ns?module-path="+module+"&pin-value=1234", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PublicKey(); err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+	if _, err := Sign(s, canton.ComputeHash([]byte("transaction"), canton.HashPurposeTopologyTransaction), "ecdsa256"); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+}
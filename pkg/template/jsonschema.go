@@ -0,0 +1,364 @@
+package template
+
+import (
+	"math"
+	"strings"
+
+	"buf-lib-poc/pkg/config"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// SchemaDialect is the JSON Schema draft emitted by JSONSchema.
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// SchemaResolver describes the fields whose JSON form the config changes: mapped bytes fields that
+// expand into nested messages, and rendered fields.
+type SchemaResolver interface {
+	// MappedTargets returns the message types a mapped bytes field may expand to, or nothing.
+	MappedTargets(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) []protoreflect.MessageDescriptor
+	// RenderFormat returns the renderer format applied to fd, or an empty string.
+	RenderFormat(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) string
+}
+
+// JSONSchema returns a JSON Schema describing the JSON form of a message that generate accepts and
+// decode produces. Every message type reachable from md is defined once under $defs and referenced
+// by its full name, so recursive messages need no depth limit. Fields may be given by JSON or proto
+// name. Proto comments become descriptions and annotation and template hint keys are allowed.
+// With a resolver, mapped fields take their nested messages and rendered fields their rendered form.
+func JSONSchema(md protoreflect.MessageDescriptor, resolver SchemaResolver) map[string]interface{} {
+	s := &schemaBuilder{defs: map[string]interface{}{}, resolver: resolver}
+	s.define(md)
+	return map[string]interface{}{
+		"$schema":     SchemaDialect,
+		"title":       string(md.FullName()),
+		"description": "All fields are optional, except proto2 required fields, which are listed as required. Fields declared optional have explicit presence, which their descriptions point out.",
+		"$ref":        defRef(md),
+		"$defs":       s.defs,
+	}
+}
+
+type schemaBuilder struct {
+	defs     map[string]interface{}
+	resolver SchemaResolver
+}
+
+func defRef(md protoreflect.MessageDescriptor) string {
+	return "#/$defs/" + string(md.FullName())
+}
+
+// define adds the definition of md, and of the messages it references, to $defs.
+func (s *schemaBuilder) define(md protoreflect.MessageDescriptor) {
+	name := string(md.FullName())
+	if _, done := s.defs[name]; done {
+		return
+	}
+	def := map[string]interface{}{"type": "object"}
+	// reserve the name before recursing so cycles terminate
+	s.defs[name] = def
+	if c := Comment(md); c != "" {
+		def["description"] = c
+	}
+
+	properties := map[string]interface{}{}
+	var required []interface{}
+	var constraints []interface{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		prop := s.field(md, fd)
+		description := Comment(fd)
+		if explicitPresence(fd) {
+			description = strings.TrimSpace(description + "\n\nOptional with explicit presence: leaving it out is not the same as setting its default value.")
+		}
+		if description != "" {
+			prop["description"] = description
+		}
+		if opts, ok := fd.Options().(interface{ GetDeprecated() bool }); ok && opts.GetDeprecated() {
+			prop["deprecated"] = true
+		}
+		// protojson also reads the proto name
+		properties[fd.JSONName()] = prop
+		properties[string(fd.Name())] = prop
+		if fd.Cardinality() == protoreflect.Required {
+			if fd.JSONName() == string(fd.Name()) {
+				required = append(required, fd.JSONName())
+			} else {
+				constraints = append(constraints, present(fd))
+			}
+		}
+	}
+	ods := md.Oneofs()
+	for i := 0; i < ods.Len(); i++ {
+		if od := ods.Get(i); !od.IsSynthetic() {
+			constraints = append(constraints, oneofSchema(od))
+		}
+	}
+
+	def["properties"] = properties
+	// annotations such as @version and template hints such as _comments are not proto fields
+	def["patternProperties"] = map[string]interface{}{"^[@_]": true}
+	def["additionalProperties"] = false
+	if len(required) > 0 {
+		def["required"] = required
+	}
+	switch {
+	case len(constraints) == 0:
+	case len(constraints) == 1 && constraints[0].(map[string]interface{})["oneOf"] != nil:
+		def["oneOf"] = constraints[0].(map[string]interface{})["oneOf"]
+	default:
+		def["allOf"] = constraints
+	}
+}
+
+// explicitPresence reports whether fd is a scalar field whose presence is tracked outside of a
+// oneof, such as a proto3 optional field. Message fields always have presence, and the members of
+// a oneof are described by its constraint.
+func explicitPresence(fd protoreflect.FieldDescriptor) bool {
+	if !fd.HasPresence() || fd.Message() != nil || fd.Cardinality() == protoreflect.Required {
+		return false
+	}
+	od := fd.ContainingOneof()
+	return od == nil || od.IsSynthetic()
+}
+
+// present requires fd to be given under its JSON or its proto name.
+func present(fd protoreflect.FieldDescriptor) map[string]interface{} {
+	if fd.JSONName() == string(fd.Name()) {
+		return map[string]interface{}{"required": []interface{}{fd.JSONName()}}
+	}
+	return map[string]interface{}{"anyOf": []interface{}{
+		map[string]interface{}{"required": []interface{}{fd.JSONName()}},
+		map[string]interface{}{"required": []interface{}{string(fd.Name())}},
+	}}
+}
+
+// oneofSchema allows at most one member of a oneof to be present.
+func oneofSchema(od protoreflect.OneofDescriptor) map[string]interface{} {
+	members := od.Fields()
+	var alternatives, all []interface{}
+	for i := 0; i < members.Len(); i++ {
+		all = append(all, present(members.Get(i)))
+	}
+	for i := 0; i < members.Len(); i++ {
+		var others []interface{}
+		for j := 0; j < members.Len(); j++ {
+			if j != i {
+				others = append(others, all[j])
+			}
+		}
+		alt := present(members.Get(i))
+		if len(others) > 0 {
+			alt["not"] = map[string]interface{}{"anyOf": others}
+		}
+		alternatives = append(alternatives, alt)
+	}
+	alternatives = append(alternatives, map[string]interface{}{
+		"description": "none of " + string(od.Name()) + " is set",
+		"not":         map[string]interface{}{"anyOf": all},
+	})
+	return map[string]interface{}{"oneOf": alternatives}
+}
+
+// field describes fd of md; the elements of repeated and map fields are described by value, or
+// by configured when the config changes their form.
+func (s *schemaBuilder) field(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) map[string]interface{} {
+	elem := s.configured(md, fd)
+	if fd.IsList() {
+		if elem == nil {
+			elem = s.value(fd)
+		}
+		return map[string]interface{}{"type": "array", "items": elem}
+	}
+	if fd.IsMap() {
+		if elem == nil {
+			elem = s.value(fd.MapValue())
+		}
+		m := map[string]interface{}{"type": "object", "additionalProperties": elem}
+		if names := mapKeySchema(fd.MapKey()); names != nil {
+			m["propertyNames"] = names
+		}
+		return m
+	}
+	if elem == nil {
+		elem = s.value(fd)
+	}
+	return elem
+}
+
+// configured describes a value of a mapped or rendered field, or returns nil for other fields.
+// The protojson form stays valid, as generate accepts it as well.
+func (s *schemaBuilder) configured(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) map[string]interface{} {
+	if s.resolver == nil {
+		return nil
+	}
+	base64 := map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+	if targets := s.resolver.MappedTargets(md, fd); len(targets) > 0 {
+		// the expanded message, or its already-serialized bytes
+		alternatives := []interface{}{base64}
+		for _, target := range targets {
+			s.define(target)
+			alternatives = append(alternatives, map[string]interface{}{"$ref": defRef(target)})
+		}
+		return map[string]interface{}{"anyOf": alternatives}
+	}
+	switch s.resolver.RenderFormat(md, fd) {
+	case config.RenderHex:
+		return map[string]interface{}{"type": "string", "pattern": `^((0x)?([0-9a-fA-F]{2})*|base64:[A-Za-z0-9+/]*={0,2})$`}
+	case config.RenderPublicKey:
+		return map[string]interface{}{"anyOf": []interface{}{
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"fingerprint": map[string]interface{}{"type": "string"},
+					"keySpec":     map[string]interface{}{"type": "string"},
+					"der":         base64,
+				},
+				"required":             []interface{}{"der"},
+				"additionalProperties": false,
+			},
+			base64,
+		}}
+	case config.RenderTimestamp:
+		return map[string]interface{}{"anyOf": []interface{}{
+			map[string]interface{}{"type": "string", "format": "date-time"},
+			int64Schema(`^-?[0-9]+$`),
+		}}
+	}
+	return nil
+}
+
+func (s *schemaBuilder) value(fd protoreflect.FieldDescriptor) map[string]interface{} {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return map[string]interface{}{"type": "string"}
+	case protoreflect.BytesKind:
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return integerSchema(math.MinInt32, math.MaxInt32)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return integerSchema(0, math.MaxUint32)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return int64Schema(`^-?[0-9]+$`)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return int64Schema(`^[0-9]+$`)
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return floatSchema()
+	case protoreflect.EnumKind:
+		return enumSchema(fd.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if v, ok := wellKnownSchema(fd.Message()); ok {
+			return v
+		}
+		s.define(fd.Message())
+		return map[string]interface{}{"$ref": defRef(fd.Message())}
+	}
+	return map[string]interface{}{}
+}
+
+func integerSchema(min, max int64) map[string]interface{} {
+	return map[string]interface{}{"type": "integer", "minimum": min, "maximum": max}
+}
+
+// int64Schema accepts the string form protojson writes as well as plain integers.
+func int64Schema(pattern string) map[string]interface{} {
+	return map[string]interface{}{"anyOf": []interface{}{
+		map[string]interface{}{"type": "string", "pattern": pattern},
+		map[string]interface{}{"type": "integer"},
+	}}
+}
+
+func floatSchema() map[string]interface{} {
+	return map[string]interface{}{"anyOf": []interface{}{
+		map[string]interface{}{"type": "number"},
+		map[string]interface{}{"enum": []interface{}{"NaN", "Infinity", "-Infinity"}},
+	}}
+}
+
+// enumSchema accepts the value names protojson writes as well as the numbers it reads.
+func enumSchema(ed protoreflect.EnumDescriptor) map[string]interface{} {
+	if ed.FullName() == "google.protobuf.NullValue" {
+		return map[string]interface{}{"type": "null"}
+	}
+	values := ed.Values()
+	names := make([]interface{}, values.Len())
+	numbers := make([]interface{}, values.Len())
+	var descriptions []string
+	for i := 0; i < values.Len(); i++ {
+		v := values.Get(i)
+		names[i] = string(v.Name())
+		numbers[i] = int64(v.Number())
+		if c := Comment(v); c != "" {
+			descriptions = append(descriptions, string(v.Name())+": "+c)
+		}
+	}
+	schema := map[string]interface{}{"anyOf": []interface{}{
+		map[string]interface{}{"type": "string", "enum": names},
+		map[string]interface{}{"type": "integer", "enum": numbers},
+	}}
+	if c := Comment(ed); c != "" {
+		descriptions = append([]string{c}, descriptions...)
+	}
+	if len(descriptions) > 0 {
+		schema["description"] = strings.Join(descriptions, "\n")
+	}
+	return schema
+}
+
+func mapKeySchema(fd protoreflect.FieldDescriptor) map[string]interface{} {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return nil
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"enum": []interface{}{"true", "false"}}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]interface{}{"pattern": `^[0-9]+$`}
+	default:
+		return map[string]interface{}{"pattern": `^-?[0-9]+$`}
+	}
+}
+
+// wellKnownSchema describes the special JSON mappings of the well-known types.
+func wellKnownSchema(md protoreflect.MessageDescriptor) (map[string]interface{}, bool) {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return map[string]interface{}{"type": "string", "format": "date-time"}, true
+	case "google.protobuf.Duration":
+		return map[string]interface{}{"type": "string", "pattern": `^-?[0-9]+(\.[0-9]{1,9})?s$`}, true
+	case "google.protobuf.FieldMask":
+		return map[string]interface{}{"type": "string"}, true
+	case "google.protobuf.Any":
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"@type": map[string]interface{}{"type": "string"}},
+			"required":   []interface{}{"@type"},
+		}, true
+	case "google.protobuf.Struct":
+		return map[string]interface{}{"type": "object"}, true
+	case "google.protobuf.Value":
+		return map[string]interface{}{}, true
+	case "google.protobuf.ListValue":
+		return map[string]interface{}{"type": "array"}, true
+	case "google.protobuf.Empty":
+		return map[string]interface{}{"type": "object", "additionalProperties": false}, true
+	case "google.protobuf.BoolValue":
+		return map[string]interface{}{"type": "boolean"}, true
+	case "google.protobuf.StringValue":
+		return map[string]interface{}{"type": "string"}, true
+	case "google.protobuf.BytesValue":
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}, true
+	case "google.protobuf.Int32Value":
+		return integerSchema(math.MinInt32, math.MaxInt32), true
+	case "google.protobuf.UInt32Value":
+		return integerSchema(0, math.MaxUint32), true
+	case "google.protobuf.Int64Value":
+		return int64Schema(`^-?[0-9]+$`), true
+	case "google.protobuf.UInt64Value":
+		return int64Schema(`^[0-9]+$`), true
+	case "google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return floatSchema(), true
+	}
+	return nil, false
+}
@@ -1,48 +1,209 @@
 package template
 
 import (
+	"strings"
+
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
+// Hint keys added to templates. They are not proto fields and are ignored by generate.
+const (
+	OneofKey    = "_oneof"    // oneof name to the JSON names of its members; the first one is filled in
+	CommentsKey = "_comments" // field JSON name to its proto comment
+)
+
+// DefaultMaxRecursion is the number of times a message type may appear on a single path before
+// the template stops expanding it.
+const DefaultMaxRecursion = 2
+
+// Options controls template generation.
+type Options struct {
+	// Comments adds the proto comments of fields under CommentsKey.
+	Comments bool
+	// MaxRecursion limits the expansion of recursive messages (DefaultMaxRecursion if zero).
+	MaxRecursion int
+}
+
 // GenerateJSONTemplate recursively creates a map representing a JSON template for a message
 func GenerateJSONTemplate(md protoreflect.MessageDescriptor) map[string]interface{} {
+	return Generate(md, Options{})
+}
+
+// Generate creates a JSON template for a message that protojson accepts: fields use their JSON names
+// and values their protojson forms. Only the first member of each oneof is included.
+func Generate(md protoreflect.MessageDescriptor, opts Options) map[string]interface{} {
+	if opts.MaxRecursion <= 0 {
+		opts.MaxRecursion = DefaultMaxRecursion
+	}
+	g := &generator{opts: opts, seen: map[protoreflect.FullName]int{}}
+	return g.message(md)
+}
+
+type generator struct {
+	opts Options
+	seen map[protoreflect.FullName]int // occurrences of each message type on the current path
+}
+
+func (g *generator) message(md protoreflect.MessageDescriptor) map[string]interface{} {
 	template := make(map[string]interface{})
+	if g.seen[md.FullName()] >= g.opts.MaxRecursion {
+		return template
+	}
+	g.seen[md.FullName()]++
+	defer func() { g.seen[md.FullName()]-- }()
+
+	oneofs := map[string]interface{}{}
+	comments := map[string]interface{}{}
 	fields := md.Fields()
 	for i := 0; i < fields.Len(); i++ {
 		fd := fields.Get(i)
-		template[string(fd.Name())] = getExampleValue(fd)
+		if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+			if _, done := oneofs[string(od.Name())]; done {
+				continue
+			}
+			members := make([]interface{}, od.Fields().Len())
+			for j := range members {
+				members[j] = od.Fields().Get(j).JSONName()
+			}
+			oneofs[string(od.Name())] = members
+		}
+		template[fd.JSONName()] = g.value(fd)
+		if g.opts.Comments {
+			if c := Comment(fd); c != "" {
+				comments[fd.JSONName()] = c
+			}
+		}
+	}
+	if len(oneofs) > 0 {
+		template[OneofKey] = oneofs
+	}
+	if len(comments) > 0 {
+		template[CommentsKey] = comments
 	}
 	return template
 }
 
-func getExampleValue(fd protoreflect.FieldDescriptor) interface{} {
+func (g *generator) value(fd protoreflect.FieldDescriptor) interface{} {
 	if fd.IsList() {
-		return []interface{}{getSingleExampleValue(fd)}
+		return []interface{}{g.singleValue(fd)}
 	}
 	if fd.IsMap() {
 		return map[string]interface{}{
-			"key": getSingleExampleValue(fd.MapValue()),
+			mapKey(fd.MapKey()): g.singleValue(fd.MapValue()),
 		}
 	}
-	return getSingleExampleValue(fd)
+	return g.singleValue(fd)
 }
 
-func getSingleExampleValue(fd protoreflect.FieldDescriptor) interface{} {
+func (g *generator) singleValue(fd protoreflect.FieldDescriptor) interface{} {
 	switch fd.Kind() {
 	case protoreflect.StringKind:
 		return "example_string"
-	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Uint32Kind, protoreflect.Uint64Kind:
-		return 0
+	case protoreflect.BytesKind:
+		return ""
 	case protoreflect.BoolKind:
 		return false
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.FloatKind, protoreflect.DoubleKind:
+		return 0
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson represents 64-bit integers as strings
+		return "0"
 	case protoreflect.EnumKind:
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			return nil
+		}
 		if fd.Enum().Values().Len() > 0 {
 			return string(fd.Enum().Values().Get(0).Name())
 		}
-		return "UNKNOWN"
-	case protoreflect.MessageKind:
-		return GenerateJSONTemplate(fd.Message())
+		return 0
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if v, ok := wellKnownValue(fd.Message()); ok {
+			return v
+		}
+		return g.message(fd.Message())
 	default:
 		return nil
 	}
 }
+
+// wellKnownValue returns the protojson form of a well-known type with a special JSON mapping.
+func wellKnownValue(md protoreflect.MessageDescriptor) (interface{}, bool) {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return "1970-01-01T00:00:00Z", true
+	case "google.protobuf.Duration":
+		return "0s", true
+	case "google.protobuf.FieldMask":
+		return "", true
+	case "google.protobuf.Any":
+		return map[string]interface{}{"@type": "type.googleapis.com/google.protobuf.Empty"}, true
+	case "google.protobuf.Struct":
+		return map[string]interface{}{}, true
+	case "google.protobuf.Value":
+		return nil, true
+	case "google.protobuf.ListValue":
+		return []interface{}{}, true
+	case "google.protobuf.BoolValue":
+		return false, true
+	case "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return "", true
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return "0", true
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return 0, true
+	}
+	return nil, false
+}
+
+func mapKey(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return "key"
+	case protoreflect.BoolKind:
+		return "false"
+	default:
+		return "0"
+	}
+}
+
+// Comment returns the proto comment of a descriptor, preferring the leading comment, or an
+// empty string if the schema carries no source info.
+func Comment(d protoreflect.Descriptor) string {
+	loc := d.ParentFile().SourceLocations().ByDescriptor(d)
+	c := loc.LeadingComments
+	if strings.TrimSpace(c) == "" {
+		c = loc.TrailingComments
+	}
+	lines := strings.Split(strings.TrimSpace(c), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// StripHints removes the template hint keys from the JSON form of a message and reports whether
+// any were found.
+func StripHints(v interface{}) bool {
+	found := false
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, k := range []string{OneofKey, CommentsKey} {
+			if _, ok := val[k]; ok {
+				delete(val, k)
+				found = true
+			}
+		}
+		for _, item := range val {
+			found = StripHints(item) || found
+		}
+	case []interface{}:
+		for _, item := range val {
+			found = StripHints(item) || found
+		}
+	}
+	return found
+}
@@ -0,0 +1,250 @@
+package template
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"buf-lib-poc/pkg/io"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+)
+
+const testProto = `
+syntax = "proto3";
+package test;
+
+import "google/protobuf/any.proto";
+import "google/protobuf/duration.proto";
+import "google/protobuf/struct.proto";
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/wrappers.proto";
+
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  COLOR_RED = 1;
+}
+
+message Scalars {
+  double d = 1;
+  float f = 2;
+  int32 i32 = 3;
+  int64 i64 = 4;
+  uint32 u32 = 5;
+  uint64 u64 = 6;
+  sint32 s32 = 7;
+  sint64 s64 = 8;
+  fixed32 f32 = 9;
+  fixed64 f64 = 10;
+  sfixed32 sf32 = 11;
+  sfixed64 sf64 = 12;
+  bool b = 13;
+  // A string field
+  string str = 14;
+  bytes raw_data = 15;
+  Color color = 16;
+  optional int32 maybe = 17;
+}
+
+message WellKnown {
+  google.protobuf.Timestamp ts = 1;
+  google.protobuf.Duration dur = 2;
+  google.protobuf.Any any = 3;
+  google.protobuf.Struct st = 4;
+  google.protobuf.Int64Value wrapped = 5;
+  map<int32, Scalars> by_id = 6;
+  repeated string tags = 7;
+}
+
+message Node {
+  string name = 1;
+  repeated Node children = 2;
+  oneof kind {
+    Scalars scalars = 3;
+    WellKnown well_known = 4;
+  }
+}
+`
+
+func compile(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"test.proto": testProto}),
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	files, err := compiler.Compile(context.Background(), "test.proto")
+	if err != nil {
+		t.Fatalf("failed to compile test proto: %v", err)
+	}
+	return files[0]
+}
+
+func TestGenerate_ProtojsonAccepts(t *testing.T) {
+	fd := compile(t)
+	for _, name := range []string{"Scalars", "WellKnown", "Node"} {
+		t.Run(name, func(t *testing.T) {
+			md := fd.Messages().ByName(protoreflect.Name(name))
+			tmpl := Generate(md, Options{Comments: true})
+			StripHints(tmpl)
+			data, _ := json.Marshal(tmpl)
+			if err := protojson.Unmarshal(data, dynamicpb.NewMessage(md)); err != nil {
+				t.Errorf("protojson rejects template %s: %v", data, err)
+			}
+		})
+	}
+}
+
+func TestGenerate_Values(t *testing.T) {
+	fd := compile(t)
+	scalars := Generate(fd.Messages().ByName("Scalars"), Options{Comments: true})
+	expected := map[string]interface{}{
+		"d": 0, "f": 0, "i32": 0, "i64": "0", "u32": 0, "u64": "0", "s32": 0, "s64": "0",
+		"f32": 0, "f64": "0", "sf32": 0, "sf64": "0", "b": false, "str": "example_string",
+		"rawData": "", "color": "COLOR_UNSPECIFIED", "maybe": 0,
+		CommentsKey: map[string]interface{}{"str": "A string field"},
+	}
+	if !reflect.DeepEqual(scalars, expected) {
+		t.Errorf("expected %v, got %v", expected, scalars)
+	}
+
+	wk := Generate(fd.Messages().ByName("WellKnown"), Options{})
+	if wk["ts"] != "1970-01-01T00:00:00Z" || wk["dur"] != "0s" || wk["wrapped"] != "0" {
+		t.Errorf("unexpected well-known values: %v", wk)
+	}
+	if _, ok := wk["byId"].(map[string]interface{})["0"]; !ok {
+		t.Errorf("expected an integer map key, got %v", wk["byId"])
+	}
+}
+
+func TestGenerate_OneofAndRecursion(t *testing.T) {
+	fd := compile(t)
+	node := Generate(fd.Messages().ByName("Node"), Options{MaxRecursion: 2})
+
+	if _, ok := node["scalars"]; !ok {
+		t.Errorf("expected the first oneof member, got %v", node)
+	}
+	if _, ok := node["wellKnown"]; ok {
+		t.Errorf("only one oneof member should be set, got %v", node)
+	}
+	hint := node[OneofKey].(map[string]interface{})["kind"]
+	if !reflect.DeepEqual(hint, []interface{}{"scalars", "wellKnown"}) {
+		t.Errorf("unexpected oneof hint: %v", hint)
+	}
+
+	child := node["children"].([]interface{})[0].(map[string]interface{})
+	grandchild := child["children"].([]interface{})[0].(map[string]interface{})
+	if len(grandchild) != 0 {
+		t.Errorf("expected recursion to stop at depth 2, got %v", grandchild)
+	}
+}
+
+func TestStripHints(t *testing.T) {
+	data := map[string]interface{}{
+		OneofKey: map[string]interface{}{},
+		"a":      []interface{}{map[string]interface{}{CommentsKey: map[string]interface{}{}, "b": 1}},
+	}
+	if !StripHints(data) {
+		t.Error("expected hints to be found")
+	}
+	expected := map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": 1}}}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+	if StripHints(data) {
+		t.Error("expected no hints left")
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	fd := compile(t)
+	schema := JSONSchema(fd.Messages().ByName("Node"), nil)
+
+	if schema["$schema"] != SchemaDialect || schema["$ref"] != "#/$defs/test.Node" {
+		t.Fatalf("unexpected schema header: %v", schema)
+	}
+	defs := schema["$defs"].(map[string]interface{})
+	for _, name := range []string{"test.Node", "test.Scalars", "test.WellKnown"} {
+		if _, ok := defs[name]; !ok {
+			t.Errorf("expected a definition for %s", name)
+		}
+	}
+
+	node := defs["test.Node"].(map[string]interface{})
+	children := node["properties"].(map[string]interface{})["children"].(map[string]interface{})
+	if children["items"].(map[string]interface{})["$ref"] != "#/$defs/test.Node" {
+		t.Errorf("expected a recursive reference, got %v", children)
+	}
+	if alternatives := node["oneOf"].([]interface{}); len(alternatives) != 3 {
+		t.Errorf("expected one alternative per member plus none, got %v", alternatives)
+	}
+
+	scalars := defs["test.Scalars"].(map[string]interface{})["properties"].(map[string]interface{})
+	if scalars["str"].(map[string]interface{})["description"] != "A string field" {
+		t.Errorf("expected the comment as description, got %v", scalars["str"])
+	}
+	color := scalars["color"].(map[string]interface{})["anyOf"].([]interface{})[0]
+	expected := map[string]interface{}{"type": "string", "enum": []interface{}{"COLOR_UNSPECIFIED", "COLOR_RED"}}
+	if !reflect.DeepEqual(color, expected) {
+		t.Errorf("expected %v, got %v", expected, color)
+	}
+	if d, _ := scalars["maybe"].(map[string]interface{})["description"].(string); !strings.HasPrefix(d, "Optional with explicit presence") {
+		t.Errorf("expected the proto3 optional field to be marked, got %q", d)
+	}
+	if _, ok := scalars["i32"].(map[string]interface{})["description"]; ok {
+		t.Errorf("expected no presence marker on a field without presence, got %v", scalars["i32"])
+	}
+	if _, ok := scalars["rawData"]; !ok {
+		t.Errorf("expected JSON field names, got %v", scalars)
+	}
+
+	if _, err := json.Marshal(schema); err != nil {
+		t.Errorf("schema is not serializable: %v", err)
+	}
+}
+
+func TestYAML_RoundTrip(t *testing.T) {
+	fd := compile(t)
+	for _, name := range []string{"Scalars", "WellKnown", "Node"} {
+		t.Run(name, func(t *testing.T) {
+			md := fd.Messages().ByName(protoreflect.Name(name))
+			tmpl := Generate(md, Options{Comments: true})
+			out := YAML(tmpl)
+
+			data, err := io.YAMLToJSON(out)
+			if err != nil {
+				t.Fatalf("failed to parse YAML template: %v\n%s", err, out)
+			}
+			if err := protojson.Unmarshal(data, dynamicpb.NewMessage(md)); err != nil {
+				t.Errorf("protojson rejects YAML template %s: %v", data, err)
+			}
+
+			StripHints(tmpl)
+			var got, expected interface{}
+			json.Unmarshal(data, &got)
+			raw, _ := json.Marshal(tmpl)
+			json.Unmarshal(raw, &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected %v, got %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestYAML_Comments(t *testing.T) {
+	fd := compile(t)
+	out := string(YAML(Generate(fd.Messages().ByName("Node"), Options{Comments: true})))
+	if !strings.Contains(out, "# oneof kind: set only one of scalars, wellKnown\nscalars:") {
+		t.Errorf("expected a oneof comment, got:\n%s", out)
+	}
+	if !strings.Contains(out, "# A string field\n") {
+		t.Errorf("expected field comments, got:\n%s", out)
+	}
+}
@@ -0,0 +1,103 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAML renders a template as YAML. The hint keys are not emitted as values: field comments and
+// the alternatives of each oneof become # comments above the fields they describe.
+func YAML(tmpl interface{}) []byte {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(yamlNode(tmpl)); err != nil {
+		// Nodes built from JSON values always encode
+		panic(fmt.Sprintf("template: encoding YAML: %v", err))
+	}
+	enc.Close()
+	return buf.Bytes()
+}
+
+// yamlNode converts a template value into a YAML node tree.
+func yamlNode(v interface{}) *yaml.Node {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return mappingNode(val)
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		if len(val) == 0 {
+			node.Style = yaml.FlowStyle
+		}
+		for _, item := range val {
+			node.Content = append(node.Content, yamlNode(item))
+		}
+		return node
+	case string:
+		// Strings are always double-quoted so that values such as "0" or "true" keep their type
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: val, Style: yaml.DoubleQuotedStyle}
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(v); err != nil {
+		// Numbers, bools and null; JSON is valid YAML for anything else
+		out, _ := json.Marshal(v)
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: string(out)}
+	}
+	return node
+}
+
+func mappingNode(m map[string]interface{}) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	keys := visibleKeys(m)
+	if len(keys) == 0 {
+		node.Style = yaml.FlowStyle
+		return node
+	}
+
+	comments, _ := m[CommentsKey].(map[string]interface{})
+	oneofOf := map[string]string{}
+	if oneofs, ok := m[OneofKey].(map[string]interface{}); ok {
+		for name, members := range oneofs {
+			list, _ := members.([]interface{})
+			names := make([]string, len(list))
+			for i, member := range list {
+				names[i] = fmt.Sprint(member)
+			}
+			for _, member := range names {
+				oneofOf[member] = fmt.Sprintf("oneof %s: set only one of %s", name, strings.Join(names, ", "))
+			}
+		}
+	}
+
+	for _, k := range keys {
+		var lines []string
+		if c, ok := comments[k].(string); ok {
+			for _, line := range strings.Split(c, "\n") {
+				lines = append(lines, strings.TrimRight("# "+line, " "))
+			}
+		}
+		if hint, ok := oneofOf[k]; ok {
+			lines = append(lines, "# "+hint)
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k, HeadComment: strings.Join(lines, "\n")}
+		node.Content = append(node.Content, key, yamlNode(m[k]))
+	}
+	return node
+}
+
+// visibleKeys returns the sorted keys of m other than the hint keys.
+func visibleKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if k != OneofKey && k != CommentsKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -87,6 +87,7 @@ echo "Building Buf Image..."
     --path community_base/com/digitalasset/canton/protocol/v30/crypto.proto \
     --path community_base/com/digitalasset/canton/version/v1/untyped_versioned_message.proto \
     --path community_base/com/digitalasset/canton/crypto/v30/crypto.proto \
+    --path community_base/com/digitalasset/canton/sequencer/api/v30/sequencer_authentication_service.proto \
     --path external/google/rpc/status.proto \
     --path external/google/rpc/error_details.proto \
     --path external/scalapb/scalapb.proto \
@@ -1,17 +1,35 @@
 package tests
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"buf-lib-poc/pkg/auth"
+	"buf-lib-poc/pkg/canton"
+	interactive "buf-lib-poc/pkg/daml/proto/com/daml/ledger/api/v2/interactive"
+	"buf-lib-poc/pkg/signer"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
 const testConfigJSON = `{
@@ -90,6 +108,30 @@ func TestCLI_BasicFlow(t *testing.T) {
 		t.Errorf("decoded output incorrect: %s", out)
 	}
 
+	// 4.1. Structured output of generate unwraps data versioned by an @version key
+	out, err = runCLI(configPath, binPath, repoRoot, "proto", "generate", "TopologyTransaction",
+		"-d", `{"@version": 30, "serial": 98}`, "-o", "prototext")
+	if err != nil || strings.Join(strings.Fields(out), " ") != "serial: 98" {
+		t.Errorf("generate of @version data with -o prototext: %v\nOutput: %s", err, out)
+	}
+
+	// 4.5. Expanded payloads are annotated with @raw/@hash only when --keep-raw is given
+	signedB64, err := runCLI(configPath, binPath, repoRoot, "proto", "generate", "SignedTopologyTransaction",
+		`{"transaction": {"serial": 1}}`, "--base64")
+	if err != nil {
+		t.Fatalf("proto generate failed: %v\nOutput: %s", err, signedB64)
+	}
+	for _, keepRaw := range []bool{false, true} {
+		out, err = runCLIWithStdin(configPath, binPath, repoRoot, signedB64, "proto", "decode", "SignedTopologyTransaction", "-", "--base64",
+			fmt.Sprintf("--keep-raw=%v", keepRaw))
+		if err != nil {
+			t.Fatalf("proto decode failed: %v\nOutput: %s", err, out)
+		}
+		if strings.Contains(out, `"@raw"`) != keepRaw || strings.Contains(out, `"@hash"`) != keepRaw {
+			t.Errorf("decode --keep-raw=%v: unexpected annotations in %s", keepRaw, out)
+		}
+	}
+
 	// 5. Test specialized prepare
 	tempDir := t.TempDir()
 	keyPath := filepath.Join(tempDir, "test_pub.der")
@@ -203,6 +245,19 @@ func TestCLI_VerifySignature(t *testing.T) {
 	if err == nil {
 		t.Errorf("expected verify to fail with wrong key, but it succeeded")
 	}
+
+	// 7. A signature format missing from the schema is reported, not a crash
+	oddPath := filepath.Join(tmpDir, "odd.cert")
+	if out, err := runCLI(configPath, binPath, repoRoot, "proto", "edit", "SignedTopologyTransaction", "@"+certPath,
+		"--versioned", "--set", "signatures[0].format=99", "--out-file", oddPath); err != nil {
+		t.Fatalf("proto edit failed: %v\nOutput: %s", err, out)
+	}
+	out, _, err = runCLIStderr(configPath, binPath, repoRoot, "", "canton", "topology", "verify",
+		"--input", "@"+oddPath,
+		"--public-key", "@"+pubPath)
+	if err == nil || !strings.Contains(out, "unknown signature format 99") {
+		t.Errorf("expected verify to report the unknown format: %v\nOutput: %s", err, out)
+	}
 }
 
 func TestCLI_VerifySignature_ECDSA(t *testing.T) {
@@ -279,6 +334,1070 @@ func TestCLI_VerifySignature_ECDSA(t *testing.T) {
 	if !strings.Contains(out, "SUCCESS: Signature is valid") {
 		t.Errorf("verification output missing success message: %s", out)
 	}
+
+	// 6. Prepare and verify honour the shared output flags
+	out, err = runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "delegation",
+		"--root", "--root-key", "@"+pubPath, "--out-prefix", filepath.Join(tmpDir, "tx2"), "-o", "hex")
+	hash, _ := os.ReadFile(prepPrefix + ".hash")
+	if err != nil || strings.TrimSpace(out) != hex.EncodeToString(hash) {
+		t.Errorf("prepare -o hex should print the transaction hash %x: %v\nOutput: %s", hash, err, out)
+	}
+	reportPath := filepath.Join(tmpDir, "verify.json")
+	out, err = runCLI(configPath, binPath, repoRoot, "canton", "topology", "verify",
+		"--input", "@"+certPath, "--public-key", "@"+pubPath, "-o", "json", "--out-file", reportPath)
+	if err != nil || out != "" {
+		t.Fatalf("verify -o json failed: %v\nOutput: %s", err, out)
+	}
+	var report struct {
+		Hash       string `json:"hash"`
+		Valid      bool   `json:"valid"`
+		Signatures []struct {
+			SignedBy string `json:"signedBy"`
+			Result   string `json:"result"`
+		} `json:"signatures"`
+	}
+	data, _ := os.ReadFile(reportPath)
+	if err := json.Unmarshal(data, &report); err != nil || !report.Valid || len(report.Signatures) != 1 ||
+		report.Signatures[0].SignedBy != fp || report.Signatures[0].Result != "valid" {
+		t.Errorf("unexpected verify report: %v\n%s", err, data)
+	}
+}
+
+func TestCLI_PEMKeys(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	tmpDir := t.TempDir()
+
+	// 1. Write an Ed25519 key pair as PEM, as exported by HSMs and KMSs
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	pubKeyDer, _ := x509.MarshalPKIXPublicKey(pub)
+	privKeyDer, _ := x509.MarshalPKCS8PrivateKey(priv)
+	privPath := filepath.Join(tmpDir, "test.key.pem")
+	pubPath := filepath.Join(tmpDir, "test.pub.pem")
+	os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privKeyDer}), 0644)
+	os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubKeyDer}), 0644)
+
+	out, err := runCLI(configPath, binPath, repoRoot, "crypto", "public-key", "@"+pubPath, "-o", "json")
+	if err != nil {
+		t.Fatalf("public-key failed: %v\nOutput: %s", err, out)
+	}
+	var info map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatalf("invalid public-key output: %v\n%s", err, out)
+	}
+	if info["detectedFormat"] != "pem-spki" || info["publicKey"] != base64.StdEncoding.EncodeToString(pubKeyDer) {
+		t.Errorf("unexpected public-key output: %s", out)
+	}
+
+	// 2. Prepare, sign, assemble and verify with the PEM files only
+	prepPrefix := filepath.Join(tmpDir, "tx")
+	_, err = runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "delegation",
+		"--root", "--root-key", "@"+pubPath, "--out-prefix", prepPrefix)
+	if err != nil {
+		t.Fatalf("prepare failed: %v", err)
+	}
+	decoded, err := runCLI(configPath, binPath, repoRoot, "proto", "decode", "TopologyTransaction", "@"+prepPrefix+".prep", "--versioned")
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !strings.Contains(decoded, base64.StdEncoding.EncodeToString(pubKeyDer)) {
+		t.Errorf("prepared transaction does not hold the DER public key:\n%s", decoded)
+	}
+
+	sig, err := runCLI(configPath, binPath, repoRoot, "crypto", "sign", "@"+privPath, "@"+prepPrefix+".hash")
+	if err != nil {
+		t.Fatalf("sign failed: %v\nOutput: %s", err, sig)
+	}
+	fp, _ := runCLI(configPath, binPath, repoRoot, "crypto", "fingerprint", "@"+pubPath)
+
+	certPath := filepath.Join(tmpDir, "tx.cert")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "assemble",
+		"--prepared-transaction", "@"+prepPrefix+".prep",
+		"--signature", strings.TrimSpace(sig),
+		"--signature-algorithm", "ed25519",
+		"--signed-by", strings.TrimSpace(fp),
+		"--out-file", certPath); err != nil {
+		t.Fatalf("assemble failed: %v\nOutput: %s", err, out)
+	}
+
+	out, err = runCLI(configPath, binPath, repoRoot, "canton", "topology", "verify",
+		"--input", "@"+certPath,
+		"--public-key", "@"+pubPath)
+	if err != nil || !strings.Contains(out, "SUCCESS: Signature is valid") {
+		t.Fatalf("verify failed: %v\nOutput: %s", err, out)
+	}
+}
+
+func TestCLI_Keygen(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	keyPrefix := filepath.Join(t.TempDir(), "key")
+
+	// 1. Generate a P-384 key with its Canton protos
+	fp, err := runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--spec", "ec-p384",
+		"--usage", "namespace,protocol", "--pem", "--proto", "--out-prefix", keyPrefix)
+	if err != nil {
+		t.Fatalf("keygen failed: %v\nOutput: %s", err, fp)
+	}
+	fp = strings.TrimSpace(fp)
+	if pubFp, _ := runCLI(configPath, binPath, repoRoot, "crypto", "fingerprint", "@"+keyPrefix+".pub"); strings.TrimSpace(pubFp) != fp {
+		t.Errorf("keygen fingerprint %s does not match the public key (%s)", fp, pubFp)
+	}
+
+	out, err := runCLI(configPath, binPath, repoRoot, "proto", "decode", "SigningPublicKey", "@"+keyPrefix+".public-key.binpb")
+	if err != nil {
+		t.Fatalf("decode failed: %v\nOutput: %s", err, out)
+	}
+	for _, want := range []string{"SIGNING_KEY_SPEC_EC_P384", "SIGNING_KEY_USAGE_PROTOCOL"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("SigningPublicKey is missing %s:\n%s", want, out)
+		}
+	}
+	out, err = runCLI(configPath, binPath, repoRoot, "proto", "decode", "com.digitalasset.canton.crypto.v30.SigningKeyPair", "@"+keyPrefix+".key-pair.binpb")
+	if err != nil || !strings.Contains(out, `"id": "`+fp+`"`) {
+		t.Errorf("SigningKeyPair is not identified by the fingerprint %s: %v\n%s", fp, err, out)
+	}
+
+	// 2. Use the generated files for a root delegation
+	prepPrefix := filepath.Join(t.TempDir(), "tx")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "delegation",
+		"--root", "--root-key", "@"+keyPrefix+".pub", "--out-prefix", prepPrefix); err != nil {
+		t.Fatalf("prepare failed: %v\nOutput: %s", err, out)
+	}
+	sig, err := runCLI(configPath, binPath, repoRoot, "crypto", "sign", "@"+keyPrefix+".priv", "@"+prepPrefix+".hash", "--algo", "ecdsa384")
+	if err != nil {
+		t.Fatalf("sign failed: %v\nOutput: %s", err, sig)
+	}
+	certPath := prepPrefix + ".cert"
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "assemble",
+		"--prepared-transaction", "@"+prepPrefix+".prep",
+		"--signature", strings.TrimSpace(sig),
+		"--signature-algorithm", "ecdsa384",
+		"--signed-by", fp,
+		"--out-file", certPath); err != nil {
+		t.Fatalf("assemble failed: %v\nOutput: %s", err, out)
+	}
+	out, err = runCLI(configPath, binPath, repoRoot, "canton", "topology", "verify",
+		"--input", "@"+certPath, "--public-key", "@"+keyPrefix+".pub")
+	if err != nil || !strings.Contains(out, "SUCCESS: Signature is valid") {
+		t.Fatalf("verify failed: %v\nOutput: %s", err, out)
+	}
+}
+
+func TestCLI_Signers(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	tmpDir := t.TempDir()
+	keyPrefix := filepath.Join(tmpDir, "key")
+	fp, err := runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--pem", "--out-prefix", keyPrefix)
+	if err != nil {
+		t.Fatalf("keygen failed: %v\nOutput: %s", err, fp)
+	}
+	fp = strings.TrimSpace(fp)
+
+	// 1. A signing service stand-in holding the key
+	backend, err := signer.Open("@"+keyPrefix+".priv", signer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(signer.Handler(backend, "test-token"))
+	defer server.Close()
+	t.Setenv("PROTON_SIGNER_TOKEN", "test-token")
+
+	// 2. Assemble by signing through the service; --signed-by comes from its public key
+	prepPrefix := filepath.Join(tmpDir, "tx")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "delegation",
+		"--root", "--root-key", "@"+keyPrefix+".pub", "--out-prefix", prepPrefix); err != nil {
+		t.Fatalf("prepare failed: %v\nOutput: %s", err, out)
+	}
+	certPath := prepPrefix + ".cert"
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "assemble",
+		"--prepared-transaction", "@"+prepPrefix+".prep",
+		"--signer", server.URL,
+		"--signature-algorithm", "ed25519",
+		"--out-file", certPath); err != nil {
+		t.Fatalf("assemble failed: %v\nOutput: %s", err, out)
+	}
+	out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "verify",
+		"--input", "@"+certPath, "--public-key", "@"+keyPrefix+".pub")
+	if err != nil || !strings.Contains(out, "SUCCESS: Signature is valid") {
+		t.Fatalf("verify failed: %v\nOutput: %s", err, out)
+	}
+
+	// 3. An external command signer, checked against the public key given for it
+	command := fmt.Sprintf("exec:%s crypto sign @%s -", binPath, keyPrefix+".priv")
+	sig, err := runCLI(configPath, binPath, repoRoot, "crypto", "sign", command, "@"+prepPrefix+".hash",
+		"--signer-public-key", "@"+keyPrefix+".pub")
+	if err != nil {
+		t.Fatalf("sign with command failed: %v\nOutput: %s", err, sig)
+	}
+	other := filepath.Join(tmpDir, "other")
+	runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--out-prefix", other)
+	if out, err := runCLI(configPath, binPath, repoRoot, "crypto", "sign", command, "@"+prepPrefix+".hash",
+		"--signer-public-key", "@"+other+".pub"); err == nil || !strings.Contains(out, "does not verify") {
+		t.Errorf("expected a signature from the wrong key to be rejected: %v\nOutput: %s", err, out)
+	}
+
+	// 4. Daml signing of a prepared transaction
+	txData, _ := proto.Marshal(&interactive.PreparedTransaction{
+		Transaction: &interactive.DamlTransaction{Version: "2.1", Roots: []string{"0"}},
+		Metadata: &interactive.Metadata{
+			SubmitterInfo:   &interactive.Metadata_SubmitterInfo{ActAs: []string{"alice::1220ab"}, CommandId: "cmd-1"},
+			TransactionUuid: "uuid-1",
+			SynchronizerId:  "sync::1220cd",
+		},
+	})
+	txPath := filepath.Join(tmpDir, "prepared.bin")
+	os.WriteFile(txPath, txData, 0644)
+	out, err = runCLI(configPath, binPath, repoRoot, "daml", "sign", "@"+txPath, server.URL, "-o", "json")
+	if err != nil {
+		t.Fatalf("daml sign failed: %v\nOutput: %s", err, out)
+	}
+	var signature struct {
+		Signature []byte `json:"signature"`
+		SignedBy  string `json:"signedBy"`
+	}
+	if err := json.Unmarshal([]byte(out), &signature); err != nil || signature.SignedBy != fp {
+		t.Fatalf("unexpected daml sign output (%v): %s", err, out)
+	}
+	txHash, err := runCLI(configPath, binPath, repoRoot, "daml", "hash", "@"+txPath, "-o", "binary")
+	if err != nil {
+		t.Fatalf("daml hash failed: %v", err)
+	}
+	pub, _ := os.ReadFile(keyPrefix + ".pub")
+	if valid, err := canton.VerifySignature([]byte(txHash), signature.Signature, pub, "SIGNING_ALGORITHM_SPEC_ED25519"); err != nil || !valid {
+		t.Errorf("daml signature does not verify: %v", err)
+	}
+}
+
+func TestCLI_ConcatSignatures(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	tmpDir := t.TempDir()
+	keyPrefix := filepath.Join(tmpDir, "key")
+	fp, err := runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--spec", "ec-p256", "--out-prefix", keyPrefix)
+	if err != nil {
+		t.Fatalf("keygen failed: %v\nOutput: %s", err, fp)
+	}
+	fp = strings.TrimSpace(fp)
+
+	prepPrefix := filepath.Join(tmpDir, "tx")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "delegation",
+		"--root", "--root-key", "@"+keyPrefix+".pub", "--out-prefix", prepPrefix); err != nil {
+		t.Fatalf("prepare failed: %v\nOutput: %s", err, out)
+	}
+
+	// 1. An HSM-like signer that returns r||s; assemble stores DER as declared
+	command := fmt.Sprintf("exec:%[1]s crypto sign @%[2]s - -a ecdsa256 | %[1]s crypto convert-signature -b - --to concat", binPath, keyPrefix+".priv")
+	certPath := filepath.Join(tmpDir, "der.cert")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "assemble",
+		"--prepared-transaction", "@"+prepPrefix+".prep",
+		"--signer", command, "--signer-public-key", "@"+keyPrefix+".pub",
+		"--signature-algorithm", "ecdsa256",
+		"--out-file", certPath); err != nil {
+		t.Fatalf("assemble failed: %v\nOutput: %s", err, out)
+	}
+	out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "verify",
+		"--input", "@"+certPath, "--public-key", "@"+keyPrefix+".pub")
+	if err != nil || !strings.Contains(out, "SUCCESS: Signature is valid") {
+		t.Fatalf("verify failed: %v\nOutput: %s", err, out)
+	}
+
+	// 2. A DER signature declared as SIGNATURE_FORMAT_CONCAT is converted
+	sigPath := filepath.Join(tmpDir, "sig.der")
+	if out, err := runCLI(configPath, binPath, repoRoot, "crypto", "sign", "@"+keyPrefix+".priv", "@"+prepPrefix+".hash",
+		"-a", "ecdsa256", "--out-file", sigPath, "-o", "binary"); err != nil {
+		t.Fatalf("sign failed: %v\nOutput: %s", err, out)
+	}
+	certPath = filepath.Join(tmpDir, "concat.cert")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "assemble",
+		"--prepared-transaction", "@"+prepPrefix+".prep",
+		"--signature", "@"+sigPath, "--signature-format", "concat", "--signed-by", fp,
+		"--signature-algorithm", "ecdsa256",
+		"--out-file", certPath); err != nil {
+		t.Fatalf("assemble failed: %v\nOutput: %s", err, out)
+	}
+	out, err = runCLI(configPath, binPath, repoRoot, "canton", "topology", "verify",
+		"--input", "@"+certPath, "--public-key", "@"+keyPrefix+".pub")
+	if err != nil || !strings.Contains(out, "SUCCESS: Signature is valid") {
+		t.Fatalf("verify failed: %v\nOutput: %s", err, out)
+	}
+
+	// 3. convert-signature reports the detected form
+	out, err = runCLI(configPath, binPath, repoRoot, "crypto", "convert-signature", "@"+sigPath, "--to", "concat", "-o", "json")
+	if err != nil {
+		t.Fatalf("convert-signature failed: %v\nOutput: %s", err, out)
+	}
+	var converted struct {
+		From      string `json:"from"`
+		Signature []byte `json:"signature"`
+	}
+	if err := json.Unmarshal([]byte(out), &converted); err != nil || converted.From != "SIGNATURE_FORMAT_DER" || len(converted.Signature) != 64 {
+		t.Errorf("unexpected convert-signature output (%v): %s", err, out)
+	}
+	if out, err := runCLI(configPath, binPath, repoRoot, "crypto", "convert-signature", "hex:3081060201010201", "--to", "concat"); err == nil {
+		t.Errorf("expected a non-canonical signature to be rejected: %s", out)
+	}
+}
+
+func TestCLI_Hash(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	tmpDir := t.TempDir()
+	keyPrefix := filepath.Join(tmpDir, "key")
+	fp, err := runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--out-prefix", keyPrefix)
+	if err != nil {
+		t.Fatalf("keygen failed: %v\nOutput: %s", err, fp)
+	}
+	fp = strings.TrimSpace(fp)
+
+	prepPrefix := filepath.Join(tmpDir, "tx")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "delegation",
+		"--root", "--root-key", "@"+keyPrefix+".pub", "--out-prefix", prepPrefix); err != nil {
+		t.Fatalf("prepare failed: %v\nOutput: %s", err, out)
+	}
+
+	// the prepared hash is the topology transaction hash of the .prep file
+	if out, err := runCLI(configPath, binPath, repoRoot, "crypto", "hash", "@"+prepPrefix+".prep",
+		"--purpose", "topology-transaction", "--check", "@"+prepPrefix+".hash"); err != nil {
+		t.Errorf("hash check failed: %v\nOutput: %s", err, out)
+	}
+	if out, err := runCLI(configPath, binPath, repoRoot, "crypto", "hash", "@"+prepPrefix+".prep",
+		"--purpose", "12", "--check", "@"+prepPrefix+".hash"); err == nil || !strings.Contains(out, "hash mismatch") {
+		t.Errorf("expected a hash for another purpose to mismatch: %v\nOutput: %s", err, out)
+	}
+
+	// fingerprints are public key fingerprint hashes of the raw Ed25519 key
+	pub, _ := os.ReadFile(keyPrefix + ".pub")
+	rawKey := base64.StdEncoding.EncodeToString(pub[len(pub)-32:])
+	out, err := runCLI(configPath, binPath, repoRoot, "crypto", "hash", "base64:"+rawKey, "--purpose", "public-key-fingerprint")
+	if err != nil || strings.TrimSpace(out) != fp {
+		t.Errorf("expected the fingerprint %s, got %s (%v)", fp, out, err)
+	}
+}
+
+func TestCLI_Auth(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	tmpDir := t.TempDir()
+	keyPrefix := filepath.Join(tmpDir, "member")
+	fp, err := runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--spec", "ec-p384", "--out-prefix", keyPrefix)
+	if err != nil {
+		t.Fatalf("keygen failed: %v\nOutput: %s", err, fp)
+	}
+	member := "MED::mediator1::" + strings.TrimSpace(fp)
+
+	// A sequencer stand-in that knows the member key
+	schema, err := auth.LoadSchema(context.Background(), imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := auth.NewService("synchronizer::1220ef")
+	pub, _ := os.ReadFile(keyPrefix + ".pub")
+	if err := service.AddMember(member, pub); err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := auth.NewServer(service, schema)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	// 1. Online: fetch the challenge
+	challengePath := filepath.Join(tmpDir, "challenge.json")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "auth", "challenge",
+		"--member", member, "--sequencer", lis.Addr().String(), "--out-file", challengePath); err != nil {
+		t.Fatalf("challenge failed: %v\nOutput: %s", err, out)
+	}
+
+	// 2. Offline: sign it with the member key
+	requestPath := filepath.Join(tmpDir, "request.bin")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "auth", "respond", "@"+challengePath, "@"+keyPrefix+".priv",
+		"--member", member, "--synchronizer-id", "synchronizer::1220ef", "--algo", "ecdsa384", "--out-file", requestPath); err != nil {
+		t.Fatalf("respond failed: %v\nOutput: %s", err, out)
+	}
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "auth", "respond", "@"+challengePath, "@"+keyPrefix+".priv",
+		"--member", member, "--synchronizer-id", "synchronizer::1220ef", "--algo", "ecdsa256"); err == nil {
+		t.Errorf("expected a P-384 key to be rejected for ecdsa256\nOutput: %s", out)
+	}
+
+	// 3. Online: exchange the answer for a token, once
+	out, err := runCLI(configPath, binPath, repoRoot, "canton", "auth", "authenticate", "@"+requestPath,
+		"--sequencer", lis.Addr().String(), "-o", "json")
+	if err != nil {
+		t.Fatalf("authenticate failed: %v\nOutput: %s", err, out)
+	}
+	var token auth.AuthenticateResponse
+	if err := json.Unmarshal([]byte(out), &token); err != nil || len(token.Token) == 0 || token.ExpiresAt == nil {
+		t.Fatalf("unexpected authenticate output (%v): %s", err, out)
+	}
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "auth", "authenticate", "@"+requestPath,
+		"--sequencer", lis.Addr().String()); err == nil {
+		t.Errorf("expected a replayed request to be rejected\nOutput: %s", out)
+	}
+}
+
+func TestCLI_Party(t *testing.T) {
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	tmpDir := t.TempDir()
+	keyPrefix := filepath.Join(tmpDir, "alice")
+	fp, err := runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--out-prefix", keyPrefix)
+	if err != nil {
+		t.Fatalf("keygen failed: %v\nOutput: %s", err, fp)
+	}
+	fp = strings.TrimSpace(fp)
+
+	// 1. The party ID of an external party is rooted in its key
+	party, err := runCLI(configPath, binPath, repoRoot, "canton", "party", "id", "alice", "--key", "@"+keyPrefix+".pub")
+	if err != nil {
+		t.Fatalf("party id failed: %v\nOutput: %s", err, party)
+	}
+	party = strings.TrimSpace(party)
+	if party != "alice::"+fp {
+		t.Errorf("expected alice::%s, got %s", fp, party)
+	}
+
+	// 2. uid build and parse
+	out, err := runCLI(configPath, binPath, repoRoot, "canton", "uid", "build", "participant1", "--namespace", fp, "--member", "par")
+	if err != nil || strings.TrimSpace(out) != "PAR::participant1::"+fp {
+		t.Errorf("uid build --member failed: %v\nOutput: %s", err, out)
+	}
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "uid", "parse", party, "--key", "@"+keyPrefix+".pub"); err != nil {
+		t.Errorf("uid parse failed: %v\nOutput: %s", err, out)
+	}
+	otherPrefix := filepath.Join(tmpDir, "other")
+	runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--out-prefix", otherPrefix)
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "uid", "parse", party, "--key", "@"+otherPrefix+".pub"); err == nil || !strings.Contains(out, "namespace mismatch") {
+		t.Errorf("expected a namespace mismatch: %v\nOutput: %s", err, out)
+	}
+	for _, invalid := range []string{"al.ice::" + fp, "alice::1220ab", strings.Repeat("a", 186) + "::" + fp} {
+		if out, err := runCLI(configPath, binPath, repoRoot, "canton", "uid", "parse", invalid); err == nil {
+			t.Errorf("expected %s to be rejected\nOutput: %s", invalid, out)
+		}
+	}
+
+	// 3. Prepared transactions resolve the hint@<key> shorthand
+	if os.Getenv("PROTO_IMAGE") == "" {
+		return
+	}
+	yamlPath := filepath.Join(tmpDir, "tx.yaml")
+	os.WriteFile(yamlPath, []byte(`operation: TOPOLOGY_CHANGE_OP_ADD_REPLACE
+serial: 1
+mapping:
+  partyToKeyMapping:
+    threshold: 1
+`), 0644)
+	prepPrefix := filepath.Join(tmpDir, "tx")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "transaction", "@"+yamlPath,
+		"--party", "alice@@"+keyPrefix+".pub", "--out-prefix", prepPrefix); err != nil {
+		t.Fatalf("prepare transaction --party failed: %v\nOutput: %s", err, out)
+	}
+	out, err = runCLI(configPath, binPath, repoRoot, "proto", "decode", "TopologyTransaction", "@"+prepPrefix+".prep", "--versioned")
+	if err != nil || !strings.Contains(out, party) {
+		t.Errorf("expected the prepared transaction to name %s: %v\nOutput: %s", party, err, out)
+	}
+}
+
+func TestCLI_PartyOnboard(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	tmpDir := t.TempDir()
+	keyPrefix := filepath.Join(tmpDir, "alice")
+	fp, err := runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--out-prefix", keyPrefix)
+	if err != nil {
+		t.Fatalf("keygen failed: %v\nOutput: %s", err, fp)
+	}
+	fp = strings.TrimSpace(fp)
+	prefix := filepath.Join(tmpDir, "onboard")
+	onboard := []string{"canton", "party", "onboard", "alice", "--key", "@" + keyPrefix + ".pub",
+		"--participant", "participant1::" + fp + ":confirmation", "--participant", "participant2::" + fp + ":observation",
+		"--serial", "3", "--out-prefix", prefix}
+
+	// 1. Without a signature, the transactions and their multi-transaction hash are prepared
+	if out, err := runCLI(configPath, binPath, repoRoot, onboard...); err != nil {
+		t.Fatalf("party onboard failed: %v\nOutput: %s", err, out)
+	}
+	for _, suffix := range []string{"-namespace.prep", "-keys.prep", "-hosting.prep", ".hash"} {
+		if _, err := os.Stat(prefix + suffix); err != nil {
+			t.Errorf("expected %s to be written: %v", prefix+suffix, err)
+		}
+	}
+	out, err := runCLI(configPath, binPath, repoRoot, "proto", "decode", "TopologyTransaction", "@"+prefix+"-hosting.prep", "--versioned")
+	if err != nil || !strings.Contains(out, `"serial": 3`) || !strings.Contains(out, "alice::"+fp) || !strings.Contains(out, "PARTICIPANT_PERMISSION_OBSERVATION") {
+		t.Errorf("unexpected PartyToParticipant: %v\nOutput: %s", err, out)
+	}
+
+	// 2. A signature made elsewhere and one made with --signer give the same bundle
+	sigPath := filepath.Join(tmpDir, "onboard.sig")
+	if out, err := runCLI(configPath, binPath, repoRoot, "crypto", "sign", "@"+keyPrefix+".priv", "@"+prefix+".hash", "--out-file", sigPath, "-o", "binary"); err != nil {
+		t.Fatalf("sign failed: %v\nOutput: %s", err, out)
+	}
+	bundlePath := filepath.Join(tmpDir, "bundle.bin")
+	if out, err := runCLI(configPath, binPath, repoRoot, append(onboard, "--signature", "@"+sigPath,
+		"--signature-algorithm", "ed25519", "--out-file", bundlePath)...); err != nil {
+		t.Fatalf("party onboard --signature failed: %v\nOutput: %s", err, out)
+	}
+	signerBundlePath := filepath.Join(tmpDir, "bundle-signer.bin")
+	if out, err := runCLI(configPath, binPath, repoRoot, append(onboard, "--signer", "@"+keyPrefix+".priv",
+		"--signature-algorithm", "ed25519", "--out-file", signerBundlePath)...); err != nil {
+		t.Fatalf("party onboard --signer failed: %v\nOutput: %s", err, out)
+	}
+	bundle, _ := os.ReadFile(bundlePath)
+	signerBundle, _ := os.ReadFile(signerBundlePath)
+	if len(bundle) == 0 || !bytes.Equal(bundle, signerBundle) {
+		t.Errorf("expected identical bundles, got %x and %x", bundle, signerBundle)
+	}
+	out, err = runCLI(configPath, binPath, repoRoot, "proto", "decode", "com.digitalasset.canton.protocol.v30.SignedTopologyTransactions", "@"+bundlePath, "--versioned")
+	var decoded struct {
+		SignedTransaction []string `json:"signedTransaction"`
+	}
+	if err != nil || json.Unmarshal([]byte(out), &decoded) != nil || len(decoded.SignedTransaction) != 3 {
+		t.Errorf("expected a bundle of 3 transactions: %v\nOutput: %s", err, out)
+	}
+
+	// 2.5. Without --out-file the bundle alone is written to stdout
+	stdoutBundle, err := runCLI(configPath, binPath, repoRoot, append(onboard, "--signer", "@"+keyPrefix+".priv",
+		"--signature-algorithm", "ed25519")...)
+	if err != nil || !bytes.Equal([]byte(stdoutBundle), bundle) {
+		t.Fatalf("party onboard to stdout: %v\nOutput: %q", err, stdoutBundle)
+	}
+	stdoutBundlePath := filepath.Join(tmpDir, "bundle-stdout.bin")
+	os.WriteFile(stdoutBundlePath, []byte(stdoutBundle), 0644)
+	out, err = runCLI(configPath, binPath, repoRoot, "proto", "decode", "com.digitalasset.canton.protocol.v30.SignedTopologyTransactions", "@"+stdoutBundlePath, "--versioned")
+	if err != nil || json.Unmarshal([]byte(out), &decoded) != nil || len(decoded.SignedTransaction) != 3 {
+		t.Errorf("expected the bundle written to stdout to decode: %v\nOutput: %s", err, out)
+	}
+
+	// 3. Other keys and invalid hosting are refused
+	otherPrefix := filepath.Join(tmpDir, "other")
+	runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--out-prefix", otherPrefix)
+	if out, err := runCLI(configPath, binPath, repoRoot, append(onboard, "--signer", "@"+otherPrefix+".priv",
+		"--signature-algorithm", "ed25519", "--out-file", filepath.Join(tmpDir, "x.bin"))...); err == nil || !strings.Contains(out, "is not the party key") {
+		t.Errorf("expected another key to be refused: %v\nOutput: %s", err, out)
+	}
+	if out, err := runCLI(configPath, binPath, repoRoot, append(onboard, "--threshold", "2")...); err == nil || !strings.Contains(out, "exceeds") {
+		t.Errorf("expected a threshold above the confirming participants to be refused: %v\nOutput: %s", err, out)
+	}
+}
+
+func TestCLI_VettedPackages(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	tmpDir := t.TempDir()
+	keyPrefix := filepath.Join(tmpDir, "participant")
+	fp, err := runCLI(configPath, binPath, repoRoot, "crypto", "keygen", "--out-prefix", keyPrefix)
+	if err != nil {
+		t.Fatalf("keygen failed: %v\nOutput: %s", err, fp)
+	}
+	participant := "participant1::" + strings.TrimSpace(fp)
+
+	// a DAR with a main package and a dependency
+	var ids []string
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var dalfs []string
+	for _, payload := range []string{"main", "dependency"} {
+		sum := sha256.Sum256([]byte(payload))
+		id := hex.EncodeToString(sum[:])
+		dalf := protowire.AppendTag(nil, 3, protowire.BytesType)
+		dalf = protowire.AppendBytes(dalf, []byte(payload))
+		name := payload + "-" + id + ".dalf"
+		f, _ := zw.Create(name)
+		f.Write(dalf)
+		ids, dalfs = append(ids, id), append(dalfs, name)
+	}
+	f, _ := zw.Create("META-INF/MANIFEST.MF")
+	f.Write([]byte("Manifest-Version: 1.0\nMain-Dalf: " + dalfs[0] + "\nDalfs: " + strings.Join(dalfs, ", ") + "\n"))
+	zw.Close()
+	darPath := filepath.Join(tmpDir, "app.dar")
+	os.WriteFile(darPath, buf.Bytes(), 0644)
+	extra := strings.Repeat("ab", 32)
+
+	// 1. Packages from a DAR and by ID, with a validity window
+	prefix := filepath.Join(tmpDir, "vet1")
+	out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "vetted-packages", "--participant", participant,
+		"--dar", "@"+darPath, "--package", extra, "--valid-from", "2025-06-01T00:00:00Z", "--out-prefix", prefix)
+	if err != nil {
+		t.Fatalf("prepare vetted-packages failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "main package "+ids[0]) {
+		t.Errorf("expected the main package to be reported: %s", out)
+	}
+	out, err = runCLI(configPath, binPath, repoRoot, "proto", "decode", "TopologyTransaction", "@"+prefix+".prep", "--versioned")
+	if err != nil || strings.Count(out, `"validFromInclusive": "2025-06-01T00:00:00Z"`) != 3 || !strings.Contains(out, ids[1]) {
+		t.Errorf("unexpected VettedPackages: %v\nOutput: %s", err, out)
+	}
+
+	// 2. Removing a package from a signed certificate
+	certPath := filepath.Join(tmpDir, "vet1.cert")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "assemble", "--prepared-transaction", "@"+prefix+".prep",
+		"--signer", "@"+keyPrefix+".priv", "--signature-algorithm", "ed25519", "--out-file", certPath); err != nil {
+		t.Fatalf("assemble failed: %v\nOutput: %s", err, out)
+	}
+	prefix2 := filepath.Join(tmpDir, "vet2")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "vetted-packages", "--base", "@"+certPath,
+		"--remove", "--package", extra, "--out-prefix", prefix2); err != nil {
+		t.Fatalf("prepare vetted-packages --remove failed: %v\nOutput: %s", err, out)
+	}
+	out, err = runCLI(configPath, binPath, repoRoot, "proto", "decode", "TopologyTransaction", "@"+prefix2+".prep", "--versioned")
+	if err != nil || strings.Contains(out, extra) || !strings.Contains(out, ids[0]) || !strings.Contains(out, `"serial": 2`) || !strings.Contains(out, participant) {
+		t.Errorf("unexpected VettedPackages after removal: %v\nOutput: %s", err, out)
+	}
+
+	// 2.5. Removing a DAR keeps its dependencies unless asked to remove them
+	for _, tc := range []struct {
+		extra   []string
+		removed []string
+		kept    []string
+	}{
+		{nil, ids[:1], ids[1:]},
+		{[]string{"--with-dependencies"}, ids, nil},
+	} {
+		prefix3 := filepath.Join(tmpDir, "vet3")
+		args := append([]string{"canton", "topology", "prepare", "vetted-packages", "--base", "@" + certPath,
+			"--remove", "--dar", "@" + darPath, "--out-prefix", prefix3}, tc.extra...)
+		out, err := runCLI(configPath, binPath, repoRoot, args...)
+		if err != nil {
+			t.Fatalf("prepare vetted-packages --remove --dar %v failed: %v\nOutput: %s", tc.extra, err, out)
+		}
+		for _, id := range tc.removed {
+			if !strings.Contains(out, "Removing package "+id) {
+				t.Errorf("%v: expected %s to be listed for removal: %s", tc.extra, id, out)
+			}
+		}
+		decoded, _ := runCLI(configPath, binPath, repoRoot, "proto", "decode", "TopologyTransaction", "@"+prefix3+".prep", "--versioned")
+		for _, id := range tc.removed {
+			if strings.Contains(decoded, id) {
+				t.Errorf("%v: %s should be removed: %s", tc.extra, id, decoded)
+			}
+		}
+		for _, id := range tc.kept {
+			if strings.Contains(out, "Removing package "+id) || !strings.Contains(decoded, id) {
+				t.Errorf("%v: %s should be kept: %s\n%s", tc.extra, id, out, decoded)
+			}
+		}
+	}
+
+	// 3. Invalid input, including a base entry without a packageId
+	blankPath := filepath.Join(tmpDir, "blank.prep")
+	if out, err := runCLI(configPath, binPath, repoRoot, "proto", "edit", "TopologyTransaction", "@"+prefix+".prep", "--versioned",
+		"--unset", "mapping.vettedPackages.packages[0].packageId", "--out-file", blankPath); err != nil {
+		t.Fatalf("proto edit failed: %v\nOutput: %s", err, out)
+	}
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "vetted-packages", "--base", "@"+blankPath,
+		"--package", extra, "--out-prefix", filepath.Join(tmpDir, "x")); err == nil || !strings.Contains(out, "has no packageId") {
+		t.Errorf("expected a base entry without packageId to be reported: %v\nOutput: %s", err, out)
+	}
+	for _, args := range [][]string{
+		{"--participant", participant, "--package", "1234"},
+		{"--participant", participant, "--package", extra, "--valid-from", "2026-01-01T00:00:00Z", "--valid-until", "2025-01-01T00:00:00Z"},
+		{"--base", "@" + certPath, "--participant", "participant2::" + strings.TrimSpace(fp), "--package", extra},
+		{"--participant", participant, "--package", extra, "--remove"},
+		{"--base", "@" + certPath, "--dar", "@" + darPath, "--with-dependencies"},
+	} {
+		args = append([]string{"canton", "topology", "prepare", "vetted-packages", "--out-prefix", filepath.Join(tmpDir, "x")}, args...)
+		if out, err := runCLI(configPath, binPath, repoRoot, args...); err == nil {
+			t.Errorf("expected %v to fail\nOutput: %s", args, out)
+		}
+	}
+}
+
+func TestCLI_SynchronizerParams(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	tmpDir := t.TempDir()
+	synchronizer := "synchronizer::1220" + strings.Repeat("ab", 32)
+
+	// 1. A new synchronizer starts from the defaults
+	prefix := filepath.Join(tmpDir, "params1")
+	out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "synchronizer-params",
+		"--synchronizer-id", synchronizer, "--out-prefix", prefix)
+	if err != nil || !strings.Contains(out, "No parameter changes") {
+		t.Fatalf("prepare synchronizer-params failed: %v\nOutput: %s", err, out)
+	}
+
+	// 2. Changes to a base are shown and get the next serial
+	prefix2 := filepath.Join(tmpDir, "params2")
+	out, err = runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "synchronizer-params", "--base", "@"+prefix+".prep",
+		"--set", "confirmationResponseTimeout=1m", "-s", "trafficControl.maxBaseTrafficAmount=20000",
+		"-s", "trafficControl.maxBaseTrafficAccumulationDuration=10m", "-s", "trafficControl.setBalanceRequestSubmissionWindowSize=5m",
+		"--out-prefix", prefix2)
+	if err != nil {
+		t.Fatalf("prepare synchronizer-params --base failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, `~ confirmationResponseTimeout: "30s" -> "60s"`) || !strings.Contains(out, "+ trafficControl:") {
+		t.Errorf("expected the changes to be shown: %s", out)
+	}
+	out, err = runCLI(configPath, binPath, repoRoot, "proto", "decode", "TopologyTransaction", "@"+prefix2+".prep", "--versioned")
+	if err != nil || !strings.Contains(out, `"serial": 2`) || !strings.Contains(out, `"maxBaseTrafficAmount": "20000"`) || !strings.Contains(out, synchronizer) {
+		t.Errorf("unexpected SynchronizerParametersState: %v\nOutput: %s", err, out)
+	}
+
+	// 3. Invalid parameters are refused and nothing is written
+	prefix3 := filepath.Join(tmpDir, "params3")
+	for _, set := range []string{"mediatorDeduplicationTimeout=1h", "confirmationResponseTimeout=0s", "trafficControl.maxBaseTrafficAmount=1000", "confirmatonResponseTimeout=1s"} {
+		if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "synchronizer-params", "--base", "@"+prefix+".prep",
+			"--set", set, "--out-prefix", prefix3); err == nil {
+			t.Errorf("expected --set %s to be refused\nOutput: %s", set, out)
+		}
+	}
+	if _, err := os.Stat(prefix3 + ".prep"); err == nil {
+		t.Error("expected no transaction to be written for invalid parameters")
+	}
+
+	// 4. Sequencing parameters
+	prefix4 := filepath.Join(tmpDir, "sequencing")
+	if out, err := runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "synchronizer-params", "--sequencing",
+		"--synchronizer-id", synchronizer, "--set", "payload=hex:cafe", "--out-prefix", prefix4); err != nil {
+		t.Fatalf("prepare synchronizer-params --sequencing failed: %v\nOutput: %s", err, out)
+	}
+	out, err = runCLI(configPath, binPath, repoRoot, "proto", "decode", "TopologyTransaction", "@"+prefix4+".prep", "--versioned")
+	if err != nil || !strings.Contains(out, "sequencingDynamicParametersState") || !strings.Contains(out, `"payload": "yv4="`) {
+		t.Errorf("unexpected DynamicSequencingParametersState: %v\nOutput: %s", err, out)
+	}
+
+	// 5. --sequencing must match the kind of the base
+	out, err = runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "synchronizer-params", "--base", "@"+prefix+".prep",
+		"--sequencing", "--out-prefix", filepath.Join(tmpDir, "params5"))
+	if err == nil || !strings.Contains(out, "--sequencing does not apply") {
+		t.Errorf("expected --sequencing with a SynchronizerParametersState base to be refused: %v\nOutput: %s", err, out)
+	}
+}
+
+func TestCLI_YAMLInput(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+	tmpDir := t.TempDir()
+
+	// 1. YAML and JSON input generate the same bytes
+	yamlPath := filepath.Join(tmpDir, "tx.yaml")
+	os.WriteFile(yamlPath, []byte(`# reviewed in git
+operation: TOPOLOGY_CHANGE_OP_REMOVE # revoke
+serial: 7
+mapping:
+  namespaceDelegation:
+    namespace: "1220abcd"
+    canSignAllMappings: {}
+`), 0644)
+	jsonPath := filepath.Join(tmpDir, "tx.json")
+	os.WriteFile(jsonPath, []byte(`{"operation": "TOPOLOGY_CHANGE_OP_REMOVE", "serial": 7,
+		"mapping": {"namespaceDelegation": {"namespace": "1220abcd", "canSignAllMappings": {}}}}`), 0644)
+
+	fromYAML, err := runCLI(configPath, binPath, repoRoot, "proto", "generate", "TopologyTransaction", "@"+yamlPath, "--base64")
+	if err != nil {
+		t.Fatalf("proto generate from YAML failed: %v\nOutput: %s", err, fromYAML)
+	}
+	fromJSON, err := runCLI(configPath, binPath, repoRoot, "proto", "generate", "TopologyTransaction", "@"+jsonPath, "--base64")
+	if err != nil {
+		t.Fatalf("proto generate from JSON failed: %v\nOutput: %s", err, fromJSON)
+	}
+	if fromYAML != fromJSON {
+		t.Errorf("YAML and JSON input differ: %s vs %s", fromYAML, fromJSON)
+	}
+
+	// 2. The YAML template generates as is
+	tmpl, err := runCLI(configPath, binPath, repoRoot, "proto", "template", "TopologyTransaction", "--format", "yaml", "--comments")
+	if err != nil {
+		t.Fatalf("proto template --format yaml failed: %v\nOutput: %s", err, tmpl)
+	}
+	if !strings.Contains(tmpl, "# oneof mapping:") {
+		t.Errorf("YAML template missing oneof comment: %s", tmpl)
+	}
+	tmplPath := filepath.Join(tmpDir, "template.yaml")
+	os.WriteFile(tmplPath, []byte(tmpl), 0644)
+	if out, err := runCLI(configPath, binPath, repoRoot, "proto", "generate", "TopologyTransaction", "@"+tmplPath); err != nil {
+		t.Fatalf("proto generate from YAML template failed: %v\nOutput: %s", err, out)
+	}
+
+	// 3. JSON Schema
+	out, err := runCLI(configPath, binPath, repoRoot, "proto", "template", "TopologyTransaction", "--format", "json-schema")
+	if err != nil {
+		t.Fatalf("proto template --format json-schema failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "https://json-schema.org/draft/2020-12/schema") {
+		t.Errorf("JSON Schema missing dialect: %s", out)
+	}
+
+	// 4. Topology transaction prepared from YAML
+	prepPrefix := filepath.Join(tmpDir, "tx")
+	out, err = runCLI(configPath, binPath, repoRoot, "canton", "topology", "prepare", "transaction", "@"+yamlPath, "--output", prepPrefix)
+	if err != nil {
+		t.Fatalf("canton topology prepare transaction failed: %v\nOutput: %s", err, out)
+	}
+	hash, err := os.ReadFile(prepPrefix + ".hash")
+	if err != nil || len(hash) != 34 {
+		t.Fatalf("expected a 34-byte multihash, got %x (%v)", hash, err)
+	}
+	out, err = runCLI(configPath, binPath, repoRoot, "proto", "decode", "TopologyTransaction", "@"+prepPrefix+".prep", "--versioned")
+	if err != nil {
+		t.Fatalf("proto decode failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, `"serial": 7`) || !strings.Contains(out, "1220abcd") {
+		t.Errorf("prepared transaction incorrect: %s", out)
+	}
+}
+
+func TestCLI_Streams(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	configPath := setupTestConfig(t)
+
+	// 1. Blank lines are skipped, not read as empty records
+	lines, err := runCLIWithStdin(configPath, binPath, repoRoot, "{\"serial\": 1}\n\n{\"serial\": 2}\n  \n",
+		"proto", "generate", "TopologyTransaction", "--lines")
+	if err != nil || strings.Count(lines, "\n") != 2 {
+		t.Fatalf("generate --lines failed: %v\nOutput: %q", err, lines)
+	}
+	out, err := runCLIWithStdin(configPath, binPath, repoRoot, lines+"\n", "proto", "decode", "TopologyTransaction", "--lines")
+	if err != nil || out != "{\"serial\":1}\n{\"serial\":2}\n" {
+		t.Errorf("decode --lines failed: %v\nOutput: %q", err, out)
+	}
+
+	// 2. Failed records are numbered from 1 and decode reports them in place
+	out, err = runCLIWithStdin(configPath, binPath, repoRoot, strings.SplitN(lines, "\n", 2)[0]+"\n!!\n", "proto", "decode", "TopologyTransaction", "--lines")
+	if err == nil || !strings.Contains(out, "record 2:") {
+		t.Errorf("decode --lines should fail on record 2: %v\nOutput: %s", err, out)
+	}
+
+	// 3. Generate keeps the records after a failure: --lines writes an empty line in place of a failed
+	// record, --delimited leaves it out, and every failure is reported
+	failing := "{\"serial\": 1}\n{\"serial\": \"x\"}\n{\"serial\": 3}\n{\"nope\": 4}\n"
+	out, stderr, err := runCLIStderr(configPath, binPath, repoRoot, failing, "proto", "generate", "TopologyTransaction", "--lines")
+	if err == nil || !strings.Contains(stderr, "record 2:") || !strings.Contains(stderr, "record 4:") {
+		t.Errorf("generate --lines should report records 2 and 4: %v\nStderr: %s", err, stderr)
+	}
+	generated := strings.Split(out, "\n")
+	if len(generated) != 5 || generated[1] != "" || generated[3] != "" || generated[0] == "" || generated[2] == "" {
+		t.Errorf("generate --lines should write empty lines for records 2 and 4, got %q", out)
+	}
+	out, stderr, err = runCLIStderr(configPath, binPath, repoRoot, failing, "proto", "generate", "TopologyTransaction", "--delimited")
+	if err == nil || !strings.Contains(stderr, "record 2:") || !strings.Contains(stderr, "record 4:") {
+		t.Errorf("generate --delimited should report records 2 and 4: %v\nStderr: %s", err, stderr)
+	}
+	decoded, err := runCLIWithStdin(configPath, binPath, repoRoot, out, "proto", "decode", "TopologyTransaction", "--delimited")
+	if err != nil || decoded != "{\"serial\":1}\n{\"serial\":3}\n" {
+		t.Errorf("generate --delimited should keep records 1 and 3: %v\nOutput: %q", err, decoded)
+	}
+}
+
+func TestCLI_SignedRoundTrip(t *testing.T) {
+	imagePath := os.Getenv("PROTO_IMAGE")
+	if imagePath == "" {
+		t.Skip("PROTO_IMAGE not set")
+	}
+
+	repoRoot, _ := filepath.Abs("../")
+	binPath := filepath.Join(repoRoot, "bin", "proton")
+
+	buildCmd := exec.Command("go", "build", "-o", binPath, "./cmd/proton")
+	buildCmd.Dir = repoRoot
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("failed to build binary: %v", err)
+	}
+
+	// The shipped config, unedited
+	configPath := filepath.Join(repoRoot, ".default.proto.config.json")
+
+	// Payloads whose bytes change when re-encoded from their decoded content
+	wrap := func(payload []byte) []byte {
+		var b []byte
+		b = protowire.AppendTag(b, 1, protowire.BytesType) // data
+		b = protowire.AppendBytes(b, payload)
+		b = protowire.AppendTag(b, 2, protowire.VarintType) // version
+		return protowire.AppendVarint(b, 30)
+	}
+	var outOfOrder, unknownField []byte
+	outOfOrder = protowire.AppendTag(outOfOrder, 3, protowire.BytesType) // mapping before serial
+	outOfOrder = protowire.AppendBytes(outOfOrder, nil)
+	outOfOrder = protowire.AppendTag(outOfOrder, 2, protowire.VarintType)
+	outOfOrder = protowire.AppendVarint(outOfOrder, 1)
+	unknownField = protowire.AppendTag(unknownField, 2, protowire.VarintType)
+	unknownField = protowire.AppendVarint(unknownField, 1)
+	unknownField = protowire.AppendTag(unknownField, 99, protowire.VarintType)
+	unknownField = protowire.AppendVarint(unknownField, 7)
+
+	cases := map[string][]byte{"field order": outOfOrder, "unknown field": unknownField}
+	for name, payload := range cases {
+		signedJSON := fmt.Sprintf(`{"transaction": %q, "signatures": [{"signedBy": "1220ab"}]}`,
+			base64.StdEncoding.EncodeToString(wrap(payload)))
+		signedB64, err := runCLI(configPath, binPath, repoRoot, "proto", "generate", "SignedTopologyTransaction", signedJSON, "--base64")
+		if err != nil {
+			t.Fatalf("%s: proto generate failed: %v\nOutput: %s", name, err, signedB64)
+		}
+		signedB64 = strings.TrimSpace(signedB64)
+
+		// 1. With --keep-raw decode keeps the original bytes and generate reproduces them exactly
+		decoded, err := runCLIWithStdin(configPath, binPath, repoRoot, signedB64, "proto", "decode", "SignedTopologyTransaction", "-", "--base64", "--keep-raw")
+		if err != nil {
+			t.Fatalf("%s: proto decode failed: %v\nOutput: %s", name, err, decoded)
+		}
+		out, err := runCLIWithStdin(configPath, binPath, repoRoot, decoded, "proto", "generate", "SignedTopologyTransaction", "-", "--base64")
+		if err != nil || strings.TrimSpace(out) != signedB64 {
+			t.Errorf("%s: round trip changed the signed bytes: %v\nOutput: %s", name, err, out)
+		}
+
+		// 2. By default there is no @raw: the bytes change, and generate says so
+		decoded, err = runCLIWithStdin(configPath, binPath, repoRoot, signedB64, "proto", "decode", "SignedTopologyTransaction", "-", "--base64")
+		if err != nil {
+			t.Fatalf("%s: proto decode failed: %v\nOutput: %s", name, err, decoded)
+		}
+		out, stderr, err := runCLIStderr(configPath, binPath, repoRoot, decoded, "proto", "generate", "SignedTopologyTransaction", "-", "--base64")
+		if err != nil || strings.TrimSpace(out) == signedB64 || !strings.Contains(stderr, "covered by signatures") {
+			t.Errorf("%s: re-encoding a signed payload without @raw should warn: %v\nOutput: %s\nStderr: %s", name, err, out, stderr)
+		}
+	}
 }
 
 func runCLI(configPath, bin, dir string, args ...string) (string, error) {
@@ -311,3 +1430,17 @@ func runCLIWithStdin(configPath, bin, dir, stdin string, args ...string) (string
 	}
 	return stdout.String(), nil
 }
+
+// runCLIStderr runs the CLI with stdin and returns stdout and stderr separately.
+func runCLIStderr(configPath, bin, dir, stdin string, args ...string) (string, string, error) {
+	fullArgs := append([]string{"--config", configPath}, args...)
+	cmd := exec.Command(bin, fullArgs...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PROTO_IMAGE="+os.Getenv("PROTO_IMAGE"))
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}